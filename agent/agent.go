@@ -5,13 +5,15 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/lowkaihon/cli-coding-agent/debuglog"
 	"github.com/lowkaihon/cli-coding-agent/llm"
 	"github.com/lowkaihon/cli-coding-agent/tools"
 	"github.com/lowkaihon/cli-coding-agent/ui"
@@ -21,9 +23,16 @@ import (
 // to prevent runaway tool-use loops.
 const MaxIterationsPerTurn = 50
 
+// defaultMaxToolCalls is how many tool calls from one response run unless
+// SetMaxToolCalls changes it.
+const defaultMaxToolCalls = 20
+
 // Agent orchestrates the LLM conversation and tool execution loop.
 type Agent struct {
 	client         llm.LLMClient
+	newClient      ClientFactory // builds clients for SwitchModel; nil disables switching
+	provider       string        // provider of client, saved with the session
+	model          string        // model of client, saved with the session
 	tools          *tools.Registry
 	messages       []llm.Message
 	workDir        string
@@ -31,9 +40,52 @@ type Agent struct {
 	lastTokensUsed int // TotalTokens from most recent API response
 	sessionID      string
 	sessionCreated time.Time
+	forkOnResume   bool                      // resumed sessions continue under a new ID; see SetForkOnResume
+	forkPending    bool                      // resumed with forkOnResume and not yet continued
+	forkedFrom     string                    // session this one was forked from, saved in SessionMeta
 	checkpoints    []Checkpoint              // ordered by turn
 	fileOriginals  map[string]*FileSnapshot  // pre-session state of each modified file
 	term           UI                        // stored for sub-agent visibility
+	name           string                    // assistant name used in the system prompt
+	listener       ui.Interrupter            // active escape listener during Run; paused for sub-agent prompts
+	exploreBudget  int                       // explore sub-agent token soft cap; 0 disables
+	exploreLimits  tools.ExploreLimits       // default depth and tool-call budget of an exploration; see SetExploreLimits
+	promptMu       sync.Mutex                // serializes prompts from parallel explore sub-agents
+	tokenCache     []tokenEstimate           // per-message token estimates, parallel to messages
+	autoEdit       bool                      // apply write/edit without confirmation
+	debug          *debuglog.Logger          // optional troubleshooting log; nil disables
+
+	toolResultCompaction bool // auto-compaction elides old tool results before summarizing
+	autoCompactOff       bool // never compact on its own; warn over the threshold instead
+	compactWarned        bool // the over-threshold warning was shown; reset once back under it
+	memoryTokens         int  // cap on MEMORY.md injected into the system prompt (0 = no cap)
+	wrapUpIterations     int  // iterations allowed past MaxIterationsPerTurn after a wrap-up nudge (0 = hard stop)
+	maxToolCalls         int  // tool calls run from one response; the rest are answered with a note (0 = no cap)
+	trustFormatters      bool // run the configured formatter after write/edit without confirmation
+	compactConfirm       bool // confirm file changes from a size summary; the diff is shown on request
+
+	auditMu     sync.Mutex
+	audit       *os.File            // log of reproducible commands for the actions run; nil disables
+	auditRedact func(string) string // applied to each audit log entry; nil leaves entries as is
+
+	reviewChanges bool          // stage changes for an end-of-turn review instead of confirming each
+	staged        []*reviewItem // changes awaiting this turn's review
+	reviewNote    string        // outcome of the last review, sent with the next user message
+
+	projectTree  bool      // append the project layout to the first message of a fresh conversation
+	narration    Narration // how much the model explains its actions; see SetNarration
+	stoppedEarly bool      // the last turn was cut off by the output token or iteration limit
+
+	memorySnapshot MemorySnapshot // MEMORY.md when the session started, for /memory diff
+	git            tools.GitInfo  // repository of workDir at the start of the last turn; zero outside git
+
+	exploreCacheMu sync.Mutex
+	exploreCache   map[string]exploreCacheEntry // explore results by exploreCacheKey; nil disables the cache
+
+	resultSummaryChars int           // tool results longer than this are summarized; 0 disables. See SetResultSummaries
+	summaryModel       string        // model writing the summaries; "" uses the current one
+	summaryClient      llm.LLMClient // client for summaryModel, built on first use
+	summaryProvider    string        // provider summaryClient was built for
 }
 
 // New creates a new Agent with the system prompt initialized.
@@ -46,7 +98,14 @@ func New(client llm.LLMClient, registry *tools.Registry, workDir string, context
 		sessionID:      generateSessionID(),
 		sessionCreated: time.Now(),
 		fileOriginals:  make(map[string]*FileSnapshot),
+		name:           DefaultName,
+		exploreBudget:  defaultExploreTokenBudget,
+		exploreLimits:  tools.ExploreLimits{MaxIterations: defaultExploreIterations},
+		memoryTokens:   defaultMemoryTokens,
+		maxToolCalls:   defaultMaxToolCalls,
 	}
+	a.memorySnapshot = a.snapshotMemory()
+	a.git = registry.GitInfo()
 	a.messages = []llm.Message{
 		llm.TextMessage("system", a.systemPrompt()),
 	}
@@ -57,16 +116,227 @@ func New(client llm.LLMClient, registry *tools.Registry, workDir string, context
 	return a
 }
 
+// DefaultName is the assistant name used when none is configured.
+const DefaultName = "Pilot"
+
+// Narration is how much the model is asked to explain its actions.
+type Narration int
+
+const (
+	// NarrationDefault adds no guidance beyond the base system prompt.
+	NarrationDefault Narration = iota
+	// NarrationExplain asks for a short explanation before each batch of tool calls.
+	NarrationExplain
+	// NarrationTerse asks the model to act with minimal narration.
+	NarrationTerse
+)
+
+// narrationGuidance is the "Tone and style" line added for each Narration.
+var narrationGuidance = map[Narration]string{
+	NarrationExplain: "- Before each batch of tool calls, briefly explain what you are about to do and why, in a sentence or two. When the work is done, summarize what changed.\n",
+	NarrationTerse:   "- Act with minimal narration. Don't announce tool calls or restate your plan; write text only for results, decisions the user needs to know about, and questions.\n",
+}
+
+// SetNarration sets how much the model explains its actions. The current
+// system prompt is rebuilt.
+func (a *Agent) SetNarration(n Narration) {
+	a.narration = n
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		a.messages[0] = llm.TextMessage("system", a.systemPrompt())
+		a.invalidateTokenCache()
+	}
+}
+
+// SetName sets the assistant name used in the system prompt identity line.
+// An empty name restores DefaultName. The current system prompt is rebuilt.
+func (a *Agent) SetName(name string) {
+	if name == "" {
+		name = DefaultName
+	}
+	a.name = name
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		a.messages[0] = llm.TextMessage("system", a.systemPrompt())
+		a.invalidateTokenCache()
+	}
+}
+
+// SetExploreTokenBudget sets the explore sub-agent's token soft cap. When a
+// single exploration's token usage crosses a multiple of the budget, the user
+// is asked whether to continue. Zero or a negative value disables the check.
+func (a *Agent) SetExploreTokenBudget(n int) {
+	if n < 0 {
+		n = 0
+	}
+	a.exploreBudget = n
+}
+
+// SetExploreLimits sets how many model requests an exploration may make
+// and how many tool calls it may run in total, unless the explore call asks
+// for other limits. When either runs out, the sub-agent is asked to
+// summarize its findings so far. Zero or a negative iterations value keeps
+// the default; zero or a negative tool-call value removes the budget.
+func (a *Agent) SetExploreLimits(iterations, toolCalls int) {
+	if iterations <= 0 {
+		iterations = defaultExploreIterations
+	}
+	a.exploreLimits = tools.ExploreLimits{MaxIterations: iterations, MaxToolCalls: max(toolCalls, 0)}
+}
+
+// SetAutoApproveEdits controls whether write and edit calls are applied
+// without asking. The diff is still shown. Bash commands always confirm.
+func (a *Agent) SetAutoApproveEdits(auto bool) {
+	a.autoEdit = auto
+}
+
+// SetProjectTree controls whether the first message of a fresh conversation
+// carries a compact listing of the project, so the model starts oriented
+// without a tool call. Resumed sessions already have history and never get it.
+func (a *Agent) SetProjectTree(enabled bool) {
+	a.projectTree = enabled
+}
+
+// projectTreeHeader introduces the listing SetProjectTree adds.
+const projectTreeHeader = "(Project layout at the start of the session, for orientation; directories skipped by glob and grep are left out.)"
+
+// SetDebugLog sets the logger that records requests, responses, tool calls,
+// and errors. A nil logger disables debug logging.
+func (a *Agent) SetDebugLog(l *debuglog.Logger) {
+	a.debug = l
+}
+
+// Shutdown stops in-flight work before the program exits: it restores the
+// terminal if a turn is still running, kills running commands, and removes
+// temp files left by interrupted writes and session saves.
+func (a *Agent) Shutdown() {
+	if a.listener != nil {
+		a.listener.Stop()
+	}
+	a.tools.Shutdown()
+	a.closeAuditLog()
+	removeStaleSessionTemps(a.workDir)
+}
+
+// SetWrapUpIterations sets how many iterations a turn may run past
+// MaxIterationsPerTurn. At the limit the model is told to wrap up and
+// summarize the remaining work; the turn stops with an error only after the
+// extra iterations. Zero or a negative value stops at the limit.
+func (a *Agent) SetWrapUpIterations(n int) {
+	a.wrapUpIterations = max(n, 0)
+}
+
+// SetMaxToolCalls sets how many tool calls from one response are run, in
+// the main loop and in explore. Calls past it are not run; the model is told
+// to request them again in a later response. Zero or a negative value
+// removes the cap.
+func (a *Agent) SetMaxToolCalls(n int) {
+	a.maxToolCalls = max(n, 0)
+}
+
+// SetToolResultCompaction selects the auto-compaction strategy. When enabled,
+// auto-compaction first elides old tool results, keeping user and assistant
+// messages verbatim, and only summarizes the conversation if that is not
+// enough. /compact always summarizes.
+func (a *Agent) SetToolResultCompaction(enabled bool) {
+	a.toolResultCompaction = enabled
+}
+
+// SetAutoCompact enables or disables automatic compaction (enabled by
+// default). When disabled, a conversation over the threshold is left as it
+// is and the user is warned once to /compact or /clear; idle compaction is
+// off too. /compact still works.
+func (a *Agent) SetAutoCompact(enabled bool) {
+	a.autoCompactOff = !enabled
+	a.compactWarned = false
+}
+
+// AutoCompact reports whether automatic compaction is enabled.
+func (a *Agent) AutoCompact() bool {
+	return !a.autoCompactOff
+}
+
+// SetFocus narrows the default scope of glob, grep, and ls to spec, a
+// directory or glob under the working directory; an empty spec clears it.
+// The system prompt is rebuilt so the model knows its searches are scoped.
+func (a *Agent) SetFocus(spec string) error {
+	if err := a.tools.SetFocus(spec); err != nil {
+		return err
+	}
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		a.messages[0] = llm.TextMessage("system", a.systemPrompt())
+		a.invalidateTokenCache()
+	}
+	return nil
+}
+
+// Focus returns the current tool focus, or "" if there is none.
+func (a *Agent) Focus() string {
+	return a.tools.Focus()
+}
+
+// Client returns the current LLM client.
+func (a *Agent) Client() llm.LLMClient {
+	return a.client
+}
+
 // SetClient swaps the LLM client and context window (e.g., after /model).
 func (a *Agent) SetClient(client llm.LLMClient, contextWindow int) {
 	a.client = client
 	a.contextWindow = contextWindow
 }
 
+// ClientFactory builds the client for a provider and model and returns it
+// with the model's context window. It fails if the provider cannot be used,
+// e.g. because it has no API key.
+type ClientFactory func(provider, model string) (llm.LLMClient, int, error)
+
+// SetClientFactory sets how SwitchModel and ResumeSession build clients.
+func (a *Agent) SetClientFactory(f ClientFactory) {
+	a.newClient = f
+}
+
+// SetModel records the provider and model of the current client. They are
+// saved with the session so ResumeSession can restore them.
+func (a *Agent) SetModel(provider, model string) {
+	a.provider = provider
+	a.model = model
+}
+
+// Model returns the provider and model of the current client.
+func (a *Agent) Model() (provider, model string) {
+	return a.provider, a.model
+}
+
+// SwitchModel builds a client for provider and model with the client
+// factory and switches to it. The current client is kept on error.
+func (a *Agent) SwitchModel(provider, model string) error {
+	if a.newClient == nil {
+		return fmt.Errorf("switch model: no client factory set")
+	}
+	client, contextWindow, err := a.newClient(provider, model)
+	if err != nil {
+		return fmt.Errorf("switch to %s (%s): %w", model, provider, err)
+	}
+	a.SetClient(client, contextWindow)
+	a.SetModel(provider, model)
+	return nil
+}
+
 // Run processes a user message through the agent loop.
 func (a *Agent) Run(ctx context.Context, userMessage string, term UI) error {
 	a.term = term
+	a.refreshGit()
+	if a.projectTree && len(a.messages) == 1 {
+		if tree := a.tools.ProjectTree(); tree != "" {
+			userMessage += "\n\n" + projectTreeHeader + "\n```\n" + tree + "```"
+		}
+	}
+	if a.reviewNote != "" {
+		userMessage = a.reviewNote + "\n" + userMessage
+		a.reviewNote = ""
+	}
+	a.forkIfResumed()
 	a.messages = append(a.messages, llm.TextMessage("user", userMessage))
+	a.stoppedEarly = false
 
 	// Start escape listener for Esc key cancellation
 	opCtx, listener, escErr := term.StartEscapeListener(ctx)
@@ -76,13 +346,34 @@ func (a *Agent) Run(ctx context.Context, userMessage string, term UI) error {
 		listener = noopInterrupter{}
 	}
 	defer listener.Stop()
-
-	for iteration := 0; iteration < MaxIterationsPerTurn; iteration++ {
+	a.listener = listener
+	defer func() { a.listener = nil }()
+	opCtx = llm.WithRetryNotifier(opCtx, term.PrintRetry)
+	defer func() { a.reviewStaged(opCtx.Err() != nil, term, listener) }()
+
+	compactedForSize := false // compacted once this turn because a request was too large
+	truncations := 0          // responses cut off mid tool call this turn
+	limit := MaxIterationsPerTurn + a.wrapUpIterations
+	for iteration := 0; iteration < limit; iteration++ {
+		if iteration == MaxIterationsPerTurn {
+			term.PrintWarning(fmt.Sprintf("Reached %d iterations; asking the model to wrap up.", MaxIterationsPerTurn))
+			a.messages = append(a.messages, llm.TextMessage("user", wrapUpMessage(a.wrapUpIterations)))
+		}
 		a.compactIfNeeded(opCtx, term)
 		term.PrintSpinner()
 
+		a.debug.Log("request", "iteration", iteration, "messages", len(a.messages))
 		events, err := a.client.StreamMessage(opCtx, a.messages, a.tools.Definitions())
+		if errors.Is(err, llm.ErrRequestTooLarge) && !compactedForSize && len(a.messages) > 2 {
+			a.debug.Log("error", "stage", "request", "err", err)
+			term.ClearSpinner()
+			term.PrintWarning("Request too large, compacting conversation...")
+			a.doCompact(opCtx, term)
+			compactedForSize = true
+			continue
+		}
 		if err != nil {
+			a.debug.Log("error", "stage", "request", "err", err)
 			term.ClearSpinner()
 			if opCtx.Err() != nil {
 				fmt.Println()
@@ -105,6 +396,7 @@ func (a *Agent) Run(ctx context.Context, userMessage string, term UI) error {
 		})
 		clearSpinner() // ensure cleared after stream ends (e.g. tool-only responses)
 		if err != nil {
+			a.debug.Log("error", "stage", "stream", "err", err)
 			if opCtx.Err() != nil {
 				fmt.Println()
 				return context.Canceled
@@ -115,13 +407,47 @@ func (a *Agent) Run(ctx context.Context, userMessage string, term UI) error {
 		if resp.Usage.TotalTokens > 0 {
 			a.lastTokensUsed = resp.Usage.TotalTokens
 		}
+		a.debug.Log("response", "finish_reason", resp.FinishReason,
+			"tool_calls", len(resp.Message.ToolCalls), "tokens", resp.Usage.TotalTokens)
+
+		// A paused server-side turn resumes by sending the conversation back
+		if resp.FinishReason == "pause_turn" {
+			if !isEmptyResponse(resp) {
+				a.messages = append(a.messages, resp.Message)
+			}
+			continue
+		}
+
+		// An empty response would otherwise end the turn silently. It is not
+		// recorded, since providers reject empty assistant messages.
+		if isEmptyResponse(resp) {
+			term.PrintWarning(emptyResponseMessage(resp.FinishReason))
+			return nil
+		}
+
+		// Tool calls cut off by the output token limit are not run. The model
+		// is asked to retry them in smaller pieces, a few times per turn.
+		var cut []llm.ToolCall
+		if resp.FinishReason == "length" {
+			cut = cutToolCalls(&resp.Message)
+			if len(cut) > 0 && truncations < MaxToolCallTruncations {
+				truncations++
+				term.PrintWarning("Response hit the token limit mid tool call; asking the model to retry it in smaller pieces.")
+				resp.FinishReason = "tool_calls"
+			}
+		}
 
 		a.messages = append(a.messages, resp.Message)
 
 		switch resp.FinishReason {
 		case "length":
+			// Answer any calls so the history stays valid to send
+			for _, tc := range resp.Message.ToolCalls {
+				a.messages = append(a.messages, llm.ToolResultMessage(tc.ID, "Error: not run; the response was truncated by the output token limit."))
+			}
 			term.PrintAssistantDone()
 			term.PrintWarning("Response was truncated due to token limit.")
+			a.stoppedEarly = true
 			return nil
 		case "stop":
 			term.PrintAssistantDone()
@@ -138,7 +464,17 @@ func (a *Agent) Run(ctx context.Context, userMessage string, term UI) error {
 			fmt.Println()
 		}
 
-		results := a.executeToolCalls(opCtx, resp.Message.ToolCalls, term, listener)
+		calls, over := splitToolCalls(resp.Message.ToolCalls[:len(resp.Message.ToolCalls)-len(cut)], a.maxToolCalls)
+		if len(over) > 0 {
+			term.PrintWarning(fmt.Sprintf("The model requested %d tool calls; running the first %d and asking it to send the rest later.", len(calls)+len(over), len(calls)))
+		}
+		results := a.executeToolCalls(opCtx, calls, term, listener)
+		for _, tc := range over {
+			results = append(results, toolResult{id: tc.ID, output: overToolCallResult(len(calls)+len(over), len(calls))})
+		}
+		for _, tc := range cut {
+			results = append(results, toolResult{id: tc.ID, output: truncatedToolCallResult(tc.Function.Name)})
+		}
 		if opCtx.Err() != nil {
 			// Cancelled during tool execution — still record any results we got
 			for _, r := range results {
@@ -149,12 +485,100 @@ func (a *Agent) Run(ctx context.Context, userMessage string, term UI) error {
 			fmt.Println()
 			return context.Canceled
 		}
-		for _, r := range results {
-			a.messages = append(a.messages, llm.ToolResultMessage(r.id, r.output))
+		for i, r := range results {
+			output := r.output
+			if i < len(calls) {
+				output = a.summarizeResult(opCtx, calls[i], output, term)
+			}
+			a.messages = append(a.messages, llm.ToolResultMessage(r.id, output))
 		}
 	}
 
-	return fmt.Errorf("agent loop exceeded maximum iterations (%d)", MaxIterationsPerTurn)
+	a.stoppedEarly = true
+	return fmt.Errorf("agent loop exceeded maximum iterations (%d)", limit)
+}
+
+// TurnOpen reports whether the last turn ended waiting for the user to say
+// go on: it was cut off by the output token or iteration limit, or the
+// assistant's reply ends with a question. A cancelled turn is not open, and
+// neither is a conversation with no turns.
+func (a *Agent) TurnOpen() bool {
+	if len(a.messages) < 2 {
+		return false
+	}
+	if a.stoppedEarly {
+		return true
+	}
+	last := a.messages[len(a.messages)-1]
+	return last.Role == "assistant" && len(last.ToolCalls) == 0 &&
+		strings.HasSuffix(strings.TrimRight(last.ContentString(), " \t\r\n*_`"), "?")
+}
+
+// MaxToolCallTruncations is how many responses per turn may be cut off by
+// the output token limit mid tool call and still have the model retry the
+// call, rather than ending the turn.
+const MaxToolCallTruncations = 2
+
+// cutToolCalls finds the trailing tool calls of a truncated response whose
+// arguments are incomplete JSON, replaces their arguments with "{}" so the
+// message can be sent back, and returns them as they were cut.
+func cutToolCalls(msg *llm.Message) []llm.ToolCall {
+	n := len(msg.ToolCalls)
+	for n > 0 && !json.Valid([]byte(msg.ToolCalls[n-1].Function.Arguments)) {
+		n--
+	}
+	cut := slices.Clone(msg.ToolCalls[n:])
+	for i := n; i < len(msg.ToolCalls); i++ {
+		msg.ToolCalls[i].Function.Arguments = "{}"
+	}
+	return cut
+}
+
+// splitToolCalls splits the tool calls of one response into the first
+// limit, which are run, and the rest. A limit of 0 runs them all.
+func splitToolCalls(calls []llm.ToolCall, limit int) (run, over []llm.ToolCall) {
+	if limit <= 0 || len(calls) <= limit {
+		return calls, nil
+	}
+	return calls[:limit], calls[limit:]
+}
+
+// overToolCallResult is the tool result for a call past the cap on tool
+// calls per response.
+func overToolCallResult(requested, limit int) string {
+	return fmt.Sprintf("Error: not run; this response requested %d tool calls and only the first %d run per response. "+
+		"Request the calls you still need in your next response, at most %d at a time, after reviewing the results so far.", requested, limit, limit)
+}
+
+// truncatedToolCallResult is the tool result for a call cut off by the
+// output token limit.
+func truncatedToolCallResult(name string) string {
+	return fmt.Sprintf("Error: this %s call was cut off by the output token limit before its arguments were complete, so it was not run. "+
+		"Retry it with less content per call: write a large file in parts (write the first part, then add the rest with edit), or split a large change into several smaller edits.", name)
+}
+
+// wrapUpMessage asks the model to conclude a turn that has reached
+// MaxIterationsPerTurn within its remaining iterations.
+func wrapUpMessage(remaining int) string {
+	return fmt.Sprintf("This request has run for %d iterations, the limit for one turn. You have %d more before it is stopped. "+
+		"Do not start new work: finish only what is essential, then summarize what is done and what remains so the user can continue.",
+		MaxIterationsPerTurn, remaining)
+}
+
+// isEmptyResponse reports whether resp has neither text nor tool calls.
+// Truncated responses are excluded; they are reported as truncation.
+func isEmptyResponse(resp *llm.Response) bool {
+	return resp.FinishReason != "length" &&
+		len(resp.Message.ToolCalls) == 0 &&
+		strings.TrimSpace(resp.Message.ContentString()) == ""
+}
+
+// emptyResponseMessage explains an empty response to the user.
+func emptyResponseMessage(finishReason string) string {
+	if finishReason == "content_filter" {
+		return "The model declined to respond (content filter or refusal). Try rephrasing your request."
+	}
+	return "The model returned an empty response. Try again or rephrase your request."
 }
 
 type toolResult struct {
@@ -166,57 +590,66 @@ type toolResult struct {
 func (a *Agent) executeToolCalls(ctx context.Context, calls []llm.ToolCall, term UI, listener ui.Interrupter) []toolResult {
 	results := make([]toolResult, len(calls))
 
-	// Check if all calls are read-only
+	// Check if all calls are read-only (including allowlisted bash commands)
 	allReadOnly := true
 	for _, tc := range calls {
-		if !a.tools.IsReadOnly(tc.Function.Name) {
+		if !a.tools.IsReadOnlyCall(tc.Function.Name, json.RawMessage(tc.Function.Arguments)) {
 			allReadOnly = false
 			break
 		}
 	}
 
 	if allReadOnly && len(calls) > 1 {
-		// Execute read-only tools concurrently
-		for i, tc := range calls {
-			term.PrintToolCall(tc.Function.Name, tc.Function.Arguments)
-			results[i].id = tc.ID
-		}
-
+		// Execute read-only tools concurrently. Each call is printed with its
+		// result once all are done, so results line up with their calls.
 		var wg sync.WaitGroup
 		for i, tc := range calls {
+			results[i].id = tc.ID
 			if !json.Valid([]byte(tc.Function.Arguments)) {
-				results[i].output = fmt.Sprintf("Error: invalid JSON in tool arguments: %s", tc.Function.Arguments)
+				results[i].output = invalidArgsResult(tc)
 				continue
 			}
 			wg.Add(1)
 			go func(idx int, tc llm.ToolCall) {
 				defer wg.Done()
+				defer ui.RestoreOnPanic()
 				input := json.RawMessage(tc.Function.Arguments)
 				output, err := a.tools.Execute(ctx, tc.Function.Name, input)
+				if confirm, ok := err.(*tools.NeedsConfirmation); ok && confirm.Safe {
+					a.auditConfirmed(confirm)
+					output, err = confirm.Execute()
+				}
 				if err != nil {
-					output = fmt.Sprintf("Error: %s", err)
+					output = errorResult(err)
 				}
 				results[idx].output = output
 			}(i, tc)
 		}
 		wg.Wait()
 
-		for _, r := range results {
-			term.PrintToolResult(r.output)
+		for i, tc := range calls {
+			printToolCall(term, tc)
+			term.PrintToolResult(results[i].output)
 		}
 	} else {
 		// Execute sequentially (write tools need confirmation one at a time)
+		batches := a.editBatches(calls)
 		for i, tc := range calls {
 			results[i].id = tc.ID
 
-			if !json.Valid([]byte(tc.Function.Arguments)) {
-				errMsg := fmt.Sprintf("Error: invalid JSON in tool arguments: %s", tc.Function.Arguments)
-				results[i].output = errMsg
-				term.PrintToolCall(tc.Function.Name, "invalid JSON")
+			if batch, ok := batches[i]; ok {
+				if batch != nil {
+					a.executeEditBatch(calls, batch, results, term, listener)
+				}
 				continue
 			}
 
-			term.PrintToolCall(tc.Function.Name, tc.Function.Arguments)
+			printToolCall(term, tc)
+			if !json.Valid([]byte(tc.Function.Arguments)) {
+				results[i].output = invalidArgsResult(tc)
+				term.PrintToolResult(results[i].output)
+				continue
+			}
 
 			input := json.RawMessage(tc.Function.Arguments)
 			output, toolErr := a.tools.Execute(ctx, tc.Function.Name, input)
@@ -225,7 +658,7 @@ func (a *Agent) executeToolCalls(ctx context.Context, calls []llm.ToolCall, term
 				if confirm, ok := toolErr.(*tools.NeedsConfirmation); ok {
 					output = a.handleConfirmation(confirm, term, listener)
 				} else {
-					output = fmt.Sprintf("Error: %s", toolErr)
+					output = errorResult(toolErr)
 				}
 			}
 
@@ -234,62 +667,260 @@ func (a *Agent) executeToolCalls(ctx context.Context, calls []llm.ToolCall, term
 		}
 	}
 
+	for i, tc := range calls {
+		a.debug.Log("tool_call", "name", tc.Function.Name, "args", tc.Function.Arguments,
+			"result_bytes", len(results[i].output), "error", strings.HasPrefix(results[i].output, "Error:"))
+	}
+
 	return results
 }
 
-func (a *Agent) handleConfirmation(confirm *tools.NeedsConfirmation, term UI, listener ui.Interrupter) string {
-	switch confirm.Tool {
-	case "write":
-		if confirm.Preview == "" {
-			term.PrintFilePreview(confirm.Path, confirm.NewContent)
+// printToolCall shows a tool call, or that its arguments are not valid JSON.
+func printToolCall(term UI, tc llm.ToolCall) {
+	if !json.Valid([]byte(tc.Function.Arguments)) {
+		term.PrintToolCall(tc.Function.Name, "invalid JSON")
+		return
+	}
+	term.PrintToolCall(tc.Function.Name, tc.Function.Arguments)
+}
+
+// errorResult is the tool result reporting err to the model. An argument
+// error's suggested fix follows on its own line.
+func errorResult(err error) string {
+	var argErr *tools.ArgError
+	if errors.As(err, &argErr) && argErr.Fix != "" {
+		return fmt.Sprintf("Error: %s\nFix: %s", err, argErr.Fix)
+	}
+	return fmt.Sprintf("Error: %s", err)
+}
+
+// invalidArgsResult is the tool result for a call whose arguments are not
+// valid JSON; the call is not executed.
+func invalidArgsResult(tc llm.ToolCall) string {
+	return fmt.Sprintf("Error: invalid JSON in tool arguments: %s", tc.Function.Arguments)
+}
+
+// editBatches finds edits to the same file within each run of consecutive
+// edit calls. It maps the first call of each such group to the indices of
+// all its calls, and the group's other calls to nil.
+func (a *Agent) editBatches(calls []llm.ToolCall) map[int][]int {
+	batches := make(map[int][]int)
+	groups := make(map[string][]int) // same-file edits in the current run
+	flush := func() {
+		for _, group := range groups {
+			if len(group) < 2 {
+				continue
+			}
+			batches[group[0]] = group
+			for _, idx := range group[1:] {
+				batches[idx] = nil
+			}
+		}
+		clear(groups)
+	}
+
+	for i, tc := range calls {
+		target := a.tools.EditTarget(tc.Function.Name, json.RawMessage(tc.Function.Arguments))
+		if target == "" {
+			// Anything else may depend on the edits before it
+			flush()
+			continue
+		}
+		groups[target] = append(groups[target], i)
+	}
+	flush()
+	return batches
+}
+
+// executeEditBatch applies several edits to one file with a single diff and
+// confirmation, so later edits see the earlier ones without re-reading the
+// file.
+func (a *Agent) executeEditBatch(calls []llm.ToolCall, batch []int, results []toolResult, term UI, listener ui.Interrupter) {
+	inputs := make([]json.RawMessage, len(batch))
+	for j, idx := range batch {
+		term.PrintToolCall(calls[idx].Function.Name, calls[idx].Function.Arguments)
+		results[idx].id = calls[idx].ID
+		inputs[j] = json.RawMessage(calls[idx].Function.Arguments)
+	}
+
+	confirm, errs := a.tools.EditBatch(inputs)
+	var output string
+	if confirm != nil {
+		output = a.handleConfirmation(confirm, term, listener)
+	}
+	for j, idx := range batch {
+		if errs[j] != nil {
+			results[idx].output = errorResult(errs[j])
 		} else {
+			results[idx].output = output
+		}
+		term.PrintToolResult(results[idx].output)
+	}
+}
+
+func (a *Agent) handleConfirmation(confirm *tools.NeedsConfirmation, term UI, listener ui.Interrupter) string {
+	if a.reviewChanges && !confirm.Safe && confirm.Warning == "" {
+		return a.stageForReview(confirm)
+	}
+	details := func() {
+		switch confirm.Tool {
+		case "write":
+			if confirm.Preview == "" {
+				term.PrintFilePreview(confirm.Path, confirm.NewContent)
+			} else {
+				term.PrintDiff(confirm.Path, confirm.Preview, confirm.NewContent)
+			}
+		case "edit":
 			term.PrintDiff(confirm.Path, confirm.Preview, confirm.NewContent)
+		case "rename":
+			for _, c := range confirm.Changes {
+				term.PrintDiff(c.Path, c.Old, c.New)
+			}
+		case "bash", "git_checkout":
+			if !confirm.Safe {
+				fmt.Println()
+			}
+		case "git_commit":
+			term.PrintPatch(confirm.Preview)
+			fmt.Println()
 		}
-	case "edit":
-		term.PrintDiff(confirm.Path, confirm.Preview, confirm.NewContent)
-	case "bash":
-		fmt.Println()
 	}
 
-	// Pause raw mode so fmt.Scanln works for y/n input
-	listener.Pause()
-	approved := term.ConfirmAction(fmt.Sprintf("Apply %s to %s?", confirm.Tool, confirm.Path))
-	listener.Resume()
+	// The compact style leaves a file change's diff for the user to ask for
+	summary := ""
+	if a.compactConfirm {
+		summary = changeSummary(confirm)
+	}
+	if summary == "" {
+		details()
+	}
+	if confirm.Warning != "" {
+		term.PrintWarning(confirm.Warning)
+	}
+
+	approved := confirm.Safe || confirm.Warning == "" && a.autoEdit && (confirm.Tool == "write" || confirm.Tool == "edit" || confirm.Tool == "rename")
+	if !approved {
+		// Pause raw mode so fmt.Scanln works for y/n input
+		listener.Pause()
+		if summary == "" {
+			approved = term.ConfirmAction(fmt.Sprintf("Apply %s to %s?", confirm.Tool, confirm.Path))
+		} else {
+			approved = confirmExpandable(term, fmt.Sprintf("Apply %s to %s (%s)?", confirm.Tool, confirm.Path, summary), details)
+		}
+		listener.Resume()
+	}
 
 	if !approved {
+		if confirm.Warning != "" {
+			return "User denied the operation. They were warned: " + confirm.Warning
+		}
 		return "User denied the operation."
 	}
 
 	// Capture file state before modification for checkpointing
-	if confirm.Tool == "write" || confirm.Tool == "edit" {
-		a.captureFileBeforeModification(confirm.Path)
-	}
+	a.captureConfirmedFiles(confirm)
+	a.auditConfirmed(confirm)
 
 	result, err := confirm.Execute()
 	if err != nil {
 		return fmt.Sprintf("Error: %s", err)
 	}
+	if confirm.Tool == "write" || confirm.Tool == "edit" {
+		result += a.formatFile(confirm.Path, term, listener)
+	}
 	return result
 }
 
 // compactIfNeeded checks if conversation tokens exceed 80% of the context window
-// and, if so, asks the LLM to produce a summary to replace the history.
+// and, if so, asks the LLM to produce a summary to replace the history. With
+// tool-result compaction enabled, old tool results are elided first and the
+// summary is only requested if that is not enough.
 func (a *Agent) compactIfNeeded(ctx context.Context, term UI) {
-	if a.contextWindow <= 0 {
+	if a.autoCompactOff {
+		a.warnIfOverThreshold(term)
 		return
 	}
+	a.compactAbove(ctx, term, 1-ContextBuffer)
+}
 
-	threshold := int(float64(a.contextWindow) * (1 - ContextBuffer))
+// warnIfOverThreshold tells the user, once until the conversation is back
+// under the auto-compaction threshold, that it is over it and needs a manual
+// /compact or /clear.
+func (a *Agent) warnIfOverThreshold(term UI) {
 	current := a.lastTokensUsed
 	if current == 0 {
-		current = EstimateTotalTokens(a.messages)
+		current = a.estimatedMessageTokens()
+	}
+	if !overContextFraction(current, a.contextWindow, 1-ContextBuffer) {
+		a.compactWarned = false
+		return
 	}
-	if current <= threshold {
+	if a.compactWarned {
 		return
 	}
+	a.compactWarned = true
+	term.PrintWarning(fmt.Sprintf("Context is %d%% full and auto-compaction is off. Run /compact to summarize or /clear to start over before it runs out.",
+		current*100/a.contextWindow))
+}
+
+// NeedsIdleCompact reports whether the conversation uses more than soft (a
+// fraction of the context window) and has history a summary would shrink.
+// It never does with auto-compaction off.
+func (a *Agent) NeedsIdleCompact(soft float64) bool {
+	if a.autoCompactOff || len(a.messages) <= 2 {
+		return false
+	}
+	current := a.lastTokensUsed
+	if current == 0 {
+		current = a.estimatedMessageTokens()
+	}
+	return overContextFraction(current, a.contextWindow, soft)
+}
+
+// IdleCompact compacts the conversation between turns, the same way as
+// auto-compaction, if NeedsIdleCompact(soft), so the next turn starts fast
+// and within budget. It reports whether it did anything.
+func (a *Agent) IdleCompact(ctx context.Context, term UI, soft float64) bool {
+	if !a.NeedsIdleCompact(soft) {
+		return false
+	}
+	return a.compactAbove(ctx, term, soft)
+}
+
+// compactAbove compacts the conversation if it uses more than fraction of
+// the context window, and reports whether it did.
+func (a *Agent) compactAbove(ctx context.Context, term UI, fraction float64) bool {
+	current := a.lastTokensUsed
+	if current == 0 {
+		current = a.estimatedMessageTokens()
+	}
+	if !overContextFraction(current, a.contextWindow, fraction) {
+		return false
+	}
+	threshold := int(float64(a.contextWindow) * fraction)
+
+	if a.toolResultCompaction {
+		if n := a.elideToolResults(); n > 0 {
+			a.lastTokensUsed = 0
+			if a.estimatedMessageTokens() <= threshold {
+				term.PrintWarning(fmt.Sprintf("Context is large, elided %d old tool results.", n))
+				return true
+			}
+		}
+	}
 
 	term.PrintWarning("Context is large, compacting conversation...")
 	a.doCompact(ctx, term)
+	return true
+}
+
+// overContextFraction reports whether tokens exceed fraction of
+// contextWindow. An unknown window or a non-positive fraction never does.
+func overContextFraction(tokens, contextWindow int, fraction float64) bool {
+	if contextWindow <= 0 || fraction <= 0 {
+		return false
+	}
+	return tokens > int(float64(contextWindow)*fraction)
 }
 
 // Compact forces an LLM-based compaction of the conversation history.
@@ -308,9 +939,59 @@ func (a *Agent) Clear(term UI) {
 	a.messages = []llm.Message{a.messages[0]}
 	a.checkpoints = nil
 	a.lastTokensUsed = 0
+	a.invalidateTokenCache()
 	term.PrintWarning("Conversation cleared.")
 }
 
+// ClearKeep drops all but the last n user turns. A turn runs from a user
+// message to the next one, so tool calls stay paired with their results and
+// the first message after the system prompt is still a user message.
+// Checkpoints for dropped turns are discarded and the rest renumbered.
+func (a *Agent) ClearKeep(n int, term UI) {
+	if n <= 0 {
+		a.Clear(term)
+		return
+	}
+
+	start, seen := 0, 0
+	for i := len(a.messages) - 1; i >= 1; i-- {
+		if isTurnStart(a.messages[i]) {
+			seen++
+			if seen == n {
+				start = i
+				break
+			}
+		}
+	}
+	if start <= 1 {
+		term.PrintWarning(fmt.Sprintf("Nothing to clear: conversation has %d turns.", seen))
+		return
+	}
+
+	dropped := start - 1
+	a.messages = append([]llm.Message{a.messages[0]}, a.messages[start:]...)
+
+	var kept []Checkpoint
+	for _, cp := range a.checkpoints {
+		if cp.MsgIndex < start {
+			continue
+		}
+		cp.MsgIndex -= dropped
+		cp.Turn = len(kept) + 1
+		kept = append(kept, cp)
+	}
+	a.checkpoints = kept
+	a.lastTokensUsed = 0
+	a.invalidateTokenCache()
+	term.PrintWarning(fmt.Sprintf("Conversation cleared, keeping the last %d turns.", n))
+}
+
+// isTurnStart reports whether msg begins a user turn (a user message that is
+// not a tool result).
+func isTurnStart(msg llm.Message) bool {
+	return msg.Role == "user" && msg.ToolCallID == ""
+}
+
 // doCompact performs the actual LLM-based compaction.
 func (a *Agent) doCompact(ctx context.Context, term UI) {
 	history := serializeHistory(a.messages)
@@ -320,6 +1001,7 @@ func (a *Agent) doCompact(ctx context.Context, term UI) {
 	}
 
 	resp, err := a.client.SendMessage(ctx, compactMessages, nil)
+	term.ClearSpinner() // removes any retry notice
 	if err != nil {
 		term.PrintWarning("Compaction failed, continuing with full history.")
 		return
@@ -351,30 +1033,56 @@ func (a *Agent) doCompact(ctx context.Context, term UI) {
 	}
 
 	a.lastTokensUsed = 0
+	a.invalidateTokenCache()
 	term.PrintWarning("Context compacted successfully.")
 }
 
-// MaxExploreIterations is the iteration limit for the explore sub-agent.
-const MaxExploreIterations = 30
+// defaultExploreIterations is the explore sub-agent's iteration limit
+// unless SetExploreLimits changes it.
+const defaultExploreIterations = 30
+
+// defaultExploreTokenBudget is the default explore sub-agent token soft cap.
+const defaultExploreTokenBudget = 200000
 
-// runExplore spawns a child agent with read-only tools to research the codebase.
+// exploreUncached spawns a child agent with read-only tools to research the codebase.
+// The sub-agent's tools are rooted at dir, so a scoped exploration cannot read
+// or search outside it. An empty dir means the agent's working directory.
+// limits must be resolved with exploreLimitsFor.
 // It uses non-streaming SendMessage to avoid interleaved terminal output.
-func (a *Agent) runExplore(ctx context.Context, task string) (string, error) {
-	roRegistry := tools.NewReadOnlyRegistry(a.workDir)
+func (a *Agent) exploreUncached(ctx context.Context, task, dir string, roots []string, limits tools.ExploreLimits) (string, error) {
+	if dir == "" {
+		dir = a.workDir
+	}
+	roRegistry := tools.NewReadOnlyRegistry(dir)
+	roRegistry.SetIgnoreDirs(a.tools.IgnoreDirs())
+	roRegistry.SetDenyRead(a.tools.DenyRead())
+	roRegistry.SetReadRoots(roots)
+	roRegistry.SetGrepIndex(a.tools.GrepIndex())
+	roRegistry.SetToolTimeout(a.tools.ToolTimeout())
+	if dir == a.workDir {
+		roRegistry.SetFocus(a.tools.Focus())
+	}
 	toolDefs := roRegistry.Definitions()
 
 	messages := []llm.Message{
-		llm.TextMessage("system", exploreSystemPrompt(a.workDir)),
+		llm.TextMessage("system", exploreSystemPrompt(dir, roots)),
 		llm.TextMessage("user", task),
 	}
 
 	totalSteps := 0
+	tokensUsed := 0
+	nextCheck := a.exploreBudget
 
-	for iteration := 0; iteration < MaxExploreIterations; iteration++ {
+	for iteration := 0; iteration < limits.MaxIterations; iteration++ {
+		a.debug.Log("explore_request", "iteration", iteration, "messages", len(messages))
 		resp, err := a.client.SendMessage(ctx, messages, toolDefs)
 		if err != nil {
+			a.debug.Log("error", "stage", "explore", "err", err)
 			return "", fmt.Errorf("explore sub-agent LLM error: %w", err)
 		}
+		tokensUsed += resp.Usage.TotalTokens
+		a.debug.Log("explore_response", "finish_reason", resp.FinishReason,
+			"tool_calls", len(resp.Message.ToolCalls), "tokens", resp.Usage.TotalTokens)
 
 		messages = append(messages, resp.Message)
 
@@ -386,8 +1094,24 @@ func (a *Agent) runExplore(ctx context.Context, task string) (string, error) {
 			return resp.Message.ContentString(), nil
 		}
 
+		// Soft cap: once usage crosses the budget, ask before spending more
+		if a.exploreBudget > 0 && tokensUsed >= nextCheck {
+			if !a.confirmExploreSpend(tokensUsed) {
+				return a.exploreFindings(ctx, messages, toolDefs, totalSteps, "the token budget")
+			}
+			nextCheck = tokensUsed + a.exploreBudget
+		}
+
 		// Print all tool calls, then execute in parallel
-		for _, tc := range resp.Message.ToolCalls {
+		calls, over := splitToolCalls(resp.Message.ToolCalls, a.maxToolCalls)
+		overResult := overToolCallResult(len(resp.Message.ToolCalls), len(calls))
+		if limits.MaxToolCalls > 0 && totalSteps+len(calls) > limits.MaxToolCalls {
+			// The budget runs out within this response; the rest never run
+			calls = calls[:limits.MaxToolCalls-totalSteps]
+			over = resp.Message.ToolCalls[len(calls):]
+			overResult = "Not executed: exploration stopped at the tool-call budget."
+		}
+		for _, tc := range calls {
 			totalSteps++
 			if a.term != nil {
 				a.term.PrintSubAgentToolCall(tc.Function.Name, tc.Function.Arguments)
@@ -395,15 +1119,19 @@ func (a *Agent) runExplore(ctx context.Context, task string) (string, error) {
 		}
 
 		outputs := make([]string, len(resp.Message.ToolCalls))
+		for i := range over {
+			outputs[len(calls)+i] = overResult
+		}
 		var wg sync.WaitGroup
-		for i, tc := range resp.Message.ToolCalls {
+		for i, tc := range calls {
 			wg.Add(1)
 			go func(idx int, tc llm.ToolCall) {
 				defer wg.Done()
+				defer ui.RestoreOnPanic()
 				input := json.RawMessage(tc.Function.Arguments)
 				output, toolErr := roRegistry.Execute(ctx, tc.Function.Name, input)
 				if toolErr != nil {
-					output = fmt.Sprintf("Error: %s", toolErr)
+					output = errorResult(toolErr)
 				}
 				outputs[idx] = output
 			}(i, tc)
@@ -413,19 +1141,73 @@ func (a *Agent) runExplore(ctx context.Context, task string) (string, error) {
 		for i, tc := range resp.Message.ToolCalls {
 			messages = append(messages, llm.ToolResultMessage(tc.ID, outputs[i]))
 		}
+		if limits.MaxToolCalls > 0 && totalSteps >= limits.MaxToolCalls {
+			return a.exploreFindings(ctx, messages, toolDefs, totalSteps, "the tool-call budget")
+		}
+	}
+
+	return a.exploreFindings(ctx, messages, toolDefs, totalSteps, "the iteration limit")
+}
+
+// confirmExploreSpend asks the user whether an explore sub-agent that has used
+// tokensUsed tokens should keep going. Without a terminal it returns false.
+func (a *Agent) confirmExploreSpend(tokensUsed int) bool {
+	if a.term == nil {
+		return false
 	}
+	a.promptMu.Lock()
+	defer a.promptMu.Unlock()
 
+	// Pause raw mode so fmt.Scanln works for y/n input
+	if a.listener != nil {
+		a.listener.Pause()
+		defer a.listener.Resume()
+	}
+	return a.term.ConfirmAction(fmt.Sprintf("Explore sub-agent has used %d tokens. Continue exploring?", tokensUsed))
+}
+
+// exploreFindings stops an exploration early at limit (e.g. "the token
+// budget") and asks the sub-agent to summarize what it has found so far.
+// Pending tool calls in the last message are answered as skipped so the
+// history stays well-formed.
+func (a *Agent) exploreFindings(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef, totalSteps int, limit string) (string, error) {
+	for _, tc := range messages[len(messages)-1].ToolCalls {
+		messages = append(messages, llm.ToolResultMessage(tc.ID, fmt.Sprintf("Not executed: exploration stopped at %s.", limit)))
+	}
+	messages = append(messages, llm.TextMessage("user", fmt.Sprintf(
+		"This exploration has reached %s. Do not call any more tools. Summarize your findings so far.", limit)))
+
+	resp, err := a.client.SendMessage(ctx, messages, toolDefs)
+	if err != nil {
+		return "", fmt.Errorf("explore sub-agent LLM error: %w", err)
+	}
 	if a.term != nil {
-		a.term.PrintSubAgentStatus(fmt.Sprintf("Explore reached max iterations (%d tool calls)", totalSteps))
+		a.term.PrintSubAgentStatus(fmt.Sprintf("Explore stopped at %s (%d tool calls)", limit, totalSteps))
 	}
-	return "Explore sub-agent reached maximum iterations without completing.", nil
+	return fmt.Sprintf("Exploration stopped at %s; findings may be incomplete.\n\n%s", limit, resp.Message.ContentString()), nil
 }
 
-func exploreSystemPrompt(workDir string) string {
+// exploreLimitsFor fills the zero fields of the limits an explore call asked
+// for with the configured ones.
+func (a *Agent) exploreLimitsFor(limits tools.ExploreLimits) tools.ExploreLimits {
+	if limits.MaxIterations <= 0 {
+		limits.MaxIterations = a.exploreLimits.MaxIterations
+	}
+	if limits.MaxToolCalls <= 0 {
+		limits.MaxToolCalls = a.exploreLimits.MaxToolCalls
+	}
+	return limits
+}
+
+func exploreSystemPrompt(workDir string, roots []string) string {
+	extra := ""
+	if len(roots) > 0 {
+		extra = "\nAlso readable, by absolute path (pass it to grep or ls, start a glob pattern with it, or read files under it): " + strings.Join(roots, ", ") + "\n"
+	}
 	return fmt.Sprintf(`You are an exploration sub-agent. Your job is to thoroughly research the codebase to answer the given question.
 
 Working directory: %s
-
+%s
 This is a READ-ONLY exploration task. You only have access to: glob, grep, ls, read.
 
 Guidelines:
@@ -439,7 +1221,7 @@ You are meant to be a fast agent. To achieve this:
 - Wherever possible, call multiple tools in parallel. When you find several files to read, read them ALL in one response instead of one at a time
 - Start broad (glob, grep) then narrow down to specific reads
 
-When you have gathered enough information, provide a clear, structured summary of your findings. Do not ask follow-up questions — just research and report.`, workDir)
+When you have gathered enough information, provide a clear, structured summary of your findings. Do not ask follow-up questions — just research and report.`, workDir, extra)
 }
 
 // ContextStats holds context usage statistics.
@@ -462,12 +1244,11 @@ func (a *Agent) ContextUsage() ContextStats {
 		MessageCount:  len(a.messages),
 		ActualTokens:  a.lastTokensUsed,
 	}
-	for _, msg := range a.messages {
-		tokens := EstimateTokens(msg)
-		if msg.Role == "system" {
-			stats.SystemTokens += tokens
+	for i, e := range a.messageTokens() {
+		if a.messages[i].Role == "system" {
+			stats.SystemTokens += e.tokens
 		} else {
-			stats.MessageTokens += tokens
+			stats.MessageTokens += e.tokens
 		}
 	}
 	stats.ToolDefTokens = EstimateToolDefTokens(a.tools.Definitions())
@@ -482,7 +1263,7 @@ func (a *Agent) systemPrompt() string {
 	var sb strings.Builder
 
 	// Section 1: Identity
-	sb.WriteString(`You are Pilot, an AI coding assistant running in the terminal. You help users with software engineering tasks. Use the instructions below and the tools available to you to assist the user.
+	sb.WriteString("You are " + a.name + `, an AI coding assistant running in the terminal. You help users with software engineering tasks. Use the instructions below and the tools available to you to assist the user.
 
 IMPORTANT: Assist with authorized security testing, defensive security, CTF challenges, and educational contexts. Refuse requests for destructive techniques, DoS attacks, mass targeting, supply chain compromise, or detection evasion for malicious purposes.
 
@@ -512,22 +1293,29 @@ When you encounter an obstacle, do not use destructive actions as a shortcut. Tr
 - Use dedicated tools instead of bash for file operations: read for reading files (not cat/head/tail), edit for editing (not sed/awk), write for creating files (not echo/cat with heredoc). Reserve bash exclusively for system commands and terminal operations that require shell execution.
 - NEVER use bash echo or other command-line tools to communicate with the user. Output all communication directly in your response text.
 - Do not create files unless they're absolutely necessary for achieving your goal. ALWAYS prefer editing an existing file to creating a new one, including markdown files.
-- For broad codebase exploration questions (project structure, how a feature works, finding patterns across files), use the explore tool to delegate the research to a focused sub-agent. This keeps the main conversation focused and avoids cluttering context with intermediate search results.
-
+`)
+	if a.tools.HasTool("explore") {
+		sb.WriteString("- For broad codebase exploration questions (project structure, how a feature works, finding patterns across files), use the explore tool to delegate the research to a focused sub-agent. This keeps the main conversation focused and avoids cluttering context with intermediate search results.\n")
+	} else {
+		sb.WriteString("- For broad codebase exploration questions, research directly with glob, grep, and read. Search broadly first, then read only the files that matter, calling independent searches in parallel.\n")
+	}
+	sb.WriteString(`
 # Tone and style
 - Only use emojis if the user explicitly requests it.
 - Your output will be displayed on a command line interface. Responses should be short and concise. You can use Github-flavored markdown for formatting.
 - Do not use a colon before tool calls. Text like "Let me read the file:" followed by a tool call should just be "Let me read the file." with a period.
 - Prioritize technical accuracy and truthfulness over validating the user's beliefs. Provide direct, objective technical info without unnecessary praise or emotional validation. Disagree when necessary — objective guidance and respectful correction are more valuable than false agreement.
 - Never give time estimates or predictions for how long tasks will take. Focus on what needs to be done, not how long it might take.
-
+`)
+	sb.WriteString(narrationGuidance[a.narration])
+	sb.WriteString(`
 # Git workflow
 When asked to create git commits:
 - Only commit when the user explicitly requests it
 - NEVER force-push, reset --hard, use --no-verify, or amend unless the user explicitly asks
 - Prefer staging specific files over ` + "`git add -A`" + ` or ` + "`git add .`" + `
 - NEVER use interactive flags (` + "`-i`" + `) since they require interactive input
-- Use HEREDOC for multi-line commit messages
+- Commit with the git_commit tool, listing the files to commit, rather than running git commit through bash
 When asked to create pull requests:
 - Use ` + "`gh pr create`" + ` with a clear title and structured body
 - Keep PR titles short (under 70 characters)
@@ -537,7 +1325,18 @@ When asked to create pull requests:
 	// Section: Working directory
 	sb.WriteString("# Environment\n\nWorking directory: ")
 	sb.WriteString(a.workDir)
-	sb.WriteString("\n\n")
+	sb.WriteString("\n")
+	sb.WriteString(a.gitPromptLine())
+	if a.reviewChanges {
+		sb.WriteString("Review mode: writes, edits, and commands that need confirmation are staged, not applied. The user reviews them when your turn ends, and you learn what was applied (with command output) in their next message. Reads and edits see staged file content; glob, grep, and bash do not.\n")
+	}
+	if focus := a.tools.Focus(); focus != "" {
+		sb.WriteString("Focus: " + focus + " (glob, grep, and ls without a path search only this; pass grep or ls a path to look elsewhere)\n")
+	}
+	if roots := a.tools.ExploreRoots(); len(roots) > 0 && a.tools.HasTool("explore") {
+		sb.WriteString("Explore roots: " + strings.Join(roots, ", ") + " (outside the project; pass them to explore's roots input to let the sub-agent read them)\n")
+	}
+	sb.WriteString("\n")
 
 	// Section: Memory
 	sb.WriteString(`# Memory
@@ -546,11 +1345,10 @@ Project knowledge is stored in MEMORY.md at the project root. This file is human
 To persist important context (conventions, architecture decisions, gotchas), use the edit tool to update MEMORY.md.
 `)
 
-	// Inject project memory if available
-	memoryPath := filepath.Join(a.workDir, "MEMORY.md")
-	if data, err := os.ReadFile(memoryPath); err == nil && len(data) > 0 {
+	// Inject project memory if available, capped to memoryTokens
+	if memory := a.projectMemory(); memory != "" {
 		sb.WriteString("\n## Project Memory (MEMORY.md)\n\n")
-		sb.WriteString(string(data))
+		sb.WriteString(memory)
 		sb.WriteString("\n")
 	}
 
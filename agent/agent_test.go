@@ -3,10 +3,18 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"testing"
 
+	"github.com/lowkaihon/cli-coding-agent/debuglog"
 	"github.com/lowkaihon/cli-coding-agent/llm"
 	"github.com/lowkaihon/cli-coding-agent/tools"
 	"github.com/lowkaihon/cli-coding-agent/ui"
@@ -14,12 +22,14 @@ import (
 
 // mockLLMClient implements llm.LLMClient for testing.
 type mockLLMClient struct {
-	responses []llm.Response
-	callCount int32
+	responses    []llm.Response
+	callCount    int32
+	lastMessages []llm.Message // messages passed to the most recent SendMessage
 }
 
 func (m *mockLLMClient) SendMessage(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (*llm.Response, error) {
 	idx := int(atomic.AddInt32(&m.callCount, 1)) - 1
+	m.lastMessages = messages
 	if idx >= len(m.responses) {
 		text := "done"
 		return &llm.Response{
@@ -64,7 +74,9 @@ func (m *mockLLMClient) StreamMessage(ctx context.Context, messages []llm.Messag
 			}
 		}
 
-		ch <- llm.StreamEvent{FinishReason: resp.FinishReason, Done: true}
+		// Providers report the finish reason before the final Done event
+		ch <- llm.StreamEvent{FinishReason: resp.FinishReason}
+		ch <- llm.StreamEvent{Done: true}
 	}()
 	return ch, nil
 }
@@ -96,6 +108,50 @@ func TestAgentSingleTurn(t *testing.T) {
 	}
 }
 
+func TestProjectTreeFirstTurn(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "cmd"), 0755)
+	os.WriteFile(filepath.Join(dir, "cmd", "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644)
+
+	mock := &mockLLMClient{}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetProjectTree(true)
+	term := ui.NewTerminal()
+
+	for _, msg := range []string{"first", "second"} {
+		if err := ag.Run(context.Background(), msg, term); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var withTree []string
+	for _, m := range ag.messages {
+		if m.Role == "user" && strings.Contains(m.ContentString(), projectTreeHeader) {
+			withTree = append(withTree, m.ContentString())
+		}
+	}
+	if len(withTree) != 1 || !strings.HasPrefix(withTree[0], "first\n\n") || !strings.Contains(withTree[0], "cmd/\n  main.go\ngo.mod\n") {
+		t.Fatalf("expected the tree once, on the first message, got %q", withTree)
+	}
+
+	// A resumed session already has history and gets no tree
+	if err := ag.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+	resumed := New(mock, tools.NewRegistry(dir), dir, 128000)
+	resumed.SetProjectTree(true)
+	if err := resumed.ResumeSession(ag.sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.Run(context.Background(), "third", term); err != nil {
+		t.Fatal(err)
+	}
+	if last := resumed.messages[len(resumed.messages)-2]; last.Role != "user" || last.ContentString() != "third" {
+		t.Errorf("expected no tree after resume, got %s %q", last.Role, last.ContentString())
+	}
+}
+
 func TestAgentToolUseLoop(t *testing.T) {
 	// First response: LLM calls glob tool
 	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
@@ -138,6 +194,191 @@ func TestAgentToolUseLoop(t *testing.T) {
 	}
 }
 
+func TestLastToolResult(t *testing.T) {
+	dir := t.TempDir()
+	var content strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	os.WriteFile(filepath.Join(dir, "long.txt"), []byte(content.String()), 0644)
+
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{
+					{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "glob", Arguments: `{"pattern": "*.txt"}`}},
+					{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "read", Arguments: `{"path": "long.txt"}`}},
+				}),
+				FinishReason: "tool_calls",
+			},
+			{Message: llm.TextMessage("assistant", "Read it."), FinishReason: "stop"},
+		},
+	}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	if _, _, ok := ag.LastToolResult(); ok {
+		t.Error("expected no tool result in a new conversation")
+	}
+
+	term := ui.NewTerminal()
+	captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "read long.txt", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	call, result, ok := ag.LastToolResult()
+	if !ok || call.Function.Name != "read" || call.Function.Arguments != `{"path": "long.txt"}` {
+		t.Fatalf("expected the read call, got %+v (ok=%v)", call, ok)
+	}
+	// The display shows a few lines; the full result has all of them
+	if !strings.Contains(result, "   1 │ line 1\n") || !strings.Contains(result, "  40 │ line 40\n") {
+		t.Errorf("expected the full result, got %q", result)
+	}
+
+	ag.Clear(term)
+	if _, _, ok := ag.LastToolResult(); ok {
+		t.Error("expected no tool result after clearing")
+	}
+}
+
+func TestArgErrorFixHint(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\nthree\n"), 0644)
+
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{
+					{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "read", Arguments: `{"path": "a.txt", "start_line": 3, "end_line": 1}`}},
+				}),
+				FinishReason: "tool_calls",
+			},
+			{Message: llm.TextMessage("assistant", "Done."), FinishReason: "stop"},
+		},
+	}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "read a.txt backwards", ui.NewTerminal()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	_, result, _ := ag.LastToolResult()
+	want := "Error: start_line 3 is after end_line 1\nFix: retry with start_line=1 end_line=3"
+	if result != want {
+		t.Errorf("got %q, want %q", result, want)
+	}
+}
+
+func TestResultSummaries(t *testing.T) {
+	dir := t.TempDir()
+	var content strings.Builder
+	for i := 1; i <= 200; i++ {
+		fmt.Fprintf(&content, "log entry %d\n", i)
+	}
+	os.WriteFile(filepath.Join(dir, "big.log"), []byte(content.String()), 0644)
+	os.WriteFile(filepath.Join(dir, "small.txt"), []byte("short\n"), 0644)
+
+	summary := "200 log entries, numbered 1 to 200."
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{
+					{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "read", Arguments: `{"path": "big.log"}`}},
+					{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "read", Arguments: `{"path": "small.txt"}`}},
+				}),
+				FinishReason: "tool_calls",
+			},
+			{Message: llm.TextMessage("assistant", summary), FinishReason: "stop"},
+			{Message: llm.TextMessage("assistant", "Done."), FinishReason: "stop"},
+		},
+	}
+	registry := tools.NewRegistry(dir)
+	ag := New(mock, registry, dir, 128000)
+	ag.SetResultSummaries(1000, "")
+	if !registry.HasTool("recall") {
+		t.Fatal("expected the recall tool with summaries enabled")
+	}
+
+	captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "check the logs", ui.NewTerminal()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// The summary request carried the raw output
+	if len(mock.lastMessages) != 2 || !strings.Contains(mock.lastMessages[1].ContentString(), "log entry 200") {
+		t.Errorf("expected the raw output sent for summary, got %+v", mock.lastMessages)
+	}
+	results := map[string]string{}
+	for _, msg := range ag.messages {
+		if msg.ToolCallID != "" {
+			results[msg.ToolCallID] = msg.ContentString()
+		}
+	}
+	big := results["call_1"]
+	if !strings.HasPrefix(big, "[Summary of ") || !strings.Contains(big, "recall with id=1") || !strings.HasSuffix(big, summary) || strings.Contains(big, "log entry 150") {
+		t.Errorf("expected the big result replaced by a summary, got %q", big)
+	}
+	if !strings.Contains(results["call_2"], "short") || strings.HasPrefix(results["call_2"], "[Summary") {
+		t.Errorf("expected the small result kept as is, got %q", results["call_2"])
+	}
+
+	raw, err := registry.Execute(context.Background(), "recall", json.RawMessage(`{"id": 1, "start_line": 150, "end_line": 150}`))
+	if err != nil || !strings.Contains(raw, "log entry 150") {
+		t.Errorf("expected the raw output archived for recall, got %q, %v", raw, err)
+	}
+
+	ag.SetResultSummaries(0, "")
+	if registry.HasTool("recall") {
+		t.Error("expected recall removed with summaries disabled")
+	}
+}
+
+func TestMaxToolCalls(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644)
+
+	var calls []llm.ToolCall
+	for i := 1; i <= 5; i++ {
+		calls = append(calls, llm.ToolCall{ID: fmt.Sprintf("call_%d", i), Type: "function", Function: llm.FunctionCall{Name: "read", Arguments: `{"path": "a.txt"}`}})
+	}
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.AssistantMessage(nil, calls), FinishReason: "tool_calls"},
+			{Message: llm.TextMessage("assistant", "Done."), FinishReason: "stop"},
+		},
+	}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetMaxToolCalls(2)
+	captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "read a.txt five times", ui.NewTerminal()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Every call is answered, in order: the first two run, the rest get the note
+	var results []llm.Message
+	for _, msg := range ag.messages {
+		if msg.ToolCallID != "" {
+			results = append(results, msg)
+		}
+	}
+	if len(results) != 5 {
+		t.Fatalf("expected 5 tool results, got %d", len(results))
+	}
+	for i, msg := range results {
+		if msg.ToolCallID != calls[i].ID {
+			t.Errorf("result %d answers %s, want %s", i, msg.ToolCallID, calls[i].ID)
+		}
+		ran := strings.Contains(msg.ContentString(), "1 │ a")
+		note := strings.Contains(msg.ContentString(), "requested 5 tool calls and only the first 2 run")
+		if (i < 2) != ran || (i >= 2) != note {
+			t.Errorf("result %d: got %q", i, msg.ContentString())
+		}
+	}
+}
+
 func TestAgentMaxIterations(t *testing.T) {
 	// Create a mock that always returns tool calls (infinite loop)
 	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
@@ -176,6 +417,157 @@ func TestAgentMaxIterations(t *testing.T) {
 	}
 }
 
+func TestAgentWrapUpNudge(t *testing.T) {
+	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
+	responses := make([]llm.Response, MaxIterationsPerTurn+10)
+	for i := range responses {
+		responses[i] = llm.Response{
+			Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+				ID: fmt.Sprintf("call_%d", i), Type: "function",
+				Function: llm.FunctionCall{Name: "glob", Arguments: string(globArgs)},
+			}}),
+			FinishReason: "tool_calls",
+		}
+	}
+
+	mock := &mockLLMClient{responses: responses}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetWrapUpIterations(3)
+
+	err := ag.Run(context.Background(), "infinite loop", ui.NewTerminal())
+	if err == nil || err.Error() != "agent loop exceeded maximum iterations (53)" {
+		t.Fatalf("expected hard stop after the grace window, got %v", err)
+	}
+	if n := atomic.LoadInt32(&mock.callCount); n != MaxIterationsPerTurn+3 {
+		t.Errorf("expected %d requests, got %d", MaxIterationsPerTurn+3, n)
+	}
+
+	// The nudge follows the limit's tool results and precedes the grace requests
+	nudge := -1
+	for i, msg := range ag.messages {
+		if msg.Role == "user" && msg.ContentString() == wrapUpMessage(3) {
+			nudge = i
+		}
+	}
+	if nudge < 0 {
+		t.Fatal("expected wrap-up nudge in history")
+	}
+	assistants := 0
+	for _, msg := range ag.messages[nudge:] {
+		if msg.Role == "assistant" {
+			assistants++
+		}
+	}
+	if ag.messages[nudge-1].Role != "tool" || assistants != 3 {
+		t.Errorf("expected nudge after tool results with 3 replies after it, got previous role %q and %d replies", ag.messages[nudge-1].Role, assistants)
+	}
+}
+
+func TestAgentToolCallTruncated(t *testing.T) {
+	call := func(id, name, args string) llm.ToolCall {
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: name, Arguments: args}}
+	}
+	truncated := llm.Response{
+		Message: llm.AssistantMessage(nil, []llm.ToolCall{
+			call("call_1", "glob", `{"pattern":"*.go"}`),
+			call("call_2", "write", `{"path":"big.txt","content":"aaaa`),
+		}),
+		FinishReason: "length",
+	}
+	results := func(ag *Agent) map[string]string {
+		out := make(map[string]string)
+		for _, m := range ag.messages {
+			if m.ToolCallID != "" {
+				out[m.ToolCallID] = m.ContentString()
+			}
+		}
+		return out
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		mock := &mockLLMClient{responses: []llm.Response{truncated, {
+			Message:      llm.AssistantMessage(nil, []llm.ToolCall{call("call_3", "write", `{"path":"big.txt","content":"aa"}`)}),
+			FinishReason: "tool_calls",
+		}}}
+		dir := t.TempDir()
+		ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+		term := &confirmUI{Terminal: ui.NewTerminal(), answer: true}
+
+		if err := ag.Run(context.Background(), "write a big file", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := results(ag)
+		if strings.HasPrefix(out["call_1"], "Error") {
+			t.Errorf("expected the complete call to run, got %q", out["call_1"])
+		}
+		if !strings.Contains(out["call_2"], "cut off by the output token limit") {
+			t.Errorf("expected the cut call to be reported, got %q", out["call_2"])
+		}
+		if args := ag.messages[2].ToolCalls[1].Function.Arguments; args != "{}" {
+			t.Errorf("expected the cut arguments replaced, got %q", args)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "big.txt")); string(data) != "aa" {
+			t.Errorf("expected the retried write, got %q", data)
+		}
+		if mock.callCount != 3 {
+			t.Errorf("expected 3 requests, got %d", mock.callCount)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		responses := make([]llm.Response, MaxToolCallTruncations+1)
+		for i := range responses {
+			responses[i] = truncated
+		}
+		mock := &mockLLMClient{responses: responses}
+		dir := t.TempDir()
+		ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+
+		if err := ag.Run(context.Background(), "write a big file", ui.NewTerminal()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if int(mock.callCount) != MaxToolCallTruncations+1 {
+			t.Errorf("expected %d requests, got %d", MaxToolCallTruncations+1, mock.callCount)
+		}
+		last := ag.messages[len(ag.messages)-1]
+		if last.Role != "tool" || !strings.Contains(last.ContentString(), "truncated") {
+			t.Errorf("expected the last call answered, got %+v", last)
+		}
+	})
+}
+
+func TestTurnOpen(t *testing.T) {
+	reply := func(text, finish string) llm.Response {
+		return llm.Response{Message: llm.TextMessage("assistant", text), FinishReason: finish}
+	}
+	mock := &mockLLMClient{responses: []llm.Response{
+		reply("Done. Should I also update the tests?\n", "stop"),
+		reply("Updated the tests.", "stop"),
+		reply("Here is the first half of the", "length"),
+	}}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	term := ui.NewTerminal()
+
+	if ag.TurnOpen() {
+		t.Error("expected a fresh conversation not to be open")
+	}
+	for _, want := range []bool{true, false, true} {
+		if err := ag.Run(context.Background(), "go", term); err != nil {
+			t.Fatal(err)
+		}
+		if got := ag.TurnOpen(); got != want {
+			t.Errorf("after %q: TurnOpen() = %v, want %v", ag.messages[len(ag.messages)-1].ContentString(), got, want)
+		}
+	}
+
+	ag.Clear(term)
+	if ag.TurnOpen() {
+		t.Error("expected a cleared conversation not to be open")
+	}
+}
+
 func TestAgentConcurrentToolExecution(t *testing.T) {
 	// LLM returns two read-only tool calls
 	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
@@ -303,6 +695,62 @@ func TestNoCompactionUnderLimit(t *testing.T) {
 	}
 }
 
+func TestIdleCompact(t *testing.T) {
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.TextMessage("assistant", "Summary of the work."), FinishReason: "stop"},
+		},
+	}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 1000000)
+	term := ui.NewTerminal()
+
+	if ag.NeedsIdleCompact(0.0001) {
+		t.Error("a conversation without history must not need compacting")
+	}
+
+	longContent := strings.Repeat("This is a long message to fill tokens. ", 100)
+	ag.messages = append(ag.messages,
+		llm.TextMessage("user", "find go files"),
+		llm.TextMessage("assistant", longContent),
+		llm.TextMessage("user", "now what?"),
+	)
+
+	if ag.IdleCompact(context.Background(), term, 0.5) {
+		t.Error("expected no compaction below the soft threshold")
+	}
+	if mock.callCount != 0 {
+		t.Fatalf("expected no LLM call, got %d", mock.callCount)
+	}
+
+	before := ag.MessageCount()
+	if !ag.IdleCompact(context.Background(), term, 0.0001) {
+		t.Fatal("expected compaction above the soft threshold")
+	}
+	if mock.callCount != 1 || ag.MessageCount() >= before {
+		t.Errorf("expected one summary call and fewer messages, got %d calls, %d -> %d messages", mock.callCount, before, ag.MessageCount())
+	}
+}
+
+func TestOverContextFraction(t *testing.T) {
+	tests := []struct {
+		tokens, window int
+		fraction       float64
+		want           bool
+	}{
+		{500, 0, 0.5, false},
+		{500, 1000, 0, false},
+		{400, 1000, 0.5, false},
+		{500, 1000, 0.5, false},
+		{501, 1000, 0.5, true},
+	}
+	for _, tt := range tests {
+		if got := overContextFraction(tt.tokens, tt.window, tt.fraction); got != tt.want {
+			t.Errorf("overContextFraction(%d, %d, %v) = %v, want %v", tt.tokens, tt.window, tt.fraction, got, tt.want)
+		}
+	}
+}
+
 func TestCompactCommand(t *testing.T) {
 	summaryText := "Summary of conversation."
 	mock := &mockLLMClient{
@@ -341,6 +789,63 @@ func TestCompactCommand(t *testing.T) {
 	}
 }
 
+func TestAutoCompactOff(t *testing.T) {
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.TextMessage("assistant", "First."), FinishReason: "stop"},
+			{Message: llm.TextMessage("assistant", "Second."), FinishReason: "stop"},
+		},
+	}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 500)
+	ag.SetAutoCompact(false)
+	term := ui.NewTerminal()
+
+	longContent := strings.Repeat("This is a long message to fill tokens. ", 100)
+	ag.messages = append(ag.messages,
+		llm.TextMessage("user", "find go files"),
+		llm.TextMessage("assistant", longContent),
+	)
+	before := ag.MessageCount()
+
+	out := captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "now what?", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	// Only the turn's own call: no summarization request
+	if mock.callCount != 1 {
+		t.Errorf("expected 1 LLM call (no compaction), got %d", mock.callCount)
+	}
+	if ag.MessageCount() != before+2 {
+		t.Errorf("expected history kept, got %d messages (was %d)", ag.MessageCount(), before)
+	}
+	if !strings.Contains(out, "auto-compaction is off") || !strings.Contains(out, "/compact") {
+		t.Errorf("expected a warning to compact manually, got %q", out)
+	}
+	if ag.NeedsIdleCompact(0.0001) {
+		t.Error("expected no idle compaction with auto-compaction off")
+	}
+
+	// The warning is shown once while the conversation stays over the threshold
+	out = captureStdout(t, func() {
+		ag.Run(context.Background(), "and then?", term)
+	})
+	if strings.Contains(out, "auto-compaction is off") {
+		t.Errorf("expected no repeated warning, got %q", out)
+	}
+
+	// Manual /compact still summarizes
+	mock.responses = append(mock.responses, llm.Response{Message: llm.TextMessage("assistant", "Summary."), FinishReason: "stop"})
+	before = ag.MessageCount()
+	if err := ag.Compact(context.Background(), term); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ag.MessageCount() >= before {
+		t.Errorf("expected /compact to shrink history, got %d messages (was %d)", ag.MessageCount(), before)
+	}
+}
+
 func TestCompactEmptyConversation(t *testing.T) {
 	mock := &mockLLMClient{}
 
@@ -366,6 +871,89 @@ func TestCompactEmptyConversation(t *testing.T) {
 	}
 }
 
+// toolHeavyHistory appends two turns whose tool results dominate the
+// conversation, returning the user and assistant text to check verbatim.
+func toolHeavyHistory(ag *Agent) []string {
+	bigOutput := strings.Repeat("line of grep output\n", 500)
+	call := func(id string) []llm.ToolCall {
+		return []llm.ToolCall{{ID: id, Type: "function", Function: llm.FunctionCall{Name: "grep", Arguments: `{"pattern":"x"}`}}}
+	}
+	reply := "Found the handler in server.go."
+	ag.messages = append(ag.messages,
+		llm.TextMessage("user", "find the handler"),
+		llm.AssistantMessage(nil, call("call_1")),
+		llm.ToolResultMessage("call_1", bigOutput),
+		llm.TextMessage("assistant", reply),
+		llm.TextMessage("user", "now check the tests"),
+		llm.AssistantMessage(nil, call("call_2")),
+		llm.ToolResultMessage("call_2", bigOutput),
+	)
+	return []string{"find the handler", reply, "now check the tests"}
+}
+
+func TestToolResultCompaction(t *testing.T) {
+	mock := &mockLLMClient{}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetToolResultCompaction(true)
+	texts := toolHeavyHistory(ag)
+
+	// Only the first tool result can be elided; size the window so that is enough
+	before := ag.estimatedMessageTokens()
+	ag.contextWindow = int(float64(before) * 0.9 / (1 - ContextBuffer))
+
+	ag.compactIfNeeded(context.Background(), ui.NewTerminal())
+
+	if mock.callCount != 0 {
+		t.Errorf("expected no summarization call, got %d", mock.callCount)
+	}
+	if after := ag.estimatedMessageTokens(); after >= before {
+		t.Errorf("expected fewer tokens after elision, got %d (was %d)", after, before)
+	}
+	if ag.MessageCount() != 8 {
+		t.Fatalf("expected all 8 messages kept, got %d", ag.MessageCount())
+	}
+
+	var got []string
+	for _, msg := range ag.messages[1:] {
+		if msg.ToolCallID == "" && msg.Content != nil {
+			got = append(got, *msg.Content)
+		}
+	}
+	if !slices.Equal(got, texts) {
+		t.Errorf("user/assistant messages changed:\ngot  %q\nwant %q", got, texts)
+	}
+
+	old := ag.messages[3].ContentString()
+	if !strings.Contains(old, "elided during compaction") || len(old) > 300 {
+		t.Errorf("expected old tool result elided, got %d chars: %q", len(old), old)
+	}
+	if ag.messages[7].ContentString() != strings.Repeat("line of grep output\n", 500) {
+		t.Error("expected current turn's tool result kept intact")
+	}
+}
+
+func TestToolResultCompactionFallsBackToSummary(t *testing.T) {
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.TextMessage("assistant", "Summary of work."), FinishReason: "stop"},
+		},
+	}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetToolResultCompaction(true)
+	toolHeavyHistory(ag)
+
+	// Too small for elision alone to help
+	ag.contextWindow = 500
+
+	ag.compactIfNeeded(context.Background(), ui.NewTerminal())
+
+	if mock.callCount != 1 {
+		t.Errorf("expected summarization after elision, got %d calls", mock.callCount)
+	}
+}
+
 func TestClear(t *testing.T) {
 	mock := &mockLLMClient{}
 
@@ -395,3 +983,1202 @@ func TestClear(t *testing.T) {
 		t.Errorf("expected 0 LLM calls for clear, got %d", mock.callCount)
 	}
 }
+
+func TestExploreScopedToSubdir(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "pkg")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(dir, "top.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(sub, "inner.go"), []byte("package pkg\n"), 0644)
+
+	globArgs, _ := json.Marshal(map[string]string{"pattern": "**/*.go"})
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+					ID:       "call_1",
+					Type:     "function",
+					Function: llm.FunctionCall{Name: "glob", Arguments: string(globArgs)},
+				}}),
+				FinishReason: "tool_calls",
+			},
+		},
+	}
+
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	if _, err := ag.runExplore(context.Background(), "list go files", sub, nil, tools.ExploreLimits{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(mock.lastMessages[0].ContentString(), sub) {
+		t.Errorf("expected system prompt to name scoped dir %s", sub)
+	}
+	result := mock.lastMessages[len(mock.lastMessages)-1].ContentString()
+	if !strings.Contains(result, "inner.go") {
+		t.Errorf("expected inner.go in scoped glob result, got: %s", result)
+	}
+	if strings.Contains(result, "top.go") {
+		t.Errorf("scoped explore should not see files outside %s, got: %s", sub, result)
+	}
+
+	// Reads outside the scope are rejected by the sub-agent's tools.
+	readArgs, _ := json.Marshal(map[string]string{"path": filepath.Join(dir, "top.go")})
+	mock = &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+					ID:       "call_1",
+					Type:     "function",
+					Function: llm.FunctionCall{Name: "read", Arguments: string(readArgs)},
+				}}),
+				FinishReason: "tool_calls",
+			},
+		},
+	}
+	ag.client = mock
+	if _, err := ag.runExplore(context.Background(), "read top.go", sub, nil, tools.ExploreLimits{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result = mock.lastMessages[len(mock.lastMessages)-1].ContentString()
+	if !strings.Contains(result, "outside the working directory") {
+		t.Errorf("expected out-of-scope read to fail, got: %s", result)
+	}
+}
+
+func TestExploreCache(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.TextMessage("assistant", "One Go file: main.go."), FinishReason: "stop"},
+			{Message: llm.TextMessage("assistant", "Two Go files."), FinishReason: "stop"},
+		},
+	}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetExploreCache(true)
+	explore := func(task string) string {
+		t.Helper()
+		input, _ := json.Marshal(map[string]string{"task": task})
+		result, err := ag.tools.Execute(context.Background(), "explore", input)
+		if err != nil {
+			t.Fatalf("explore %q: %v", task, err)
+		}
+		return result
+	}
+
+	if got := explore("List the Go files."); got != "One Go file: main.go." {
+		t.Fatalf("unexpected first result: %q", got)
+	}
+
+	// The same task, spelled a little differently, comes from the cache
+	got := explore("  list the go   files ")
+	if mock.callCount != 1 {
+		t.Errorf("expected the sub-agent to run once, got %d calls", mock.callCount)
+	}
+	if !strings.HasPrefix(got, "[Cached result") || !strings.HasSuffix(got, "One Go file: main.go.") {
+		t.Errorf("expected the cached result with an age note, got %q", got)
+	}
+
+	// A different task, or a changed file, runs the sub-agent again
+	os.WriteFile(filepath.Join(dir, "util.go"), []byte("package main\n"), 0644)
+	if got := explore("List the Go files."); got != "Two Go files." || mock.callCount != 2 {
+		t.Errorf("expected a fresh exploration after a file changed, got %q after %d calls", got, mock.callCount)
+	}
+	explore("Where is main defined?")
+	if mock.callCount != 3 {
+		t.Errorf("expected a different task to run the sub-agent, got %d calls", mock.callCount)
+	}
+
+	ag.SetExploreCache(false)
+	explore("Where is main defined?")
+	if mock.callCount != 4 {
+		t.Errorf("expected no caching once disabled, got %d calls", mock.callCount)
+	}
+}
+
+func TestSetNameUpdatesSystemPrompt(t *testing.T) {
+	dir := t.TempDir()
+	ag := New(&mockLLMClient{}, tools.NewRegistry(dir), dir, 128000)
+
+	if !strings.HasPrefix(ag.messages[0].ContentString(), "You are Pilot,") {
+		t.Errorf("expected default name in system prompt, got: %.40s", ag.messages[0].ContentString())
+	}
+
+	ag.SetName("Ace")
+	if !strings.HasPrefix(ag.messages[0].ContentString(), "You are Ace,") {
+		t.Errorf("expected configured name in system prompt, got: %.40s", ag.messages[0].ContentString())
+	}
+	if strings.Contains(ag.systemPrompt(), "You are Pilot") {
+		t.Error("default name should not remain in assembled system prompt")
+	}
+
+	ag.SetName("")
+	if !strings.HasPrefix(ag.messages[0].ContentString(), "You are Pilot,") {
+		t.Errorf("expected empty name to restore default, got: %.40s", ag.messages[0].ContentString())
+	}
+}
+
+func TestSetNarrationUpdatesSystemPrompt(t *testing.T) {
+	dir := t.TempDir()
+	ag := New(&mockLLMClient{}, tools.NewRegistry(dir), dir, 128000)
+	base := ag.messages[0].ContentString()
+	for _, guidance := range narrationGuidance {
+		if strings.Contains(base, guidance) {
+			t.Errorf("default prompt should carry no narration guidance, found %q", guidance)
+		}
+	}
+
+	for _, n := range []Narration{NarrationExplain, NarrationTerse} {
+		ag.SetNarration(n)
+		prompt := ag.messages[0].ContentString()
+		if !strings.Contains(prompt, narrationGuidance[n]) {
+			t.Errorf("narration %d: guidance missing from system prompt", n)
+		}
+		if !strings.Contains(prompt, "# Tone and style") || strings.Index(prompt, narrationGuidance[n]) > strings.Index(prompt, "# Git workflow") {
+			t.Errorf("narration %d: guidance should be in the tone and style section", n)
+		}
+	}
+	if strings.Contains(ag.messages[0].ContentString(), narrationGuidance[NarrationExplain]) {
+		t.Error("switching to terse should drop the explain guidance")
+	}
+
+	ag.SetNarration(NarrationDefault)
+	if ag.messages[0].ContentString() != base {
+		t.Error("NarrationDefault should restore the base system prompt")
+	}
+}
+
+func TestAgentEmptyResponse(t *testing.T) {
+	for _, reason := range []string{"stop", "content_filter"} {
+		t.Run(reason, func(t *testing.T) {
+			mock := &mockLLMClient{
+				responses: []llm.Response{
+					{Message: llm.AssistantMessage(nil, nil), FinishReason: reason},
+				},
+			}
+
+			dir := t.TempDir()
+			ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+			if err := ag.Run(context.Background(), "hello", ui.NewTerminal()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// system + user; the empty assistant message is not recorded
+			if ag.MessageCount() != 2 {
+				t.Errorf("expected 2 messages, got %d", ag.MessageCount())
+			}
+		})
+	}
+}
+
+func TestEmptyResponseDetection(t *testing.T) {
+	text := "hi"
+	blank := "  \n"
+	tests := []struct {
+		name string
+		resp llm.Response
+		want bool
+	}{
+		{"text", llm.Response{Message: llm.Message{Content: &text}, FinishReason: "stop"}, false},
+		{"nil content", llm.Response{FinishReason: "stop"}, true},
+		{"whitespace only", llm.Response{Message: llm.Message{Content: &blank}, FinishReason: "stop"}, true},
+		{"content filter", llm.Response{FinishReason: "content_filter"}, true},
+		{"tool calls", llm.Response{Message: llm.AssistantMessage(nil, []llm.ToolCall{{ID: "1"}}), FinishReason: "tool_calls"}, false},
+		{"truncated", llm.Response{FinishReason: "length"}, false},
+	}
+	for _, tt := range tests {
+		if got := isEmptyResponse(&tt.resp); got != tt.want {
+			t.Errorf("%s: isEmptyResponse = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if !strings.Contains(emptyResponseMessage("content_filter"), "content filter") {
+		t.Error("expected content filter reason in message")
+	}
+	if !strings.Contains(emptyResponseMessage("stop"), "empty response") {
+		t.Error("expected empty response message")
+	}
+}
+
+// confirmUI is a terminal whose confirmation prompts are answered by the test.
+type confirmUI struct {
+	*ui.Terminal
+	answer  bool
+	prompts []string
+}
+
+func (c *confirmUI) ConfirmAction(prompt string) bool {
+	c.prompts = append(c.prompts, prompt)
+	return c.answer
+}
+
+// captureStdout returns what fn prints to standard output.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestToolCallSecretsMaskedInDisplayOnly(t *testing.T) {
+	const token = "ghp_AbCdEfGhIjKlMnOpQrStUv0123"
+	dir := t.TempDir()
+	bashArgs, _ := json.Marshal(map[string]string{"command": "printf %s " + token + " > out.txt && cat out.txt"})
+	mock := &mockLLMClient{responses: []llm.Response{{
+		Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+			ID: "call_1", Type: "function",
+			Function: llm.FunctionCall{Name: "bash", Arguments: string(bashArgs)},
+		}}),
+		FinishReason: "tool_calls",
+	}}}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	term := &confirmUI{Terminal: ui.NewTerminal(), answer: true}
+	term.SetRedactor(debuglog.Redactor())
+
+	output := captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "save the token", term); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	if strings.Contains(output, token) || !strings.Contains(output, "ghp_[REDACTED]") {
+		t.Errorf("expected token masked in display, got:\n%s", output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil || string(data) != token {
+		t.Errorf("expected command to run with the real token, got %q (%v)", data, err)
+	}
+	for _, msg := range ag.messages {
+		if msg.Role == "tool" && msg.ContentString() != token {
+			t.Errorf("expected model to see the real output, got %q", msg.ContentString())
+		}
+	}
+}
+
+func TestExploreTokenBudget(t *testing.T) {
+	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
+	globCall := llm.Response{
+		Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: llm.FunctionCall{Name: "glob", Arguments: string(globArgs)},
+		}}),
+		FinishReason: "tool_calls",
+		Usage:        llm.Usage{TotalTokens: 600},
+	}
+
+	tests := []struct {
+		name        string
+		budget      int
+		answer      bool
+		wantAsked   int
+		wantCalls   int32
+		wantStopped bool
+	}{
+		// 600 then 1200 tokens: crossing 1000 asks; declining requests a summary
+		{"decline returns partial findings", 1000, false, 1, 3, true},
+		// Continuing moves the next check to 2200, which is never reached
+		{"continue keeps exploring", 1000, true, 1, 4, false},
+		{"under budget never asks", 10000, false, 0, 4, false},
+		{"disabled never asks", 0, false, 0, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockLLMClient{responses: []llm.Response{globCall, globCall, globCall}}
+			dir := t.TempDir()
+			ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+			ag.SetExploreTokenBudget(tt.budget)
+			term := &confirmUI{Terminal: ui.NewTerminal(), answer: tt.answer}
+			ag.term = term
+
+			result, err := ag.runExplore(context.Background(), "explore", "", nil, tools.ExploreLimits{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(term.prompts) != tt.wantAsked {
+				t.Errorf("expected %d prompts, got %d: %v", tt.wantAsked, len(term.prompts), term.prompts)
+			}
+			if mock.callCount != tt.wantCalls {
+				t.Errorf("expected %d LLM calls, got %d", tt.wantCalls, mock.callCount)
+			}
+			if stopped := strings.Contains(result, "token budget"); stopped != tt.wantStopped {
+				t.Errorf("stopped=%v, want %v; result: %s", stopped, tt.wantStopped, result)
+			}
+			if tt.wantStopped {
+				// Pending tool calls are answered before the summary request
+				last := mock.lastMessages[len(mock.lastMessages)-2]
+				if last.ToolCallID != "call_1" {
+					t.Errorf("expected skipped tool result before summary request, got %+v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestExploreToolCallBudget(t *testing.T) {
+	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
+	glob := func(id string) llm.ToolCall {
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: "glob", Arguments: string(globArgs)}}
+	}
+	responses := []llm.Response{
+		{Message: llm.AssistantMessage(nil, []llm.ToolCall{glob("call_1"), glob("call_2")}), FinishReason: "tool_calls"},
+		{Message: llm.AssistantMessage(nil, []llm.ToolCall{glob("call_3"), glob("call_4")}), FinishReason: "tool_calls"},
+		{Message: llm.TextMessage("assistant", "partial findings"), FinishReason: "stop"},
+	}
+
+	tests := []struct {
+		name       string
+		configured int // SetExploreLimits tool-call budget
+		requested  tools.ExploreLimits
+		wantCalls  int32
+		wantResult string
+	}{
+		// 2 calls run, then 1 of the next 2; the summary is the third request
+		{"configured budget", 3, tools.ExploreLimits{}, 3, "Exploration stopped at the tool-call budget"},
+		{"requested budget", 0, tools.ExploreLimits{MaxToolCalls: 2}, 2, "Exploration stopped at the tool-call budget"},
+		{"requested depth", 0, tools.ExploreLimits{MaxIterations: 1}, 2, "Exploration stopped at the iteration limit"},
+		{"no budget", 0, tools.ExploreLimits{}, 3, "partial findings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockLLMClient{responses: responses}
+			dir := t.TempDir()
+			ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+			ag.SetExploreLimits(0, tt.configured)
+
+			result, err := ag.runExplore(context.Background(), "explore", "", nil, tt.requested)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mock.callCount != tt.wantCalls {
+				t.Errorf("expected %d LLM calls, got %d", tt.wantCalls, mock.callCount)
+			}
+			if !strings.HasPrefix(result, tt.wantResult) {
+				t.Errorf("expected result starting %q, got %q", tt.wantResult, result)
+			}
+			if tt.wantResult == "partial findings" {
+				return
+			}
+			// The summary request follows an answer for every call made
+			last := mock.lastMessages[len(mock.lastMessages)-1]
+			if last.Role != "user" || !strings.Contains(last.ContentString(), "Summarize your findings") {
+				t.Errorf("expected a summary request last, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestContextUsageTokenCache(t *testing.T) {
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.TextMessage("assistant", "compacted summary"), FinishReason: "stop"},
+		},
+	}
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	term := ui.NewTerminal()
+
+	check := func(step string) {
+		t.Helper()
+		s := ag.ContextUsage()
+		if got, want := s.SystemTokens+s.MessageTokens, EstimateTotalTokens(ag.messages); got != want {
+			t.Errorf("%s: cached total %d != recomputed %d", step, got, want)
+		}
+		if len(ag.tokenCache) != len(ag.messages) {
+			t.Errorf("%s: cache has %d entries for %d messages", step, len(ag.tokenCache), len(ag.messages))
+		}
+	}
+
+	check("initial")
+
+	for i := 0; i < 3; i++ {
+		ag.CreateCheckpoint(fmt.Sprintf("turn %d", i))
+		ag.messages = append(ag.messages,
+			llm.TextMessage("user", strings.Repeat("question ", 10*(i+1))),
+			llm.TextMessage("assistant", strings.Repeat("answer ", 20*(i+1))))
+		check(fmt.Sprintf("append %d", i))
+	}
+
+	// Rewind truncates, then new messages land at the old indices
+	ag.RewindConversation(2)
+	check("rewind")
+	ag.messages = append(ag.messages,
+		llm.TextMessage("user", "a much longer replacement question than before"),
+		llm.TextMessage("assistant", "x"))
+	check("append after rewind")
+
+	ag.SetName("Ace")
+	check("rename")
+
+	if err := ag.Compact(context.Background(), term); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	check("compact")
+
+	ag.Clear(term)
+	check("clear")
+}
+
+func TestClearKeep(t *testing.T) {
+	// buildTurns adds n turns; odd turns include a tool call and its result.
+	buildTurns := func(ag *Agent, n int) {
+		for i := 1; i <= n; i++ {
+			ag.CreateCheckpoint(fmt.Sprintf("turn %d", i))
+			ag.messages = append(ag.messages, llm.TextMessage("user", fmt.Sprintf("turn %d", i)))
+			if i%2 == 1 {
+				ag.messages = append(ag.messages,
+					llm.AssistantMessage(nil, []llm.ToolCall{{ID: fmt.Sprintf("call_%d", i), Type: "function",
+						Function: llm.FunctionCall{Name: "ls", Arguments: "{}"}}}),
+					llm.ToolResultMessage(fmt.Sprintf("call_%d", i), "file.go"))
+			}
+			ag.messages = append(ag.messages, llm.TextMessage("assistant", fmt.Sprintf("reply %d", i)))
+		}
+	}
+
+	tests := []struct {
+		name      string
+		turns     int
+		keep      int
+		wantMsgs  int
+		wantTurns int
+	}{
+		// system + turn 4 (2 msgs) + turn 5 (4 msgs)
+		{"keep two of five", 5, 2, 7, 2},
+		// system + turn 5
+		{"keep one of five", 5, 1, 5, 1},
+		// nothing to drop: all messages remain
+		{"keep more than exist", 4, 6, 13, 4},
+		{"keep all", 3, 3, 11, 3},
+		{"keep zero clears", 3, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ag, _ := newTestAgent(t)
+			buildTurns(ag, tt.turns)
+
+			ag.ClearKeep(tt.keep, ui.NewTerminal())
+
+			if ag.MessageCount() != tt.wantMsgs {
+				t.Fatalf("expected %d messages, got %d", tt.wantMsgs, ag.MessageCount())
+			}
+			if ag.messages[0].Role != "system" {
+				t.Errorf("expected system prompt first, got %s", ag.messages[0].Role)
+			}
+			if len(ag.messages) > 1 && !isTurnStart(ag.messages[1]) {
+				t.Errorf("expected a user message after the system prompt, got %s", ag.messages[1].Role)
+			}
+
+			// Every tool result must follow the assistant message that called it
+			pending := map[string]bool{}
+			for _, m := range ag.messages {
+				for _, tc := range m.ToolCalls {
+					pending[tc.ID] = true
+				}
+				if m.ToolCallID != "" {
+					if !pending[m.ToolCallID] {
+						t.Errorf("orphaned tool result %s", m.ToolCallID)
+					}
+					delete(pending, m.ToolCallID)
+				}
+			}
+			if len(pending) != 0 {
+				t.Errorf("tool calls without results: %v", pending)
+			}
+
+			// Checkpoints are renumbered and point at the kept turns
+			if len(ag.checkpoints) != tt.wantTurns {
+				t.Fatalf("expected %d checkpoints, got %d", tt.wantTurns, len(ag.checkpoints))
+			}
+			for i, cp := range ag.checkpoints {
+				if cp.Turn != i+1 {
+					t.Errorf("checkpoint %d: expected turn %d, got %d", i, i+1, cp.Turn)
+				}
+				if msg := ag.messages[cp.MsgIndex]; msg.ContentString() != cp.Preview {
+					t.Errorf("checkpoint %d points at %q, want %q", i, msg.ContentString(), cp.Preview)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoApproveEdits(t *testing.T) {
+	writeArgs, _ := json.Marshal(map[string]string{"path": "out.txt", "content": "hi"})
+	bashArgs, _ := json.Marshal(map[string]string{"command": "echo ok"})
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{
+					{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "write", Arguments: string(writeArgs)}},
+					{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "bash", Arguments: string(bashArgs)}},
+				}),
+				FinishReason: "tool_calls",
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetAutoApproveEdits(true)
+	term := &confirmUI{Terminal: ui.NewTerminal(), answer: false}
+
+	if err := ag.Run(context.Background(), "write and run", term); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "hi" {
+		t.Errorf("expected write to be applied without confirmation, got %q, %v", data, err)
+	}
+	if len(term.prompts) != 1 || !strings.Contains(term.prompts[0], "bash") {
+		t.Errorf("expected only bash to prompt, got %v", term.prompts)
+	}
+}
+
+func TestBinaryWriteAlwaysConfirms(t *testing.T) {
+	writeArgs, _ := json.Marshal(map[string]string{"path": "out.bin", "content": "MZ\x00\x00"})
+	mock := &mockLLMClient{responses: []llm.Response{{
+		Message: llm.AssistantMessage(nil, []llm.ToolCall{
+			{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "write", Arguments: string(writeArgs)}},
+		}),
+		FinishReason: "tool_calls",
+	}}}
+
+	dir := t.TempDir()
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetAutoApproveEdits(true)
+	term := &confirmUI{Terminal: ui.NewTerminal(), answer: false}
+	captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "write it", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	if len(term.prompts) != 1 {
+		t.Errorf("expected the write to be confirmed despite auto-approve, got %v", term.prompts)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.bin")); !os.IsNotExist(err) {
+		t.Error("expected the denied write not to create the file")
+	}
+	for _, m := range ag.messages {
+		if m.ToolCallID == "call_1" && !strings.Contains(m.ContentString(), "null bytes") {
+			t.Errorf("expected the model told about the warning, got %q", m.ContentString())
+		}
+	}
+}
+
+func TestFormatAfterEdit(t *testing.T) {
+	const upcase = `*.go=sh -c 'tr a-z A-Z < "$0" > "$0.tmp" && mv "$0.tmp" "$0"'`
+	run := func(t *testing.T, trust bool) (*Agent, *confirmUI, string) {
+		t.Helper()
+		editArgs, _ := json.Marshal(map[string]string{"path": "main.go", "old_str": "old", "new_str": "new"})
+		writeArgs, _ := json.Marshal(map[string]string{"path": "notes.txt", "content": "plain"})
+		mock := &mockLLMClient{responses: []llm.Response{{
+			Message: llm.AssistantMessage(nil, []llm.ToolCall{
+				{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "edit", Arguments: string(editArgs)}},
+				{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "write", Arguments: string(writeArgs)}},
+			}),
+			FinishReason: "tool_calls",
+		}}}
+
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "main.go"), []byte("package old\n"), 0644)
+		registry := tools.NewRegistry(dir)
+		if err := registry.SetFormatters([]string{upcase}); err != nil {
+			t.Fatal(err)
+		}
+		ag := New(mock, registry, dir, 128000)
+		ag.SetAutoApproveEdits(true)
+		ag.SetTrustFormatters(trust)
+		term := &confirmUI{Terminal: ui.NewTerminal(), answer: false}
+		if err := ag.Run(context.Background(), "edit", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+		return ag, term, string(data)
+	}
+	toolOutput := func(ag *Agent, id string) string {
+		for _, m := range ag.messages {
+			if m.ToolCallID == id {
+				return m.ContentString()
+			}
+		}
+		return ""
+	}
+
+	t.Run("trusted", func(t *testing.T) {
+		ag, term, content := run(t, true)
+		if content != "PACKAGE NEW\n" {
+			t.Errorf("expected the edited file to be formatted, got %q", content)
+		}
+		if len(term.prompts) != 0 {
+			t.Errorf("trusted formatter should not prompt, got %v", term.prompts)
+		}
+		if out := toolOutput(ag, "call_1"); !strings.Contains(out, "Formatted with: sh -c") || !strings.Contains(out, "main.go") {
+			t.Errorf("edit result should report the formatter run, got %q", out)
+		}
+		if out := toolOutput(ag, "call_2"); strings.Contains(out, "Formatted") {
+			t.Errorf("unmatched file should not be formatted, got %q", out)
+		}
+	})
+
+	t.Run("untrusted and declined", func(t *testing.T) {
+		ag, term, content := run(t, false)
+		if content != "package new\n" {
+			t.Errorf("declined formatter should leave the edit as is, got %q", content)
+		}
+		if len(term.prompts) != 1 || !strings.Contains(term.prompts[0], "Run formatter") {
+			t.Errorf("expected one formatter prompt, got %v", term.prompts)
+		}
+		if out := toolOutput(ag, "call_1"); !strings.Contains(out, "declined to run the formatter") {
+			t.Errorf("edit result should say the formatter was declined, got %q", out)
+		}
+	})
+}
+
+// recordUI is a terminal that records tool calls and results in the order
+// they are printed.
+type recordUI struct {
+	*ui.Terminal
+	log []string
+}
+
+func (r *recordUI) PrintToolCall(name, args string) {
+	r.log = append(r.log, "call "+name+" "+args)
+}
+
+func (r *recordUI) PrintToolResult(result string) {
+	r.log = append(r.log, "result "+result)
+}
+
+func TestParallelBatchInvalidJSON(t *testing.T) {
+	call := func(id, name, args string) llm.ToolCall {
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: name, Arguments: args}}
+	}
+	mock := &mockLLMClient{responses: []llm.Response{{
+		Message: llm.AssistantMessage(nil, []llm.ToolCall{
+			call("call_1", "glob", `{"pattern": "*.go"}`),
+			call("call_2", "read", `{"path": "main.go"`),
+			call("call_3", "read", `{"path": "main.go"}`),
+			call("call_4", "grep", `not json`),
+		}),
+		FinishReason: "tool_calls",
+	}}}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	term := &recordUI{Terminal: ui.NewTerminal()}
+
+	results := ag.executeToolCalls(context.Background(), mock.responses[0].Message.ToolCalls, term, noopInterrupter{})
+
+	want := []struct{ id, output string }{
+		{"call_1", "main.go"},
+		{"call_2", `Error: invalid JSON in tool arguments: {"path": "main.go"`},
+		{"call_3", "package main"},
+		{"call_4", "Error: invalid JSON in tool arguments: not json"},
+	}
+	for i, w := range want {
+		if results[i].id != w.id || !strings.Contains(results[i].output, w.output) {
+			t.Errorf("result %d = %s %q, want %s containing %q", i, results[i].id, results[i].output, w.id, w.output)
+		}
+	}
+
+	// Each call is printed right before its own result, as in the sequential path
+	wantLog := []string{
+		"call glob", "result main.go",
+		"call read invalid JSON", "result Error: invalid JSON",
+		"call read {", "result    1 │ package main",
+		"call grep invalid JSON", "result Error: invalid JSON",
+	}
+	if len(term.log) != len(wantLog) {
+		t.Fatalf("printed %d lines, want %d: %q", len(term.log), len(wantLog), term.log)
+	}
+	for i, prefix := range wantLog {
+		if !strings.HasPrefix(term.log[i], prefix) {
+			t.Errorf("printed line %d = %q, want prefix %q", i, term.log[i], prefix)
+		}
+	}
+}
+
+func TestSafeCommandsAutoRun(t *testing.T) {
+	bash := func(id, command string) llm.ToolCall {
+		args, _ := json.Marshal(map[string]string{"command": command})
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: "bash", Arguments: string(args)}}
+	}
+	toolOutputs := func(ag *Agent) map[string]string {
+		out := make(map[string]string)
+		for _, m := range ag.messages {
+			if m.ToolCallID != "" {
+				out[m.ToolCallID] = m.ContentString()
+			}
+		}
+		return out
+	}
+
+	t.Run("listed runs, unlisted confirms", func(t *testing.T) {
+		mock := &mockLLMClient{responses: []llm.Response{{
+			Message: llm.AssistantMessage(nil, []llm.ToolCall{
+				bash("call_1", "echo listed"),
+				bash("call_2", "echo chained; touch chained.txt"),
+				bash("call_3", "touch unlisted.txt"),
+			}),
+			FinishReason: "tool_calls",
+		}}}
+		dir := t.TempDir()
+		registry := tools.NewRegistry(dir)
+		if err := registry.SetSafeCommands([]string{"echo"}); err != nil {
+			t.Fatal(err)
+		}
+		ag := New(mock, registry, dir, 128000)
+		term := &confirmUI{Terminal: ui.NewTerminal(), answer: false}
+
+		if err := ag.Run(context.Background(), "run things", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(term.prompts) != 2 || !strings.Contains(term.prompts[0], "echo chained") || !strings.Contains(term.prompts[1], "touch unlisted.txt") {
+			t.Errorf("expected only the chained and unlisted commands to confirm, got %v", term.prompts)
+		}
+		out := toolOutputs(ag)
+		if !strings.Contains(out["call_1"], "listed") {
+			t.Errorf("expected allowlisted command to run, got %q", out["call_1"])
+		}
+		for _, id := range []string{"call_2", "call_3"} {
+			if out[id] != "User denied the operation." {
+				t.Errorf("%s: expected denial, got %q", id, out[id])
+			}
+		}
+	})
+
+	t.Run("listed commands run in parallel with read-only tools", func(t *testing.T) {
+		globArgs, _ := json.Marshal(map[string]string{"pattern": "*.txt"})
+		mock := &mockLLMClient{responses: []llm.Response{{
+			Message: llm.AssistantMessage(nil, []llm.ToolCall{
+				bash("call_1", "echo one"),
+				{ID: "call_2", Type: "function", Function: llm.FunctionCall{Name: "glob", Arguments: string(globArgs)}},
+				bash("call_3", "echo two"),
+			}),
+			FinishReason: "tool_calls",
+		}}}
+		dir := t.TempDir()
+		registry := tools.NewRegistry(dir)
+		if err := registry.SetSafeCommands([]string{"re:echo (one|two)"}); err != nil {
+			t.Fatal(err)
+		}
+		if !registry.IsReadOnlyCall("bash", json.RawMessage(mock.responses[0].Message.ToolCalls[0].Function.Arguments)) {
+			t.Fatal("expected allowlisted bash call to be read-only")
+		}
+		ag := New(mock, registry, dir, 128000)
+		term := &confirmUI{Terminal: ui.NewTerminal(), answer: false}
+
+		if err := ag.Run(context.Background(), "run things", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(term.prompts) != 0 {
+			t.Errorf("expected no confirmations, got %v", term.prompts)
+		}
+		out := toolOutputs(ag)
+		if !strings.Contains(out["call_1"], "one") || !strings.Contains(out["call_3"], "two") {
+			t.Errorf("expected both commands to run, got %q and %q", out["call_1"], out["call_3"])
+		}
+	})
+}
+
+func TestSameFileEditsBatched(t *testing.T) {
+	edit := func(id, oldStr, newStr string) llm.ToolCall {
+		args, _ := json.Marshal(map[string]string{"path": "main.go", "old_str": oldStr, "new_str": newStr})
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: "edit", Arguments: string(args)}}
+	}
+	mock := &mockLLMClient{responses: []llm.Response{{
+		Message: llm.AssistantMessage(nil, []llm.ToolCall{
+			edit("call_1", "func a() {\n\treturn 1\n}", "func a() {\n\treturn 10\n}"),
+			edit("call_2", "func b() {\n\treturn 2\n}", "func b() {\n\treturn 20\n}"),
+			// Written against the original file, but call_1 changed "return 1"
+			edit("call_3", "\treturn 1\n}\n\nfunc b", "\treturn 1\n}\n\n// b doubles\nfunc b"),
+		}),
+		FinishReason: "tool_calls",
+	}}}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	os.WriteFile(path, []byte("func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n"), 0644)
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	term := &confirmUI{Terminal: ui.NewTerminal(), answer: true}
+
+	if err := ag.Run(context.Background(), "edit twice", term); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(term.prompts) != 1 {
+		t.Errorf("expected one confirmation for the batch, got %v", term.prompts)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "func a() {\n\treturn 10\n}\n\nfunc b() {\n\treturn 20\n}\n"; string(data) != want {
+		t.Errorf("unexpected content:\n%s", data)
+	}
+
+	out := make(map[string]string)
+	for _, m := range ag.messages {
+		if m.ToolCallID != "" {
+			out[m.ToolCallID] = m.ContentString()
+		}
+	}
+	for _, id := range []string{"call_1", "call_2"} {
+		if !strings.HasPrefix(out[id], "Successfully edited") {
+			t.Errorf("%s: expected success, got %q", id, out[id])
+		}
+	}
+	if !strings.Contains(out["call_3"], "overlaps an earlier edit") {
+		t.Errorf("call_3: expected overlap error, got %q", out["call_3"])
+	}
+}
+
+// scriptedUI answers confirmations from answers in order, denying once they
+// run out.
+type scriptedUI struct {
+	*ui.Terminal
+	answers []bool
+	prompts []string
+}
+
+func (s *scriptedUI) ConfirmAction(prompt string) bool {
+	s.prompts = append(s.prompts, prompt)
+	if len(s.answers) == 0 {
+		return false
+	}
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	return answer
+}
+
+func TestReviewChanges(t *testing.T) {
+	call := func(id, name string, args map[string]string) llm.ToolCall {
+		data, _ := json.Marshal(args)
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: name, Arguments: string(data)}}
+	}
+	turn := func() *mockLLMClient {
+		return &mockLLMClient{responses: []llm.Response{
+			{
+				Message:      llm.AssistantMessage(nil, []llm.ToolCall{call("call_1", "edit", map[string]string{"path": "main.go", "old_str": "return 1", "new_str": "return 10"})}),
+				FinishReason: "tool_calls",
+			},
+			{
+				// Builds on the staged edit, which is not on disk yet
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{
+					call("call_2", "edit", map[string]string{"path": "main.go", "old_str": "return 10", "new_str": "return 100"}),
+					call("call_3", "write", map[string]string{"path": "new.txt", "content": "new\n"}),
+					call("call_4", "bash", map[string]string{"command": "touch ran.txt"}),
+				}),
+				FinishReason: "tool_calls",
+			},
+		}}
+	}
+	setup := func(t *testing.T, answers ...bool) (*Agent, *scriptedUI, string) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "main.go"), []byte("func a() int {\n\treturn 1\n}\n"), 0644)
+		ag := New(turn(), tools.NewRegistry(dir), dir, 128000)
+		ag.SetReviewChanges(true)
+		term := &scriptedUI{Terminal: ui.NewTerminal(), answers: answers}
+		if err := ag.Run(context.Background(), "change things", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return ag, term, dir
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	t.Run("approve all", func(t *testing.T) {
+		ag, term, dir := setup(t, true)
+
+		if len(term.prompts) != 1 || term.prompts[0] != "Apply all 3 staged change(s)?" {
+			t.Errorf("expected a single review prompt, got %q", term.prompts)
+		}
+		for _, m := range ag.messages {
+			if m.ToolCallID != "" && !strings.HasPrefix(m.ContentString(), "Staged for review") {
+				t.Errorf("%s: expected the change staged, got %q", m.ToolCallID, m.ContentString())
+			}
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); !strings.Contains(string(data), "return 100") {
+			t.Errorf("expected both edits applied, got:\n%s", data)
+		}
+		if !exists(filepath.Join(dir, "new.txt")) || !exists(filepath.Join(dir, "ran.txt")) {
+			t.Error("expected the write and the command applied")
+		}
+
+		ag.Run(context.Background(), "thanks", term)
+		msg := ag.messages[len(ag.messages)-2].ContentString()
+		if !strings.HasPrefix(msg, "Result of the review") || !strings.Contains(msg, "bash touch ran.txt: approved") || !strings.HasSuffix(msg, "thanks") {
+			t.Errorf("expected the review outcome sent with the next message, got %q", msg)
+		}
+	})
+
+	t.Run("one by one", func(t *testing.T) {
+		// Not all; one by one; main.go yes, new.txt no, command no
+		ag, term, dir := setup(t, false, true, true, false, false)
+
+		if len(term.prompts) != 5 {
+			t.Errorf("expected a prompt per change, got %q", term.prompts)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); !strings.Contains(string(data), "return 100") {
+			t.Errorf("expected main.go applied, got:\n%s", data)
+		}
+		if exists(filepath.Join(dir, "new.txt")) || exists(filepath.Join(dir, "ran.txt")) {
+			t.Error("rejected changes were applied")
+		}
+		if !strings.Contains(ag.reviewNote, "new.txt: rejected by the user") {
+			t.Errorf("expected the rejection noted, got %q", ag.reviewNote)
+		}
+	})
+
+	t.Run("reject all", func(t *testing.T) {
+		_, _, dir := setup(t, false, false)
+		if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); strings.Contains(string(data), "return 10") {
+			t.Errorf("expected main.go untouched, got:\n%s", data)
+		}
+		if exists(filepath.Join(dir, "new.txt")) || exists(filepath.Join(dir, "ran.txt")) {
+			t.Error("rejected changes were applied")
+		}
+	})
+}
+
+// tooLargeClient fails the first failures streamed requests with
+// ErrRequestTooLarge, then behaves like the embedded mock.
+type tooLargeClient struct {
+	*mockLLMClient
+	failures int
+}
+
+func (c *tooLargeClient) StreamMessage(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (<-chan llm.StreamEvent, error) {
+	if c.failures > 0 {
+		c.failures--
+		return nil, &llm.RequestTooLargeError{Size: 2 << 20, Limit: 1 << 20}
+	}
+	return c.mockLLMClient.StreamMessage(ctx, messages, toolDefs)
+}
+
+func TestRequestTooLargeCompacts(t *testing.T) {
+	newAgent := func(failures int) *Agent {
+		client := &tooLargeClient{mockLLMClient: &mockLLMClient{}, failures: failures}
+		ag := New(client, tools.NewRegistry(t.TempDir()), t.TempDir(), 128000)
+		ag.messages = append(ag.messages,
+			llm.TextMessage("user", "read the logs"),
+			llm.TextMessage("assistant", strings.Repeat("log line\n", 100)))
+		return ag
+	}
+
+	ag := newAgent(1)
+	if err := ag.Run(context.Background(), "summarize", ui.NewTerminal()); err != nil {
+		t.Fatalf("expected the turn to succeed after compaction, got %v", err)
+	}
+	if len(ag.messages) != 4 || !strings.Contains(ag.messages[1].ContentString(), "[Conversation compacted]") {
+		t.Errorf("expected compacted history, got %d messages", len(ag.messages))
+	}
+
+	// Still too large after compacting: the error surfaces instead of looping
+	ag = newAgent(2)
+	if err := ag.Run(context.Background(), "summarize", ui.NewTerminal()); !errors.Is(err, llm.ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, got %v", err)
+	}
+}
+
+func TestDebugLogEntries(t *testing.T) {
+	globArgs, _ := json.Marshal(map[string]string{"pattern": "*.go"})
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+					ID:       "call_1",
+					Type:     "function",
+					Function: llm.FunctionCall{Name: "glob", Arguments: string(globArgs)},
+				}}),
+				FinishReason: "tool_calls",
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "debug.log")
+	l, err := debuglog.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	ag.SetDebugLog(l)
+
+	if err := ag.Run(context.Background(), "find go files", ui.NewTerminal()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Close()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		" request iteration=0",
+		" response finish_reason=",
+		` tool_call name="glob"`,
+		" request iteration=1",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in debug log:\n%s", want, data)
+		}
+	}
+}
+
+// expandUI is a confirmUI that also confirms from a summary, recording the
+// prompts and showing the details when expand is set.
+type expandUI struct {
+	confirmUI
+	expand        bool
+	expandPrompts []string
+}
+
+func (e *expandUI) ConfirmExpandable(prompt string, details func()) bool {
+	e.expandPrompts = append(e.expandPrompts, prompt)
+	if e.expand {
+		details()
+	}
+	return e.answer
+}
+
+func TestCompactConfirm(t *testing.T) {
+	edit := func() *tools.NeedsConfirmation {
+		return &tools.NeedsConfirmation{
+			Tool:       "edit",
+			Path:       "main.go",
+			Preview:    "package main\nvar a = 1\n",
+			NewContent: "package main\nvar b = 2\nvar c = 3\n",
+			Execute:    func() (string, error) { return "edited", nil },
+		}
+	}
+	bash := &tools.NeedsConfirmation{Tool: "bash", Path: "make test", Execute: func() (string, error) { return "ok", nil }}
+
+	tests := []struct {
+		name       string
+		compact    bool
+		expand     bool
+		confirm    *tools.NeedsConfirmation
+		wantDiff   bool
+		wantPrompt string // expected prompt, of ConfirmExpandable when compact applies
+		expandable bool
+	}{
+		{"verbose edit", false, false, edit(), true, "Apply edit to main.go?", false},
+		{"compact edit", true, false, edit(), false, "Apply edit to main.go (+2 -1 lines)?", true},
+		{"compact edit expanded", true, true, edit(), true, "Apply edit to main.go (+2 -1 lines)?", true},
+		{"compact bash", true, false, bash, false, "Apply bash to make test?", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ag := New(&mockLLMClient{}, tools.NewRegistry(dir), dir, 128000)
+			ag.SetCompactConfirm(tt.compact)
+			term := &expandUI{confirmUI: confirmUI{Terminal: ui.NewTerminal(), answer: true}, expand: tt.expand}
+
+			var result string
+			out := captureStdout(t, func() {
+				result = ag.handleConfirmation(tt.confirm, term, noopInterrupter{})
+			})
+
+			if result == "User denied the operation." {
+				t.Errorf("expected approval, got %q", result)
+			}
+			if got := strings.Contains(out, "--- main.go"); got != tt.wantDiff {
+				t.Errorf("diff shown = %v, want %v; output:\n%s", got, tt.wantDiff, out)
+			}
+			prompts := term.prompts
+			if tt.expandable {
+				prompts = term.expandPrompts
+				if len(term.prompts) != 0 {
+					t.Errorf("compact confirmation should not use ConfirmAction, got %v", term.prompts)
+				}
+			}
+			if len(prompts) != 1 || prompts[0] != tt.wantPrompt {
+				t.Errorf("prompts = %v, want [%s]", prompts, tt.wantPrompt)
+			}
+		})
+	}
+}
+
+func TestChangeSummary(t *testing.T) {
+	tests := []struct {
+		confirm *tools.NeedsConfirmation
+		want    string
+	}{
+		{&tools.NeedsConfirmation{Tool: "write", NewContent: "a\nb\nc\n"}, "new file, 3 lines"},
+		{&tools.NeedsConfirmation{Tool: "write", Preview: "a\nb\n", NewContent: "a\nc\n"}, "+1 -1 lines"},
+		{&tools.NeedsConfirmation{Tool: "edit", Preview: "a\nb\nc\n", NewContent: "a\nc\n"}, "+0 -1 lines"},
+		{&tools.NeedsConfirmation{Tool: "rename", Changes: []tools.FileChange{
+			{Old: "foo()\n", New: "bar()\n"},
+			{Old: "x\nfoo\n", New: "x\nbar\n"},
+		}}, "2 files, +2 -2 lines"},
+		{&tools.NeedsConfirmation{Tool: "bash", Path: "ls"}, ""},
+		{&tools.NeedsConfirmation{Tool: "git_commit", Preview: "diff"}, ""},
+	}
+	for _, tt := range tests {
+		if got := changeSummary(tt.confirm); got != tt.want {
+			t.Errorf("changeSummary(%s) = %q, want %q", tt.confirm.Tool, got, tt.want)
+		}
+	}
+}
+
+func TestSystemPromptGitInfo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	plain := t.TempDir()
+	if prompt := New(&mockLLMClient{}, tools.NewRegistry(plain), plain, 100000).systemPrompt(); strings.Contains(prompt, "Git repository") {
+		t.Error("expected no git line outside a repository")
+	}
+
+	dir := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("one\n"), 0644)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/main"},
+		{"add", "."},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	mock := &mockLLMClient{
+		responses: []llm.Response{
+			{Message: llm.TextMessage("assistant", "Done."), FinishReason: "stop"},
+		},
+	}
+	ag := New(mock, tools.NewRegistry(dir), dir, 100000)
+	if prompt := ag.messages[0].ContentString(); !strings.Contains(prompt, "(branch main, clean)") {
+		t.Errorf("expected a clean main branch in the prompt, got:\n%s", prompt)
+	}
+
+	// The next turn picks up the change
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("two\n"), 0644)
+	if err := ag.Run(context.Background(), "hi", ui.NewTerminal()); err != nil {
+		t.Fatal(err)
+	}
+	if prompt := ag.messages[0].ContentString(); !strings.Contains(prompt, "(branch main, uncommitted changes)") {
+		t.Errorf("expected uncommitted changes in the prompt, got:\n%s", prompt)
+	}
+}
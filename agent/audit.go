@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// SetAuditLog makes the agent append, for every write, edit, rename, and
+// bash call it runs, an equivalent shell command to the file at path, so
+// the log can be reviewed or replayed from the working directory. redact
+// (if not nil) is applied to each entry. An empty path turns it off.
+func (a *Agent) SetAuditLog(path string, redact func(string) string) error {
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+	if a.audit != nil {
+		a.audit.Close()
+		a.audit = nil
+	}
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	if _, err := fmt.Fprintf(f, "# Pilot session started %s\ncd %s\n\n", time.Now().Format(time.RFC3339), shellQuote(a.workDir)); err != nil {
+		f.Close()
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	a.audit, a.auditRedact = f, redact
+	return nil
+}
+
+// auditConfirmed records an approved action in the audit log, if one is
+// set, just before it runs.
+func (a *Agent) auditConfirmed(confirm *tools.NeedsConfirmation) {
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+	if a.audit == nil {
+		return
+	}
+	entry := fmt.Sprintf("# %s %s\n%s\n\n", time.Now().Format(time.RFC3339), confirm.Tool, auditCommand(confirm))
+	if a.auditRedact != nil {
+		entry = a.auditRedact(entry)
+	}
+	if _, err := a.audit.WriteString(entry); err != nil {
+		a.debug.Log("error", "stage", "audit log", "err", err)
+	}
+}
+
+// closeAuditLog closes the audit log, if one is open.
+func (a *Agent) closeAuditLog() {
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+	if a.audit != nil {
+		a.audit.Close()
+		a.audit = nil
+	}
+}
+
+// auditCommand returns a shell command with the same effect as confirm:
+// a bash command verbatim, or a heredoc writing each file's new content.
+func auditCommand(confirm *tools.NeedsConfirmation) string {
+	switch confirm.Tool {
+	case "bash", "git_checkout":
+		return confirm.Preview
+	case "write", "edit":
+		return heredocWrite(confirm.Path, confirm.NewContent)
+	case "rename":
+		writes := make([]string, len(confirm.Changes))
+		for i, c := range confirm.Changes {
+			writes[i] = heredocWrite(c.Path, c.New)
+		}
+		return strings.Join(writes, "\n")
+	default:
+		return fmt.Sprintf("# %s %s has no equivalent command here", confirm.Tool, confirm.Path)
+	}
+}
+
+// heredocWrite returns a command that writes content to path, with a
+// delimiter that no line of content matches. A heredoc always ends with a
+// newline, so a file without one is noted.
+func heredocWrite(path, content string) string {
+	if content == "" {
+		return ": > " + shellQuote(path)
+	}
+	delim := "PILOT_EOF"
+	lines := strings.Split(content, "\n")
+	for n := 1; slices.Contains(lines, delim); n++ {
+		delim = fmt.Sprintf("PILOT_EOF_%d", n)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "cat > %s <<'%s'\n%s", shellQuote(path), delim, content)
+	if strings.HasSuffix(content, "\n") {
+		b.WriteString(delim)
+	} else {
+		b.WriteString("\n" + delim + "\n# (the file has no newline at the end)")
+	}
+	return b.String()
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
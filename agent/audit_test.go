@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+	"github.com/lowkaihon/cli-coding-agent/tools"
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+func TestAuditLog(t *testing.T) {
+	call := func(id, name string, args map[string]string) llm.ToolCall {
+		data, _ := json.Marshal(args)
+		return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: name, Arguments: string(data)}}
+	}
+	mock := &mockLLMClient{responses: []llm.Response{
+		{
+			Message: llm.AssistantMessage(nil, []llm.ToolCall{
+				call("call_1", "write", map[string]string{"path": "notes.txt", "content": "hello\npassword hunter2\n"}),
+				call("call_2", "bash", map[string]string{"command": "echo hi > out.txt"}),
+				call("call_3", "write", map[string]string{"path": "it's.txt", "content": "PILOT_EOF\nno newline"}),
+			}),
+			FinishReason: "tool_calls",
+		},
+		{Message: llm.TextMessage("assistant", "Done."), FinishReason: "stop"},
+	}}
+	dir := t.TempDir()
+	logPath := filepath.Join(t.TempDir(), "audit.sh")
+	ag := New(mock, tools.NewRegistry(dir), dir, 128000)
+	redact := func(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") }
+	if err := ag.SetAuditLog(logPath, redact); err != nil {
+		t.Fatal(err)
+	}
+
+	term := &confirmUI{Terminal: ui.NewTerminal(), answer: true}
+	captureStdout(t, func() {
+		if err := ag.Run(context.Background(), "take notes", term); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	ag.Shutdown()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, want := range []string{
+		"cd '" + dir + "'\n",
+		"write\ncat > 'notes.txt' <<'PILOT_EOF'\nhello\npassword [REDACTED]\nPILOT_EOF\n",
+		"bash\necho hi > out.txt\n",
+		"cat > 'it'\\''s.txt' <<'PILOT_EOF_1'\nPILOT_EOF\nno newline\nPILOT_EOF_1\n# (the file has no newline at the end)\n",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("expected %q in the audit log:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "hunter2") {
+		t.Error("expected the secret redacted")
+	}
+
+	// Replaying the log recreates what the turn did
+	os.Remove(filepath.Join(dir, "notes.txt"))
+	os.Remove(filepath.Join(dir, "out.txt"))
+	if out, err := exec.Command("bash", logPath).CombinedOutput(); err != nil {
+		t.Fatalf("replaying the audit log failed: %v\n%s", err, out)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "out.txt")); string(got) != "hi\n" {
+		t.Errorf("expected out.txt recreated, got %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); !strings.HasPrefix(string(got), "hello\n") {
+		t.Errorf("expected notes.txt recreated, got %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of FileChange.
+const (
+	FileCreated  = "created"
+	FileModified = "modified"
+	FileDeleted  = "deleted"
+)
+
+// FileChange summarizes how one file changed during a turn.
+type FileChange struct {
+	Path    string `json:"path"`    // relative to the working directory when possible
+	Kind    string `json:"kind"`    // FileCreated, FileModified, or FileDeleted
+	Added   int    `json:"added"`   // lines added
+	Removed int    `json:"removed"` // lines removed
+}
+
+// TurnFileChanges compares the files modified this session against their
+// state at the start of the latest turn and returns what changed, sorted by
+// path. It returns nil if there is no checkpoint or nothing changed.
+func (a *Agent) TurnFileChanges() []FileChange {
+	if len(a.checkpoints) == 0 {
+		return nil
+	}
+	cp := a.checkpoints[len(a.checkpoints)-1]
+
+	var changes []FileChange
+	for path, snap := range a.fileOriginals {
+		// Files first touched this turn are not in the checkpoint; their
+		// pre-session snapshot is their state at the start of the turn.
+		before, inCheckpoint := cp.Files[path]
+		existed := before != nil
+		if !inCheckpoint {
+			before, existed = snap.Content, snap.Existed
+		}
+		if change, ok := a.fileChange(path, before, existed); ok {
+			changes = append(changes, change)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// SessionFileChanges compares the files modified this session against
+// their state before the session first changed them and returns what
+// changed, sorted by churn (lines added plus removed), most first, then by
+// path. It returns nil if nothing changed.
+func (a *Agent) SessionFileChanges() []FileChange {
+	var changes []FileChange
+	for path, snap := range a.fileOriginals {
+		if change, ok := a.fileChange(path, snap.Content, snap.Existed); ok {
+			changes = append(changes, change)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		ci, cj := changes[i].Added+changes[i].Removed, changes[j].Added+changes[j].Removed
+		if ci != cj {
+			return ci > cj
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// fileChange compares the file at path on disk with before, its content
+// when it existed, and reports false if they are the same.
+func (a *Agent) fileChange(path string, before []byte, existed bool) (FileChange, bool) {
+	after, err := os.ReadFile(path)
+	exists := err == nil
+
+	change := FileChange{Path: a.displayPath(path)}
+	switch {
+	case !existed && !exists:
+		return change, false
+	case !existed:
+		change.Kind = FileCreated
+		change.Added = countLines(after)
+	case !exists:
+		change.Kind = FileDeleted
+		change.Removed = countLines(before)
+	case bytes.Equal(before, after):
+		return change, false
+	default:
+		change.Kind = FileModified
+		change.Added, change.Removed = lineDelta(string(before), string(after))
+	}
+	return change, true
+}
+
+// displayPath returns path relative to the working directory when it lies
+// inside it.
+func (a *Agent) displayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(a.workDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// countLines returns the number of lines in data, counting a final line
+// without a trailing newline.
+func countLines(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	n := bytes.Count(data, []byte("\n"))
+	if data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// maxLineDeltaCells bounds the LCS table lineDelta builds; past it, the
+// differing regions are counted whole.
+const maxLineDeltaCells = 4 << 20
+
+// lineDelta counts the lines added and removed between two versions: lines
+// outside their longest common subsequence, after trimming the lines they
+// share at the start and end.
+func lineDelta(before, after string) (added, removed int) {
+	oldLines := strings.Split(before, "\n")
+	newLines := strings.Split(after, "\n")
+
+	start := 0
+	for start < len(oldLines) && start < len(newLines) && oldLines[start] == newLines[start] {
+		start++
+	}
+	endOld, endNew := len(oldLines), len(newLines)
+	for endOld > start && endNew > start && oldLines[endOld-1] == newLines[endNew-1] {
+		endOld--
+		endNew--
+	}
+	oldMid, newMid := oldLines[start:endOld], newLines[start:endNew]
+
+	common := 0
+	if len(oldMid)*len(newMid) <= maxLineDeltaCells {
+		common = lcsLength(oldMid, newMid)
+	}
+	return len(newMid) - common, len(oldMid) - common
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/lowkaihon/cli-coding-agent/llm"
+	"github.com/lowkaihon/cli-coding-agent/tools"
 )
 
 // CreateCheckpoint saves a checkpoint before a user turn begins.
@@ -73,6 +74,19 @@ func (a *Agent) captureFileBeforeModification(path string) {
 	}
 }
 
+// captureConfirmedFiles captures every file a confirmed write, edit, or
+// rename is about to modify.
+func (a *Agent) captureConfirmedFiles(confirm *tools.NeedsConfirmation) {
+	switch confirm.Tool {
+	case "write", "edit":
+		a.captureFileBeforeModification(confirm.Path)
+	case "rename":
+		for _, c := range confirm.Changes {
+			a.captureFileBeforeModification(c.Path)
+		}
+	}
+}
+
 // Checkpoints returns a lightweight list of all checkpoints for UI display.
 func (a *Agent) Checkpoints() []CheckpointItem {
 	items := make([]CheckpointItem, len(a.checkpoints))
@@ -117,6 +131,7 @@ func (a *Agent) RewindConversation(turn int) {
 	a.messages = a.messages[:cp.MsgIndex]
 	a.checkpoints = a.checkpoints[:turn-1]
 	a.lastTokensUsed = 0
+	a.invalidateTokenCache()
 }
 
 // RewindCode restores files to their state at the given checkpoint.
@@ -218,6 +233,7 @@ func (a *Agent) SummarizeFrom(ctx context.Context, turn int, term UI) error {
 	// Trim checkpoints to before this turn
 	a.checkpoints = a.checkpoints[:turn-1]
 	a.lastTokensUsed = 0
+	a.invalidateTokenCache()
 	term.PrintWarning("Summarized successfully.")
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/lowkaihon/cli-coding-agent/llm"
@@ -267,3 +268,77 @@ func TestSummarizeFrom(t *testing.T) {
 		t.Error("expected summary message to have content")
 	}
 }
+
+func TestTurnFileChanges(t *testing.T) {
+	ag, dir := newTestAgent(t)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	os.WriteFile(path("a.txt"), []byte("one\ntwo\nthree\n"), 0644)
+	os.WriteFile(path("gone.txt"), []byte("x\ny\nz"), 0644)
+	os.WriteFile(path("same.txt"), []byte("same\n"), 0644)
+
+	if changes := ag.TurnFileChanges(); changes != nil {
+		t.Fatalf("expected no changes before any checkpoint, got %+v", changes)
+	}
+
+	// Turn 1: modify, create, delete, and touch without changing
+	ag.CreateCheckpoint("turn 1")
+	for _, name := range []string{"a.txt", "new.txt", "gone.txt", "same.txt"} {
+		ag.captureFileBeforeModification(path(name))
+	}
+	os.WriteFile(path("a.txt"), []byte("one\nTWO\nthree\nfour\n"), 0644)
+	os.WriteFile(path("new.txt"), []byte("hello\nworld\n"), 0644)
+	os.Remove(path("gone.txt"))
+
+	want := []FileChange{
+		{Path: "a.txt", Kind: FileModified, Added: 2, Removed: 1},
+		{Path: "gone.txt", Kind: FileDeleted, Removed: 3},
+		{Path: "new.txt", Kind: FileCreated, Added: 2},
+	}
+	if got := ag.TurnFileChanges(); !slices.Equal(got, want) {
+		t.Errorf("turn 1:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Turn 2: files are compared with the new checkpoint, not the session start
+	ag.CreateCheckpoint("turn 2")
+	if changes := ag.TurnFileChanges(); changes != nil {
+		t.Errorf("expected no changes at start of turn 2, got %+v", changes)
+	}
+	os.WriteFile(path("new.txt"), []byte("hello\nworld\nagain\n"), 0644)
+	want = []FileChange{{Path: "new.txt", Kind: FileModified, Added: 1}}
+	if got := ag.TurnFileChanges(); !slices.Equal(got, want) {
+		t.Errorf("turn 2:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestSessionFileChanges(t *testing.T) {
+	ag, dir := newTestAgent(t)
+	path := func(name string) string { return filepath.Join(dir, name) }
+	os.WriteFile(path("a.txt"), []byte("one\ntwo\nthree\n"), 0644)
+	os.WriteFile(path("gone.txt"), []byte("x\ny\nz\nw\n"), 0644)
+	os.WriteFile(path("same.txt"), []byte("same\n"), 0644)
+
+	if changes := ag.SessionFileChanges(); changes != nil {
+		t.Fatalf("expected no changes before any edit, got %+v", changes)
+	}
+
+	ag.CreateCheckpoint("turn 1")
+	for _, name := range []string{"a.txt", "new.txt", "gone.txt", "same.txt"} {
+		ag.captureFileBeforeModification(path(name))
+	}
+	os.WriteFile(path("a.txt"), []byte("one\nTWO\nthree\n"), 0644)
+	os.WriteFile(path("new.txt"), []byte("hello\n"), 0644)
+	os.Remove(path("gone.txt"))
+
+	// Turn 2 changes are measured from the session start, not the turn
+	ag.CreateCheckpoint("turn 2")
+	os.WriteFile(path("new.txt"), []byte("hello\nworld\n"), 0644)
+
+	want := []FileChange{
+		{Path: "gone.txt", Kind: FileDeleted, Removed: 4},
+		{Path: "a.txt", Kind: FileModified, Added: 1, Removed: 1},
+		{Path: "new.txt", Kind: FileCreated, Added: 2},
+	}
+	if got := ag.SessionFileChanges(); !slices.Equal(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// SetCompactConfirm selects the compact confirmation style: a file change is
+// confirmed from a one-line summary of its size instead of its full diff,
+// which the user can still ask to see. Commands always show in full.
+func (a *Agent) SetCompactConfirm(compact bool) {
+	a.compactConfirm = compact
+}
+
+// expandableConfirmer is implemented by UIs that can confirm from a summary
+// and show the details on request, such as *ui.Terminal.
+type expandableConfirmer interface {
+	ConfirmExpandable(prompt string, details func()) bool
+}
+
+// confirmExpandable asks prompt with details available on request, or shows
+// the details first if term cannot expand them.
+func confirmExpandable(term UI, prompt string, details func()) bool {
+	if ec, ok := term.(expandableConfirmer); ok {
+		return ec.ConfirmExpandable(prompt, details)
+	}
+	details()
+	return term.ConfirmAction(prompt)
+}
+
+// changeSummary describes the size of the file change confirm makes, such
+// as "+12 -3 lines", for the compact confirmation style. It returns "" for
+// tools that do not change files, which are always confirmed in full.
+func changeSummary(confirm *tools.NeedsConfirmation) string {
+	switch confirm.Tool {
+	case "write", "edit":
+		if confirm.Tool == "write" && confirm.Preview == "" {
+			return fmt.Sprintf("new file, %d lines", countLines([]byte(confirm.NewContent)))
+		}
+		added, removed := lineDelta(confirm.Preview, confirm.NewContent)
+		return fmt.Sprintf("+%d -%d lines", added, removed)
+	case "rename":
+		added, removed := 0, 0
+		for _, c := range confirm.Changes {
+			a, r := lineDelta(c.Old, c.New)
+			added += a
+			removed += r
+		}
+		return fmt.Sprintf("%d files, +%d -%d lines", len(confirm.Changes), added, removed)
+	}
+	return ""
+}
@@ -54,6 +54,80 @@ func EstimateTotalTokens(messages []llm.Message) int {
 	return total
 }
 
+// tokenEstimate is a cached EstimateTokens result. content identifies the
+// message it was computed for, so a replaced message is detected.
+type tokenEstimate struct {
+	content *string
+	tokens  int
+}
+
+// messageTokens returns per-message token estimates for a.messages. History
+// is append-only between mutations, so only messages added since the last
+// call are estimated; callers that replace or truncate history must call
+// invalidateTokenCache.
+func (a *Agent) messageTokens() []tokenEstimate {
+	n := len(a.tokenCache)
+	if n > len(a.messages) || (n > 0 && a.tokenCache[n-1].content != a.messages[n-1].Content) {
+		a.tokenCache = nil
+	}
+	for i := len(a.tokenCache); i < len(a.messages); i++ {
+		a.tokenCache = append(a.tokenCache, tokenEstimate{
+			content: a.messages[i].Content,
+			tokens:  EstimateTokens(a.messages[i]),
+		})
+	}
+	return a.tokenCache
+}
+
+// estimatedMessageTokens returns the cached estimate for all messages.
+func (a *Agent) estimatedMessageTokens() int {
+	total := 0
+	for _, e := range a.messageTokens() {
+		total += e.tokens
+	}
+	return total
+}
+
+// invalidateTokenCache discards cached estimates after history is rewritten.
+func (a *Agent) invalidateTokenCache() {
+	a.tokenCache = nil
+}
+
+// elidedToolResultChars is how much of each old tool result is kept when
+// tool results are elided during compaction.
+const elidedToolResultChars = 200
+
+// elideToolResults shortens tool results that precede the current turn,
+// keeping a short head of each and a note of how much was removed. User and
+// assistant messages are left untouched, as are results in the current turn,
+// which the model is still working with. Returns the number of results elided.
+func (a *Agent) elideToolResults() int {
+	current := len(a.messages)
+	for i := len(a.messages) - 1; i >= 1; i-- {
+		if isTurnStart(a.messages[i]) {
+			current = i
+			break
+		}
+	}
+
+	elided := 0
+	for i := 1; i < current; i++ {
+		msg := a.messages[i]
+		if msg.ToolCallID == "" || msg.Content == nil || len(*msg.Content) <= elidedToolResultChars {
+			continue
+		}
+		content := *msg.Content
+		head := strings.ToValidUTF8(content[:elidedToolResultChars], "")
+		a.messages[i] = llm.ToolResultMessage(msg.ToolCallID, fmt.Sprintf(
+			"%s\n[... %d chars of tool output elided during compaction]", head, len(content)-len(head)))
+		elided++
+	}
+	if elided > 0 {
+		a.invalidateTokenCache()
+	}
+	return elided
+}
+
 // compactionPrompt returns the system prompt used when asking the LLM to summarize the conversation.
 func compactionPrompt() string {
 	return `Your task is to create a detailed summary of the conversation so far, paying close attention to the user's explicit requests and your previous actions. This summary should be thorough in capturing technical details, code patterns, and architectural decisions essential for continuing work without losing context.
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// exploreCacheEntry is a finished exploration kept for reuse by runExplore.
+type exploreCacheEntry struct {
+	result      string
+	fingerprint string // Registry.Fingerprint when the exploration started
+	at          time.Time
+}
+
+// SetExploreCache enables reusing explore results across turns: a task that
+// normalizes to one already explored in the same directory gets the earlier
+// result while no project file has changed. Disabling it drops the cache.
+func (a *Agent) SetExploreCache(enabled bool) {
+	a.exploreCacheMu.Lock()
+	defer a.exploreCacheMu.Unlock()
+	switch {
+	case !enabled:
+		a.exploreCache = nil
+	case a.exploreCache == nil:
+		a.exploreCache = make(map[string]exploreCacheEntry)
+	}
+}
+
+// runExplore is the explore tool's callback. With the cache enabled it
+// answers a repeated task from the cache, noting the result's age, and
+// otherwise runs the sub-agent with exploreUncached and caches the result.
+// Explorations given extra roots are never cached, since the fingerprint
+// covers only the project.
+func (a *Agent) runExplore(ctx context.Context, task, dir string, roots []string, limits tools.ExploreLimits) (string, error) {
+	limits = a.exploreLimitsFor(limits)
+	a.exploreCacheMu.Lock()
+	enabled := a.exploreCache != nil
+	a.exploreCacheMu.Unlock()
+	if !enabled || len(roots) > 0 {
+		return a.exploreUncached(ctx, task, dir, roots, limits)
+	}
+
+	key := exploreCacheKey(task, dir, limits)
+	fingerprint := a.tools.Fingerprint()
+	a.exploreCacheMu.Lock()
+	entry, ok := a.exploreCache[key]
+	a.exploreCacheMu.Unlock()
+	if ok && entry.fingerprint == fingerprint {
+		a.debug.Log("explore_cache_hit", "age", time.Since(entry.at).Round(time.Second))
+		if a.term != nil {
+			a.term.PrintSubAgentStatus("Explore reused an earlier result for the same task")
+		}
+		return fmt.Sprintf("[Cached result of the same exploration from %s ago; no files have changed since.]\n\n%s",
+			time.Since(entry.at).Round(time.Second), entry.result), nil
+	}
+
+	result, err := a.exploreUncached(ctx, task, dir, nil, limits)
+	if err != nil {
+		return "", err
+	}
+	a.exploreCacheMu.Lock()
+	if a.exploreCache != nil {
+		a.exploreCache[key] = exploreCacheEntry{result: result, fingerprint: fingerprint, at: time.Now()}
+	}
+	a.exploreCacheMu.Unlock()
+	return result, nil
+}
+
+// exploreCacheKey identifies an exploration by its directory, its limits,
+// and its task, ignoring case, spacing, and trailing punctuation. A shallow
+// exploration's findings are not reused for a deeper one.
+func exploreCacheKey(task, dir string, limits tools.ExploreLimits) string {
+	task = strings.ToLower(strings.Join(strings.Fields(task), " "))
+	task = strings.TrimRight(task, ".?! ")
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%s", dir, limits.MaxIterations, limits.MaxToolCalls, task)
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Markdown renders the session as a readable Markdown transcript: user and
+// assistant turns as sections, tool calls and results as code blocks.
+func (sf *SessionFile) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", sf.Meta.ID)
+	fmt.Fprintf(&b, "- Created: %s\n", sf.Meta.CreatedAt.Format(time.DateTime))
+	fmt.Fprintf(&b, "- Updated: %s\n", sf.Meta.UpdatedAt.Format(time.DateTime))
+	fmt.Fprintf(&b, "- Messages: %d\n", sf.Meta.MsgCount)
+
+	for _, msg := range sf.Messages {
+		content := strings.TrimSpace(msg.ContentString())
+		switch {
+		case msg.Role == "system":
+			continue
+		case msg.ToolCallID != "":
+			fmt.Fprintf(&b, "\n**Result:**\n\n%s\n", codeBlock(content))
+		case msg.Role == "user":
+			fmt.Fprintf(&b, "\n## User\n\n%s\n", content)
+		case msg.Role == "assistant":
+			b.WriteString("\n## Assistant\n")
+			if content != "" {
+				fmt.Fprintf(&b, "\n%s\n", content)
+			}
+			for _, tc := range msg.ToolCalls {
+				fmt.Fprintf(&b, "\n**Tool call:** `%s`\n\n%s\n", tc.Function.Name, codeBlock(tc.Function.Arguments))
+			}
+		}
+	}
+	return b.String()
+}
+
+// codeBlock fences s, using a fence longer than any backtick run inside it.
+func codeBlock(s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + s + "\n" + fence
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+// SetTrustFormatters controls whether the formatter configured for a file
+// runs after each write or edit without asking. Untrusted, the user confirms
+// each run.
+func (a *Agent) SetTrustFormatters(trust bool) {
+	a.trustFormatters = trust
+}
+
+// formatFile runs the formatter configured for path, if any, after a write
+// or edit. The returned note is appended to the tool result so the model
+// sees what the formatter did, or why it failed.
+func (a *Agent) formatFile(path string, term UI, listener ui.Interrupter) string {
+	command := a.tools.FormatCommand(path)
+	if command == "" {
+		return ""
+	}
+	if !a.trustFormatters {
+		listener.Pause()
+		approved := term.ConfirmAction(fmt.Sprintf("Run formatter %q?", command))
+		listener.Resume()
+		if !approved {
+			return "\n\nThe user declined to run the formatter: " + command
+		}
+	}
+
+	term.PrintToolCall("format", command)
+	output, err := a.tools.RunFormatter(context.Background(), path)
+	if err != nil {
+		term.PrintToolResult(fmt.Sprintf("Error: %s", err))
+		return fmt.Sprintf("\n\nFormatter %s failed, so the file may not be formatted: %s", command, err)
+	}
+	if output == "" {
+		return "\n\nFormatted with: " + command
+	}
+	term.PrintToolResult(output)
+	return fmt.Sprintf("\n\nFormatted with: %s\n%s", command, output)
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+// refreshGit re-reads the working directory's repository state and rebuilds
+// the system prompt if it changed since the last turn.
+func (a *Agent) refreshGit() {
+	info := a.tools.GitInfo()
+	if info == a.git {
+		return
+	}
+	a.git = info
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		a.messages[0] = llm.TextMessage("system", a.systemPrompt())
+		a.invalidateTokenCache()
+	}
+}
+
+// gitPromptLine describes the repository for the Environment section of the
+// system prompt, or returns "" outside a repository.
+func (a *Agent) gitPromptLine() string {
+	if a.git.Root == "" {
+		return ""
+	}
+	branch := "branch " + a.git.Branch
+	if a.git.Branch == "" {
+		branch = "detached HEAD"
+	}
+	state := "clean"
+	if a.git.Dirty {
+		state = "uncommitted changes"
+	}
+	return fmt.Sprintf("Git repository: %s (%s, %s)\n", a.git.Root, branch, state)
+}
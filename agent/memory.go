@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+// MemoryFile is the project memory file injected into the system prompt.
+const MemoryFile = "MEMORY.md"
+
+// defaultMemoryTokens is the default cap on memory injected into the system prompt.
+const defaultMemoryTokens = 4000
+
+// SetMemoryTokenLimit caps how much of MEMORY.md is injected into the system
+// prompt, in estimated tokens. Zero or a negative value disables the cap.
+// The current system prompt is rebuilt.
+func (a *Agent) SetMemoryTokenLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	a.memoryTokens = n
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		a.messages[0] = llm.TextMessage("system", a.systemPrompt())
+		a.invalidateTokenCache()
+	}
+}
+
+// MemoryWarning returns a warning for the user if MEMORY.md is over the
+// injection cap, or "" if it fits.
+func (a *Agent) MemoryWarning() string {
+	data, err := os.ReadFile(filepath.Join(a.workDir, MemoryFile))
+	if err != nil {
+		return ""
+	}
+	tokens := len(data) / CharsPerToken
+	if a.memoryTokens <= 0 || tokens <= a.memoryTokens {
+		return ""
+	}
+	return fmt.Sprintf("%s is ~%d tokens, over the %d-token cap; only its last sections are included in the prompt. Consider trimming it.",
+		MemoryFile, tokens, a.memoryTokens)
+}
+
+// projectMemory returns the MEMORY.md content to inject into the system
+// prompt, or "" if there is none.
+func (a *Agent) projectMemory() string {
+	data, err := os.ReadFile(filepath.Join(a.workDir, MemoryFile))
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	return truncateMemory(string(data), a.memoryTokens)
+}
+
+// truncateMemory fits memory within maxTokens (0 = no cap). Memory files are
+// appended to over time, so the most recent sections — those at the end —
+// are kept whole, and a note explains what was left out. If even the last
+// section is too large, its tail is kept.
+func truncateMemory(memory string, maxTokens int) string {
+	if maxTokens <= 0 || len(memory)/CharsPerToken <= maxTokens {
+		return memory
+	}
+	maxChars := maxTokens * CharsPerToken
+
+	sections := splitSections(memory)
+	kept := 0
+	size := 0
+	for i := len(sections) - 1; i >= 0; i-- {
+		if size+len(sections[i]) > maxChars {
+			break
+		}
+		size += len(sections[i])
+		kept++
+	}
+
+	var body string
+	if kept > 0 {
+		body = strings.Join(sections[len(sections)-kept:], "")
+	} else {
+		body = memory[len(memory)-maxChars:]
+		if i := strings.IndexByte(body, '\n'); i >= 0 {
+			body = body[i+1:] // start on a whole line
+		}
+	}
+
+	return fmt.Sprintf("[%s is ~%d tokens, over the %d-token cap. Showing the most recent part; read %s for earlier sections.]\n\n%s",
+		MemoryFile, len(memory)/CharsPerToken, maxTokens, MemoryFile, body)
+}
+
+// splitSections splits markdown into chunks that each start at a heading.
+// Text before the first heading is its own chunk.
+func splitSections(md string) []string {
+	var sections []string
+	start := 0
+	for i := 0; i < len(md); {
+		end := strings.IndexByte(md[i:], '\n')
+		next := len(md)
+		if end >= 0 {
+			next = i + end + 1
+		}
+		if i > start && strings.HasPrefix(md[i:], "#") {
+			sections = append(sections, md[start:i])
+			start = i
+		}
+		i = next
+	}
+	return append(sections, md[start:])
+}
+
+// MemorySnapshot records MEMORY.md as it was when a session started.
+type MemorySnapshot struct {
+	Exists  bool   `json:"exists"`
+	Content string `json:"content,omitempty"`
+}
+
+// snapshotMemory reads MEMORY.md as it is now.
+func (a *Agent) snapshotMemory() MemorySnapshot {
+	data, err := os.ReadFile(filepath.Join(a.workDir, MemoryFile))
+	if err != nil {
+		return MemorySnapshot{}
+	}
+	return MemorySnapshot{Exists: true, Content: string(data)}
+}
+
+// MemoryDiff compares MEMORY.md with its snapshot from the start of the
+// session. It returns the old and new content for PrintDiff and a summary
+// of the change, or "" if the file is unchanged.
+func (a *Agent) MemoryDiff() (oldContent, newContent, summary string) {
+	return diffMemory(a.memorySnapshot, a.snapshotMemory())
+}
+
+// diffMemory describes the change from before to after. A missing file
+// diffs as empty content.
+func diffMemory(before, after MemorySnapshot) (oldContent, newContent, summary string) {
+	switch {
+	case !before.Exists && !after.Exists:
+		return "", "", ""
+	case !before.Exists:
+		summary = fmt.Sprintf("%s was created this session.", MemoryFile)
+	case !after.Exists:
+		summary = fmt.Sprintf("%s was deleted this session.", MemoryFile)
+	case before.Content == after.Content:
+		return "", "", ""
+	default:
+		summary = fmt.Sprintf("%s changed this session.", MemoryFile)
+	}
+	return before.Content, after.Content, summary
+}
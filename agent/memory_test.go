@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+func writeMemory(t *testing.T, dir string, sections int) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("Project notes.\n\n")
+	for i := 1; i <= sections; i++ {
+		fmt.Fprintf(&b, "## Section %d\n\n%s\n", i, strings.Repeat(fmt.Sprintf("note %d. ", i), 50))
+	}
+	if err := os.WriteFile(filepath.Join(dir, MemoryFile), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestSystemPromptTruncatesLargeMemory(t *testing.T) {
+	dir := t.TempDir()
+	memory := writeMemory(t, dir, 40) // ~4k tokens
+	ag := testAgent(t, dir)
+	ag.SetMemoryTokenLimit(1000)
+
+	prompt := ag.systemPrompt()
+	if strings.Contains(prompt, memory) {
+		t.Fatal("expected oversized memory to be truncated")
+	}
+	if !strings.Contains(prompt, "over the 1000-token cap") {
+		t.Error("expected truncation note in prompt")
+	}
+	if !strings.Contains(prompt, "## Section 40\n") {
+		t.Error("expected most recent section kept")
+	}
+	if strings.Contains(prompt, "## Section 1\n") {
+		t.Error("expected oldest section dropped")
+	}
+
+	start := strings.Index(prompt, "## Project Memory (MEMORY.md)")
+	if got := len(prompt[start:]) / CharsPerToken; got > 1100 {
+		t.Errorf("expected injected memory near the cap, got ~%d tokens", got)
+	}
+	if ag.MemoryWarning() == "" {
+		t.Error("expected a warning for oversized memory")
+	}
+	if ag.messages[0].ContentString() != prompt {
+		t.Error("expected system message rebuilt with the new limit")
+	}
+}
+
+func TestSystemPromptKeepsSmallMemory(t *testing.T) {
+	dir := t.TempDir()
+	memory := writeMemory(t, dir, 2)
+	ag := testAgent(t, dir)
+
+	if !strings.Contains(ag.systemPrompt(), memory) {
+		t.Error("expected small memory injected whole")
+	}
+	if msg := ag.MemoryWarning(); msg != "" {
+		t.Errorf("expected no warning, got %q", msg)
+	}
+
+	// No cap injects everything
+	memory = writeMemory(t, dir, 40)
+	ag.SetMemoryTokenLimit(0)
+	if !strings.Contains(ag.systemPrompt(), memory) {
+		t.Error("expected uncapped memory injected whole")
+	}
+}
+
+func TestTruncateMemorySingleHugeSection(t *testing.T) {
+	memory := "## Log\n" + strings.Repeat("line of text\n", 2000)
+	got := truncateMemory(memory, 100)
+	if len(got) > 100*CharsPerToken+200 {
+		t.Errorf("expected tail within the cap, got %d chars", len(got))
+	}
+	body := got[strings.Index(got, "\n\n")+2:]
+	if !strings.HasPrefix(body, "line of text\n") {
+		t.Errorf("expected truncated body to start on a whole line, got %q", body[:20])
+	}
+}
+
+func TestDiffMemory(t *testing.T) {
+	absent := MemorySnapshot{}
+	v1 := MemorySnapshot{Exists: true, Content: "## Notes\n\nuse tabs\n"}
+	v2 := MemorySnapshot{Exists: true, Content: "## Notes\n\nuse tabs\nrun go vet\n"}
+
+	tests := []struct {
+		name          string
+		before, after MemorySnapshot
+		wantSummary   string
+		wantOld       string
+		wantNew       string
+	}{
+		{"absent both", absent, absent, "", "", ""},
+		{"unchanged", v1, v1, "", "", ""},
+		{"changed", v1, v2, "MEMORY.md changed this session.", v1.Content, v2.Content},
+		{"created", absent, v1, "MEMORY.md was created this session.", "", v1.Content},
+		{"deleted", v1, absent, "MEMORY.md was deleted this session.", v1.Content, ""},
+		{"created empty", absent, MemorySnapshot{Exists: true}, "MEMORY.md was created this session.", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldContent, newContent, summary := diffMemory(tt.before, tt.after)
+			if summary != tt.wantSummary || oldContent != tt.wantOld || newContent != tt.wantNew {
+				t.Errorf("diffMemory = (%q, %q, %q), want (%q, %q, %q)",
+					oldContent, newContent, summary, tt.wantOld, tt.wantNew, tt.wantSummary)
+			}
+		})
+	}
+}
+
+func TestMemoryDiffSurvivesResume(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, MemoryFile)
+	if err := os.WriteFile(path, []byte("first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ag := testAgent(t, dir)
+	ag.messages = append(ag.messages, llm.TextMessage("user", "remember this"))
+	if err := os.WriteFile(path, []byte("first\nsecond\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ag.SaveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A resumed session compares against the snapshot saved with it, not
+	// the file as it was when the new process started
+	ag2 := testAgent(t, dir)
+	if err := ag2.ResumeSession(ag.sessionID); err != nil {
+		t.Fatal(err)
+	}
+	oldContent, newContent, summary := ag2.MemoryDiff()
+	if summary == "" || oldContent != "first\n" || newContent != "first\nsecond\n" {
+		t.Errorf("unexpected diff after resume: (%q, %q, %q)", oldContent, newContent, summary)
+	}
+
+	os.Remove(path)
+	if _, newContent, summary := ag2.MemoryDiff(); summary != "MEMORY.md was deleted this session." || newContent != "" {
+		t.Errorf("expected deletion to be reported, got (%q, %q)", newContent, summary)
+	}
+}
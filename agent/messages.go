@@ -11,3 +11,28 @@ func (a *Agent) MessageHistory() []llm.Message {
 func (a *Agent) MessageCount() int {
 	return len(a.messages)
 }
+
+// LastToolResult returns the most recent tool result in the conversation,
+// exactly as the model sees it, with the call that produced it. ok is false
+// if the conversation has no tool result, e.g. after /clear or compaction.
+func (a *Agent) LastToolResult() (call llm.ToolCall, result string, ok bool) {
+	for i := len(a.messages) - 1; i >= 0; i-- {
+		m := a.messages[i]
+		if m.Role != "tool" {
+			continue
+		}
+		// The call is in the assistant message before this run of results
+		for j := i - 1; j >= 0; j-- {
+			for _, tc := range a.messages[j].ToolCalls {
+				if tc.ID == m.ToolCallID {
+					return tc, m.ContentString(), true
+				}
+			}
+			if a.messages[j].Role != "tool" {
+				break
+			}
+		}
+		return llm.ToolCall{ID: m.ToolCallID}, m.ContentString(), true
+	}
+	return llm.ToolCall{}, "", false
+}
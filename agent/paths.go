@@ -19,9 +19,27 @@ func projectHash(workDir string) string {
 	return hex.EncodeToString(h[:])[:16]
 }
 
-// GlobalSessionsDir returns the path to the sessions directory for a given project
-// under the user's home directory: ~/.pilot/projects/<hash>/sessions
-func GlobalSessionsDir(workDir string) (string, error) {
+// sessionsDirOverride replaces the derived sessions directory when set.
+var sessionsDirOverride string
+
+// SetSessionsDir makes every project store its sessions in dir instead of
+// under ~/.pilot ("" restores the default). Sessions of different projects
+// then share dir.
+func SetSessionsDir(dir string) {
+	sessionsDirOverride = dir
+}
+
+// SessionsDir returns the path to the sessions directory for a given project:
+// the SetSessionsDir override, else ~/.pilot/projects/<hash>/sessions under
+// the user's home directory.
+func SessionsDir(workDir string) (string, error) {
+	return sessionsDir(workDir)
+}
+
+func sessionsDir(workDir string) (string, error) {
+	if sessionsDirOverride != "" {
+		return sessionsDirOverride, nil
+	}
 	return globalSessionsDir(workDir)
 }
 
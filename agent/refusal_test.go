@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+func TestLooksLikeRefusal(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"I can't help with that.", true},
+		{"I cannot assist with creating this script.", true},
+		{"Sorry, but I won't write code that does this.", true},
+		{"I’m sorry, I can’t help with that request.", true},
+		{"I'm unable to provide that.", true},
+		{"  i am not able to comply with this request.", true},
+		{"I can't find the config file; could you tell me where it is?", false},
+		{"I cannot reproduce the failure locally. The test passes on my end.", false},
+		{"Done. I can't help noticing the tests are slow, though.", false},
+		{"The function can't help with that case, since it returns early.", false},
+		{"", false},
+		{"I can't help with that part, but here is how to do the rest:\n" + strings.Repeat("step\n", 200), false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeRefusal(tt.text); got != tt.want {
+			t.Errorf("looksLikeRefusal(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRefused(t *testing.T) {
+	ag := testAgent(t, t.TempDir())
+	if ag.Refused() {
+		t.Error("expected no refusal in a new conversation")
+	}
+
+	ag.messages = append(ag.messages, llm.TextMessage("user", "write a port scanner for my lab"), llm.TextMessage("assistant", "I can't help with that."))
+	if !ag.Refused() {
+		t.Error("expected the refusal detected")
+	}
+
+	ag.stoppedEarly = true
+	if ag.Refused() {
+		t.Error("expected a turn cut off by a limit not to count as a refusal")
+	}
+	ag.stoppedEarly = false
+
+	ag.messages = append(ag.messages, llm.TextMessage("user", RefusalClarification), llm.TextMessage("assistant", "Understood. Here is the scanner."))
+	if ag.Refused() {
+		t.Error("expected no refusal after the model proceeds")
+	}
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+	"github.com/lowkaihon/cli-coding-agent/tools"
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+// reviewOutputLimit caps each command's output in the review summary the
+// model gets with the next message.
+const reviewOutputLimit = 2000
+
+// reviewItem is one entry of an end-of-turn review: every staged write and
+// edit to one file, or one command.
+type reviewItem struct {
+	path     string // file changes; "" for a command
+	isNew    bool   // the file did not exist before the turn
+	original string // file content before the turn
+	content  string // file content after the staged changes
+
+	changes []*tools.NeedsConfirmation // applied in order on approval
+}
+
+func (it *reviewItem) label() string {
+	if it.path != "" {
+		return it.path
+	}
+	c := it.changes[0]
+	return c.Tool + " " + c.Path
+}
+
+// SetReviewChanges controls review mode. When enabled, writes, edits, and
+// commands that need confirmation are staged instead of applied; at the end
+// of the turn they are shown together and applied only if approved, all at
+// once or one by one. The system prompt is rebuilt to tell the model.
+func (a *Agent) SetReviewChanges(enabled bool) {
+	a.reviewChanges = enabled
+	if len(a.messages) > 0 && a.messages[0].Role == "system" {
+		a.messages[0] = llm.TextMessage("system", a.systemPrompt())
+		a.invalidateTokenCache()
+	}
+}
+
+// stageForReview holds confirm for the end-of-turn review and returns the
+// tool result telling the model so.
+func (a *Agent) stageForReview(confirm *tools.NeedsConfirmation) string {
+	if confirm.Tool != "write" && confirm.Tool != "edit" {
+		a.staged = append(a.staged, &reviewItem{changes: []*tools.NeedsConfirmation{confirm}})
+		return "Staged for review: this runs only if the user approves it at the end of your turn, after the staged file changes. Its output is not available now."
+	}
+
+	if err := a.tools.StageContent(confirm.Path, confirm.NewContent); err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	path := filepath.Clean(confirm.Path)
+	var item *reviewItem
+	for _, it := range a.staged {
+		if it.path == path {
+			item = it
+			break
+		}
+	}
+	if item == nil {
+		abs := path
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(a.workDir, abs)
+		}
+		_, err := os.Stat(abs)
+		item = &reviewItem{path: path, isNew: err != nil, original: confirm.Preview}
+		a.staged = append(a.staged, item)
+	}
+	item.content = confirm.NewContent
+	item.changes = append(item.changes, confirm)
+	return fmt.Sprintf("Staged for review: %s changes only if the user approves it at the end of your turn. Reads and edits of it already see the staged content.", confirm.Path)
+}
+
+// reviewStaged shows the changes staged this turn and applies those the
+// user approves, file changes before commands. A cancelled turn discards
+// them. What happened is kept for the model's next message.
+func (a *Agent) reviewStaged(cancelled bool, term UI, listener ui.Interrupter) {
+	items := a.staged
+	a.staged = nil
+	if len(items) == 0 {
+		return
+	}
+	defer a.tools.ClearStaged()
+
+	if cancelled {
+		term.PrintWarning(fmt.Sprintf("Discarded %d staged change(s) from the cancelled turn.", len(items)))
+		a.reviewNote = "The turn was cancelled, so none of the changes you staged for review were applied."
+		return
+	}
+
+	// Files first, in the order they were first staged, then commands
+	var files, commands []*reviewItem
+	for _, it := range items {
+		if it.path != "" {
+			files = append(files, it)
+		} else {
+			commands = append(commands, it)
+		}
+	}
+	items = append(files, commands...)
+
+	term.PrintWarning(fmt.Sprintf("Review: %d staged change(s) from this turn", len(items)))
+	for _, it := range files {
+		if it.isNew {
+			term.PrintFilePreview(it.path, it.content)
+		} else {
+			term.PrintDiff(it.path, it.original, it.content)
+		}
+	}
+	for _, it := range commands {
+		c := it.changes[0]
+		term.PrintToolCall(c.Tool, c.Path)
+		for _, fc := range c.Changes {
+			term.PrintDiff(fc.Path, fc.Old, fc.New)
+		}
+	}
+
+	listener.Pause()
+	all := term.ConfirmAction(fmt.Sprintf("Apply all %d staged change(s)?", len(items)))
+	oneByOne := !all && len(items) > 1 && term.ConfirmAction("Choose changes one by one?")
+	listener.Resume()
+
+	var note strings.Builder
+	note.WriteString("Result of the review of the changes you staged in your previous turn:\n")
+	for _, it := range items {
+		approved := all
+		if oneByOne {
+			listener.Pause()
+			approved = term.ConfirmAction(fmt.Sprintf("Apply %s?", it.label()))
+			listener.Resume()
+		}
+		if !approved {
+			fmt.Fprintf(&note, "- %s: rejected by the user\n", it.label())
+			continue
+		}
+		output := a.applyReviewItem(it, term, listener)
+		if it.path == "" {
+			term.PrintToolCall(it.changes[0].Tool, it.changes[0].Path)
+			term.PrintToolResult(output)
+			fmt.Fprintf(&note, "- %s: approved; output:\n%s\n", it.label(), truncateOutput(output, reviewOutputLimit))
+		} else {
+			fmt.Fprintf(&note, "- %s: %s\n", it.label(), output)
+		}
+	}
+	if !all && !oneByOne {
+		term.PrintWarning("Discarded all staged changes.")
+	}
+	a.reviewNote = note.String()
+}
+
+// applyReviewItem applies every change of an approved item in order and
+// returns the last result, or the first error. A file is formatted once,
+// after its last change.
+func (a *Agent) applyReviewItem(it *reviewItem, term UI, listener ui.Interrupter) string {
+	if it.path != "" {
+		a.captureFileBeforeModification(it.path)
+	} else {
+		a.captureConfirmedFiles(it.changes[0])
+	}
+	var result string
+	for _, c := range it.changes {
+		a.auditConfirmed(c)
+		out, err := c.Execute()
+		if err != nil {
+			return fmt.Sprintf("Error: %s", err)
+		}
+		result = out
+	}
+	if it.path != "" {
+		result += a.formatFile(it.path, term, listener)
+	}
+	return result
+}
+
+// truncateOutput cuts s to limit bytes, noting how much was left out.
+func truncateOutput(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + fmt.Sprintf("\n... (%d more bytes)", len(s)-limit)
+}
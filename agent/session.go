@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/lowkaihon/cli-coding-agent/llm"
@@ -15,17 +16,21 @@ import (
 
 // SessionMeta holds metadata about a saved session.
 type SessionMeta struct {
-	ID        string    `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Preview   string    `json:"preview"`
-	MsgCount  int       `json:"msg_count"`
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Preview    string    `json:"preview"`
+	MsgCount   int       `json:"msg_count"`
+	Provider   string    `json:"provider,omitempty"`    // provider in use when last saved
+	Model      string    `json:"model,omitempty"`       // model in use when last saved
+	ForkedFrom string    `json:"forked_from,omitempty"` // session this one was resumed from and continued under a new ID
 }
 
 // SessionFile is the on-disk representation of a session.
 type SessionFile struct {
-	Meta     SessionMeta   `json:"meta"`
-	Messages []llm.Message `json:"messages"`
+	Meta     SessionMeta     `json:"meta"`
+	Messages []llm.Message   `json:"messages"`
+	Memory   *MemorySnapshot `json:"memory,omitempty"`
 }
 
 func generateSessionID() string {
@@ -34,10 +39,6 @@ func generateSessionID() string {
 	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
 }
 
-func sessionsDir(workDir string) (string, error) {
-	return globalSessionsDir(workDir)
-}
-
 // SaveSession persists the current conversation (excluding system prompt) to disk.
 // Errors are returned but callers should treat them as non-fatal.
 func (a *Agent) SaveSession() error {
@@ -71,13 +72,17 @@ func (a *Agent) SaveSession() error {
 
 	sf := SessionFile{
 		Meta: SessionMeta{
-			ID:        a.sessionID,
-			CreatedAt: a.sessionCreated,
-			UpdatedAt: now,
-			Preview:   preview,
-			MsgCount:  len(saved),
+			ID:         a.sessionID,
+			CreatedAt:  a.sessionCreated,
+			UpdatedAt:  now,
+			Preview:    preview,
+			MsgCount:   len(saved),
+			Provider:   a.provider,
+			Model:      a.model,
+			ForkedFrom: a.forkedFrom,
 		},
 		Messages: saved,
+		Memory:   &a.memorySnapshot,
 	}
 
 	data, err := json.Marshal(sf)
@@ -109,22 +114,78 @@ func atomicWriteSession(path string, data []byte) error {
 	return os.Rename(tmpName, path)
 }
 
-// ResumeSession loads a saved session and rebuilds the message history
-// with a fresh system prompt.
-func (a *Agent) ResumeSession(sessionID string) error {
-	dir, err := sessionsDir(a.workDir)
+// staleSessionTempAge is how old a session temp file must be before
+// Shutdown treats it as left over from a crash rather than another
+// instance's save in progress.
+const staleSessionTempAge = time.Minute
+
+// removeStaleSessionTemps deletes session temp files left behind by saves
+// that never completed.
+func removeStaleSessionTemps(workDir string) {
+	dir, err := sessionsDir(workDir)
 	if err != nil {
-		return fmt.Errorf("resolve sessions dir: %w", err)
+		return
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, ".session-*.tmp"))
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleSessionTempAge {
+			os.Remove(path)
+		}
+	}
+}
+
+// sessionPath returns the file path of a session, rejecting IDs that could
+// escape the sessions directory.
+func sessionPath(workDir, sessionID string) (string, error) {
+	if sessionID == "" || sessionID != filepath.Base(sessionID) || strings.HasPrefix(sessionID, ".") {
+		return "", fmt.Errorf("invalid session id %q", sessionID)
+	}
+	dir, err := sessionsDir(workDir)
+	if err != nil {
+		return "", fmt.Errorf("resolve sessions dir: %w", err)
+	}
+	return filepath.Join(dir, sessionID+".json"), nil
+}
+
+// LoadSession reads a saved session for the project at workDir.
+func LoadSession(workDir, sessionID string) (*SessionFile, error) {
+	path, err := sessionPath(workDir, sessionID)
+	if err != nil {
+		return nil, err
 	}
-	path := filepath.Join(dir, sessionID+".json")
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("read session: %w", err)
+		return nil, fmt.Errorf("read session: %w", err)
 	}
 
 	var sf SessionFile
 	if err := json.Unmarshal(data, &sf); err != nil {
-		return fmt.Errorf("parse session: %w", err)
+		return nil, fmt.Errorf("parse session: %w", err)
+	}
+	return &sf, nil
+}
+
+// DeleteSession removes a saved session for the project at workDir.
+func DeleteSession(workDir, sessionID string) error {
+	path, err := sessionPath(workDir, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// ResumeSession loads a saved session and rebuilds the message history
+// with a fresh system prompt. The session's model is restored too when the
+// client factory can build it; otherwise, e.g. when its provider no longer
+// has an API key, the current model is kept. Compare Model with the
+// session's meta to tell.
+func (a *Agent) ResumeSession(sessionID string) error {
+	sf, err := LoadSession(a.workDir, sessionID)
+	if err != nil {
+		return err
 	}
 
 	// Rebuild: fresh system prompt + saved messages
@@ -133,11 +194,49 @@ func (a *Agent) ResumeSession(sessionID string) error {
 	a.messages = append(a.messages, sf.Messages...)
 	a.sessionID = sf.Meta.ID
 	a.sessionCreated = sf.Meta.CreatedAt
+	a.forkedFrom = sf.Meta.ForkedFrom
+	a.forkPending = a.forkOnResume
+	// Sessions saved without a snapshot diff against the file as it is now
+	a.memorySnapshot = a.snapshotMemory()
+	if sf.Memory != nil {
+		a.memorySnapshot = *sf.Memory
+	}
 	a.lastTokensUsed = 0
+	a.invalidateTokenCache()
 	a.rebuildCheckpoints()
+
+	if m := sf.Meta; m.Model != "" && (m.Provider != a.provider || m.Model != a.model) {
+		a.SwitchModel(m.Provider, m.Model)
+	}
 	return nil
 }
 
+// SetForkOnResume controls whether a resumed session is saved under a new
+// ID once it is continued, so the original file keeps the conversation as
+// it was. It applies to sessions resumed after the call.
+func (a *Agent) SetForkOnResume(enabled bool) {
+	a.forkOnResume = enabled
+}
+
+// ForkPending reports whether the current session was resumed with fork on
+// resume and will move to a new ID with its next message.
+func (a *Agent) ForkPending() bool {
+	return a.forkPending
+}
+
+// forkIfResumed moves a resumed session awaiting its first new message to
+// a new ID, recording the one it came from.
+func (a *Agent) forkIfResumed() {
+	if !a.forkPending {
+		return
+	}
+	a.forkPending = false
+	a.forkedFrom = a.sessionID
+	a.sessionID = generateSessionID()
+	a.sessionCreated = time.Now()
+	a.debug.Log("session_fork", "from", a.forkedFrom, "to", a.sessionID)
+}
+
 // ListSessions reads all session files from the sessions directory,
 // returning up to max entries sorted by UpdatedAt descending.
 func ListSessions(workDir string, max int) ([]SessionMeta, error) {
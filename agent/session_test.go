@@ -1,14 +1,18 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/lowkaihon/cli-coding-agent/llm"
 	"github.com/lowkaihon/cli-coding-agent/tools"
+	"github.com/lowkaihon/cli-coding-agent/ui"
 )
 
 func testAgent(t *testing.T, workDir string) *Agent {
@@ -105,6 +109,116 @@ func TestSaveAndResumeSession(t *testing.T) {
 	}
 }
 
+func TestForkOnResume(t *testing.T) {
+	dir := t.TempDir()
+	ag := testAgent(t, dir)
+	ag.messages = append(ag.messages, llm.TextMessage("user", "first"), llm.TextMessage("assistant", "reply"))
+	if err := ag.SaveSession(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	original := ag.sessionID
+
+	resumed := testAgent(t, dir)
+	resumed.SetForkOnResume(true)
+	if err := resumed.ResumeSession(original); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if !resumed.ForkPending() || resumed.sessionID != original {
+		t.Fatalf("expected the original ID kept until the session is continued, got %s", resumed.sessionID)
+	}
+	// Saving before continuing leaves the original as it was
+	if err := resumed.SaveSession(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	captureStdout(t, func() {
+		if err := resumed.Run(context.Background(), "second", ui.NewTerminal()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if err := resumed.SaveSession(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if resumed.sessionID == original || resumed.ForkPending() {
+		t.Fatalf("expected a new session ID after continuing, still %s", resumed.sessionID)
+	}
+
+	sf, err := LoadSession(dir, original)
+	if err != nil {
+		t.Fatalf("load original: %v", err)
+	}
+	if sf.Meta.MsgCount != 2 {
+		t.Errorf("expected the original left with 2 messages, got %d", sf.Meta.MsgCount)
+	}
+	fork, err := LoadSession(dir, resumed.sessionID)
+	if err != nil {
+		t.Fatalf("load fork: %v", err)
+	}
+	if fork.Meta.MsgCount != 4 || fork.Meta.ForkedFrom != original {
+		t.Errorf("expected the fork with 4 messages from %s, got %d from %q", original, fork.Meta.MsgCount, fork.Meta.ForkedFrom)
+	}
+
+	// Without the option, continuing writes to the resumed file
+	plain := testAgent(t, dir)
+	if err := plain.ResumeSession(original); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	captureStdout(t, func() {
+		plain.Run(context.Background(), "third", ui.NewTerminal())
+	})
+	if plain.sessionID != original {
+		t.Errorf("expected the session ID kept without fork on resume, got %s", plain.sessionID)
+	}
+}
+
+func TestResumeSessionRestoresModel(t *testing.T) {
+	dir := t.TempDir()
+	ag := testAgent(t, dir)
+	ag.SetModel("anthropic", "claude-x")
+	ag.messages = append(ag.messages, llm.TextMessage("user", "Hello"))
+	if err := ag.SaveSession(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// A factory that builds a client for the saved model
+	ag2 := testAgent(t, dir)
+	ag2.SetModel("openai", "gpt-4o-mini")
+	restored := &mockLLMClient{}
+	var gotProvider, gotModel string
+	ag2.SetClientFactory(func(provider, model string) (llm.LLMClient, int, error) {
+		gotProvider, gotModel = provider, model
+		return restored, 200000, nil
+	})
+	if err := ag2.ResumeSession(ag.sessionID); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if gotProvider != "anthropic" || gotModel != "claude-x" {
+		t.Errorf("factory called with %s/%s, want anthropic/claude-x", gotProvider, gotModel)
+	}
+	if p, m := ag2.Model(); p != "anthropic" || m != "claude-x" {
+		t.Errorf("Model() = %s/%s, want anthropic/claude-x", p, m)
+	}
+	if ag2.client != restored {
+		t.Error("client was not swapped to the restored model")
+	}
+
+	// A factory that fails leaves the current model in place
+	ag3 := testAgent(t, dir)
+	ag3.SetModel("openai", "gpt-4o-mini")
+	ag3.SetClientFactory(func(provider, model string) (llm.LLMClient, int, error) {
+		return nil, 0, fmt.Errorf("no API key found for %s", provider)
+	})
+	if err := ag3.ResumeSession(ag.sessionID); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if p, m := ag3.Model(); p != "openai" || m != "gpt-4o-mini" {
+		t.Errorf("Model() = %s/%s, want openai/gpt-4o-mini kept", p, m)
+	}
+	if len(ag3.messages) != 2 {
+		t.Errorf("expected 2 messages after resume, got %d", len(ag3.messages))
+	}
+}
+
 func TestListSessions_Ordering(t *testing.T) {
 	dir := t.TempDir()
 	sessDir, _ := globalSessionsDir(dir)
@@ -239,3 +353,92 @@ func TestSaveSession_NilContent(t *testing.T) {
 		t.Errorf("expected 1 tool call, got %d", len(ag2.messages[2].ToolCalls))
 	}
 }
+
+func TestSessionsDirOverride(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	override := filepath.Join(t.TempDir(), "sessions")
+	SetSessionsDir(override)
+	t.Cleanup(func() { SetSessionsDir("") })
+
+	dir := t.TempDir()
+	ag := testAgent(t, dir)
+	ag.messages = append(ag.messages, llm.TextMessage("user", "Store me elsewhere"))
+	if err := ag.SaveSession(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(override, ag.sessionID+".json")); err != nil {
+		t.Fatalf("expected session saved in the override dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".pilot")); !os.IsNotExist(err) {
+		t.Error("expected nothing written under ~/.pilot")
+	}
+	if got, _ := SessionsDir(dir); got != override {
+		t.Errorf("SessionsDir = %q, want %q", got, override)
+	}
+
+	metas, err := ListSessions(dir, 10)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(metas) != 1 || metas[0].ID != ag.sessionID {
+		t.Fatalf("expected the saved session listed, got %+v", metas)
+	}
+
+	ag2 := testAgent(t, dir)
+	if err := ag2.ResumeSession(ag.sessionID); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if ag2.messages[1].ContentString() != "Store me elsewhere" {
+		t.Errorf("unexpected resumed message: %s", ag2.messages[1].ContentString())
+	}
+}
+
+func TestShutdownRemovesStaleSessionTemps(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	ag := testAgent(t, dir)
+
+	sessDir, _ := globalSessionsDir(dir)
+	os.MkdirAll(sessDir, 0755)
+	stale := filepath.Join(sessDir, ".session-stale.tmp")
+	fresh := filepath.Join(sessDir, ".session-fresh.tmp")
+	os.WriteFile(stale, []byte("{"), 0644)
+	os.WriteFile(fresh, []byte("{"), 0644)
+	old := time.Now().Add(-2 * staleSessionTempAge)
+	os.Chtimes(stale, old, old)
+
+	ag.Shutdown()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("expected stale session temp file removed")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("expected recent session temp file kept (may be another instance's save)")
+	}
+}
+
+func TestSessionMarkdown(t *testing.T) {
+	sf := SessionFile{
+		Meta: SessionMeta{ID: "s1", MsgCount: 4},
+		Messages: []llm.Message{
+			llm.TextMessage("user", "list files"),
+			llm.AssistantMessage(nil, []llm.ToolCall{{ID: "c1", Type: "function", Function: llm.FunctionCall{Name: "ls", Arguments: `{"path":"."}`}}}),
+			llm.ToolResultMessage("c1", "main.go\n```fenced```"),
+			llm.TextMessage("assistant", "There is one file."),
+		},
+	}
+	md := sf.Markdown()
+	for _, want := range []string{
+		"# Session s1",
+		"## User\n\nlist files",
+		"**Tool call:** `ls`\n\n```\n{\"path\":\".\"}\n```",
+		"**Result:**\n\n````\nmain.go\n```fenced```\n````",
+		"## Assistant\n\nThere is one file.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in markdown, got:\n%s", want, md)
+		}
+	}
+}
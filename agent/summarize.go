@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+// resultSummaryPrompt asks for a summary of one tool result that can stand
+// in for it in the conversation.
+const resultSummaryPrompt = `You condense the output of a tool call made by a coding agent. The agent will see your summary instead of the output, so keep everything it is likely to act on: errors and warnings with their file paths and line numbers, failing test names, counts, the structure of a file (its types, functions, and sections with line numbers), and any value the call was evidently looking for. Drop repetition and routine noise. Quote short key lines verbatim. Reply with the summary only, in at most about 40 lines.`
+
+// SetResultSummaries makes successful tool results longer than threshold
+// characters go into the conversation as a summary written by model, on the
+// current provider ("" uses the current model). The full output is archived
+// for the recall tool, which this adds. 0 disables it, the default.
+func (a *Agent) SetResultSummaries(threshold int, model string) {
+	a.resultSummaryChars = max(threshold, 0)
+	a.summaryModel = model
+	a.summaryClient = nil
+	a.tools.SetRecall(a.resultSummaryChars > 0)
+}
+
+// summarizeResult returns the output of call as the conversation should hold
+// it: a summary naming its archive ID if it is over the summary threshold,
+// else the output unchanged. If no summary can be made the output is kept.
+func (a *Agent) summarizeResult(ctx context.Context, call llm.ToolCall, output string, term UI) string {
+	name := call.Function.Name
+	if a.resultSummaryChars == 0 || len(output) <= a.resultSummaryChars || strings.HasPrefix(output, "Error:") {
+		return output
+	}
+	// Their results are already condensed
+	if name == "recall" || name == "explore" {
+		return output
+	}
+
+	messages := []llm.Message{
+		llm.TextMessage("system", resultSummaryPrompt),
+		llm.TextMessage("user", fmt.Sprintf("Tool: %s\nArguments: %s\n\nOutput:\n%s", name, call.Function.Arguments, output)),
+	}
+	term.PrintSpinner()
+	resp, err := a.resultSummaryClient().SendMessage(ctx, messages, nil)
+	term.ClearSpinner()
+	if err != nil || resp.Message.Content == nil || strings.TrimSpace(*resp.Message.Content) == "" {
+		a.debug.Log("error", "stage", "summarize result", "tool", name, "err", err)
+		return output
+	}
+
+	id := a.tools.ArchiveResult(output)
+	a.debug.Log("summarize", "tool", name, "result_bytes", len(output), "archive_id", id)
+	return fmt.Sprintf("[Summary of %d chars of %s output. The full output is archived: call recall with id=%d, and start_line/end_line, for exact text such as lines to edit.]\n%s",
+		len(output), name, id, strings.TrimSpace(*resp.Message.Content))
+}
+
+// resultSummaryClient returns the client that writes result summaries: one
+// for the summary model, built on first use and again after a provider
+// switch, or the current client if there is no summary model or it cannot
+// be built.
+func (a *Agent) resultSummaryClient() llm.LLMClient {
+	if a.summaryModel == "" || a.newClient == nil {
+		return a.client
+	}
+	if a.summaryClient == nil || a.summaryProvider != a.provider {
+		client, _, err := a.newClient(a.provider, a.summaryModel)
+		if err != nil {
+			a.debug.Log("error", "stage", "summary client", "model", a.summaryModel, "err", err)
+			return a.client
+		}
+		a.summaryClient, a.summaryProvider = client, a.provider
+	}
+	return a.summaryClient
+}
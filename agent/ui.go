@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"time"
 
 	"github.com/lowkaihon/cli-coding-agent/ui"
 )
@@ -12,6 +13,7 @@ type UI interface {
 	StartEscapeListener(parent context.Context) (context.Context, ui.Interrupter, error)
 	PrintSpinner()
 	ClearSpinner()
+	PrintRetry(attempt, maxRetries int, delay time.Duration, reason string)
 	PrintAssistant(text string)
 	PrintAssistantDone()
 	PrintWarning(msg string)
@@ -21,6 +23,7 @@ type UI interface {
 	PrintSubAgentStatus(msg string)
 	PrintDiff(path, oldContent, newContent string)
 	PrintFilePreview(path, content string)
+	PrintPatch(patch string)
 	ConfirmAction(prompt string) bool
 }
 
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// Limits on the file content @path references inline into a message.
+const (
+	maxAttachLines    = 500     // lines inlined per file; the rest is left to the read tool
+	maxAttachFileSize = 1 << 20 // files larger than this are not inlined at all
+)
+
+// attachRef matches an @path reference: an @ at the start of the input or
+// after whitespace, so e-mail addresses are left alone.
+var attachRef = regexp.MustCompile(`(?:^|\s)@(\S+)`)
+
+// expandAttachments appends the line-numbered content of every file the
+// input references as @path, so the model has it without a read round-trip.
+// Paths are relative to workDir (or absolute inside it). A reference that is
+// not an existing file is left as plain text; one that names a file which
+// cannot be inlined gets a warning for the user. Each file is attached once.
+func expandAttachments(workDir, input string) (message string, warnings []string) {
+	var attached strings.Builder
+	seen := make(map[string]bool)
+	for _, m := range attachRef.FindAllStringSubmatch(input, -1) {
+		ref := attachPath(workDir, m[1])
+		if ref == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		content, err := attachContent(workDir, ref)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("@%s: %s", ref, err))
+			continue
+		}
+		fmt.Fprintf(&attached, "\n\nContents of %s:\n%s", ref, content)
+	}
+	return input + attached.String(), warnings
+}
+
+// attachPath returns the path an @ reference names, trimming punctuation
+// that ends the sentence around it, or "" if no such file or directory
+// exists.
+func attachPath(workDir, ref string) string {
+	for _, path := range []string{ref, strings.TrimRight(ref, ".,;:!?)]}'\"")} {
+		if path == "" {
+			continue
+		}
+		abs := path
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(workDir, abs)
+		}
+		if _, err := os.Stat(abs); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// attachContent returns the fenced, line-numbered content of path, capped
+// at maxAttachLines.
+func attachContent(workDir, path string) (string, error) {
+	absPath, err := tools.ValidatePath(workDir, path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("is a directory")
+	}
+	if info.Size() > maxAttachFileSize {
+		return "", fmt.Errorf("file is %d KB; only files up to %d KB are attached", info.Size()/1024, maxAttachFileSize/1024)
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", fmt.Errorf("binary file")
+	}
+	if len(data) == 0 {
+		return "(empty file)", nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+	var b strings.Builder
+	for i, line := range lines[:min(len(lines), maxAttachLines)] {
+		fmt.Fprintf(&b, "%4d │ %s\n", i+1, line)
+	}
+	numbered := strings.TrimSuffix(b.String(), "\n")
+	lang := strings.TrimPrefix(filepath.Ext(path), ".")
+	fence, body, _ := strings.Cut(codeFence(numbered), "\n")
+	out := fence + lang + "\n" + body
+	if len(lines) > maxAttachLines {
+		out += fmt.Sprintf("\n(Showing lines 1-%d of %d; read the rest with start_line=%d.)", maxAttachLines, len(lines), maxAttachLines+1)
+	}
+	return out, nil
+}
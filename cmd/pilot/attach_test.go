@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandAttachments(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "foo.go"), []byte("package foo\n\nfunc Foo() {}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.md"), []byte("# Notes\r\n"), 0644)
+
+	input := "Compare @src/foo.go with @" + filepath.Join(dir, "notes.md") + ", then fix @src/foo.go."
+	got, warnings := expandAttachments(dir, input)
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+	want := input +
+		"\n\nContents of src/foo.go:\n```go\n   1 │ package foo\n   2 │ \n   3 │ func Foo() {}\n```" +
+		"\n\nContents of " + filepath.Join(dir, "notes.md") + ":\n```md\n   1 │ # Notes\n```"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExpandAttachmentsSkipsAndWarns(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "bin.dat"), []byte("a\x00b"), 0644)
+	os.Mkdir(filepath.Join(dir, "pkg"), 0755)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret\n"), 0644)
+
+	// Plain mentions and e-mail addresses are not references
+	input := "ask @alice or mail bob@example.com"
+	if got, warnings := expandAttachments(dir, input); got != input || len(warnings) != 0 {
+		t.Errorf("expected input unchanged, got %q, %v", got, warnings)
+	}
+
+	for _, ref := range []string{"bin.dat", "pkg", outside} {
+		input := "look at @" + ref
+		got, warnings := expandAttachments(dir, input)
+		if got != input || len(warnings) != 1 {
+			t.Errorf("@%s: expected one warning and no attachment, got %q, %v", ref, got, warnings)
+		}
+	}
+}
+
+func TestExpandAttachmentsTruncates(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	for i := 1; i <= maxAttachLines+20; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	os.WriteFile(filepath.Join(dir, "long.txt"), []byte(b.String()), 0644)
+
+	got, _ := expandAttachments(dir, "@long.txt")
+	if !strings.Contains(got, fmt.Sprintf(" %d │ line %d\n", maxAttachLines, maxAttachLines)) || strings.Contains(got, fmt.Sprintf("line %d\n", maxAttachLines+1)) {
+		t.Errorf("expected exactly %d lines inlined", maxAttachLines)
+	}
+	if !strings.HasSuffix(got, fmt.Sprintf("(Showing lines 1-%d of %d; read the rest with start_line=%d.)", maxAttachLines, maxAttachLines+20, maxAttachLines+1)) {
+		t.Errorf("expected a truncation note, got tail %q", got[len(got)-100:])
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// commandRunner runs an external command and returns its stdout. It is
+// swapped out in tests.
+type commandRunner func(name string, args ...string) ([]byte, error)
+
+// runCommand is the commandRunner used outside tests.
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// clipboardCommands returns the commands that print the clipboard on goos,
+// in order of preference.
+func clipboardCommands(goos string) [][]string {
+	switch goos {
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	default:
+		return [][]string{
+			{"wl-paste", "--no-newline"},
+			{"xclip", "-selection", "clipboard", "-o"},
+			{"xsel", "--clipboard", "--output"},
+		}
+	}
+}
+
+// readClipboard returns the clipboard text using the first clipboard utility
+// for goos that is installed.
+func readClipboard(goos string, run commandRunner) (string, error) {
+	cmds := clipboardCommands(goos)
+	for _, c := range cmds {
+		out, err := run(c[0], c[1:]...)
+		if errors.Is(err, exec.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", c[0], err)
+		}
+		text := strings.TrimRight(strings.ReplaceAll(string(out), "\r\n", "\n"), "\n")
+		if strings.TrimSpace(text) == "" {
+			return "", fmt.Errorf("clipboard is empty")
+		}
+		return text, nil
+	}
+
+	names := make([]string, len(cmds))
+	for i, c := range cmds {
+		names[i] = c[0]
+	}
+	return "", fmt.Errorf("no clipboard utility found (tried %s)", strings.Join(names, ", "))
+}
+
+// clipMessage combines a user message with clipboard text for the model.
+func clipMessage(text, clip string) string {
+	if text == "" {
+		text = "Here is what I copied:"
+	}
+	return text + "\n\n" + codeFence(clip)
+}
+
+// codeFence fences s, using a fence longer than any backtick run inside it.
+func codeFence(s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + s + "\n" + fence
+}
+
+// pasteClipboard reads the clipboard on the current OS.
+func pasteClipboard() (string, error) {
+	return readClipboard(runtime.GOOS, runCommand)
+}
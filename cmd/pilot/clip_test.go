@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// fakeRunner returns a commandRunner that serves outputs for installed
+// commands and reports every other command as not found.
+func fakeRunner(installed map[string]string, ran *[]string) commandRunner {
+	return func(name string, args ...string) ([]byte, error) {
+		*ran = append(*ran, strings.Join(append([]string{name}, args...), " "))
+		out, ok := installed[name]
+		if !ok {
+			return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+		}
+		return []byte(out), nil
+	}
+}
+
+func TestReadClipboardDispatch(t *testing.T) {
+	tests := []struct {
+		goos      string
+		installed map[string]string
+		want      string
+		wantRan   []string
+	}{
+		{"darwin", map[string]string{"pbpaste": "mac text\n"}, "mac text", []string{"pbpaste"}},
+		{"windows", map[string]string{"powershell": "win text\r\nline 2\r\n"}, "win text\nline 2",
+			[]string{"powershell -NoProfile -Command Get-Clipboard"}},
+		{"linux", map[string]string{"wl-paste": "wayland"}, "wayland", []string{"wl-paste --no-newline"}},
+		{"linux", map[string]string{"xclip": "x11"}, "x11",
+			[]string{"wl-paste --no-newline", "xclip -selection clipboard -o"}},
+		{"freebsd", map[string]string{"xsel": "bsd"}, "bsd",
+			[]string{"wl-paste --no-newline", "xclip -selection clipboard -o", "xsel --clipboard --output"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.want, func(t *testing.T) {
+			var ran []string
+			got, err := readClipboard(tt.goos, fakeRunner(tt.installed, &ran))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if strings.Join(ran, "|") != strings.Join(tt.wantRan, "|") {
+				t.Errorf("expected commands %q, got %q", tt.wantRan, ran)
+			}
+		})
+	}
+}
+
+func TestReadClipboardNoUtility(t *testing.T) {
+	var ran []string
+	_, err := readClipboard("linux", fakeRunner(nil, &ran))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "no clipboard utility found") || !strings.Contains(err.Error(), "xclip") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReadClipboardErrors(t *testing.T) {
+	var ran []string
+	if _, err := readClipboard("darwin", fakeRunner(map[string]string{"pbpaste": " \n"}, &ran)); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected empty clipboard error, got %v", err)
+	}
+
+	failed := errors.New("exit status 1")
+	run := func(name string, args ...string) ([]byte, error) { return nil, failed }
+	if _, err := readClipboard("darwin", run); !errors.Is(err, failed) {
+		t.Errorf("expected command failure to be returned, got %v", err)
+	}
+}
+
+func TestClipMessage(t *testing.T) {
+	got := clipMessage("why does this fail?", "panic: boom")
+	want := "why does this fail?\n\n```\npanic: boom\n```"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := clipMessage("", "x := 1"); !strings.HasPrefix(got, "Here is what I copied:") {
+		t.Errorf("expected default lead-in, got %q", got)
+	}
+	if got := clipMessage("see", "```go\nx\n```"); !strings.Contains(got, "````\n```go") {
+		t.Errorf("expected a longer fence around fenced text, got %q", got)
+	}
+}
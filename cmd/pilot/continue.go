@@ -0,0 +1,17 @@
+package main
+
+// enterContinueMessage is sent for an empty Enter that continues a turn.
+const enterContinueMessage = "Continue."
+
+// maxEnterContinues is how many empty Enters in a row may continue before
+// one has to be typed, so a held or repeated Enter cannot keep the model
+// running unattended.
+const maxEnterContinues = 3
+
+// shouldContinueOnEnter decides whether an empty line is sent as
+// enterContinueMessage: only with the option enabled, when the last turn
+// ended open (asked a question or was cut off), and while fewer than
+// maxEnterContinues empty Enters in a row have already continued.
+func shouldContinueOnEnter(enabled, turnOpen bool, streak int) bool {
+	return enabled && turnOpen && streak < maxEnterContinues
+}
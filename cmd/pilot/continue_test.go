@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestShouldContinueOnEnter(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		turnOpen bool
+		streak   int
+		want     bool
+	}{
+		{"disabled", false, true, 0, false},
+		{"turn finished", true, false, 0, false},
+		{"open turn", true, true, 0, true},
+		{"still under the streak cap", true, true, maxEnterContinues - 1, true},
+		{"streak cap reached", true, true, maxEnterContinues, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldContinueOnEnter(tt.enabled, tt.turnOpen, tt.streak); got != tt.want {
+				t.Errorf("shouldContinueOnEnter(%v, %v, %d) = %v, want %v", tt.enabled, tt.turnOpen, tt.streak, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/lowkaihon/cli-coding-agent/config"
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+// errorHint suggests what to do about a failed LLM request to provider, or
+// returns "" if the error's cause is not recognized.
+func errorHint(err error, provider string) string {
+	switch llm.ClassifyError(err) {
+	case llm.ErrorAuth:
+		return "The provider rejected the API key. Check " + config.APIKeyEnv(provider) + ", or switch providers with /provider."
+	case llm.ErrorRateLimit:
+		return "Still rate limited after retrying. Wait a minute and try again, or switch models with /model."
+	case llm.ErrorServer:
+		return "The provider is having problems or is overloaded. Try again shortly."
+	case llm.ErrorNetwork:
+		return "Could not reach the provider. Check your network connection, then try again."
+	case llm.ErrorRequest:
+		return "The provider rejected the request. If the conversation is large, /compact or /clear may help."
+	default:
+		return ""
+	}
+}
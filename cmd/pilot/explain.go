@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// maxExplainLines caps how much code /explain pre-loads into the prompt.
+const maxExplainLines = 500
+
+// parseLineRange parses a "<path>:<start>-<end>" or "<path>:<line>" selection.
+// Lines are 1-indexed and inclusive.
+func parseLineRange(arg string) (path string, start, end int, err error) {
+	i := strings.LastIndex(arg, ":")
+	if i <= 0 || i == len(arg)-1 {
+		return "", 0, 0, fmt.Errorf("want <path>:<start>-<end>")
+	}
+	path, spec := arg[:i], arg[i+1:]
+
+	lo, hi, isRange := strings.Cut(spec, "-")
+	start, err = strconv.Atoi(lo)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid start line %q", lo)
+	}
+	end = start
+	if isRange {
+		end, err = strconv.Atoi(hi)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("invalid end line %q", hi)
+		}
+	}
+	if start < 1 || end < start {
+		return "", 0, 0, fmt.Errorf("invalid line range %d-%d", start, end)
+	}
+	return path, start, end, nil
+}
+
+// extractLines returns lines start..end of content, checking that the range
+// lies within the file.
+func extractLines(content string, start, end int) (string, error) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if end > len(lines) {
+		return "", fmt.Errorf("line range %d-%d is past the end of the file (%d lines)", start, end, len(lines))
+	}
+	if end-start+1 > maxExplainLines {
+		return "", fmt.Errorf("selection is %d lines; /explain takes at most %d", end-start+1, maxExplainLines)
+	}
+	return strings.Join(lines[start-1:end], "\n"), nil
+}
+
+// explainPrompt builds the user message for /explain: the selected code,
+// pre-loaded so the model can answer without reading the file first.
+func explainPrompt(workDir, arg string) (string, error) {
+	path, start, end, err := parseLineRange(arg)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := tools.ValidatePath(workDir, path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	snippet, err := extractLines(string(data), start, end)
+	if err != nil {
+		return "", err
+	}
+
+	lang := strings.TrimPrefix(filepath.Ext(path), ".")
+	return fmt.Sprintf("Explain this code from %s (lines %d-%d). Focus on just this selection: what it does, how, and anything notable. Only read other files if you need them to understand it.\n\n```%s\n%s\n```",
+		path, start, end, lang, snippet), nil
+}
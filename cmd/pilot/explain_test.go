@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		arg        string
+		path       string
+		start, end int
+		wantErr    bool
+	}{
+		{"main.go:10-20", "main.go", 10, 20, false},
+		{"sub/util.go:7", "sub/util.go", 7, 7, false},
+		{`C:\src\main.go:3-4`, `C:\src\main.go`, 3, 4, false},
+		{"main.go", "", 0, 0, true},
+		{"main.go:", "", 0, 0, true},
+		{":1-2", "", 0, 0, true},
+		{"main.go:a-2", "", 0, 0, true},
+		{"main.go:5-x", "", 0, 0, true},
+		{"main.go:0-2", "", 0, 0, true},
+		{"main.go:9-3", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			path, start, end, err := parseLineRange(tt.arg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s:%d-%d", path, start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if path != tt.path || start != tt.start || end != tt.end {
+				t.Errorf("got %s:%d-%d, want %s:%d-%d", path, start, end, tt.path, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestExtractLines(t *testing.T) {
+	content := "one\ntwo\nthree\nfour\n"
+
+	got, err := extractLines(content, 2, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "two\nthree" {
+		t.Errorf("got %q, want %q", got, "two\nthree")
+	}
+
+	if got, _ := extractLines(content, 4, 4); got != "four" {
+		t.Errorf("expected last line, got %q", got)
+	}
+	if _, err := extractLines(content, 3, 5); err == nil {
+		t.Error("expected error for range past end of file")
+	}
+}
+
+func TestExplainPrompt(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "calc.go"), []byte("package calc\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n"), 0644)
+
+	prompt, err := explainPrompt(dir, "calc.go:3-5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(prompt, "calc.go (lines 3-5)") {
+		t.Errorf("expected path and range in prompt, got: %s", prompt)
+	}
+	if !strings.Contains(prompt, "```go\nfunc Add(a, b int) int {\n\treturn a + b\n}\n```") {
+		t.Errorf("expected fenced snippet in prompt, got: %s", prompt)
+	}
+	if strings.Contains(prompt, "package calc") {
+		t.Error("expected only the selected lines")
+	}
+
+	if _, err := explainPrompt(dir, "../outside.go:1-2"); err == nil {
+		t.Error("expected error for path outside the working directory")
+	}
+	if _, err := explainPrompt(dir, "missing.go:1-2"); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
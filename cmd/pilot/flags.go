@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/lowkaihon/cli-coding-agent/config"
+)
+
+// startupFlags are the REPL's command-line options.
+type startupFlags struct {
+	provider string
+	model    string
+	debug    bool
+	quiet    bool
+}
+
+// parseStartupFlags parses the REPL's command-line arguments. For -h it
+// prints usage to w and returns flag.ErrHelp.
+func parseStartupFlags(w io.Writer, args []string) (startupFlags, error) {
+	var f startupFlags
+	fs := flag.NewFlagSet("pilot", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.StringVar(&f.provider, "provider", "", "LLM provider, openai or anthropic (overrides PILOT_PROVIDER)")
+	fs.StringVar(&f.model, "model", "", "model name (overrides PILOT_MODEL)")
+	fs.BoolVar(&f.debug, "debug", false, "write a debug log (same as PILOT_DEBUG=1)")
+	fs.BoolVar(&f.quiet, "quiet", false, "start at the prompt without the banner (same as PILOT_QUIET=1)")
+	fs.BoolVar(&f.quiet, "no-banner", false, "same as --quiet")
+	if err := fs.Parse(args); err != nil {
+		return f, err
+	}
+	if fs.NArg() > 0 {
+		return f, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return f, nil
+}
+
+// resolveProvider returns the provider the --provider and --model flags
+// select, or "" to leave the choice to config.Load. With only --model, a
+// curated model picks its own provider. Unlike config.Load, which prompts,
+// it fails if the selected provider has no API key (hasKey), since the flags
+// name a provider the user expects to be ready.
+func resolveProvider(f startupFlags, hasKey func(provider string) bool) (string, error) {
+	provider := f.provider
+	if provider != "" && !slices.Contains(config.KnownProviders(), provider) {
+		return "", fmt.Errorf("unknown provider %q: want \"openai\" or \"anthropic\"", provider)
+	}
+	if f.model != "" {
+		if p := knownModelProvider(f.model); p != "" {
+			if provider == "" {
+				provider = p
+			} else if p != provider {
+				return "", fmt.Errorf("model %s is served by %s, not %s", f.model, p, provider)
+			}
+		}
+	}
+	if provider == "" {
+		return "", nil
+	}
+	if !hasKey(provider) {
+		return "", fmt.Errorf("no API key for %s: set %s", provider, config.APIKeyEnv(provider))
+	}
+	return provider, nil
+}
+
+// knownModelProvider returns the provider of a curated model, or "" for a
+// model not in config.KnownModels.
+func knownModelProvider(model string) string {
+	for _, m := range config.KnownModels() {
+		if m.Model == model {
+			return m.Provider
+		}
+	}
+	return ""
+}
+
+// applyModelFlag sets the --model flag's model (or one picked by a model
+// rule) on cfg, with that model's context window.
+func applyModelFlag(cfg *config.Config, model string) {
+	if model == "" {
+		return
+	}
+	cfg.Model = model
+	_, _, cfg.ContextWindow = config.ProviderDefaults(cfg.Provider, model)
+}
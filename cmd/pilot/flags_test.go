@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/config"
+)
+
+func TestParseStartupFlags(t *testing.T) {
+	f, err := parseStartupFlags(io.Discard, []string{"--provider", "anthropic", "--model=claude-opus-4-6", "--debug", "--no-banner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.provider != "anthropic" || f.model != "claude-opus-4-6" || !f.debug || !f.quiet {
+		t.Errorf("unexpected flags: %+v", f)
+	}
+
+	if _, err := parseStartupFlags(io.Discard, []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("expected flag.ErrHelp for -h, got %v", err)
+	}
+	if _, err := parseStartupFlags(io.Discard, []string{"--bogus"}); err == nil {
+		t.Error("expected an error for an unknown flag")
+	}
+	if _, err := parseStartupFlags(io.Discard, []string{"hello"}); err == nil {
+		t.Error("expected an error for a positional argument")
+	}
+}
+
+func TestResolveProvider(t *testing.T) {
+	onlyOpenAI := func(p string) bool { return p == "openai" }
+	tests := []struct {
+		name    string
+		flags   startupFlags
+		want    string
+		wantErr string
+	}{
+		{"no flags", startupFlags{}, "", ""},
+		{"provider", startupFlags{provider: "openai"}, "openai", ""},
+		{"unknown provider", startupFlags{provider: "gemini"}, "", "unknown provider"},
+		{"missing key", startupFlags{provider: "anthropic"}, "", "ANTHROPIC_API_KEY"},
+		{"known model picks provider", startupFlags{model: "gpt-4o-mini"}, "openai", ""},
+		{"known model missing key", startupFlags{model: "claude-opus-4-6"}, "", "ANTHROPIC_API_KEY"},
+		{"unknown model", startupFlags{model: "my-finetune"}, "", ""},
+		{"unknown model with provider", startupFlags{provider: "openai", model: "my-finetune"}, "openai", ""},
+		{"mismatch", startupFlags{provider: "openai", model: "claude-opus-4-6"}, "", "is served by anthropic"},
+	}
+	for _, tt := range tests {
+		got, err := resolveProvider(tt.flags, onlyOpenAI)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyModelFlag(t *testing.T) {
+	cfg := &config.Config{Provider: "openai", Model: "gpt-4o-mini", ContextWindow: 128000}
+	applyModelFlag(cfg, "")
+	if cfg.Model != "gpt-4o-mini" {
+		t.Errorf("empty flag changed the model to %q", cfg.Model)
+	}
+
+	applyModelFlag(cfg, "gpt-5.2-codex")
+	_, _, window := config.ProviderDefaults("openai", "gpt-5.2-codex")
+	if cfg.Model != "gpt-5.2-codex" || cfg.ContextWindow != window {
+		t.Errorf("got model %q, window %d; want gpt-5.2-codex, %d", cfg.Model, cfg.ContextWindow, window)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+// errIdle is the cancellation cause of a prompt read that timed out.
+var errIdle = errors.New("idle timeout")
+
+// countdown runs a function once a prompt read has gone a while without a
+// keystroke: Touch, called for each key, starts the wait over.
+type countdown struct {
+	// afterFunc schedules f after d and returns a function that cancels it;
+	// replaced in tests to control time.
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+
+	mu      sync.Mutex
+	restart func() // starts the armed wait over; nil when disarmed
+}
+
+// newCountdown returns a countdown backed by time.AfterFunc.
+func newCountdown() countdown {
+	return countdown{afterFunc: func(d time.Duration, f func()) func() bool {
+		return time.AfterFunc(d, f).Stop
+	}}
+}
+
+// arm runs f after d without a keystroke, until disarm is called.
+func (c *countdown) arm(d time.Duration, f func()) (disarm func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := c.afterFunc(d, f)
+	c.restart = func() {
+		stop()
+		stop = c.afterFunc(d, f)
+	}
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		stop()
+		c.restart = nil
+	}
+}
+
+// Touch starts the armed wait, if any, over.
+func (c *countdown) Touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.restart != nil {
+		c.restart()
+	}
+}
+
+// idleTimer cancels the prompt read after a period without input. A nil
+// idleTimer is disabled.
+type idleTimer struct {
+	countdown
+	timeout time.Duration
+}
+
+// newIdleTimer returns a timer for the given timeout, or nil if timeout is 0.
+func newIdleTimer(timeout time.Duration) *idleTimer {
+	if timeout <= 0 {
+		return nil
+	}
+	return &idleTimer{countdown: newCountdown(), timeout: timeout}
+}
+
+// Start arms the timer for one prompt read. The returned context is cancelled
+// with errIdle once the timeout passes without a keystroke (see Touch);
+// calling stop (when input arrives) disarms the timer. Each call starts a
+// fresh countdown.
+func (it *idleTimer) Start(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	if it == nil {
+		return ctx, func() { cancel(nil) }
+	}
+	disarm := it.arm(it.timeout, func() { cancel(errIdle) })
+	return ctx, func() {
+		disarm()
+		cancel(nil)
+	}
+}
+
+// Touch restarts the countdown of the read in progress, on a keystroke.
+func (it *idleTimer) Touch() {
+	if it != nil {
+		it.countdown.Touch()
+	}
+}
+
+// isIdleTimeout reports whether ctx was cancelled by the idle timer.
+func isIdleTimeout(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errIdle)
+}
+
+// errIdleCompact is the cancellation cause of a prompt read given up so the
+// conversation can be compacted while idle.
+var errIdleCompact = errors.New("idle compaction")
+
+// idleCompactDelay is how long the prompt waits without a keystroke before
+// an idle compaction starts.
+const idleCompactDelay = 30 * time.Second
+
+// idleCompactor gives up the prompt read after idleCompactDelay without
+// input when the conversation is over a soft threshold, below the one that
+// compacts at the start of a turn, so the compaction runs while the user is
+// away. A nil idleCompactor is disabled.
+type idleCompactor struct {
+	countdown
+	ag   *agent.Agent
+	soft float64 // fraction of the context window
+}
+
+// newIdleCompactor returns a compactor for the given percentage of the
+// context window, or nil if percent is 0.
+func newIdleCompactor(ag *agent.Agent, percent int) *idleCompactor {
+	if percent <= 0 {
+		return nil
+	}
+	return &idleCompactor{countdown: newCountdown(), ag: ag, soft: float64(percent) / 100}
+}
+
+// Start arms the compactor for one prompt read, if the conversation needs
+// compacting. The returned context is cancelled with errIdleCompact once the
+// delay passes without a keystroke (see Touch), leaving any typed text as
+// the line editor's draft; calling stop (when input arrives) disarms it.
+func (c *idleCompactor) Start(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	if c == nil || !c.ag.NeedsIdleCompact(c.soft) {
+		return ctx, func() { cancel(nil) }
+	}
+	disarm := c.arm(idleCompactDelay, func() { cancel(errIdleCompact) })
+	return ctx, func() {
+		disarm()
+		cancel(nil)
+	}
+}
+
+// Touch restarts the delay of the read in progress, on a keystroke.
+func (c *idleCompactor) Touch() {
+	if c != nil {
+		c.countdown.Touch()
+	}
+}
+
+// Compact runs the idle compaction.
+func (c *idleCompactor) Compact(ctx context.Context, term *ui.Terminal) {
+	c.ag.IdleCompact(ctx, term, c.soft)
+}
+
+// isIdleCompact reports whether ctx was cancelled by the idle compactor.
+func isIdleCompact(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errIdleCompact)
+}
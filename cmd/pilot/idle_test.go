@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+	"github.com/lowkaihon/cli-coding-agent/llm"
+	"github.com/lowkaihon/cli-coding-agent/tools"
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+// fakeClock records scheduled callbacks so tests can fire them on demand.
+type fakeClock struct {
+	delays  []time.Duration
+	funcs   []func()
+	stopped []bool
+}
+
+func (c *fakeClock) afterFunc(d time.Duration, f func()) func() bool {
+	i := len(c.funcs)
+	c.delays = append(c.delays, d)
+	c.funcs = append(c.funcs, f)
+	c.stopped = append(c.stopped, false)
+	return func() bool {
+		c.stopped[i] = true
+		return true
+	}
+}
+
+func newFakeIdleTimer(timeout time.Duration) (*idleTimer, *fakeClock) {
+	clock := &fakeClock{}
+	it := newIdleTimer(timeout)
+	it.afterFunc = clock.afterFunc
+	return it, clock
+}
+
+func TestIdleTimerFires(t *testing.T) {
+	it, clock := newFakeIdleTimer(10 * time.Minute)
+
+	ctx, stop := it.Start(context.Background())
+	defer stop()
+	if len(clock.delays) != 1 || clock.delays[0] != 10*time.Minute {
+		t.Fatalf("expected one 10m timer, got %v", clock.delays)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("context cancelled before the timer fired")
+	}
+
+	clock.funcs[0]()
+
+	if ctx.Err() == nil {
+		t.Fatal("expected context cancelled after the timer fired")
+	}
+	if !isIdleTimeout(ctx) {
+		t.Errorf("expected idle timeout cause, got %v", context.Cause(ctx))
+	}
+}
+
+func TestIdleTimerResetOnInput(t *testing.T) {
+	it, clock := newFakeIdleTimer(time.Minute)
+
+	// Input arrives before the timeout: the timer is disarmed
+	ctx, stop := it.Start(context.Background())
+	stop()
+	if !clock.stopped[0] {
+		t.Error("expected first timer stopped on input")
+	}
+	if isIdleTimeout(ctx) {
+		t.Error("expected input, not idle timeout, to end the first read")
+	}
+
+	// The next read starts a fresh countdown
+	ctx, stop = it.Start(context.Background())
+	defer stop()
+	if len(clock.funcs) != 2 || clock.stopped[1] {
+		t.Fatalf("expected a fresh running timer, got %d timers", len(clock.funcs))
+	}
+	if ctx.Err() != nil {
+		t.Error("expected new read context to be live")
+	}
+}
+
+func TestIdleTimerRestartsOnKey(t *testing.T) {
+	it, clock := newFakeIdleTimer(time.Minute)
+
+	ctx, stop := it.Start(context.Background())
+	it.Touch()
+	if len(clock.funcs) != 2 || !clock.stopped[0] || clock.delays[1] != time.Minute {
+		t.Fatalf("expected a keystroke to restart the minute, got delays %v stopped %v", clock.delays, clock.stopped)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the read still live after a keystroke")
+	}
+	clock.funcs[1]()
+	if !isIdleTimeout(ctx) {
+		t.Errorf("expected idle timeout after a minute without keys, got %v", context.Cause(ctx))
+	}
+
+	// Keys between reads arm nothing
+	stop()
+	it.Touch()
+	if len(clock.funcs) != 2 {
+		t.Errorf("expected no timer outside a read, got %d", len(clock.funcs))
+	}
+}
+
+func TestIdleTimerDisabled(t *testing.T) {
+	it := newIdleTimer(0)
+	if it != nil {
+		t.Fatal("expected nil timer for zero timeout")
+	}
+	ctx, stop := it.Start(context.Background())
+	if ctx.Err() != nil {
+		t.Error("expected live context from disabled timer")
+	}
+	stop()
+	if isIdleTimeout(ctx) {
+		t.Error("disabled timer must never report idle")
+	}
+}
+
+func TestIdleCompactorDisabled(t *testing.T) {
+	c := newIdleCompactor(nil, 0)
+	if c != nil {
+		t.Fatal("expected nil compactor for zero percent")
+	}
+	ctx, stop := c.Start(context.Background())
+	stop()
+	if isIdleCompact(ctx) || isIdleTimeout(ctx) {
+		t.Errorf("disabled compactor must never end the read, got cause %v", context.Cause(ctx))
+	}
+}
+
+// replyClient answers every request with the same text.
+type replyClient struct{ text string }
+
+func (c replyClient) SendMessage(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (*llm.Response, error) {
+	return &llm.Response{Message: llm.TextMessage("assistant", c.text), FinishReason: "stop"}, nil
+}
+
+func (c replyClient) StreamMessage(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (<-chan llm.StreamEvent, error) {
+	ch := make(chan llm.StreamEvent, 2)
+	ch <- llm.StreamEvent{TextDelta: c.text}
+	ch <- llm.StreamEvent{FinishReason: "stop", Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func TestIdleCompactorRestartsOnKey(t *testing.T) {
+	dir := t.TempDir()
+	ag := agent.New(replyClient{"Hi."}, tools.NewRegistry(dir), dir, 100000)
+	if err := ag.Run(context.Background(), "hello", ui.NewTerminal()); err != nil {
+		t.Fatal(err)
+	}
+	c := newIdleCompactor(ag, 1) // the system prompt alone is over 1%
+	clock := &fakeClock{}
+	c.afterFunc = clock.afterFunc
+
+	ctx, stop := c.Start(context.Background())
+	defer stop()
+	if len(clock.delays) != 1 || clock.delays[0] != idleCompactDelay {
+		t.Fatalf("expected the compactor armed, got %v", clock.delays)
+	}
+
+	// Typing puts the compaction off, so a half-written prompt is not cut off
+	c.Touch()
+	if len(clock.funcs) != 2 || !clock.stopped[0] || clock.delays[1] != idleCompactDelay {
+		t.Fatalf("expected a keystroke to restart the delay, got delays %v stopped %v", clock.delays, clock.stopped)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected the read still live after a keystroke")
+	}
+	clock.funcs[1]()
+	if !isIdleCompact(ctx) {
+		t.Errorf("expected idle compaction after the delay without keys, got %v", context.Cause(ctx))
+	}
+}
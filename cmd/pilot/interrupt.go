@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// interruptAction is what a Ctrl+C does.
+type interruptAction int
+
+const (
+	// interruptCancel cancels the running turn.
+	interruptCancel interruptAction = iota
+	// interruptHint tells the user how to exit; nothing else happens.
+	interruptHint
+	// interruptExit quits Pilot.
+	interruptExit
+)
+
+// interruptTracker decides what each Ctrl+C does: during a turn it cancels
+// the turn, and at the prompt a second press within window of the previous
+// one exits. With a zero window, the first press at the prompt exits.
+type interruptTracker struct {
+	window time.Duration
+	now    func() time.Time // replaced in tests to control time
+	last   time.Time        // previous Ctrl+C, whether or not a turn was running
+}
+
+// newInterruptTracker returns a tracker with the given double-tap window.
+func newInterruptTracker(window time.Duration) *interruptTracker {
+	return &interruptTracker{window: window, now: time.Now}
+}
+
+// Press records a Ctrl+C and returns what it should do. running reports
+// whether a turn is in progress.
+func (t *interruptTracker) Press(running bool) interruptAction {
+	now := t.now()
+	doubleTap := !t.last.IsZero() && now.Sub(t.last) < t.window
+	t.last = now
+	switch {
+	case running:
+		return interruptCancel
+	case doubleTap || t.window <= 0:
+		return interruptExit
+	default:
+		return interruptHint
+	}
+}
+
+// Hint is the message shown for interruptHint.
+func (t *interruptTracker) Hint() string {
+	return fmt.Sprintf("Press Ctrl+C again within %s to exit.", formatWindow(t.window))
+}
+
+// formatWindow renders a window as "2s" or "1.5s".
+func formatWindow(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
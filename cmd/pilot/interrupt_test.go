@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newFakeInterruptTracker returns a tracker whose clock is advanced by the
+// returned function.
+func newFakeInterruptTracker(window time.Duration) (*interruptTracker, func(time.Duration)) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := newInterruptTracker(window)
+	t.now = func() time.Time { return now }
+	return t, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestInterruptDoubleTap(t *testing.T) {
+	it, advance := newFakeInterruptTracker(2 * time.Second)
+
+	if got := it.Press(false); got != interruptHint {
+		t.Fatalf("first press at the prompt: got %v, want hint", got)
+	}
+	advance(time.Second)
+	if got := it.Press(false); got != interruptExit {
+		t.Errorf("second press within the window: got %v, want exit", got)
+	}
+
+	it, advance = newFakeInterruptTracker(2 * time.Second)
+	it.Press(false)
+	advance(3 * time.Second)
+	if got := it.Press(false); got != interruptHint {
+		t.Errorf("second press after the window: got %v, want hint", got)
+	}
+}
+
+func TestInterruptDuringTurn(t *testing.T) {
+	it, advance := newFakeInterruptTracker(2 * time.Second)
+
+	// Every press during a turn cancels it, however fast
+	for i := 0; i < 3; i++ {
+		if got := it.Press(true); got != interruptCancel {
+			t.Fatalf("press %d during a turn: got %v, want cancel", i+1, got)
+		}
+		advance(100 * time.Millisecond)
+	}
+
+	// A press at the prompt right after cancelling still counts as the second tap
+	if got := it.Press(false); got != interruptExit {
+		t.Errorf("press at the prompt just after a cancel: got %v, want exit", got)
+	}
+}
+
+func TestInterruptZeroWindow(t *testing.T) {
+	it, _ := newFakeInterruptTracker(0)
+	if got := it.Press(true); got != interruptCancel {
+		t.Errorf("press during a turn: got %v, want cancel", got)
+	}
+	if got := it.Press(false); got != interruptExit {
+		t.Errorf("press at the prompt with no window: got %v, want exit", got)
+	}
+}
+
+func TestInterruptHint(t *testing.T) {
+	tests := map[time.Duration]string{
+		2 * time.Second:         "Press Ctrl+C again within 2s to exit.",
+		1500 * time.Millisecond: "Press Ctrl+C again within 1.5s to exit.",
+	}
+	for window, want := range tests {
+		if got := newInterruptTracker(window).Hint(); got != want {
+			t.Errorf("Hint() for %v = %q, want %q", window, got, want)
+		}
+	}
+}
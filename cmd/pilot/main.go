@@ -5,18 +5,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/lowkaihon/cli-coding-agent/agent"
 	"github.com/lowkaihon/cli-coding-agent/config"
+	"github.com/lowkaihon/cli-coding-agent/debuglog"
 	"github.com/lowkaihon/cli-coding-agent/llm"
 	"github.com/lowkaihon/cli-coding-agent/tools"
 	"github.com/lowkaihon/cli-coding-agent/ui"
@@ -35,8 +39,29 @@ func getVersion() string {
 }
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
-		fmt.Printf("pilot %s\n", getVersion())
+	// A panic must not leave the terminal without echo
+	defer ui.RestoreOnPanic()
+
+	if len(os.Args) > 1 && (os.Args[1] == "version" || os.Args[1] == "--version" || os.Args[1] == "-v") {
+		info, _ := debug.ReadBuildInfo()
+		printVersion(os.Stdout, gatherBuildInfo(getVersion(), info))
+		os.Exit(0)
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "sessions" || os.Args[1] == "serve") {
+		workDir, err := os.Getwd()
+		if err == nil && os.Args[1] == "sessions" {
+			var sessDir string
+			if sessDir, err = config.SessionsDir(); err == nil {
+				agent.SetSessionsDir(sessDir)
+				err = runSessions(os.Stdout, workDir, os.Args[2:])
+			}
+		} else if err == nil {
+			err = runServe(os.Stdout, workDir, os.Args[2:])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 
@@ -44,17 +69,41 @@ func main() {
 
 	// Set up signal handling: Ctrl+C cancels current operation first, exits on double-tap
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigCh, os.Interrupt)
+	// SIGTERM and SIGHUP exit at once, after the same cleanup
+	termCh := make(chan os.Signal, 1)
+	signal.Notify(termCh, syscall.SIGTERM, syscall.SIGHUP)
 
-	cfg, err := config.Load("")
+	flags, err := parseStartupFlags(os.Stderr, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(2)
+	}
+
+	// Flags fail fast on a missing key instead of prompting for it
+	config.LoadEnvFiles()
+	provider, err := resolveProvider(flags, func(p string) bool {
+		return config.APIKeyForProvider(p) != "" || os.Getenv("PILOT_REPLAY") != ""
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
-	client := newClient(cfg.Provider, cfg.APIKey, cfg.Model, cfg.MaxTokens, cfg.BaseURL)
-	currentModel := cfg.Model
-	currentProvider := cfg.Provider
+	cfg, err := config.Load(provider)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	applyModelFlag(cfg, flags.model)
+	if flags.debug {
+		cfg.Debug = true
+	}
+	if flags.quiet {
+		cfg.Quiet = true
+	}
 
 	workDir, err := os.Getwd()
 	if err != nil {
@@ -62,78 +111,251 @@ func main() {
 		os.Exit(1)
 	}
 
-	registry := tools.NewRegistry(workDir)
-	ag := agent.New(client, registry, workDir, cfg.ContextWindow)
+	// Model rules only replace the global default, not a chosen model
+	var ruleNote string
+	if flags.model == "" && os.Getenv("PILOT_MODEL") == "" {
+		ruleNote, err = applyModelRules(cfg, workDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	currentModel := cfg.Model
+	currentProvider := cfg.Provider
+	clientOpts, err := clientOptionsFor(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	ag, err := newAgent(cfg, workDir, &clientOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	defer ag.Shutdown()
+
+	var debugLog *debuglog.Logger
+	if cfg.Debug {
+		debugLog, err = openDebugLog(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: debug log disabled: %s\n", err)
+		} else {
+			defer debugLog.Close()
+			ag.SetDebugLog(debugLog)
+		}
+	}
+	// Audit entries are always redacted, whatever PILOT_REDACT says
+	if err := ag.SetAuditLog(cfg.AuditLog, debuglog.Redactor(cfg.APIKey, config.APIKeyForProvider("openai"), config.APIKeyForProvider("anthropic"))); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: audit log disabled: %s\n", err)
+	}
 
 	term := ui.NewTerminal()
-	term.PrintBanner(currentModel, workDir, getVersion())
+	term.SetToolResultLines(cfg.ToolResultLines)
+	term.SetPagerLines(cfg.PagerLines)
+	term.SetBranding(cfg.AssistantName, cfg.Tagline)
+	term.SetConfirmTimeout(cfg.ConfirmTimeout, cfg.ConfirmDefault == config.ConfirmApprove)
+	if cfg.Redact {
+		term.SetRedactor(debuglog.Redactor(cfg.APIKey, config.APIKeyForProvider("openai"), config.APIKeyForProvider("anthropic")))
+	}
+	startup := startupInfo{model: currentModel, workDir: workDir, version: getVersion(), warnings: []string{ag.MemoryWarning()}}
+	startup.warnings = append(startup.warnings, term.SetColors(cfg.Colors)...)
+	if cfg.Replay != "" {
+		startup.warnings = append(startup.warnings, fmt.Sprintf("Replaying recorded responses from %s; the provider is not called.", cfg.Replay))
+	}
+	if cfg.Record != "" {
+		startup.notes = append(startup.notes, fmt.Sprintf("Recording requests and responses to %s", cfg.Record))
+	}
+	if debugLog != nil {
+		startup.notes = append(startup.notes, fmt.Sprintf("Debug log: %s", debugLog.Path()))
+	}
+	startup.notes = append(startup.notes, ruleNote)
+	printStartup(term, cfg.Quiet, startup)
 
 	reader := bufio.NewReader(os.Stdin)
 
+	var history *ui.History
+	if configDir, err := config.ConfigDir(); err == nil {
+		history = ui.LoadHistory(filepath.Join(configDir, "history"))
+	} else {
+		history = ui.LoadHistory("")
+	}
+	editor := ui.NewLineEditor(history)
+
 	// Track whether agent is currently running, protected by mutex
 	var mu sync.Mutex
 	var runCancel context.CancelFunc
-	var lastInterrupt time.Time
+	interrupts := newInterruptTracker(cfg.ExitWindow)
+
+	go func() {
+		<-termCh
+		ag.Shutdown()
+		ui.RestoreTerminal()
+		os.Exit(1)
+	}()
 
 	// Background goroutine to handle Ctrl+C signals
 	go func() {
 		for range sigCh {
 			mu.Lock()
 			cancel := runCancel
-			now := time.Now()
-			doubleTap := now.Sub(lastInterrupt) < 2*time.Second
-			lastInterrupt = now
+			action := interrupts.Press(cancel != nil)
 			mu.Unlock()
 
-			if cancel != nil {
+			switch action {
+			case interruptCancel:
 				// Agent is running — cancel the current operation
 				cancel()
-			} else if doubleTap {
-				// Not running + double-tap — exit program
+			case interruptExit:
 				fmt.Println("\nExiting.")
+				ag.Shutdown()
+				ui.RestoreTerminal()
 				os.Exit(0)
-			} else {
+			default:
 				fmt.Println()
+				term.PrintInfo(interrupts.Hint())
 				term.PrintPrompt()
 			}
 		}
 	}()
 
+	idle := newIdleTimer(cfg.IdleTimeout)
+	compactor := newIdleCompactor(ag, cfg.IdleCompactPercent)
+	editor.SetOnKey(func() {
+		idle.Touch()
+		compactor.Touch()
+	})
+	idleNotified := false // the notify action fires once until the next input
+	pendingClip := ""     // clipboard text /clip attaches to the next message
+	enterStreak := 0      // empty Enters in a row sent as "continue"
+	clarified := false    // a refusal was already answered with Enter
+
 	running := true
 	for running {
-		fmt.Print(term.Prompt())
-		input, err := readInput(reader, term)
+		readCtx, stopIdle := rootCtx, func() {}
+		if !idleNotified {
+			readCtx, stopIdle = idle.Start(rootCtx)
+		}
+		readCtx, stopCompact := compactor.Start(readCtx)
+		input, err := readInput(readCtx, reader, editor, term.Prompt())
+		stopCompact()
+		stopIdle()
+		if isIdleCompact(readCtx) {
+			compactor.Compact(rootCtx, term)
+			continue
+		}
+		if isIdleTimeout(readCtx) {
+			if handleIdle(term, ag, cfg) {
+				// Keep what was typed where the next session can recall it
+				if err := history.Add(editor.Draft()); err != nil {
+					term.PrintWarning(fmt.Sprintf("History save failed: %s", err))
+				}
+				break
+			}
+			idleNotified = true
+			continue
+		}
 		if err != nil {
 			// EOF (Ctrl+D) or error
 			break
 		}
+		idleNotified = false
+
+		if input == "" && ag.Refused() && !clarified {
+			// Offered once per request, so a repeated refusal stands
+			clarified = true
+			input = agent.RefusalClarification
+			term.PrintInfo("Telling the model the task is authorized.")
+		} else if input == "" {
+			if !shouldContinueOnEnter(cfg.EnterContinues, ag.TurnOpen(), enterStreak) {
+				continue
+			}
+			enterStreak++
+			input = enterContinueMessage
+			term.PrintInfo("Continuing.")
+		} else {
+			enterStreak = 0
+			clarified = false
+			if err := history.Add(input); err != nil {
+				term.PrintWarning(fmt.Sprintf("History save failed: %s", err))
+			}
+		}
 
-		if input == "" {
+		cmd, arg := parseCommand(input)
+		if unknownCommand(cmd, ui.Commands()) {
+			if s := suggestCommand(cmd, ui.Commands()); s != "" {
+				term.PrintWarning(fmt.Sprintf("Unknown command %s; did you mean %s?", cmd, s))
+			} else {
+				term.PrintWarning(fmt.Sprintf("Unknown command %s. Type /help for commands.", cmd))
+			}
 			continue
 		}
+		if cmd == "/edit" {
+			text, ok := composeInEditor(term, arg)
+			if !ok {
+				continue
+			}
+			input, cmd = text, ""
+		}
+		if cmd == "" {
+			var warnings []string
+			input, warnings = expandAttachments(workDir, input)
+			for _, w := range warnings {
+				term.PrintWarning(w)
+			}
+		}
+		if cmd == "/explain" {
+			text, err := explainPrompt(workDir, arg)
+			if err != nil {
+				term.PrintWarning(fmt.Sprintf("/explain: %s. Usage: /explain <path>:<start>-<end>", err))
+				continue
+			}
+			input, cmd = text, ""
+		}
+		if cmd == "/clip" {
+			clip, err := pasteClipboard()
+			if err != nil {
+				term.PrintWarning(fmt.Sprintf("/clip: %s", err))
+				continue
+			}
+			if arg == "" {
+				pendingClip = clip
+				term.PrintInfo(fmt.Sprintf("Clipboard (%d lines) will be attached to your next message.", strings.Count(clip, "\n")+1))
+				continue
+			}
+			input, cmd, pendingClip = clipMessage(arg, clip), "", ""
+		}
+		if cmd == "" && pendingClip != "" {
+			input, pendingClip = clipMessage(input, pendingClip), ""
+		}
 
-		switch input {
+		switch cmd {
 		case "/help":
-			term.PrintHelp()
-			if sessDir, err := agent.GlobalSessionsDir(workDir); err == nil {
+			term.PrintHelp(unsupportedCommands(currentProvider, currentModel))
+			if sessDir, err := agent.SessionsDir(workDir); err == nil {
 				fmt.Printf("  Sessions stored at: %s\n\n", sessDir)
 			}
 		case "/model":
 			handleModelSwitch(reader, term, ag, &currentModel, &currentProvider)
+		case "/provider":
+			handleProvider(term, ag, arg, &currentModel, &currentProvider)
 		case "/quit":
 			running = false
 		case "/resume":
-			handleResume(reader, term, ag, workDir)
+			handleResume(reader, term, ag, workDir, arg, &currentModel, &currentProvider)
 		case "/compact":
-			if err := ag.Compact(rootCtx, term); err != nil {
-				term.PrintError(err)
+			if arg != "" {
+				handleCompactAuto(term, ag, arg)
+			} else if err := ag.Compact(rootCtx, term); err != nil {
+				term.PrintErrorHint(err, errorHint(err, currentProvider))
 			} else {
 				if err := ag.SaveSession(); err != nil {
 					term.PrintWarning(fmt.Sprintf("Session save failed: %s", err))
 				}
 			}
 		case "/clear":
-			ag.Clear(term)
+			handleClear(term, ag, arg)
 		case "/context":
 			s := ag.ContextUsage()
 			term.PrintContextUsage(s.TotalTokens, s.ContextWindow, s.Threshold,
@@ -141,6 +363,22 @@ func main() {
 				s.MessageTokens, s.ActualTokens)
 		case "/rewind":
 			handleRewind(reader, term, ag, rootCtx)
+		case "/verbosity":
+			handleVerbosity(term, arg)
+		case "/memory":
+			handleMemory(term, ag, arg)
+		case "/diffstat":
+			handleDiffstat(term, ag)
+		case "/focus":
+			handleFocus(term, ag, arg)
+		case "/unfocus":
+			handleFocus(term, ag, "-")
+		case "/last":
+			handleLast(term, ag)
+		case "/raw":
+			handleRaw(term, ag, arg)
+		case "/temp":
+			handleTemp(term, ag, arg, currentProvider, currentModel, &clientOpts)
 		default:
 			ag.CreateCheckpoint(input)
 
@@ -164,9 +402,13 @@ func main() {
 					fmt.Println("Operation cancelled.")
 					fmt.Println()
 				} else {
-					term.PrintError(err)
+					term.PrintErrorHint(err, errorHint(err, currentProvider))
 				}
 			}
+			printTurnChanges(term, ag)
+			if ag.Refused() && !clarified {
+				term.PrintInfo("The model declined. Press Enter to confirm the task is authorized and ask it to reconsider, or rephrase the request.")
+			}
 
 			if saveErr := ag.SaveSession(); saveErr != nil {
 				term.PrintWarning(fmt.Sprintf("Session save failed: %s", saveErr))
@@ -175,19 +417,208 @@ func main() {
 	}
 }
 
-func newClient(provider, apiKey, model string, maxTokens int, baseURL string) llm.LLMClient {
+// openDebugLog opens the debug log in the config dir, redacting every
+// configured API key.
+func openDebugLog(cfg *config.Config) (*debuglog.Logger, error) {
+	configDir, err := config.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	l, err := debuglog.Open(filepath.Join(configDir, "debug.log"),
+		cfg.APIKey, config.APIKeyForProvider("openai"), config.APIKeyForProvider("anthropic"))
+	if err != nil {
+		return nil, err
+	}
+	l.Log("session_start", "version", getVersion(), "provider", cfg.Provider, "model", cfg.Model)
+	return l, nil
+}
+
+// newAgent builds the agent for workDir from cfg: the LLM client, the tool
+// registry, and the settings shared by the REPL and `pilot serve`. Clients
+// built later by /model or /resume use opts as it is at that time.
+func newAgent(cfg *config.Config, workDir string, opts *clientOptions) (*agent.Agent, error) {
+	registry := tools.NewRegistry(workDir)
+	registry.SetIgnoreDirs(cfg.IgnoreDirs)
+	registry.SetProtectedPaths(protectedPaths(cfg))
+	registry.SetDenyRead(denyReadPaths(cfg))
+	registry.SetGrepIndex(cfg.GrepIndex)
+	registry.SetExplore(cfg.Explore)
+	registry.SetExploreRoots(cfg.ExploreRoots)
+	if err := registry.SetSafeCommands(cfg.SafeCommands); err != nil {
+		return nil, err
+	}
+	registry.SetBashInterim(cfg.BashInterim)
+	registry.SetToolTimeout(cfg.ToolTimeout)
+	if err := registry.SetFormatters(cfg.Formatters); err != nil {
+		return nil, err
+	}
+	if dir, err := config.ConfigDir(); err == nil {
+		custom, err := tools.LoadCustomTools(filepath.Join(dir, "tools"))
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.AddCustomTools(custom); err != nil {
+			return nil, err
+		}
+	}
+
+	agent.SetSessionsDir(cfg.SessionsDir)
+	client := newClient(cfg.Provider, cfg.APIKey, cfg.Model, cfg.MaxTokens, cfg.BaseURL, *opts)
+	ag := agent.New(client, registry, workDir, cfg.ContextWindow)
+	ag.SetModel(cfg.Provider, cfg.Model)
+	ag.SetClientFactory(func(provider, model string) (llm.LLMClient, int, error) {
+		apiKey := config.APIKeyForProvider(provider)
+		if apiKey == "" {
+			return nil, 0, fmt.Errorf("no API key found for %s", provider)
+		}
+		baseURL, maxTokens, contextWindow := config.ProviderDefaults(provider, model)
+		return newClient(provider, apiKey, model, maxTokens, baseURL, *opts), contextWindow, nil
+	})
+	ag.SetAutoApproveEdits(cfg.Approval == config.ApprovalAutoEdit)
+	ag.SetReviewChanges(cfg.Approval == config.ApprovalReview)
+	ag.SetTrustFormatters(cfg.TrustFormatters)
+	ag.SetCompactConfirm(cfg.ConfirmStyle == config.ConfirmStyleCompact)
+	switch cfg.Narration {
+	case config.NarrationExplain:
+		ag.SetNarration(agent.NarrationExplain)
+	case config.NarrationTerse:
+		ag.SetNarration(agent.NarrationTerse)
+	}
+	ag.SetToolResultCompaction(cfg.Compaction == config.CompactionToolResults)
+	ag.SetAutoCompact(cfg.AutoCompact)
+	ag.SetResultSummaries(cfg.SummarizeResults, cfg.SummarizeModel)
+	ag.SetName(cfg.AssistantName)
+	ag.SetExploreTokenBudget(cfg.ExploreTokenBudget)
+	ag.SetExploreLimits(cfg.ExploreIterations, cfg.ExploreToolCalls)
+	ag.SetMemoryTokenLimit(cfg.MemoryTokens)
+	ag.SetWrapUpIterations(cfg.WrapUpIterations)
+	ag.SetMaxToolCalls(cfg.MaxToolCalls)
+	ag.SetProjectTree(cfg.ProjectTree)
+	ag.SetExploreCache(cfg.ExploreCache)
+	ag.SetForkOnResume(cfg.ForkOnResume)
+	return ag, nil
+}
+
+// protectedPaths lists the files write and edit must not touch: Pilot's own
+// session storage, credentials, and binary, then the configured extras.
+func protectedPaths(cfg *config.Config) []tools.ProtectedPath {
+	var paths []tools.ProtectedPath
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, tools.ProtectedPath{Path: filepath.Join(home, ".pilot"), Reason: "it is Pilot's session storage"})
+	}
+	if cfg.SessionsDir != "" {
+		paths = append(paths, tools.ProtectedPath{Path: cfg.SessionsDir, Reason: "it is Pilot's session storage"})
+	}
+	if dir, err := config.ConfigDir(); err == nil {
+		paths = append(paths, tools.ProtectedPath{Path: filepath.Join(dir, "credentials"), Reason: "it is Pilot's credentials file"})
+	}
+	if cfg.AuditLog != "" {
+		paths = append(paths, tools.ProtectedPath{Path: cfg.AuditLog, Reason: "it is Pilot's audit log"})
+	}
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, tools.ProtectedPath{Path: exe, Reason: "it is the running pilot binary"})
+	}
+	for _, p := range cfg.ProtectPaths {
+		paths = append(paths, tools.ProtectedPath{Path: p, Reason: "it is protected by PILOT_PROTECT"})
+	}
+	return paths
+}
+
+// denyReadPaths lists the files read, grep, and glob must not show the
+// model: Pilot's credentials file, the default secrets patterns, then the
+// configured extras.
+func denyReadPaths(cfg *config.Config) []string {
+	var paths []string
+	if dir, err := config.ConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "credentials"))
+	}
+	paths = append(paths, tools.DefaultDenyRead...)
+	return append(paths, cfg.DenyRead...)
+}
+
+func newClient(provider, apiKey, model string, maxTokens int, baseURL string, opts clientOptions) llm.LLMClient {
+	if opts.replay != nil {
+		return opts.replay
+	}
+	var client llm.LLMClient
 	switch provider {
 	case "anthropic":
-		return llm.NewAnthropicClient(apiKey, model, maxTokens, baseURL)
+		c := llm.NewAnthropicClient(apiKey, model, maxTokens, baseURL)
+		c.SetMaxRequestBytes(opts.maxRequestBytes)
+		c.SetTemperature(opts.temperature)
+		c.SetRawCapture(opts.rawCapture, debuglog.Redactor(apiKey))
+		c.SetHeaders(opts.headers[provider])
+		c.SetKeyRefresh(keyRefresh(provider))
+		client = c
 	default:
-		return llm.NewOpenAIResponsesClient(apiKey, model, maxTokens, baseURL)
+		c := llm.NewOpenAIResponsesClient(apiKey, model, maxTokens, baseURL)
+		c.SetMaxRequestBytes(opts.maxRequestBytes)
+		c.SetTemperature(opts.temperature)
+		c.SetRawCapture(opts.rawCapture, debuglog.Redactor(apiKey))
+		c.SetHeaders(opts.headers[provider])
+		c.SetKeyRefresh(keyRefresh(provider))
+		client = c
 	}
+	if opts.recorder != nil {
+		client = opts.recorder.Wrap(client)
+	}
+	return client
 }
 
-// readInput reads one line from the reader, then collects any additional
-// pasted lines that arrived in the same paste event. This handles multi-line
-// paste by checking both the bufio buffer and the OS stdin buffer.
-func readInput(reader *bufio.Reader, term *ui.Terminal) (string, error) {
+// keyRefresh returns a function that reruns the provider's credential
+// command for a new key, or nil if it has none.
+func keyRefresh(provider string) func() (string, error) {
+	if config.CredentialCommand(provider) == "" {
+		return nil
+	}
+	return func() (string, error) {
+		return config.RefreshAPIKey(provider)
+	}
+}
+
+// clientOptions are the request settings every LLM client is built with,
+// kept across /model and /provider switches.
+type clientOptions struct {
+	maxRequestBytes int
+	temperature     *float64 // nil leaves the provider default
+	rawCapture      bool     // keep the last request and response for /raw (debug mode)
+
+	headers map[string]map[string]string // extra request headers by provider; see config.Config.Headers
+
+	recorder *llm.Recorder       // PILOT_RECORD: clients are wrapped to record to a cassette
+	replay   *llm.CassetteClient // PILOT_REPLAY: replaces every client
+}
+
+// clientOptionsFor builds the client options from cfg, opening the record or
+// replay cassette if one is configured. The two cannot be combined.
+func clientOptionsFor(cfg *config.Config) (clientOptions, error) {
+	opts := clientOptions{maxRequestBytes: cfg.MaxRequestMB << 20, temperature: cfg.Temperature, rawCapture: cfg.Debug, headers: cfg.Headers}
+	var err error
+	switch {
+	case cfg.Record != "" && cfg.Replay != "":
+		err = fmt.Errorf("PILOT_RECORD and PILOT_REPLAY cannot both be set")
+	case cfg.Record != "":
+		opts.recorder, err = llm.NewRecorder(cfg.Record)
+	case cfg.Replay != "":
+		opts.replay, err = llm.LoadCassette(cfg.Replay)
+	}
+	return opts, err
+}
+
+// readInput prints the prompt and reads one line of input. On a terminal it
+// uses the raw-mode line editor (with history recall); otherwise it reads one
+// line from the reader, then collects any additional pasted lines that arrived
+// in the same paste event by checking both the bufio buffer and the OS stdin buffer.
+// Only the line editor stops early when ctx is done.
+func readInput(ctx context.Context, reader *bufio.Reader, editor *ui.LineEditor, prompt string) (string, error) {
+	if reader.Buffered() == 0 {
+		line, err := editor.ReadLineContext(ctx, prompt)
+		if !errors.Is(err, ui.ErrNoTTY) {
+			return line, err
+		}
+	}
+
+	fmt.Print(prompt)
 	line, err := reader.ReadString('\n')
 	if err != nil {
 		return "", err
@@ -205,6 +636,244 @@ func readInput(reader *bufio.Reader, term *ui.Terminal) (string, error) {
 	return strings.TrimSpace(strings.Join(lines, "\n")), nil
 }
 
+// handleIdle saves the session after the idle timeout and reports whether
+// Pilot should exit.
+func handleIdle(term *ui.Terminal, ag *agent.Agent, cfg *config.Config) bool {
+	if err := ag.SaveSession(); err != nil {
+		term.PrintWarning(fmt.Sprintf("Session save failed: %s", err))
+	}
+	msg := fmt.Sprintf("Idle for %d minutes, session saved.", int(cfg.IdleTimeout.Minutes()))
+	if cfg.IdleAction == config.IdleActionExit {
+		term.PrintInfo(msg + " Exiting.")
+		return true
+	}
+	term.PrintInfo(msg)
+	return false
+}
+
+// parseCommand splits a slash command into its name and argument string.
+// Input that doesn't start with "/" returns an empty command.
+func parseCommand(input string) (cmd, arg string) {
+	if !strings.HasPrefix(input, "/") {
+		return "", input
+	}
+	cmd, arg, _ = strings.Cut(input, " ")
+	return cmd, strings.TrimSpace(arg)
+}
+
+func handleClear(term *ui.Terminal, ag *agent.Agent, arg string) {
+	if arg == "" {
+		ag.Clear(term)
+		return
+	}
+	keep, count, _ := strings.Cut(arg, " ")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if keep != "keep" || err != nil || n < 1 {
+		term.PrintWarning("Usage: /clear [keep <n>]")
+		return
+	}
+	ag.ClearKeep(n, term)
+}
+
+// handleLast prints the latest tool result in the conversation in full,
+// with the call that produced it.
+func handleLast(term *ui.Terminal, ag *agent.Agent) {
+	call, result, ok := ag.LastToolResult()
+	if !ok {
+		term.PrintInfo("No tool result in the conversation.")
+		return
+	}
+	if call.Function.Name != "" {
+		term.PrintToolCall(call.Function.Name, call.Function.Arguments)
+	}
+	term.PrintFullToolResult(result)
+}
+
+// rawDisplayLimit is how much of each body /raw prints unless asked for all.
+const rawDisplayLimit = 10000
+
+// handleRaw prints the request and response bodies of the latest LLM call.
+// Clients keep them only in debug mode.
+func handleRaw(term *ui.Terminal, ag *agent.Agent, arg string) {
+	if arg != "" && arg != "full" {
+		term.PrintWarning("Usage: /raw [full]")
+		return
+	}
+	r, ok := ag.Client().(llm.RawExchanger)
+	if !ok {
+		term.PrintWarning("This client does not keep raw requests.")
+		return
+	}
+	ex, ok := r.LastExchange()
+	if !ok {
+		term.PrintWarning("No raw request captured. Start Pilot with --debug (or PILOT_DEBUG=1) to keep the last request and response.")
+		return
+	}
+	limit := rawDisplayLimit
+	if arg == "full" {
+		limit = 0
+	}
+	term.PrintRawExchange(ex.Request, ex.Status, ex.Response, limit)
+}
+
+// unsupportedCommands maps the slash commands that model on provider cannot
+// use to the reason, for graying them out in /help.
+func unsupportedCommands(provider, model string) map[string]string {
+	caps := llm.CapabilitiesFor(provider, model)
+	unsupported := make(map[string]string)
+	if !caps.Temperature {
+		unsupported["/temp"] = model + " does not accept a temperature"
+	}
+	return unsupported
+}
+
+// handleTemp shows or sets the sampling temperature for later turns. The
+// setting is kept in opts so it carries over to clients built by /model.
+func handleTemp(term *ui.Terminal, ag *agent.Agent, arg, currentProvider, currentModel string, opts *clientOptions) {
+	var note string
+	if !llm.CapabilitiesFor(currentProvider, currentModel).Temperature {
+		note = fmt.Sprintf(" %s does not accept a temperature, so none is sent while it is in use.", currentModel)
+	}
+	switch arg {
+	case "":
+		if opts.temperature == nil {
+			term.PrintInfo("Temperature: provider default." + note)
+		} else {
+			term.PrintInfo(fmt.Sprintf("Temperature: %g.%s", *opts.temperature, note))
+		}
+		return
+	case "default":
+		opts.temperature = nil
+	default:
+		t, ok := config.ParseTemperature(arg)
+		if !ok {
+			term.PrintWarning("Usage: /temp <0-2>|default")
+			return
+		}
+		opts.temperature = &t
+	}
+
+	if c, ok := ag.Client().(interface{ SetTemperature(*float64) }); ok {
+		c.SetTemperature(opts.temperature)
+	}
+	if opts.temperature == nil {
+		term.PrintInfo("Temperature reset to the provider default." + note)
+	} else {
+		term.PrintInfo(fmt.Sprintf("Temperature set to %g.%s", *opts.temperature, note))
+	}
+}
+
+// handleMemory implements /memory diff, which shows how MEMORY.md changed
+// since the session started (or was resumed from a session that predates
+// snapshots).
+func handleMemory(term *ui.Terminal, ag *agent.Agent, arg string) {
+	if arg != "diff" {
+		term.PrintWarning("Usage: /memory diff")
+		return
+	}
+	oldContent, newContent, summary := ag.MemoryDiff()
+	if summary == "" {
+		term.PrintInfo(fmt.Sprintf("%s is unchanged since the session started.", agent.MemoryFile))
+		return
+	}
+	term.PrintInfo(summary)
+	term.PrintDiff(agent.MemoryFile, oldContent, newContent)
+	fmt.Println()
+}
+
+// handleFocus shows or changes the tool focus. "-" clears it, as /unfocus
+// does.
+func handleFocus(term *ui.Terminal, ag *agent.Agent, arg string) {
+	switch arg {
+	case "":
+		if focus := ag.Focus(); focus != "" {
+			term.PrintInfo(fmt.Sprintf("Focus: %s (glob, grep, and ls search only this by default). /unfocus resets.", focus))
+		} else {
+			term.PrintInfo("No focus set; tools search the whole working directory. Usage: /focus <dir-or-glob>")
+		}
+	case "-":
+		if ag.Focus() == "" {
+			term.PrintInfo("No focus set.")
+			return
+		}
+		ag.SetFocus("")
+		term.PrintInfo("Focus cleared; tools search the whole working directory.")
+	default:
+		if err := ag.SetFocus(arg); err != nil {
+			term.PrintError(err)
+			return
+		}
+		term.PrintInfo(fmt.Sprintf("Focus set to %s.", ag.Focus()))
+	}
+}
+
+// composeInEditor opens $EDITOR, seeded with initial, and returns the saved
+// text to send as the next prompt. It returns false if there is nothing to send.
+func composeInEditor(term *ui.Terminal, initial string) (string, bool) {
+	text, err := ui.EditText(initial)
+	if errors.Is(err, ui.ErrNoEditor) {
+		term.PrintWarning("No editor found. Set $EDITOR (e.g. export EDITOR=vim) to use /edit.")
+		return "", false
+	}
+	if err != nil {
+		term.PrintError(err)
+		return "", false
+	}
+	if text == "" {
+		term.PrintInfo("Editor closed without changes; nothing sent.")
+		return "", false
+	}
+	fmt.Println(text)
+	fmt.Println()
+	return text, true
+}
+
+// handleCompactAuto shows or sets whether the conversation is compacted
+// automatically when the context fills up.
+func handleCompactAuto(term *ui.Terminal, ag *agent.Agent, arg string) {
+	switch arg {
+	case "auto":
+		if ag.AutoCompact() {
+			term.PrintInfo("Auto-compaction is on.")
+		} else {
+			term.PrintInfo("Auto-compaction is off: you are warned when context is nearly full.")
+		}
+	case "auto on":
+		ag.SetAutoCompact(true)
+		term.PrintInfo("Auto-compaction on.")
+	case "auto off":
+		ag.SetAutoCompact(false)
+		term.PrintInfo("Auto-compaction off. Run /compact or /clear when warned that context is nearly full.")
+	default:
+		term.PrintWarning("Usage: /compact [auto [on|off]]")
+	}
+}
+
+func handleVerbosity(term *ui.Terminal, arg string) {
+	switch arg {
+	case "":
+		if n := term.ToolResultLines(); n > 0 {
+			term.PrintInfo(fmt.Sprintf("Tool results: showing %d lines.", n))
+		} else {
+			term.PrintInfo("Tool results: showing full output.")
+		}
+	case "last":
+		term.PrintLastToolResult()
+	default:
+		n, ok := config.ParseToolResultLines(arg)
+		if !ok {
+			term.PrintWarning("Usage: /verbosity <lines>|full|last")
+			return
+		}
+		term.SetToolResultLines(n)
+		if n > 0 {
+			term.PrintInfo(fmt.Sprintf("Tool results will show %d lines.", n))
+		} else {
+			term.PrintInfo("Tool results will show full output.")
+		}
+	}
+}
+
 func handleModelSwitch(reader *bufio.Reader, term *ui.Terminal, ag *agent.Agent, currentModel, currentProvider *string) {
 	models := config.KnownModels()
 	options := make([]ui.ModelOption, len(models))
@@ -278,24 +947,66 @@ func handleModelSwitch(reader *bufio.Reader, term *ui.Terminal, ag *agent.Agent,
 		return
 	}
 
-	// Get API key for the target provider
-	apiKey := config.APIKeyForProvider(selectedProvider)
-	if apiKey == "" {
-		term.PrintWarning(fmt.Sprintf("No API key found for %s. Set the environment variable or add it to credentials.", selectedProvider))
+	if switchClient(term, ag, selectedProvider, selectedModel) {
+		*currentModel = selectedModel
+		*currentProvider = selectedProvider
+		term.PrintModelSwitch(selectedModel)
+	}
+}
+
+// handleProvider lists providers with their key status, or with a provider
+// name switches to it using that provider's default model.
+func handleProvider(term *ui.Terminal, ag *agent.Agent, arg string, currentModel, currentProvider *string) {
+	if arg == "" {
+		statuses := config.ProviderStatuses()
+		items := make([]ui.ProviderItem, len(statuses))
+		for i, s := range statuses {
+			items[i] = ui.ProviderItem{
+				Name:         s.Name,
+				Configured:   s.Configured,
+				DefaultModel: s.DefaultModel,
+				BaseURL:      s.BaseURL,
+				Current:      s.Name == *currentProvider,
+			}
+		}
+		term.PrintProviders(items)
+		return
+	}
+
+	provider := strings.ToLower(arg)
+	if !slices.Contains(config.KnownProviders(), provider) {
+		term.PrintWarning(fmt.Sprintf("Unknown provider %q. Known: %s.", arg, strings.Join(config.KnownProviders(), ", ")))
+		return
+	}
+	if provider == *currentProvider {
+		term.PrintWarning(fmt.Sprintf("Already using %s.", provider))
 		return
 	}
 
-	baseURL, maxTokens, contextWindow := config.ProviderDefaults(selectedProvider, selectedModel)
-	client := newClient(selectedProvider, apiKey, selectedModel, maxTokens, baseURL)
-	ag.SetClient(client, contextWindow)
-	*currentModel = selectedModel
-	*currentProvider = selectedProvider
+	model := config.DefaultModel(provider)
+	if switchClient(term, ag, provider, model) {
+		*currentModel = model
+		*currentProvider = provider
+		term.PrintModelSwitch(fmt.Sprintf("%s (%s)", model, provider))
+	}
+}
 
-	term.PrintModelSwitch(selectedModel)
+// switchClient points the agent at a new provider and model. It warns and
+// reports false if the provider has no API key.
+func switchClient(term *ui.Terminal, ag *agent.Agent, provider, model string) bool {
+	if config.APIKeyForProvider(provider) == "" {
+		term.PrintWarning(fmt.Sprintf("No API key found for %s. Set the environment variable or add it to credentials.", provider))
+		return false
+	}
+	if err := ag.SwitchModel(provider, model); err != nil {
+		term.PrintWarning(err.Error())
+		return false
+	}
+	return true
 }
 
-func handleResume(reader *bufio.Reader, term *ui.Terminal, ag *agent.Agent, workDir string) {
-	sessions, err := agent.ListSessions(workDir, 10)
+func handleResume(reader *bufio.Reader, term *ui.Terminal, ag *agent.Agent, workDir, arg string, currentModel, currentProvider *string) {
+	sessions, err := agent.ListSessions(workDir, resumeMenuSize)
 	if err != nil {
 		term.PrintError(fmt.Errorf("list sessions: %w", err))
 		return
@@ -305,41 +1016,94 @@ func handleResume(reader *bufio.Reader, term *ui.Terminal, ag *agent.Agent, work
 		return
 	}
 
-	items := make([]ui.SessionListItem, len(sessions))
-	for i, s := range sessions {
-		items[i] = ui.SessionListItem{
-			ID:       s.ID,
-			Updated:  s.UpdatedAt,
-			Preview:  s.Preview,
-			MsgCount: s.MsgCount,
+	var selected agent.SessionMeta
+	if arg != "" {
+		if selected, err = pickSession(sessions, arg); err != nil {
+			term.PrintWarning(err.Error())
+			return
+		}
+	} else {
+		items := make([]ui.SessionListItem, len(sessions))
+		for i, s := range sessions {
+			items[i] = ui.SessionListItem{
+				ID:       s.ID,
+				Updated:  s.UpdatedAt,
+				Preview:  s.Preview,
+				MsgCount: s.MsgCount,
+			}
+		}
+		term.PrintSessionList(items)
+
+		fmt.Print("Choice: ")
+		choice, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		choice = strings.TrimSpace(choice)
+		if choice == "" {
+			return
+		}
+		if selected, err = pickSession(sessions, choice); err != nil {
+			term.PrintWarning("Invalid choice.")
+			return
 		}
 	}
-	term.PrintSessionList(items)
 
-	fmt.Print("Choice: ")
-	choice, err := reader.ReadString('\n')
-	if err != nil {
+	if err := ag.ResumeSession(selected.ID); err != nil {
+		term.PrintError(fmt.Errorf("resume session: %w", err))
 		return
 	}
-	choice = strings.TrimSpace(choice)
-	if choice == "" {
-		return
+
+	term.PrintConversationHistory(ag.MessageHistory())
+	term.PrintSessionResumed(selected.MsgCount, selected.Preview)
+	if ag.ForkPending() {
+		term.PrintInfo("Continuing saves a new session; this one stays as it was.")
 	}
 
-	n, err := strconv.Atoi(choice)
-	if err != nil || n < 1 || n > len(sessions) {
-		term.PrintWarning("Invalid choice.")
+	provider, model := ag.Model()
+	switch {
+	case selected.Model != "" && (provider != selected.Provider || model != selected.Model):
+		term.PrintWarning(fmt.Sprintf("This session used %s (%s), but no API key was found for %s; continuing with %s (%s).",
+			selected.Model, selected.Provider, selected.Provider, model, provider))
+	case model != *currentModel || provider != *currentProvider:
+		term.PrintModelSwitch(fmt.Sprintf("%s (%s)", model, provider))
+	}
+	*currentModel, *currentProvider = model, provider
+}
+
+// printTurnChanges shows the user which files the last turn created,
+// modified, or deleted. The summary is not added to the conversation.
+func printTurnChanges(term *ui.Terminal, ag *agent.Agent) {
+	changes := ag.TurnFileChanges()
+	if len(changes) == 0 {
 		return
 	}
+	term.PrintFileChanges(fileChangeItems(changes))
+}
 
-	selected := sessions[n-1]
-	if err := ag.ResumeSession(selected.ID); err != nil {
-		term.PrintError(fmt.Errorf("resume session: %w", err))
+// handleDiffstat prints the lines added and removed in each file changed
+// this session, most changed first.
+func handleDiffstat(term *ui.Terminal, ag *agent.Agent) {
+	changes := ag.SessionFileChanges()
+	if len(changes) == 0 {
+		term.PrintInfo("No files changed this session.")
 		return
 	}
+	term.PrintDiffStat(fileChangeItems(changes))
+}
 
-	term.PrintConversationHistory(ag.MessageHistory())
-	term.PrintSessionResumed(selected.MsgCount, selected.Preview)
+// fileChangeItems converts file changes to their UI type.
+func fileChangeItems(changes []agent.FileChange) []ui.FileChangeItem {
+	items := make([]ui.FileChangeItem, len(changes))
+	for i, c := range changes {
+		items[i] = ui.FileChangeItem{
+			Path:    c.Path,
+			Kind:    c.Kind,
+			Added:   c.Added,
+			Removed: c.Removed,
+		}
+	}
+	return items
 }
 
 func handleRewind(reader *bufio.Reader, term *ui.Terminal, ag *agent.Agent, ctx context.Context) {
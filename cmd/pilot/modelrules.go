@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/lowkaihon/cli-coding-agent/config"
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// modelRulesFile is the file in the config directory that picks a default
+// model from the project's profile.
+const modelRulesFile = "model_rules.json"
+
+// modelRule picks model for projects that meet all of its conditions.
+// Conditions left empty or zero always hold.
+type modelRule struct {
+	Language string `json:"language"`  // main language, as tools.DetectProject names it
+	File     string `json:"file"`      // file or directory in the project root, e.g. "next.config.js"
+	MinFiles int    `json:"min_files"` // at least this many files
+	MaxFiles int    `json:"max_files"` // at most this many files
+	Provider string `json:"provider"`  // defaults to the provider of a known model
+	Model    string `json:"model"`
+}
+
+// loadModelRules reads the rules table at path. A missing file means no
+// rules.
+func loadModelRules(path string) ([]modelRule, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read model rules: %w", err)
+	}
+	var rules []modelRule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, rule := range rules {
+		switch {
+		case rule.Model == "":
+			return nil, fmt.Errorf("%s: rule %d: model is required", path, i+1)
+		case rule.Provider != "" && !slices.Contains(config.KnownProviders(), rule.Provider):
+			return nil, fmt.Errorf("%s: rule %d: unknown provider %q", path, i+1, rule.Provider)
+		case rule.MinFiles < 0 || rule.MaxFiles < 0 || (rule.MaxFiles > 0 && rule.MinFiles > rule.MaxFiles):
+			return nil, fmt.Errorf("%s: rule %d: want 0 <= min_files <= max_files", path, i+1)
+		}
+	}
+	return rules, nil
+}
+
+// matchModelRule returns the index of the first rule that profile meets and
+// whose model provider serves, or -1 if there is none.
+func matchModelRule(rules []modelRule, profile tools.ProjectProfile, provider string) int {
+	for i, rule := range rules {
+		ruleProvider := rule.Provider
+		if ruleProvider == "" {
+			ruleProvider = knownModelProvider(rule.Model)
+		}
+		switch {
+		case ruleProvider != "" && ruleProvider != provider:
+		case rule.Language != "" && rule.Language != profile.Language:
+		case rule.File != "" && !profile.RootFiles[rule.File]:
+		case profile.Files < rule.MinFiles:
+		case rule.MaxFiles > 0 && profile.Files > rule.MaxFiles:
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// applyModelRules sets cfg's model from the first rule in the config
+// directory's rules table that the project in workDir meets, and returns a
+// note saying so, or "" if no rule applies.
+func applyModelRules(cfg *config.Config, workDir string) (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", nil
+	}
+	rules, err := loadModelRules(filepath.Join(dir, modelRulesFile))
+	if err != nil || len(rules) == 0 {
+		return "", err
+	}
+	profile := tools.DetectProject(workDir, cfg.IgnoreDirs)
+	i := matchModelRule(rules, profile, cfg.Provider)
+	if i < 0 {
+		return "", nil
+	}
+	applyModelFlag(cfg, rules[i].Model)
+	lang := profile.Language
+	if lang == "" {
+		lang = "no main language"
+	}
+	return fmt.Sprintf("Using %s for this project (%s, %d files; rule %d in %s).", cfg.Model, lang, profile.Files, i+1, modelRulesFile), nil
+}
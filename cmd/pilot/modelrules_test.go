@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+func TestMatchModelRule(t *testing.T) {
+	rules := []modelRule{
+		{Language: "go", MinFiles: 500, Model: "claude-opus-4-6"},
+		{Language: "go", MinFiles: 500, Model: "gpt-5.2-codex"},
+		{File: "next.config.js", Model: "gpt-5.2-codex"},
+		{MaxFiles: 20, Model: "gpt-5.1-codex-mini"},
+		{Language: "python", Provider: "openai", Model: "my-finetune"},
+	}
+	profile := func(lang string, files int, root ...string) tools.ProjectProfile {
+		p := tools.ProjectProfile{Files: files, Language: lang, RootFiles: make(map[string]bool)}
+		for _, name := range root {
+			p.RootFiles[name] = true
+		}
+		return p
+	}
+	tests := []struct {
+		name     string
+		profile  tools.ProjectProfile
+		provider string
+		want     int
+	}{
+		{"large go service on anthropic", profile("go", 800), "anthropic", 0},
+		{"large go service on openai skips the anthropic model", profile("go", 800), "openai", 1},
+		{"framework marker", profile("typescript", 300, "next.config.js", "package.json"), "openai", 2},
+		{"small script", profile("python", 3), "openai", 3},
+		{"unknown model uses its rule's provider", profile("python", 100), "openai", 4},
+		{"unknown model is not used on another provider", profile("python", 100), "anthropic", -1},
+		{"mid-size go project", profile("go", 100), "openai", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchModelRule(rules, tt.profile, tt.provider); got != tt.want {
+				t.Errorf("matchModelRule() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadModelRules(t *testing.T) {
+	dir := t.TempDir()
+	if rules, err := loadModelRules(filepath.Join(dir, "missing.json")); rules != nil || err != nil {
+		t.Errorf("expected no rules for a missing file, got %v, %v", rules, err)
+	}
+
+	path := filepath.Join(dir, modelRulesFile)
+	os.WriteFile(path, []byte(`[{"language": "go", "min_files": 200, "model": "gpt-5.2-codex"}]`), 0644)
+	rules, err := loadModelRules(path)
+	if err != nil || len(rules) != 1 || rules[0].Language != "go" || rules[0].MinFiles != 200 || rules[0].Model != "gpt-5.2-codex" {
+		t.Errorf("unexpected rules: %+v, %v", rules, err)
+	}
+
+	for name, content := range map[string]string{
+		"no model":      `[{"language": "go"}]`,
+		"bad provider":  `[{"provider": "acme", "model": "x"}]`,
+		"bad range":     `[{"min_files": 50, "max_files": 10, "model": "x"}]`,
+		"unknown field": `[{"lang": "go", "model": "x"}]`,
+		"not a list":    `{"model": "x"}`,
+	} {
+		os.WriteFile(path, []byte(content), 0644)
+		if _, err := loadModelRules(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/config"
+	"github.com/lowkaihon/cli-coding-agent/server"
+)
+
+// defaultServePort is the port `pilot serve` listens on unless --port is given.
+const defaultServePort = 7433
+
+// runServe implements `pilot serve`: it exposes an agent for workDir over a
+// local HTTP API until interrupted. The API binds to 127.0.0.1 only.
+func runServe(w io.Writer, workDir string, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(w)
+	port := fs.Int("port", defaultServePort, "port to listen on (0 picks a free one)")
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load("")
+	if err != nil {
+		return err
+	}
+	opts, err := clientOptionsFor(cfg)
+	if err != nil {
+		return err
+	}
+	ag, err := newAgent(cfg, workDir, &opts)
+	if err != nil {
+		return err
+	}
+	defer ag.Shutdown()
+
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(*port)))
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	srv := &http.Server{Handler: server.New(ag, workDir).Handler()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(w, "Pilot API (%s) listening on http://%s\n", cfg.Model, ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
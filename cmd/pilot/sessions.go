@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+)
+
+const sessionsUsage = `usage: pilot sessions <command>
+
+Commands:
+  list                  List saved sessions for this directory
+  show <id>             Print a session transcript as Markdown
+  delete <id>           Delete a session
+  export <id> <file>    Write a session transcript to a Markdown file`
+
+// runSessions implements the `pilot sessions` subcommands for the project at
+// workDir, writing output to w.
+func runSessions(w io.Writer, workDir string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", sessionsUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	want := map[string]int{"list": 0, "show": 1, "delete": 1, "export": 2}
+	n, ok := want[cmd]
+	if !ok || len(args) != n {
+		return fmt.Errorf("%s", sessionsUsage)
+	}
+
+	switch cmd {
+	case "list":
+		sessions, err := agent.ListSessions(workDir, 0)
+		if err != nil {
+			return fmt.Errorf("list sessions: %w", err)
+		}
+		if len(sessions) == 0 {
+			fmt.Fprintln(w, "No saved sessions.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUPDATED\tMESSAGES\tPREVIEW")
+		for _, s := range sessions {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", s.ID, s.UpdatedAt.Format(time.DateTime), s.MsgCount, oneLine(s.Preview, 60))
+		}
+		return tw.Flush()
+
+	case "show":
+		sf, err := agent.LoadSession(workDir, args[0])
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, sf.Markdown())
+		return err
+
+	case "delete":
+		if err := agent.DeleteSession(workDir, args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Deleted session %s\n", args[0])
+		return nil
+
+	default: // export
+		sf, err := agent.LoadSession(workDir, args[0])
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[1], []byte(sf.Markdown()), 0644); err != nil {
+			return fmt.Errorf("write export: %w", err)
+		}
+		fmt.Fprintf(w, "Exported session %s to %s\n", args[0], args[1])
+		return nil
+	}
+}
+
+// resumeMenuSize is how many recent sessions /resume lists and numbers.
+const resumeMenuSize = 10
+
+// pickSession returns the session /resume <arg> selects from sessions,
+// newest first as ListSessions returns them: "last" is the most recent and
+// a number n is the nth, as numbered in the /resume menu.
+func pickSession(sessions []agent.SessionMeta, arg string) (agent.SessionMeta, error) {
+	if len(sessions) == 0 {
+		return agent.SessionMeta{}, fmt.Errorf("no saved sessions")
+	}
+	if arg == "last" {
+		return sessions[0], nil
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return agent.SessionMeta{}, fmt.Errorf("usage: /resume [last|<n>]")
+	}
+	if n < 1 || n > len(sessions) {
+		return agent.SessionMeta{}, fmt.Errorf("no session %d: pick 1 to %d", n, len(sessions))
+	}
+	return sessions[n-1], nil
+}
+
+// oneLine flattens s to a single line of at most max runes.
+func oneLine(s string, max int) string {
+	r := []rune(s)
+	for i, c := range r {
+		if c == '\n' || c == '\r' || c == '\t' {
+			r[i] = ' '
+		}
+	}
+	if len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return string(r)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+	"github.com/lowkaihon/cli-coding-agent/llm"
+)
+
+// writeTestSession saves a session file for workDir in the (temp) home dir.
+func writeTestSession(t *testing.T, workDir, id, prompt string, updated time.Time) {
+	t.Helper()
+	dir, err := agent.SessionsDir(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(dir, 0755)
+	sf := agent.SessionFile{
+		Meta: agent.SessionMeta{ID: id, CreatedAt: updated, UpdatedAt: updated, Preview: prompt, MsgCount: 2},
+		Messages: []llm.Message{
+			llm.TextMessage("user", prompt),
+			llm.TextMessage("assistant", "Done: "+prompt),
+		},
+	}
+	data, _ := json.Marshal(sf)
+	if err := os.WriteFile(filepath.Join(dir, id+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupSessions(t *testing.T) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	workDir := t.TempDir()
+	now := time.Now()
+	writeTestSession(t, workDir, "20260101-100000-aaaa", "fix the parser", now.Add(-time.Hour))
+	writeTestSession(t, workDir, "20260102-100000-bbbb", "add tests", now)
+	return workDir
+}
+
+func TestSessionsList(t *testing.T) {
+	workDir := setupSessions(t)
+
+	var out bytes.Buffer
+	if err := runSessions(&out, workDir, []string{"list"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header + 2 sessions, got:\n%s", out.String())
+	}
+	// Most recently updated first
+	if !strings.HasPrefix(lines[1], "20260102-100000-bbbb") || !strings.Contains(lines[1], "add tests") {
+		t.Errorf("unexpected first row: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "20260101-100000-aaaa") {
+		t.Errorf("unexpected second row: %q", lines[2])
+	}
+}
+
+func TestSessionsListEmpty(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var out bytes.Buffer
+	if err := runSessions(&out, t.TempDir(), []string{"list"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "No saved sessions") {
+		t.Errorf("expected empty notice, got %q", out.String())
+	}
+}
+
+func TestSessionsShow(t *testing.T) {
+	workDir := setupSessions(t)
+
+	var out bytes.Buffer
+	if err := runSessions(&out, workDir, []string{"show", "20260101-100000-aaaa"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"# Session 20260101-100000-aaaa", "## User\n\nfix the parser", "## Assistant\n\nDone: fix the parser"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in transcript, got:\n%s", want, out.String())
+		}
+	}
+
+	if err := runSessions(&out, workDir, []string{"show", "missing"}); err == nil {
+		t.Error("expected error for unknown session")
+	}
+}
+
+func TestSessionsDelete(t *testing.T) {
+	workDir := setupSessions(t)
+
+	var out bytes.Buffer
+	if err := runSessions(&out, workDir, []string{"delete", "20260101-100000-aaaa"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sessions, _ := agent.ListSessions(workDir, 0)
+	if len(sessions) != 1 || sessions[0].ID != "20260102-100000-bbbb" {
+		t.Errorf("expected only the other session left, got %+v", sessions)
+	}
+
+	if err := runSessions(&out, workDir, []string{"delete", "../../escape"}); err == nil {
+		t.Error("expected error for an id with a path")
+	}
+}
+
+func TestSessionsExport(t *testing.T) {
+	workDir := setupSessions(t)
+	dest := filepath.Join(t.TempDir(), "session.md")
+
+	var out bytes.Buffer
+	if err := runSessions(&out, workDir, []string{"export", "20260102-100000-bbbb", dest}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("export not written: %v", err)
+	}
+	if !strings.Contains(string(data), "## User\n\nadd tests") {
+		t.Errorf("unexpected export:\n%s", data)
+	}
+}
+
+func TestSessionsUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"bogus"}, {"show"}, {"export", "id"}} {
+		if err := runSessions(&bytes.Buffer{}, t.TempDir(), args); err == nil {
+			t.Errorf("expected usage error for %q", args)
+		}
+	}
+}
+
+func TestPickSession(t *testing.T) {
+	sessions := []agent.SessionMeta{{ID: "newest"}, {ID: "middle"}, {ID: "oldest"}}
+
+	tests := []struct {
+		arg     string
+		want    string
+		wantErr bool
+	}{
+		{arg: "last", want: "newest"},
+		{arg: "1", want: "newest"},
+		{arg: "2", want: "middle"},
+		{arg: "3", want: "oldest"},
+		{arg: "0", wantErr: true},
+		{arg: "4", wantErr: true},
+		{arg: "-1", wantErr: true},
+		{arg: "first", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := pickSession(sessions, tt.arg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("pickSession(%q) = %s, want error", tt.arg, got.ID)
+			}
+			continue
+		}
+		if err != nil || got.ID != tt.want {
+			t.Errorf("pickSession(%q) = %s, %v; want %s", tt.arg, got.ID, err, tt.want)
+		}
+	}
+
+	if _, err := pickSession(nil, "last"); err == nil {
+		t.Error("expected error with no sessions")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+// startupUI is the part of the terminal the startup messages go to.
+type startupUI interface {
+	PrintBanner(model, workDir, version string)
+	PrintInfo(msg string)
+	PrintWarning(msg string)
+}
+
+// startupInfo is what the REPL shows when it starts. Empty notes and
+// warnings are skipped.
+type startupInfo struct {
+	model    string
+	workDir  string
+	version  string
+	notes    []string // e.g. the debug log path
+	warnings []string
+}
+
+// printStartup prints the banner, then the notes and warnings. quiet drops
+// the banner and notes so the session starts at the prompt; warnings are
+// kept since they report something to fix.
+func printStartup(term startupUI, quiet bool, info startupInfo) {
+	if !quiet {
+		term.PrintBanner(info.model, info.workDir, info.version)
+		for _, note := range info.notes {
+			if note != "" {
+				term.PrintInfo(note)
+			}
+		}
+	}
+	for _, warning := range info.warnings {
+		if warning != "" {
+			term.PrintWarning(warning)
+		}
+	}
+}
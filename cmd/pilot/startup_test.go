@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// recordingUI records the startup messages printed to it.
+type recordingUI struct {
+	lines []string
+}
+
+func (r *recordingUI) PrintBanner(model, workDir, version string) {
+	r.lines = append(r.lines, "banner "+model)
+}
+func (r *recordingUI) PrintInfo(msg string)    { r.lines = append(r.lines, "info "+msg) }
+func (r *recordingUI) PrintWarning(msg string) { r.lines = append(r.lines, "warning "+msg) }
+
+func TestPrintStartup(t *testing.T) {
+	info := startupInfo{
+		model:    "gpt-4o-mini",
+		notes:    []string{"Debug log: pilot.log", ""},
+		warnings: []string{"", "MEMORY.md truncated"},
+	}
+
+	var term recordingUI
+	printStartup(&term, false, info)
+	want := []string{"banner gpt-4o-mini", "info Debug log: pilot.log", "warning MEMORY.md truncated"}
+	if !slices.Equal(term.lines, want) {
+		t.Errorf("got %q, want %q", term.lines, want)
+	}
+
+	term = recordingUI{}
+	printStartup(&term, true, info)
+	want = []string{"warning MEMORY.md truncated"}
+	if !slices.Equal(term.lines, want) {
+		t.Errorf("quiet: got %q, want %q", term.lines, want)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+)
+
+// commandWord matches input that looks like a slash command rather than an
+// absolute path: a slash followed by a single word.
+var commandWord = regexp.MustCompile(`^/[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// unknownCommand reports whether cmd looks like a slash command but is not
+// one of known, so it can be caught instead of being sent to the model.
+func unknownCommand(cmd string, known []string) bool {
+	return commandWord.MatchString(cmd) && !slices.Contains(known, cmd)
+}
+
+// suggestCommand returns the known command closest to a mistyped cmd, or ""
+// if none is close enough to be a likely typo: at most two edits away, and
+// fewer edits than half the typed name.
+func suggestCommand(cmd string, known []string) string {
+	best, bestDist := "", 3
+	for _, k := range known {
+		d := editDistance(cmd[1:], k[1:])
+		if d < bestDist && d*2 < len(cmd)-1 {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the number of single-character insertions,
+// deletions, substitutions, and adjacent transpositions that turn a into b.
+func editDistance(a, b string) int {
+	// rows[i%3] holds the distances for a[:i]; the transposition step needs
+	// the row two back.
+	var rows [3][]int
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur, prev, prev2 := rows[i%3], rows[(i-1)%3], rows[(i-2+3)%3]
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)%3][len(b)]
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+func TestSuggestCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"/modle", "/model"},
+		{"/compcat", "/compact"},
+		{"/hlep", "/help"},
+		{"/contxt", "/context"},
+		{"/rewnid", "/rewind"},
+		{"/qiut", "/quit"},
+		{"/unfcous", "/unfocus"},
+		{"/xyz", ""},
+		{"/deploy", ""},
+		{"/ra", ""}, // one edit from /raw, but too short to trust
+	}
+	for _, tt := range tests {
+		if got := suggestCommand(tt.input, ui.Commands()); got != tt.want {
+			t.Errorf("suggestCommand(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	known := ui.Commands()
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"/model", false},
+		{"/modle", true},
+		{"/usr/bin/env", false}, // a path, sent to the model as a message
+		{"/", false},
+		{"/tmp/x.log", false},
+		{"/foo-bar", true},
+	}
+	for _, tt := range tests {
+		if got := unknownCommand(tt.input, known); got != tt.want {
+			t.Errorf("unknownCommand(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"model", "model", 0},
+		{"modle", "model", 1},
+		{"compcat", "compact", 1},
+		{"", "raw", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
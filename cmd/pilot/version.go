@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/lowkaihon/cli-coding-agent/config"
+)
+
+// buildInfo describes the running binary for `pilot version` output.
+type buildInfo struct {
+	Version    string
+	GoVersion  string
+	OS         string
+	Arch       string
+	Commit     string // VCS revision, empty if not stamped
+	CommitTime string
+	Modified   bool // working tree had uncommitted changes at build time
+}
+
+// gatherBuildInfo assembles build details from the version string and the
+// module build info (nil if unavailable). Taking the build info as a parameter
+// keeps this independent of the real VCS state for testing.
+func gatherBuildInfo(version string, info *debug.BuildInfo) buildInfo {
+	bi := buildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if info == nil {
+		return bi
+	}
+	if info.GoVersion != "" {
+		bi.GoVersion = info.GoVersion
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Commit = s.Value
+		case "vcs.time":
+			bi.CommitTime = s.Value
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		case "GOOS":
+			bi.OS = s.Value
+		case "GOARCH":
+			bi.Arch = s.Value
+		}
+	}
+	return bi
+}
+
+// printVersion writes version and build details, plus the default provider
+// and model, to w.
+func printVersion(w io.Writer, bi buildInfo) {
+	fmt.Fprintf(w, "pilot %s\n", bi.Version)
+	fmt.Fprintf(w, "  Go:       %s\n", bi.GoVersion)
+	fmt.Fprintf(w, "  OS/Arch:  %s/%s\n", bi.OS, bi.Arch)
+	commit := bi.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if bi.Modified {
+		commit += " (modified)"
+	}
+	if bi.CommitTime != "" {
+		commit += " " + bi.CommitTime
+	}
+	fmt.Fprintf(w, "  Commit:   %s\n", commit)
+	fmt.Fprintf(w, "  Provider: %s\n", config.DefaultProvider)
+	fmt.Fprintf(w, "  Model:    %s\n", config.DefaultModel(config.DefaultProvider))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestGatherBuildInfo(t *testing.T) {
+	info := &debug.BuildInfo{
+		GoVersion: "go1.99.0",
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+			{Key: "vcs.time", Value: "2026-01-02T03:04:05Z"},
+			{Key: "vcs.modified", Value: "true"},
+			{Key: "GOOS", Value: "plan9"},
+			{Key: "GOARCH", Value: "mips"},
+		},
+	}
+
+	bi := gatherBuildInfo("1.2.3", info)
+	if bi.Version != "1.2.3" || bi.GoVersion != "go1.99.0" {
+		t.Errorf("unexpected version fields: %+v", bi)
+	}
+	if bi.Commit != "0123456789abcdef0123" || bi.CommitTime != "2026-01-02T03:04:05Z" || !bi.Modified {
+		t.Errorf("unexpected VCS fields: %+v", bi)
+	}
+	if bi.OS != "plan9" || bi.Arch != "mips" {
+		t.Errorf("unexpected platform: %s/%s", bi.OS, bi.Arch)
+	}
+
+	var out bytes.Buffer
+	printVersion(&out, bi)
+	for _, want := range []string{"pilot 1.2.3", "go1.99.0", "plan9/mips", "0123456789ab (modified)", "Provider:", "Model:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestGatherBuildInfoNoVCS(t *testing.T) {
+	bi := gatherBuildInfo("dev", nil)
+	if bi.Commit != "" || bi.Modified {
+		t.Errorf("expected no VCS info, got %+v", bi)
+	}
+	if bi.OS != runtime.GOOS || bi.Arch != runtime.GOARCH || bi.GoVersion != runtime.Version() {
+		t.Errorf("expected runtime defaults, got %+v", bi)
+	}
+
+	var out bytes.Buffer
+	printVersion(&out, bi)
+	if !strings.Contains(out.String(), "Commit:   unknown") {
+		t.Errorf("expected unknown commit, got:\n%s", out.String())
+	}
+}
@@ -7,7 +7,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // Config holds the resolved LLM provider configuration including API credentials,
@@ -19,29 +23,320 @@ type Config struct {
 	MaxTokens     int
 	BaseURL       string
 	ContextWindow int
+
+	// ToolResultLines is how many lines of each tool result the terminal
+	// shows (0 = all). Set via PILOT_TOOL_RESULT_LINES ("full" or a number).
+	ToolResultLines int
+
+	// PagerLines is the length above which a finished assistant response is
+	// reopened in $PAGER (0 = never). Set via PILOT_PAGER_LINES.
+	PagerLines int
+
+	// Temperature is the sampling temperature sent with each request; nil
+	// leaves the provider default. Models that reject it never get it. Set
+	// via PILOT_TEMPERATURE.
+	Temperature *float64
+
+	// MaxRequestMB caps the size of each request body sent to the provider,
+	// in megabytes (0 = no cap). Set via PILOT_MAX_REQUEST_MB.
+	MaxRequestMB int
+
+	// AssistantName and Tagline customize the assistant's identity in the
+	// system prompt and startup banner. Set via PILOT_NAME and PILOT_TAGLINE;
+	// empty values keep the defaults.
+	AssistantName string
+	Tagline       string
+
+	// Colors sets the terminal colors of output parts (prompt, assistant,
+	// tool, error) to named colors or ANSI codes; the terminal checks the
+	// values and keeps the default for any it cannot use. Set via
+	// PILOT_COLORS (comma-separated part=color entries).
+	Colors map[string]string
+
+	// Quiet skips the startup banner and notes, for scripting or embedding.
+	// Set via PILOT_QUIET or the --quiet flag.
+	Quiet bool
+
+	// ExploreTokenBudget is the explore sub-agent's token soft cap (0 = no
+	// cap). Set via PILOT_EXPLORE_TOKEN_BUDGET.
+	ExploreTokenBudget int
+
+	// ExploreIterations is how many model requests an exploration may make,
+	// and ExploreToolCalls how many tool calls it may run in total (0 = no
+	// budget), unless the explore call asks for other limits. Set via
+	// PILOT_EXPLORE_ITERATIONS (default DefaultExploreIterations) and
+	// PILOT_EXPLORE_TOOL_CALLS.
+	ExploreIterations int
+	ExploreToolCalls  int
+
+	// WrapUpIterations is how many iterations a turn may run past the
+	// per-turn limit after the model is told to wrap up (0 = stop at the
+	// limit). Set via PILOT_WRAP_UP_ITERATIONS.
+	WrapUpIterations int
+
+	// MaxToolCalls is how many tool calls from one model response are run;
+	// the rest are answered with a note asking the model to send them later
+	// (0 = no cap). Set via PILOT_MAX_TOOL_CALLS (default
+	// DefaultMaxToolCalls).
+	MaxToolCalls int
+
+	// EnterContinues makes an empty Enter send "continue" when the last turn
+	// ended open (see Agent.TurnOpen). Set via PILOT_ENTER_CONTINUES
+	// (default false).
+	EnterContinues bool
+
+	// MemoryTokens caps how much of MEMORY.md goes into the system prompt,
+	// in estimated tokens (0 = no cap). Set via PILOT_MEMORY_TOKENS.
+	MemoryTokens int
+
+	// IgnoreDirs lists extra directory names or glob patterns that glob and
+	// grep skip. Set via PILOT_IGNORE (comma-separated).
+	IgnoreDirs []string
+
+	// ProtectPaths lists extra files or directories the write and edit tools
+	// refuse to modify, absolute or relative to the working directory. Set via
+	// PILOT_PROTECT (comma-separated).
+	ProtectPaths []string
+
+	// DenyRead lists extra files read, grep, and glob refuse, on top of
+	// tools.DefaultDenyRead and Pilot's credentials file: paths (absolute or
+	// relative to the working directory) or name patterns. Set via
+	// PILOT_DENY_READ (comma-separated).
+	DenyRead []string
+
+	// ExploreRoots lists directories outside the working directory that the
+	// explore sub-agent may read when an explore call asks for them. Set via
+	// PILOT_EXPLORE_ROOTS (comma-separated, made absolute) in the environment
+	// or credentials file only, since it widens what the model can read.
+	ExploreRoots []string
+
+	// SafeCommands lists bash commands that run without confirmation: command
+	// prefixes, or regular expressions prefixed with "re:". Set via
+	// PILOT_SAFE_COMMANDS (comma-separated) in the environment or credentials
+	// file only, since a project could otherwise approve any command.
+	SafeCommands []string
+
+	// BashInterim is how long a bash command may run before it moves to the
+	// background and the model gets its output so far (0 = wait for it to
+	// finish). Set via PILOT_BASH_INTERIM in seconds.
+	BashInterim time.Duration
+
+	// ToolTimeout is how long a read-only tool call such as glob or grep may
+	// run before it is abandoned (0 = no limit). Set via PILOT_TOOL_TIMEOUT
+	// in seconds (default DefaultToolTimeout).
+	ToolTimeout time.Duration
+
+	// Formatters lists commands run on a file after a write or edit, as
+	// "pattern=command" entries such as "*.go=gofmt -w". Set via PILOT_FORMAT
+	// (comma-separated).
+	Formatters []string
+	// TrustFormatters runs the formatters without asking first. Set via
+	// PILOT_FORMAT_TRUST (default false) in the environment or credentials
+	// file; it is ignored when PILOT_FORMAT came from the project.
+	TrustFormatters bool
+
+	// Approval is the confirmation policy for file changes: ApprovalAsk,
+	// ApprovalAutoEdit, or ApprovalReview. Set via PILOT_APPROVAL.
+	Approval string
+
+	// Compaction is the auto-compaction strategy: CompactionSummarize or
+	// CompactionToolResults. Set via PILOT_COMPACTION.
+	Compaction string
+	// AutoCompact enables compaction when the context fills up; when off, the
+	// user is warned to /compact or /clear instead. Set via PILOT_AUTO_COMPACT
+	// (default true).
+	AutoCompact bool
+	// SummarizeResults is the length in characters above which a tool result
+	// goes into the conversation as a summary written by the LLM, with the
+	// full output kept for the recall tool (0 = never). Set via
+	// PILOT_SUMMARIZE_RESULTS.
+	SummarizeResults int
+	// SummarizeModel is the model writing those summaries, on the current
+	// provider ("" = the current model). Set via PILOT_SUMMARIZE_MODEL.
+	SummarizeModel string
+	// IdleCompactPercent is the share of the context window above which the
+	// conversation is compacted while the prompt sits idle between turns
+	// (0 = never). Set via PILOT_IDLE_COMPACT.
+	IdleCompactPercent int
+
+	// Narration is how much the model explains its actions: NarrationDefault,
+	// NarrationExplain, or NarrationTerse. Set via PILOT_NARRATION.
+	Narration string
+
+	// ConfirmTimeout is how long a confirmation prompt waits for an answer
+	// before taking ConfirmDefault (0 = wait indefinitely). Set via
+	// PILOT_CONFIRM_TIMEOUT in seconds, in the environment or credentials
+	// file only, like ConfirmDefault: a project could otherwise approve
+	// every change by letting prompts time out.
+	ConfirmTimeout time.Duration
+	// ConfirmDefault is ConfirmDeny or ConfirmApprove. Set via PILOT_CONFIRM_DEFAULT.
+	ConfirmDefault string
+	// ConfirmStyle is ConfirmStyleVerbose or ConfirmStyleCompact. Set via
+	// PILOT_CONFIRM_STYLE.
+	ConfirmStyle string
+
+	// IdleTimeout is how long the prompt may wait for input before the
+	// session is saved and IdleAction is taken (0 = never). Set via
+	// PILOT_IDLE_TIMEOUT in minutes.
+	IdleTimeout time.Duration
+	// IdleAction is IdleActionExit or IdleActionNotify. Set via PILOT_IDLE_ACTION.
+	IdleAction string
+
+	// ExitWindow is how soon a second Ctrl+C at the prompt must follow the
+	// first to exit (0 = the first one exits). Set via PILOT_EXIT_WINDOW in
+	// seconds (default DefaultExitWindow).
+	ExitWindow time.Duration
+
+	// GrepIndex enables the in-session trigram index that lets grep skip
+	// files which cannot match. Set via PILOT_GREP_INDEX (default true).
+	GrepIndex bool
+
+	// ProjectTree adds a compact listing of the working directory to the
+	// first message of a fresh session. Set via PILOT_PROJECT_TREE (default
+	// false).
+	ProjectTree bool
+
+	// Redact masks API keys, tokens, and passwords in the tool calls and
+	// results shown in the terminal. Display only. Set via PILOT_REDACT
+	// (default true).
+	Redact bool
+
+	// Explore offers the explore sub-agent tool. With it off, the model
+	// researches inline with glob, grep, and read. Set via PILOT_EXPLORE
+	// (default true).
+	Explore bool
+	// ExploreCache reuses an explore result for a repeated task while the
+	// project's files are unchanged. Set via PILOT_EXPLORE_CACHE (default
+	// false).
+	ExploreCache bool
+
+	// Headers holds extra HTTP headers sent with every request to a provider,
+	// by provider name, such as the organization ID or routing key a gateway
+	// needs. They never replace the client's own headers. Set via
+	// PILOT_OPENAI_HEADERS and PILOT_ANTHROPIC_HEADERS (comma-separated
+	// Name=value entries).
+	Headers map[string]map[string]string
+
+	// SessionsDir is where sessions are saved and listed, as an absolute
+	// path, or "" for ~/.pilot/projects/<hash>/sessions. Set via
+	// PILOT_SESSIONS_DIR in the environment or credentials file only, so a
+	// project can neither collect the conversation nor plant sessions.
+	SessionsDir string
+
+	// ForkOnResume saves a resumed session that is continued under a new
+	// ID, leaving the original file as it was. Set via PILOT_FORK_ON_RESUME
+	// (default false).
+	ForkOnResume bool
+
+	// Record is a cassette file that every LLM request and response is
+	// written to, for replay with Replay. Set via PILOT_RECORD.
+	Record string
+	// Replay is a cassette file whose recorded responses are served instead
+	// of calling the provider, which then needs no API key. Set via
+	// PILOT_REPLAY. Both are user-only: a project could otherwise script the
+	// model's replies or capture the conversation.
+	Replay string
+
+	// Debug enables the troubleshooting log in the config dir. Set via
+	// PILOT_DEBUG or the --debug flag.
+	Debug bool
+
+	// AuditLog is a file, as an absolute path, that an equivalent shell
+	// command for each write, edit, rename, and bash call is appended to
+	// ("" = none). Set via PILOT_AUDIT_LOG in the environment or credentials
+	// file only, since a project could point it at a file the shell runs.
+	AuditLog string
 }
 
+// Approval policies.
+const (
+	// ApprovalAsk confirms every write, edit, and bash call (the default).
+	ApprovalAsk = "ask"
+	// ApprovalAutoEdit applies writes and edits without asking; bash still confirms.
+	ApprovalAutoEdit = "auto-edit"
+	// ApprovalReview holds writes, edits, and bash calls until the end of the
+	// turn, then asks for them all at once.
+	ApprovalReview = "review"
+)
+
+// Compaction strategies.
+const (
+	// CompactionSummarize replaces the history with an LLM summary (the default).
+	CompactionSummarize = "summarize"
+	// CompactionToolResults elides old tool results first, keeping user and
+	// assistant messages verbatim, and summarizes only if still over the limit.
+	CompactionToolResults = "tool-results"
+)
+
+// Confirmation prompt styles.
+const (
+	// ConfirmStyleVerbose shows the full diff or preview before asking (the default).
+	ConfirmStyleVerbose = "verbose"
+	// ConfirmStyleCompact asks from a one-line summary of a file change's
+	// size and shows the diff only on request.
+	ConfirmStyleCompact = "compact"
+)
+
+// Narration levels.
+const (
+	// NarrationDefault leaves narration to the base system prompt (the default).
+	NarrationDefault = "default"
+	// NarrationExplain asks the model to explain each step before taking it.
+	NarrationExplain = "explain"
+	// NarrationTerse asks the model to act with minimal narration.
+	NarrationTerse = "terse"
+)
+
+// Answers taken when a confirmation prompt times out.
+const (
+	// ConfirmDeny rejects the pending action (the default).
+	ConfirmDeny = "deny"
+	// ConfirmApprove lets the pending action proceed.
+	ConfirmApprove = "approve"
+)
+
+// Idle actions.
+const (
+	// IdleActionExit saves the session and exits (the default).
+	IdleActionExit = "exit"
+	// IdleActionNotify saves the session, prints a notice, and keeps running.
+	IdleActionNotify = "notify"
+)
+
+// DefaultToolResultLines is the number of tool result lines shown when
+// PILOT_TOOL_RESULT_LINES is unset.
+const DefaultToolResultLines = 5
+
 // Load resolves LLM configuration by reading .env files, XDG credentials,
-// and prompting for missing API keys. An empty provider defaults to "openai".
+// the project config file, and prompting for missing API keys. Environment
+// variables take precedence over .env, then credentials, then the project
+// config. An empty provider falls back to PILOT_PROVIDER, then "openai".
 func Load(provider string) (*Config, error) {
-	// Load .env file in cwd if present
-	loadEnvFile(".env")
+	LoadEnvFiles()
 
-	// Load credentials from XDG config dir
-	if configDir, err := ConfigDir(); err == nil {
-		loadEnvFile(filepath.Join(configDir, "credentials"))
+	// Project defaults only fill in what is still unset
+	if err := loadProjectConfig(ProjectConfigFile); err != nil {
+		return nil, err
 	}
 
 	if provider == "" {
-		provider = "openai"
+		provider = os.Getenv("PILOT_PROVIDER")
+	}
+	if provider == "" {
+		provider = DefaultProvider
+	}
+	if provider != "openai" && provider != "anthropic" {
+		return nil, fmt.Errorf("unknown provider %q: want \"openai\" or \"anthropic\"", provider)
 	}
 
 	var cfg *Config
 	switch provider {
 	case "anthropic":
-		apiKey := os.Getenv("ANTHROPIC_API_KEY")
-		if apiKey == "" {
-			var err error
+		apiKey, err := resolveAPIKey("anthropic")
+		if err != nil {
+			return nil, err
+		}
+		if apiKey == "" && os.Getenv("PILOT_REPLAY") == "" {
 			apiKey, err = promptAPIKeyFor("Anthropic", "ANTHROPIC_API_KEY")
 			if err != nil {
 				return nil, err
@@ -50,15 +345,17 @@ func Load(provider string) (*Config, error) {
 		cfg = &Config{
 			Provider:      "anthropic",
 			APIKey:        apiKey,
-			Model:         "claude-sonnet-4-6",
+			Model:         DefaultModel("anthropic"),
 			MaxTokens:     16384,
 			BaseURL:       "https://api.anthropic.com/v1",
 			ContextWindow: 200000,
 		}
 	default:
-		apiKey := os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			var err error
+		apiKey, err := resolveAPIKey("openai")
+		if err != nil {
+			return nil, err
+		}
+		if apiKey == "" && os.Getenv("PILOT_REPLAY") == "" {
 			apiKey, err = promptAPIKeyFor("OpenAI", "OPENAI_API_KEY")
 			if err != nil {
 				return nil, err
@@ -67,16 +364,501 @@ func Load(provider string) (*Config, error) {
 		cfg = &Config{
 			Provider:      "openai",
 			APIKey:        apiKey,
-			Model:         "gpt-4o-mini",
+			Model:         DefaultModel("openai"),
 			MaxTokens:     16384,
 			BaseURL:       "https://api.openai.com/v1",
 			ContextWindow: 128000,
 		}
 	}
 
+	if model := strings.TrimSpace(os.Getenv("PILOT_MODEL")); model != "" {
+		cfg.Model = model
+		_, _, cfg.ContextWindow = ProviderDefaults(cfg.Provider, model)
+	}
+
+	cfg.ToolResultLines = DefaultToolResultLines
+	if v := os.Getenv("PILOT_TOOL_RESULT_LINES"); v != "" {
+		n, ok := ParseToolResultLines(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid PILOT_TOOL_RESULT_LINES %q: want a non-negative number or \"full\"", v)
+		}
+		cfg.ToolResultLines = n
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_PAGER_LINES")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_PAGER_LINES %q: want a non-negative number", v)
+		}
+		cfg.PagerLines = n
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_TEMPERATURE")); v != "" {
+		t, ok := ParseTemperature(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid PILOT_TEMPERATURE %q: want a number from 0 to 2", v)
+		}
+		cfg.Temperature = &t
+	}
+
+	cfg.MaxRequestMB = DefaultMaxRequestMB
+	if v := strings.TrimSpace(os.Getenv("PILOT_MAX_REQUEST_MB")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_MAX_REQUEST_MB %q: want a non-negative number", v)
+		}
+		cfg.MaxRequestMB = n
+	}
+
+	cfg.ExploreTokenBudget = DefaultExploreTokenBudget
+	if v := os.Getenv("PILOT_EXPLORE_TOKEN_BUDGET"); v != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE_TOKEN_BUDGET %q: want a non-negative number", v)
+		}
+		cfg.ExploreTokenBudget = n
+	}
+
+	cfg.ExploreIterations = DefaultExploreIterations
+	if v := strings.TrimSpace(os.Getenv("PILOT_EXPLORE_ITERATIONS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE_ITERATIONS %q: want a positive number", v)
+		}
+		cfg.ExploreIterations = n
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_EXPLORE_TOOL_CALLS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE_TOOL_CALLS %q: want a non-negative number", v)
+		}
+		cfg.ExploreToolCalls = n
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_WRAP_UP_ITERATIONS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_WRAP_UP_ITERATIONS %q: want a non-negative number", v)
+		}
+		cfg.WrapUpIterations = n
+	}
+
+	cfg.MaxToolCalls = DefaultMaxToolCalls
+	if v := strings.TrimSpace(os.Getenv("PILOT_MAX_TOOL_CALLS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_MAX_TOOL_CALLS %q: want a non-negative number", v)
+		}
+		cfg.MaxToolCalls = n
+	}
+
+	if v := os.Getenv("PILOT_ENTER_CONTINUES"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_ENTER_CONTINUES %q: want 1/0 or true/false", v)
+		}
+		cfg.EnterContinues = enabled
+	}
+
+	cfg.MemoryTokens = DefaultMemoryTokens
+	if v := os.Getenv("PILOT_MEMORY_TOKENS"); v != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_MEMORY_TOKENS %q: want a non-negative number", v)
+		}
+		cfg.MemoryTokens = n
+	}
+
+	for _, p := range strings.Split(os.Getenv("PILOT_IGNORE"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.IgnoreDirs = append(cfg.IgnoreDirs, p)
+		}
+	}
+
+	for _, p := range strings.Split(os.Getenv("PILOT_PROTECT"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.ProtectPaths = append(cfg.ProtectPaths, p)
+		}
+	}
+
+	for _, p := range strings.Split(os.Getenv("PILOT_DENY_READ"), ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid PILOT_DENY_READ entry %q: %w", p, err)
+		}
+		cfg.DenyRead = append(cfg.DenyRead, p)
+	}
+	for _, p := range strings.Split(os.Getenv("PILOT_EXPLORE_ROOTS"), ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE_ROOTS entry %q: %w", p, err)
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE_ROOTS entry %q: not a directory", p)
+		}
+		cfg.ExploreRoots = append(cfg.ExploreRoots, abs)
+	}
+
+	for _, p := range strings.Split(os.Getenv("PILOT_SAFE_COMMANDS"), ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(p, "re:"); ok {
+			if _, err := regexp.Compile(`^(?:` + expr + `)$`); err != nil {
+				return nil, fmt.Errorf("invalid PILOT_SAFE_COMMANDS pattern %q: %w", p, err)
+			}
+		}
+		cfg.SafeCommands = append(cfg.SafeCommands, p)
+	}
+	if v := strings.TrimSpace(os.Getenv("PILOT_BASH_INTERIM")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_BASH_INTERIM %q: want a non-negative number of seconds", v)
+		}
+		cfg.BashInterim = time.Duration(n) * time.Second
+	}
+	cfg.ToolTimeout = DefaultToolTimeout
+	if v := strings.TrimSpace(os.Getenv("PILOT_TOOL_TIMEOUT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_TOOL_TIMEOUT %q: want a non-negative number of seconds", v)
+		}
+		cfg.ToolTimeout = time.Duration(n) * time.Second
+	}
+
+	for _, p := range strings.Split(os.Getenv("PILOT_FORMAT"), ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		pattern, command, ok := strings.Cut(p, "=")
+		if !ok || strings.TrimSpace(pattern) == "" || strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("invalid PILOT_FORMAT entry %q: want pattern=command", p)
+		}
+		if _, err := filepath.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return nil, fmt.Errorf("invalid PILOT_FORMAT pattern %q: %w", pattern, err)
+		}
+		cfg.Formatters = append(cfg.Formatters, p)
+	}
+	if v := os.Getenv("PILOT_FORMAT_TRUST"); v != "" {
+		trust, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_FORMAT_TRUST %q: want 1/0 or true/false", v)
+		}
+		// A project's own formatter commands always ask first
+		cfg.TrustFormatters = trust && !fromProject("PILOT_FORMAT")
+	}
+
+	cfg.Approval = ApprovalAsk
+	if v := strings.TrimSpace(os.Getenv("PILOT_APPROVAL")); v != "" {
+		if v != ApprovalAsk && v != ApprovalAutoEdit && v != ApprovalReview {
+			return nil, fmt.Errorf("invalid PILOT_APPROVAL %q: want %q, %q, or %q", v, ApprovalAsk, ApprovalAutoEdit, ApprovalReview)
+		}
+		cfg.Approval = v
+	}
+
+	cfg.Compaction = CompactionSummarize
+	if v := strings.TrimSpace(os.Getenv("PILOT_COMPACTION")); v != "" {
+		if v != CompactionSummarize && v != CompactionToolResults {
+			return nil, fmt.Errorf("invalid PILOT_COMPACTION %q: want %q or %q", v, CompactionSummarize, CompactionToolResults)
+		}
+		cfg.Compaction = v
+	}
+	cfg.AutoCompact = true
+	if v := os.Getenv("PILOT_AUTO_COMPACT"); v != "" {
+		enabled, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_AUTO_COMPACT %q: want 1/0 or true/false", v)
+		}
+		cfg.AutoCompact = enabled
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_SUMMARIZE_RESULTS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_SUMMARIZE_RESULTS %q: want a non-negative number of characters", v)
+		}
+		cfg.SummarizeResults = n
+	}
+	cfg.SummarizeModel = strings.TrimSpace(os.Getenv("PILOT_SUMMARIZE_MODEL"))
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_IDLE_COMPACT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			return nil, fmt.Errorf("invalid PILOT_IDLE_COMPACT %q: want a percentage from 0 to 100", v)
+		}
+		cfg.IdleCompactPercent = n
+	}
+
+	cfg.Narration = NarrationDefault
+	if v := strings.TrimSpace(os.Getenv("PILOT_NARRATION")); v != "" {
+		if v != NarrationDefault && v != NarrationExplain && v != NarrationTerse {
+			return nil, fmt.Errorf("invalid PILOT_NARRATION %q: want %q, %q, or %q", v, NarrationDefault, NarrationExplain, NarrationTerse)
+		}
+		cfg.Narration = v
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_CONFIRM_TIMEOUT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_CONFIRM_TIMEOUT %q: want a non-negative number of seconds", v)
+		}
+		cfg.ConfirmTimeout = time.Duration(n) * time.Second
+	}
+
+	cfg.ConfirmDefault = ConfirmDeny
+	if v := strings.TrimSpace(os.Getenv("PILOT_CONFIRM_DEFAULT")); v != "" {
+		if v != ConfirmDeny && v != ConfirmApprove {
+			return nil, fmt.Errorf("invalid PILOT_CONFIRM_DEFAULT %q: want %q or %q", v, ConfirmDeny, ConfirmApprove)
+		}
+		cfg.ConfirmDefault = v
+	}
+
+	cfg.ConfirmStyle = ConfirmStyleVerbose
+	if v := strings.TrimSpace(os.Getenv("PILOT_CONFIRM_STYLE")); v != "" {
+		if v != ConfirmStyleVerbose && v != ConfirmStyleCompact {
+			return nil, fmt.Errorf("invalid PILOT_CONFIRM_STYLE %q: want %q or %q", v, ConfirmStyleVerbose, ConfirmStyleCompact)
+		}
+		cfg.ConfirmStyle = v
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_IDLE_TIMEOUT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_IDLE_TIMEOUT %q: want a non-negative number of minutes", v)
+		}
+		cfg.IdleTimeout = time.Duration(n) * time.Minute
+	}
+
+	cfg.IdleAction = IdleActionExit
+	if v := strings.TrimSpace(os.Getenv("PILOT_IDLE_ACTION")); v != "" {
+		if v != IdleActionExit && v != IdleActionNotify {
+			return nil, fmt.Errorf("invalid PILOT_IDLE_ACTION %q: want %q or %q", v, IdleActionExit, IdleActionNotify)
+		}
+		cfg.IdleAction = v
+	}
+
+	cfg.ExitWindow = DefaultExitWindow
+	if v := strings.TrimSpace(os.Getenv("PILOT_EXIT_WINDOW")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PILOT_EXIT_WINDOW %q: want a non-negative number of seconds", v)
+		}
+		cfg.ExitWindow = time.Duration(n) * time.Second
+	}
+
+	cfg.GrepIndex = true
+	if v := os.Getenv("PILOT_GREP_INDEX"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_GREP_INDEX %q: want 1/0 or true/false", v)
+		}
+		cfg.GrepIndex = enabled
+	}
+
+	if v := os.Getenv("PILOT_PROJECT_TREE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_PROJECT_TREE %q: want 1/0 or true/false", v)
+		}
+		cfg.ProjectTree = enabled
+	}
+
+	cfg.Redact = true
+	if v := os.Getenv("PILOT_REDACT"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_REDACT %q: want 1/0 or true/false", v)
+		}
+		cfg.Redact = enabled
+	}
+
+	cfg.Explore = true
+	if v := os.Getenv("PILOT_EXPLORE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE %q: want 1/0 or true/false", v)
+		}
+		cfg.Explore = enabled
+	}
+
+	if v := os.Getenv("PILOT_EXPLORE_CACHE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_EXPLORE_CACHE %q: want 1/0 or true/false", v)
+		}
+		cfg.ExploreCache = enabled
+	}
+
+	if v := os.Getenv("PILOT_DEBUG"); v != "" {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_DEBUG %q: want 1/0 or true/false", v)
+		}
+		cfg.Debug = debug
+	}
+
+	if v := strings.TrimSpace(os.Getenv("PILOT_AUDIT_LOG")); v != "" {
+		path, err := filepath.Abs(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_AUDIT_LOG %q: %w", v, err)
+		}
+		cfg.AuditLog = path
+	}
+
+	colors, err := parseColors()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Colors = colors
+
+	for _, p := range KnownProviders() {
+		headers, err := parseHeaders(headersEnv(p))
+		if err != nil {
+			return nil, err
+		}
+		if len(headers) > 0 {
+			if cfg.Headers == nil {
+				cfg.Headers = make(map[string]map[string]string)
+			}
+			cfg.Headers[p] = headers
+		}
+	}
+
+	sessionsDir, err := sessionsDirEnv()
+	if err != nil {
+		return nil, err
+	}
+	cfg.SessionsDir = sessionsDir
+
+	if v := os.Getenv("PILOT_FORK_ON_RESUME"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_FORK_ON_RESUME %q: want 1/0 or true/false", v)
+		}
+		cfg.ForkOnResume = enabled
+	}
+
+	cfg.Record = strings.TrimSpace(os.Getenv("PILOT_RECORD"))
+	cfg.Replay = strings.TrimSpace(os.Getenv("PILOT_REPLAY"))
+	if cfg.Record != "" && cfg.Replay != "" {
+		return nil, fmt.Errorf("PILOT_RECORD and PILOT_REPLAY cannot both be set")
+	}
+
+	cfg.AssistantName = strings.TrimSpace(os.Getenv("PILOT_NAME"))
+	cfg.Tagline = strings.TrimSpace(os.Getenv("PILOT_TAGLINE"))
+	if v := os.Getenv("PILOT_QUIET"); v != "" {
+		quiet, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PILOT_QUIET %q: want 1/0 or true/false", v)
+		}
+		cfg.Quiet = quiet
+	}
+
 	return cfg, nil
 }
 
+// ParseToolResultLines parses a tool result line limit: a non-negative
+// integer, or "full"/"all" for no limit (returned as 0).
+func ParseToolResultLines(s string) (int, bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "full" || s == "all" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// ParseTemperature parses a sampling temperature between 0 and 2, the
+// widest range any provider accepts.
+func ParseTemperature(s string) (float64, bool) {
+	t, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || t < 0 || t > 2 {
+		return 0, false
+	}
+	return t, true
+}
+
+// DefaultExploreTokenBudget is the explore token soft cap used when
+// PILOT_EXPLORE_TOKEN_BUDGET is unset.
+const DefaultExploreTokenBudget = 200000
+
+// DefaultExploreIterations is the explore iteration limit used when
+// PILOT_EXPLORE_ITERATIONS is unset.
+const DefaultExploreIterations = 30
+
+// DefaultToolTimeout is the read-only tool call limit used when
+// PILOT_TOOL_TIMEOUT is unset.
+const DefaultToolTimeout = 2 * time.Minute
+
+// DefaultExitWindow is the Ctrl+C double-tap window used when
+// PILOT_EXIT_WINDOW is unset.
+const DefaultExitWindow = 2 * time.Second
+
+// DefaultMaxRequestMB is the request body cap used when PILOT_MAX_REQUEST_MB
+// is unset.
+const DefaultMaxRequestMB = 20
+
+// DefaultMaxToolCalls is the cap on tool calls run from one response used
+// when PILOT_MAX_TOOL_CALLS is unset.
+const DefaultMaxToolCalls = 20
+
+// DefaultMemoryTokens is the MEMORY.md injection cap used when
+// PILOT_MEMORY_TOKENS is unset.
+const DefaultMemoryTokens = 4000
+
+// DefaultProvider is the provider used when none is specified.
+const DefaultProvider = "openai"
+
+// DefaultModel returns the model used for a provider when none is specified.
+func DefaultModel(provider string) string {
+	switch provider {
+	case "anthropic":
+		return "claude-sonnet-4-6"
+	default:
+		return "gpt-4o-mini"
+	}
+}
+
+// KnownProviders returns the supported provider names.
+func KnownProviders() []string {
+	return []string{"openai", "anthropic"}
+}
+
+// ProviderStatus describes a provider for the /provider listing.
+type ProviderStatus struct {
+	Name         string
+	Configured   bool // an API key is available
+	DefaultModel string
+	BaseURL      string
+}
+
+// ProviderStatuses reports each known provider's key availability, default
+// model, and base URL.
+func ProviderStatuses() []ProviderStatus {
+	providers := KnownProviders()
+	statuses := make([]ProviderStatus, len(providers))
+	for i, p := range providers {
+		model := DefaultModel(p)
+		baseURL, _, _ := ProviderDefaults(p, model)
+		statuses[i] = ProviderStatus{
+			Name:         p,
+			Configured:   APIKeyForProvider(p) != "",
+			DefaultModel: model,
+			BaseURL:      baseURL,
+		}
+	}
+	return statuses
+}
+
 // KnownModel represents a curated model option.
 type KnownModel struct {
 	Provider string
@@ -121,14 +903,34 @@ func openAIContextWindow(model string) int {
 	}
 }
 
-// APIKeyForProvider returns the API key for the given provider from env/credentials.
-// Returns empty string if not found.
+// APIKeyForProvider returns the API key for the given provider from its
+// credential command, else env/credentials. Returns empty string if not found.
 func APIKeyForProvider(provider string) string {
+	key, _ := resolveAPIKey(provider)
+	return key
+}
+
+// resolveAPIKey returns the key the provider's credential command prints,
+// falling back to its API key variable from env/credentials if the command
+// fails. The command's error is returned only when there is no fallback.
+func resolveAPIKey(provider string) (string, error) {
+	key, err := commandAPIKey(provider)
+	if err == nil && key != "" {
+		return key, nil
+	}
+	if key := os.Getenv(APIKeyEnv(provider)); key != "" {
+		return key, nil
+	}
+	return "", err
+}
+
+// APIKeyEnv returns the environment variable holding the given provider's API key.
+func APIKeyEnv(provider string) string {
 	switch provider {
 	case "anthropic":
-		return os.Getenv("ANTHROPIC_API_KEY")
+		return "ANTHROPIC_API_KEY"
 	default:
-		return os.Getenv("OPENAI_API_KEY")
+		return "OPENAI_API_KEY"
 	}
 }
 
@@ -145,6 +947,86 @@ func ConfigDir() (string, error) {
 	return filepath.Join(home, ".config", "pilot"), nil
 }
 
+// headersEnv returns the environment variable holding the extra request
+// headers for provider.
+func headersEnv(provider string) string {
+	return "PILOT_" + strings.ToUpper(provider) + "_HEADERS"
+}
+
+// parseHeaders reads the comma-separated Name=value entries of the
+// environment variable env.
+func parseHeaders(env string) (map[string]string, error) {
+	var headers map[string]string
+	for _, entry := range strings.Split(os.Getenv(env), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid %s entry %q: want Name=value", env, entry)
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// parseColors reads the comma-separated part=color entries of PILOT_COLORS.
+// The colors themselves are checked by the terminal.
+func parseColors() (map[string]string, error) {
+	var colors map[string]string
+	for _, entry := range strings.Split(os.Getenv("PILOT_COLORS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		part, color, ok := strings.Cut(entry, "=")
+		part = strings.ToLower(strings.TrimSpace(part))
+		if !ok || part == "" {
+			return nil, fmt.Errorf("invalid PILOT_COLORS entry %q: want part=color", entry)
+		}
+		if colors == nil {
+			colors = make(map[string]string)
+		}
+		colors[part] = strings.TrimSpace(color)
+	}
+	return colors, nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name.
+func validHeaderName(name string) bool {
+	return name != "" && !strings.ContainsFunc(name, func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r))
+	})
+}
+
+// SessionsDir returns the sessions directory set by PILOT_SESSIONS_DIR, or
+// "" for the default. It reads the .env files and project config as Load
+// does, for commands that need no provider or API key.
+func SessionsDir() (string, error) {
+	LoadEnvFiles()
+	if err := loadProjectConfig(ProjectConfigFile); err != nil {
+		return "", err
+	}
+	return sessionsDirEnv()
+}
+
+// sessionsDirEnv returns PILOT_SESSIONS_DIR made absolute, so a relative
+// path means the same directory wherever the sessions are later read.
+func sessionsDirEnv() (string, error) {
+	v := strings.TrimSpace(os.Getenv("PILOT_SESSIONS_DIR"))
+	if v == "" {
+		return "", nil
+	}
+	dir, err := filepath.Abs(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid PILOT_SESSIONS_DIR %q: %w", v, err)
+	}
+	return dir, nil
+}
+
 // promptAPIKeyFor asks the user for an API key and saves it to the credentials file.
 func promptAPIKeyFor(providerName, envVar string) (string, error) {
 	fmt.Printf("Enter your %s API key: ", providerName)
@@ -181,10 +1063,54 @@ func promptAPIKeyFor(providerName, envVar string) (string, error) {
 	return key, nil
 }
 
+// LoadEnvFiles reads the .env file in the current directory and the
+// credentials file into the environment, filling in only unset variables.
+// Load calls it first; callers use it to check for an API key before Load
+// would prompt for one.
+func LoadEnvFiles() {
+	// Find the credentials file first, so the project's .env cannot move it
+	configDir, dirErr := ConfigDir()
+
+	// Load .env file in cwd if present; it comes with the project, so it
+	// cannot set user-only variables
+	loadEnvFile(".env", false)
+
+	// Load credentials from XDG config dir
+	if dirErr == nil {
+		loadEnvFile(filepath.Join(configDir, "credentials"), true)
+	}
+}
+
+// userOnlyEnv reports whether key may only be set by the environment or
+// the credentials file, never by a project's .env or config file, because a
+// cloned repository could use it to run commands without asking or to read
+// files outside itself. HOME and XDG_CONFIG_HOME are included because they
+// locate the credentials file and Pilot's other user-level state.
+func userOnlyEnv(key string) bool {
+	switch key {
+	case "HOME", "XDG_CONFIG_HOME", "PILOT_FORMAT_TRUST", "PILOT_SAFE_COMMANDS", "PILOT_CONFIRM_TIMEOUT", "PILOT_CONFIRM_DEFAULT", "PILOT_EXPLORE_ROOTS", "PILOT_AUDIT_LOG",
+		"PILOT_RECORD", "PILOT_REPLAY", "PILOT_SESSIONS_DIR":
+		return true
+	}
+	return strings.HasPrefix(key, "PILOT_") && strings.HasSuffix(key, "_CREDENTIAL_COMMAND")
+}
+
+// projectEnv records the variables a project's .env or config file set,
+// with their values.
+var projectEnv = map[string]string{}
+
+// fromProject reports whether key still holds the value a project's .env or
+// config file gave it.
+func fromProject(key string) bool {
+	v, ok := projectEnv[key]
+	return ok && os.Getenv(key) == v
+}
+
 // loadEnvFile reads a .env file and sets environment variables.
 // Lines are KEY=VALUE format. Ignores comments (#) and blank lines.
-// Does not override variables already set in the environment.
-func loadEnvFile(path string) {
+// Does not override variables already set in the environment. Unless the
+// file is trusted (the user's own), user-only variables are skipped.
+func loadEnvFile(path string, trusted bool) {
 	f, err := os.Open(path)
 	if err != nil {
 		return // file not found is fine
@@ -202,6 +1128,9 @@ func loadEnvFile(path string) {
 			continue
 		}
 		key = strings.TrimSpace(key)
+		if !trusted && userOnlyEnv(key) {
+			continue
+		}
 		value = strings.TrimSpace(value)
 		// Strip surrounding quotes
 		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
@@ -210,6 +1139,9 @@ func loadEnvFile(path string) {
 		// Don't override existing env vars
 		if os.Getenv(key) == "" {
 			os.Setenv(key, value)
+			if !trusted {
+				projectEnv[key] = value
+			}
 		}
 	}
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadEnvFile(t *testing.T) {
@@ -25,7 +27,7 @@ EMPTY=
 	os.Unsetenv("SINGLE_QUOTED")
 	os.Unsetenv("EMPTY")
 
-	loadEnvFile(envPath)
+	loadEnvFile(envPath, true)
 
 	tests := []struct {
 		key  string
@@ -60,7 +62,7 @@ func TestLoadEnvFileDoesNotOverride(t *testing.T) {
 	os.Setenv("MY_VAR", "from_env")
 	defer os.Unsetenv("MY_VAR")
 
-	loadEnvFile(envPath)
+	loadEnvFile(envPath, true)
 
 	if got := os.Getenv("MY_VAR"); got != "from_env" {
 		t.Errorf("expected from_env, got %s", got)
@@ -69,7 +71,7 @@ func TestLoadEnvFileDoesNotOverride(t *testing.T) {
 
 func TestLoadEnvFileMissing(t *testing.T) {
 	// Should not panic on missing file
-	loadEnvFile("/nonexistent/path/.env")
+	loadEnvFile("/nonexistent/path/.env", true)
 }
 
 func TestConfigDir(t *testing.T) {
@@ -106,3 +108,788 @@ func TestConfigDirDefault(t *testing.T) {
 		t.Errorf("expected %s, got %s", expected, configDir)
 	}
 }
+
+func TestParseToolResultLines(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   int
+		wantOK bool
+	}{
+		{"10", 10, true},
+		{"0", 0, true},
+		{"full", 0, true},
+		{" ALL ", 0, true},
+		{"-1", 0, false},
+		{"many", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseToolResultLines(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseToolResultLines(%q) = %d, %v; want %d, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLoadToolResultLines(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	t.Setenv("PILOT_TOOL_RESULT_LINES", "")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ToolResultLines != DefaultToolResultLines {
+		t.Errorf("expected default %d, got %d", DefaultToolResultLines, cfg.ToolResultLines)
+	}
+
+	t.Setenv("PILOT_TOOL_RESULT_LINES", "20")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ToolResultLines != 20 {
+		t.Errorf("expected 20, got %d", cfg.ToolResultLines)
+	}
+
+	t.Setenv("PILOT_TOOL_RESULT_LINES", "lots")
+	if _, err := Load(""); err == nil {
+		t.Error("expected error for invalid PILOT_TOOL_RESULT_LINES")
+	}
+}
+
+func TestLoadBranding(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("PILOT_TOOL_RESULT_LINES", "")
+
+	t.Setenv("PILOT_NAME", " Ace ")
+	t.Setenv("PILOT_TAGLINE", "Your pair programmer")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AssistantName != "Ace" || cfg.Tagline != "Your pair programmer" {
+		t.Errorf("unexpected branding: name=%q tagline=%q", cfg.AssistantName, cfg.Tagline)
+	}
+}
+
+func TestLoadRecordReplay(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+
+	// Replay needs no key, so Load must not prompt for one
+	t.Setenv("PILOT_REPLAY", "demo.jsonl")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Replay != "demo.jsonl" || cfg.Record != "" {
+		t.Errorf("unexpected cassettes: record=%q replay=%q", cfg.Record, cfg.Replay)
+	}
+
+	t.Setenv("PILOT_RECORD", "demo.jsonl")
+	if _, err := Load(""); err == nil {
+		t.Error("expected error with both PILOT_RECORD and PILOT_REPLAY set")
+	}
+}
+
+func TestLoadExploreTokenBudget(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("PILOT_TOOL_RESULT_LINES", "")
+
+	t.Setenv("PILOT_EXPLORE_TOKEN_BUDGET", "")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ExploreTokenBudget != DefaultExploreTokenBudget {
+		t.Errorf("expected default %d, got %d", DefaultExploreTokenBudget, cfg.ExploreTokenBudget)
+	}
+
+	t.Setenv("PILOT_EXPLORE_TOKEN_BUDGET", "0")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ExploreTokenBudget != 0 {
+		t.Errorf("expected 0, got %d", cfg.ExploreTokenBudget)
+	}
+
+	t.Setenv("PILOT_EXPLORE_TOKEN_BUDGET", "-5")
+	if _, err := Load(""); err == nil {
+		t.Error("expected error for negative PILOT_EXPLORE_TOKEN_BUDGET")
+	}
+}
+
+// clearPilotEnv blanks the PILOT_* variables so Load sees them as unset and
+// any values the project config applies are restored after the test.
+func clearPilotEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"PILOT_PROVIDER", "PILOT_MODEL", "PILOT_IGNORE", "PILOT_APPROVAL",
+		"PILOT_TOOL_RESULT_LINES", "PILOT_EXPLORE_TOKEN_BUDGET", "PILOT_EXPLORE_ITERATIONS", "PILOT_EXPLORE_TOOL_CALLS", "PILOT_NAME", "PILOT_TAGLINE",
+		"PILOT_COMPACTION", "PILOT_AUTO_COMPACT", "PILOT_IDLE_COMPACT", "PILOT_NARRATION", "PILOT_IDLE_TIMEOUT", "PILOT_IDLE_ACTION", "PILOT_EXIT_WINDOW",
+		"PILOT_MEMORY_TOKENS", "PILOT_CONFIRM_TIMEOUT", "PILOT_CONFIRM_DEFAULT", "PILOT_CONFIRM_STYLE", "PILOT_GREP_INDEX",
+		"PILOT_SAFE_COMMANDS", "PILOT_BASH_INTERIM", "PILOT_TOOL_TIMEOUT", "PILOT_FORMAT", "PILOT_FORMAT_TRUST", "PILOT_EXPLORE", "PILOT_EXPLORE_ROOTS", "PILOT_PAGER_LINES",
+		"PILOT_MAX_REQUEST_MB", "PILOT_TEMPERATURE", "PILOT_WRAP_UP_ITERATIONS", "PILOT_MAX_TOOL_CALLS",
+		"PILOT_RECORD", "PILOT_REPLAY", "PILOT_REDACT", "PILOT_PROTECT", "PILOT_DENY_READ", "PILOT_PROJECT_TREE", "PILOT_EXPLORE_CACHE", "PILOT_ENTER_CONTINUES", "PILOT_QUIET",
+		"PILOT_SESSIONS_DIR", "PILOT_FORK_ON_RESUME", "PILOT_COLORS", "PILOT_SUMMARIZE_RESULTS", "PILOT_SUMMARIZE_MODEL", "PILOT_OPENAI_HEADERS", "PILOT_ANTHROPIC_HEADERS",
+		"PILOT_OPENAI_CREDENTIAL_COMMAND", "PILOT_ANTHROPIC_CREDENTIAL_COMMAND", "PILOT_AUDIT_LOG",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func writeProjectConfig(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.MkdirAll(filepath.Join(dir, ".pilot"), 0755)
+	if err := os.WriteFile(filepath.Join(dir, ".pilot", "config.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	writeProjectConfig(t, `{
+		"provider": "anthropic",
+		"model": "claude-opus-4-6",
+		"ignore": ["dist", "*.egg-info"],
+		"protect": ["deploy/prod.env"],
+		"deny_read": ["secrets", "*.pem"],
+		"approval": "auto-edit",
+		"tool_result_lines": "full",
+		"explore_token_budget": 5000,
+		"explore_iterations": 10,
+		"explore_tool_calls": 25,
+		"name": "Ace",
+		"compaction": "tool-results",
+		"auto_compact": false,
+		"idle_compact": 60,
+		"summarize_results": 20000,
+		"summarize_model": "gpt-5-mini",
+		"narration": "terse",
+		"idle_timeout": 30,
+		"idle_action": "notify",
+		"exit_window": 5,
+		"memory_tokens": 0,
+		"confirm_style": "compact",
+		"grep_index": false,
+		"explore": false,
+		"explore_cache": true,
+		"quiet": true,
+		"redact": false,
+		"project_tree": true,
+		"pager_lines": 80,
+		"max_request_mb": 8,
+		"temperature": 0.2,
+		"wrap_up_iterations": 3,
+		"max_tool_calls": 8,
+		"enter_continues": true,
+		"bash_interim": 20,
+		"tool_timeout": 0,
+		"format": ["*.go=gofmt -w", "*.ts=prettier --write"],
+		"fork_on_resume": true,
+		"colors": {"prompt": "bold magenta", "error": "1;31"},
+		"headers": {"anthropic": {"X-Route": "team-a", "X-Org": "acme"}}
+	}`)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Provider != "anthropic" || cfg.Model != "claude-opus-4-6" {
+		t.Errorf("expected anthropic/claude-opus-4-6, got %s/%s", cfg.Provider, cfg.Model)
+	}
+	if len(cfg.IgnoreDirs) != 2 || cfg.IgnoreDirs[0] != "dist" || cfg.IgnoreDirs[1] != "*.egg-info" {
+		t.Errorf("unexpected ignore dirs: %q", cfg.IgnoreDirs)
+	}
+	if len(cfg.ProtectPaths) != 1 || cfg.ProtectPaths[0] != "deploy/prod.env" {
+		t.Errorf("unexpected protected paths: %q", cfg.ProtectPaths)
+	}
+	if len(cfg.DenyRead) != 2 || cfg.DenyRead[0] != "secrets" || cfg.DenyRead[1] != "*.pem" {
+		t.Errorf("unexpected deny-read list: %q", cfg.DenyRead)
+	}
+	if cfg.Approval != ApprovalAutoEdit {
+		t.Errorf("expected approval %q, got %q", ApprovalAutoEdit, cfg.Approval)
+	}
+	if cfg.ToolResultLines != 0 || cfg.ExploreTokenBudget != 5000 || cfg.AssistantName != "Ace" {
+		t.Errorf("unexpected limits: lines=%d budget=%d name=%q", cfg.ToolResultLines, cfg.ExploreTokenBudget, cfg.AssistantName)
+	}
+	if cfg.Compaction != CompactionToolResults {
+		t.Errorf("expected compaction %q, got %q", CompactionToolResults, cfg.Compaction)
+	}
+	if cfg.AutoCompact {
+		t.Error("expected auto-compaction disabled")
+	}
+	if cfg.IdleCompactPercent != 60 {
+		t.Errorf("expected idle compaction at 60%%, got %d", cfg.IdleCompactPercent)
+	}
+	if cfg.SummarizeResults != 20000 || cfg.SummarizeModel != "gpt-5-mini" {
+		t.Errorf("expected results over 20000 chars summarized by gpt-5-mini, got %d %q", cfg.SummarizeResults, cfg.SummarizeModel)
+	}
+	if cfg.Narration != NarrationTerse {
+		t.Errorf("expected narration %q, got %q", NarrationTerse, cfg.Narration)
+	}
+	if cfg.ConfirmStyle != ConfirmStyleCompact {
+		t.Errorf("expected confirm style %q, got %q", ConfirmStyleCompact, cfg.ConfirmStyle)
+	}
+	if cfg.MemoryTokens != 0 {
+		t.Errorf("expected memory cap disabled, got %d", cfg.MemoryTokens)
+	}
+	if cfg.IdleTimeout != 30*time.Minute || cfg.IdleAction != IdleActionNotify {
+		t.Errorf("expected 30m notify idle timeout, got %v %q", cfg.IdleTimeout, cfg.IdleAction)
+	}
+	if cfg.ExitWindow != 5*time.Second {
+		t.Errorf("expected 5s exit window, got %v", cfg.ExitWindow)
+	}
+	if cfg.GrepIndex {
+		t.Error("expected grep index disabled")
+	}
+	if cfg.Explore {
+		t.Error("expected explore disabled")
+	}
+	if !cfg.Quiet {
+		t.Error("expected Quiet from project config")
+	}
+	if !cfg.ExploreCache {
+		t.Error("expected explore cache enabled")
+	}
+	if !cfg.EnterContinues {
+		t.Error("expected enter to continue")
+	}
+	if !cfg.ProjectTree {
+		t.Error("expected project tree enabled")
+	}
+	if cfg.Redact {
+		t.Error("expected redaction disabled")
+	}
+	if cfg.PagerLines != 80 {
+		t.Errorf("expected pager threshold 80, got %d", cfg.PagerLines)
+	}
+	if cfg.MaxRequestMB != 8 {
+		t.Errorf("expected 8 MB request cap, got %d", cfg.MaxRequestMB)
+	}
+	if cfg.WrapUpIterations != 3 {
+		t.Errorf("expected 3 wrap-up iterations, got %d", cfg.WrapUpIterations)
+	}
+	if cfg.MaxToolCalls != 8 {
+		t.Errorf("expected 8 max tool calls, got %d", cfg.MaxToolCalls)
+	}
+	if cfg.ExploreIterations != 10 || cfg.ExploreToolCalls != 25 {
+		t.Errorf("expected explore limits 10 and 25, got %d and %d", cfg.ExploreIterations, cfg.ExploreToolCalls)
+	}
+	if cfg.Temperature == nil || *cfg.Temperature != 0.2 {
+		t.Errorf("expected temperature 0.2, got %v", cfg.Temperature)
+	}
+	if cfg.SafeCommands != nil {
+		t.Errorf("expected no safe commands from a project, got %q", cfg.SafeCommands)
+	}
+	if cfg.BashInterim != 20*time.Second {
+		t.Errorf("expected 20s bash interim, got %v", cfg.BashInterim)
+	}
+	if cfg.ToolTimeout != 0 {
+		t.Errorf("expected tool timeout disabled, got %v", cfg.ToolTimeout)
+	}
+	if len(cfg.Formatters) != 2 || cfg.Formatters[0] != "*.go=gofmt -w" || cfg.Formatters[1] != "*.ts=prettier --write" {
+		t.Errorf("unexpected formatters: %q", cfg.Formatters)
+	}
+	if cfg.TrustFormatters {
+		t.Error("expected the project's formatters untrusted")
+	}
+	if h := cfg.Headers["anthropic"]; len(cfg.Headers) != 1 || len(h) != 2 || h["X-Route"] != "team-a" || h["X-Org"] != "acme" {
+		t.Errorf("unexpected headers: %v", cfg.Headers)
+	}
+	if !cfg.ForkOnResume {
+		t.Error("expected fork on resume enabled")
+	}
+	if len(cfg.Colors) != 2 || cfg.Colors["prompt"] != "bold magenta" || cfg.Colors["error"] != "1;31" {
+		t.Errorf("unexpected colors: %v", cfg.Colors)
+	}
+}
+
+func TestLoadProjectConfigEnvOverrides(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	writeProjectConfig(t, `{"provider": "anthropic", "model": "claude-opus-4-6", "tool_result_lines": 3, "approval": "auto-edit"}`)
+
+	t.Setenv("PILOT_PROVIDER", "openai")
+	t.Setenv("PILOT_MODEL", "gpt-5.2-codex")
+	t.Setenv("PILOT_TOOL_RESULT_LINES", "12")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Provider != "openai" || cfg.Model != "gpt-5.2-codex" {
+		t.Errorf("expected env to override provider/model, got %s/%s", cfg.Provider, cfg.Model)
+	}
+	if cfg.ContextWindow != 400000 {
+		t.Errorf("expected context window for gpt-5 model, got %d", cfg.ContextWindow)
+	}
+	if cfg.ToolResultLines != 12 {
+		t.Errorf("expected env tool result lines 12, got %d", cfg.ToolResultLines)
+	}
+	// Keys not set in the environment still come from the file
+	if cfg.Approval != ApprovalAutoEdit {
+		t.Errorf("expected approval from file, got %q", cfg.Approval)
+	}
+}
+
+func TestLoadProjectConfigInvalid(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	tests := map[string]string{
+		"malformed json":  `{"model": `,
+		"unknown field":   `{"modle": "gpt-4o"}`,
+		"bad approval":    `{"approval": "always"}`,
+		"bad provider":    `{"provider": "acme"}`,
+		"bad compaction":  `{"compaction": "never"}`,
+		"bad autocompact": `{"auto_compact": "off"}`,
+		"bad narration":   `{"narration": "chatty"}`,
+		"bad idle pct":    `{"idle_compact": 150}`,
+		"bad summarize":   `{"summarize_results": -1}`,
+		"bad header":      `{"headers": {"openai": {"Bad Name": "x"}}}`,
+		"header provider": `{"headers": {"acme": {"X-Org": "acme"}}}`,
+		"bad idle action": `{"idle_action": "sleep"}`,
+		"bad exit window": `{"exit_window": -1}`,
+		"confirm default": `{"confirm_default": "approve"}`,
+		"confirm timeout": `{"confirm_timeout": 1}`,
+		"bad style":       `{"confirm_style": "tiny"}`,
+		"bad grep index":  `{"grep_index": "yes"}`,
+		"safe commands":   `{"safe_commands": ["git status"]}`,
+		"bad interim":     `{"bash_interim": -5}`,
+		"bad tool limit":  `{"tool_timeout": -1}`,
+		"bad format":      `{"format": ["gofmt -w"]}`,
+		"bad format glob": `{"format": ["[.go=gofmt -w"]}`,
+		"format trust":    `{"format_trust": true}`,
+		"bad explore":     `{"explore": "off"}`,
+		"bad explore hit": `{"explore_cache": "on"}`,
+		"bad quiet":       `{"quiet": "yes"}`,
+		"bad redact":      `{"redact": "no"}`,
+		"bad tree":        `{"project_tree": "on"}`,
+		"bad pager lines": `{"pager_lines": -1}`,
+		"bad request cap": `{"max_request_mb": "big"}`,
+		"bad temperature": `{"temperature": 3}`,
+		"bad wrap-up":     `{"wrap_up_iterations": -1}`,
+		"bad tool calls":  `{"max_tool_calls": -2}`,
+		"bad depth":       `{"explore_iterations": 0}`,
+		"bad budget":      `{"explore_tool_calls": -1}`,
+		"bad enter":       `{"enter_continues": "sure"}`,
+		"bad fork":        `{"fork_on_resume": "yes"}`,
+		"bad colors":      `{"colors": ["red"]}`,
+		"bad deny_read":   `{"deny_read": ["[.env"]}`,
+		"sessions dir":    `{"sessions_dir": "state/sessions"}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			clearPilotEnv(t)
+			writeProjectConfig(t, content)
+			if _, err := Load(""); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLoadWithoutProjectConfig(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Provider != DefaultProvider || cfg.Model != DefaultModel(DefaultProvider) || cfg.Approval != ApprovalAsk || cfg.Compaction != CompactionSummarize || !cfg.AutoCompact || cfg.Narration != NarrationDefault || cfg.IdleCompactPercent != 0 || cfg.IdleTimeout != 0 || cfg.ExitWindow != DefaultExitWindow || cfg.MemoryTokens != DefaultMemoryTokens || cfg.ConfirmTimeout != 0 || cfg.ConfirmStyle != ConfirmStyleVerbose || !cfg.GrepIndex || cfg.SafeCommands != nil || cfg.BashInterim != 0 || cfg.ToolTimeout != DefaultToolTimeout || cfg.Formatters != nil || cfg.TrustFormatters || !cfg.Explore || cfg.ExploreCache || cfg.PagerLines != 0 || cfg.MaxRequestMB != DefaultMaxRequestMB || cfg.Temperature != nil || cfg.WrapUpIterations != 0 || !cfg.Redact || cfg.ProjectTree || cfg.EnterContinues || cfg.SessionsDir != "" || cfg.SummarizeResults != 0 || cfg.SummarizeModel != "" || cfg.Headers != nil || cfg.Quiet || cfg.MaxToolCalls != DefaultMaxToolCalls || cfg.AuditLog != "" || cfg.ExploreIterations != DefaultExploreIterations || cfg.ExploreToolCalls != 0 || cfg.ForkOnResume || cfg.Colors != nil || cfg.DenyRead != nil || cfg.ExploreRoots != nil {
+		t.Errorf("expected defaults, got %s/%s approval=%s compaction=%s", cfg.Provider, cfg.Model, cfg.Approval, cfg.Compaction)
+	}
+}
+
+func TestLoadHeaders(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	t.Setenv("PILOT_OPENAI_HEADERS", "OpenAI-Organization=org-1, X-Token=a=b")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h := cfg.Headers["openai"]; len(h) != 2 || h["OpenAI-Organization"] != "org-1" || h["X-Token"] != "a=b" {
+		t.Errorf("unexpected headers: %v", cfg.Headers)
+	}
+
+	t.Setenv("PILOT_OPENAI_HEADERS", "OpenAI-Organization")
+	if _, err := Load(""); err == nil {
+		t.Error("expected error for a header entry without a value")
+	}
+}
+
+func TestCredentialCommand(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte("sk-ant-from-command\n"), 0600)
+	t.Setenv("PILOT_ANTHROPIC_CREDENTIAL_COMMAND", "cat '"+keyFile+"'")
+
+	cfg, err := Load("anthropic")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.APIKey != "sk-ant-from-command" {
+		t.Errorf("expected the command's key, got %q", cfg.APIKey)
+	}
+
+	// The key is cached until a refresh reruns the command
+	os.WriteFile(keyFile, []byte("sk-ant-rotated"), 0600)
+	if got := APIKeyForProvider("anthropic"); got != "sk-ant-from-command" {
+		t.Errorf("expected the cached key, got %q", got)
+	}
+	if key, err := RefreshAPIKey("anthropic"); err != nil || key != "sk-ant-rotated" {
+		t.Errorf("expected the rotated key, got %q, %v", key, err)
+	}
+	if got := APIKeyForProvider("anthropic"); got != "sk-ant-rotated" {
+		t.Errorf("expected the refreshed key, got %q", got)
+	}
+	if _, err := RefreshAPIKey("openai"); err == nil {
+		t.Error("expected an error refreshing a provider without a command")
+	}
+}
+
+func TestCredentialCommandNotFromProjectEnv(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	t.Setenv("PILOT_OPENAI_CREDENTIAL_COMMAND", "")
+	marker := filepath.Join(t.TempDir(), "ran")
+	os.WriteFile(".env", []byte("PILOT_OPENAI_CREDENTIAL_COMMAND=touch '"+marker+"'; echo sk-repo\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.APIKey != "sk-env" {
+		t.Errorf("expected the env key, got %q", cfg.APIKey)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected the .env credential command not to run")
+	}
+	if got := os.Getenv("PILOT_OPENAI_CREDENTIAL_COMMAND"); got != "" {
+		t.Errorf("expected the .env credential command ignored, got %q", got)
+	}
+
+	// The user's credentials file may still set one
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte("sk-from-command\n"), 0600)
+	dir, _ := ConfigDir()
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "credentials"), []byte("PILOT_OPENAI_CREDENTIAL_COMMAND=cat '"+keyFile+"'\n"), 0600)
+	cfg, err = Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.APIKey != "sk-from-command" {
+		t.Errorf("expected the credentials file's command key, got %q", cfg.APIKey)
+	}
+}
+
+func TestProjectEnvCannotMoveCredentials(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	os.Unsetenv("XDG_CONFIG_HOME")
+	clearPilotEnv(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	// The repository ships a credentials file and points the config dir at it
+	marker := filepath.Join(t.TempDir(), "ran")
+	os.MkdirAll(filepath.Join(dir, "pilot"), 0755)
+	os.WriteFile(filepath.Join(dir, "pilot", "credentials"), []byte(
+		"PILOT_OPENAI_CREDENTIAL_COMMAND=touch '"+marker+"'; echo sk-repo\nPILOT_SAFE_COMMANDS=re:.*\n"), 0600)
+	os.WriteFile(".env", []byte("XDG_CONFIG_HOME="+dir+"\nHOME="+dir+"\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := os.Getenv("XDG_CONFIG_HOME"); got != "" {
+		t.Errorf("expected the .env config dir ignored, got %q", got)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected the repository's credential command not to run")
+	}
+	if cfg.APIKey != "sk-env" || cfg.SafeCommands != nil {
+		t.Errorf("expected the repository's credentials file untrusted, got key %q and safe commands %q", cfg.APIKey, cfg.SafeCommands)
+	}
+}
+
+func TestFormatTrustOnlyFromUser(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+
+	// A project can neither trust formatters nor have its own trusted
+	writeProjectConfig(t, `{"format": ["*.go=gofmt -w"]}`)
+	os.WriteFile(".env", []byte("PILOT_FORMAT_TRUST=true\n"), 0644)
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TrustFormatters || len(cfg.Formatters) != 1 {
+		t.Errorf("expected the project's formatter untrusted, got trust %v for %q", cfg.TrustFormatters, cfg.Formatters)
+	}
+
+	t.Setenv("PILOT_FORMAT_TRUST", "true")
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TrustFormatters {
+		t.Error("expected the project's formatter untrusted even with PILOT_FORMAT_TRUST set")
+	}
+
+	// The user's own formatters can be trusted
+	t.Setenv("PILOT_FORMAT", "*.go=goimports -w")
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.TrustFormatters {
+		t.Error("expected the user's formatter trusted")
+	}
+}
+
+func TestSafeCommandsOnlyFromUser(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	os.WriteFile(".env", []byte("PILOT_SAFE_COMMANDS=python,re:.*\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SafeCommands != nil {
+		t.Errorf("expected the .env allowlist ignored, got %q", cfg.SafeCommands)
+	}
+
+	t.Setenv("PILOT_SAFE_COMMANDS", `git status, re:go (vet|list) \S+`)
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.SafeCommands) != 2 || cfg.SafeCommands[0] != "git status" || cfg.SafeCommands[1] != `re:go (vet|list) \S+` {
+		t.Errorf("unexpected safe commands: %q", cfg.SafeCommands)
+	}
+
+	t.Setenv("PILOT_SAFE_COMMANDS", "re:go (vet")
+	if _, err := Load("openai"); err == nil {
+		t.Error("expected an error for an invalid safe command regex")
+	}
+}
+
+func TestExploreRootsOnlyFromUser(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.Mkdir("lib", 0755)
+	os.WriteFile(".env", []byte("PILOT_EXPLORE_ROOTS=/\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ExploreRoots != nil {
+		t.Errorf("expected the .env explore roots ignored, got %q", cfg.ExploreRoots)
+	}
+
+	other := t.TempDir()
+	t.Setenv("PILOT_EXPLORE_ROOTS", other+", lib")
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.ExploreRoots) != 2 || cfg.ExploreRoots[0] != other || cfg.ExploreRoots[1] != filepath.Join(dir, "lib") {
+		t.Errorf("unexpected explore roots: %q", cfg.ExploreRoots)
+	}
+
+	t.Setenv("PILOT_EXPLORE_ROOTS", filepath.Join(dir, "missing"))
+	if _, err := Load("openai"); err == nil {
+		t.Error("expected an error for a missing explore root")
+	}
+}
+
+func TestAuditLogOnlyFromUser(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	home := t.TempDir()
+	os.WriteFile(".env", []byte("PILOT_AUDIT_LOG="+filepath.Join(home, ".bashrc")+"\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AuditLog != "" {
+		t.Errorf("expected the .env audit log ignored, got %q", cfg.AuditLog)
+	}
+
+	logPath := filepath.Join(t.TempDir(), "audit.sh")
+	t.Setenv("PILOT_AUDIT_LOG", logPath)
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AuditLog != logPath {
+		t.Errorf("expected audit log %q, got %q", logPath, cfg.AuditLog)
+	}
+}
+
+func TestRecordReplayOnlyFromUser(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	os.WriteFile(".env", []byte("PILOT_REPLAY=scripted.jsonl\nPILOT_RECORD=transcript.jsonl\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Replay != "" || cfg.Record != "" {
+		t.Errorf("expected the .env cassettes ignored, got replay %q and record %q", cfg.Replay, cfg.Record)
+	}
+
+	t.Setenv("PILOT_REPLAY", "demo.jsonl")
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Replay != "demo.jsonl" {
+		t.Errorf("expected replay demo.jsonl, got %q", cfg.Replay)
+	}
+}
+
+func TestSessionsDirOnlyFromUser(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	os.WriteFile(".env", []byte("PILOT_SESSIONS_DIR=.sessions\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SessionsDir != "" {
+		t.Errorf("expected the .env sessions dir ignored, got %q", cfg.SessionsDir)
+	}
+
+	t.Setenv("PILOT_SESSIONS_DIR", "state/sessions")
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wd, _ := os.Getwd(); cfg.SessionsDir != filepath.Join(wd, "state", "sessions") {
+		t.Errorf("expected sessions dir resolved against the working directory, got %q", cfg.SessionsDir)
+	}
+}
+
+func TestConfirmTimeoutOnlyFromUser(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	os.WriteFile(".env", []byte("PILOT_CONFIRM_TIMEOUT=1\nPILOT_CONFIRM_DEFAULT=approve\n"), 0644)
+
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ConfirmTimeout != 0 || cfg.ConfirmDefault != ConfirmDeny {
+		t.Errorf("expected the .env confirm timeout ignored, got %v %q", cfg.ConfirmTimeout, cfg.ConfirmDefault)
+	}
+
+	t.Setenv("PILOT_CONFIRM_TIMEOUT", "90")
+	t.Setenv("PILOT_CONFIRM_DEFAULT", "approve")
+	if cfg, err = Load("openai"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ConfirmTimeout != 90*time.Second || cfg.ConfirmDefault != ConfirmApprove {
+		t.Errorf("expected 90s approve confirm timeout, got %v %q", cfg.ConfirmTimeout, cfg.ConfirmDefault)
+	}
+
+	t.Setenv("PILOT_CONFIRM_DEFAULT", "maybe")
+	if _, err := Load("openai"); err == nil {
+		t.Error("expected an error for an invalid confirm default")
+	}
+}
+
+func TestCredentialCommandFailure(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clearPilotEnv(t)
+	t.Chdir(t.TempDir())
+	t.Setenv("PILOT_OPENAI_CREDENTIAL_COMMAND", "echo vault sealed >&2; exit 3")
+
+	// A key from env/credentials is the fallback
+	t.Setenv("OPENAI_API_KEY", "sk-env")
+	cfg, err := Load("openai")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.APIKey != "sk-env" {
+		t.Errorf("expected the env key, got %q", cfg.APIKey)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "")
+	_, err = Load("openai")
+	if err == nil || !strings.Contains(err.Error(), "vault sealed") {
+		t.Errorf("expected the command's error, got %v", err)
+	}
+
+	t.Setenv("PILOT_OPENAI_CREDENTIAL_COMMAND", "true")
+	if _, err := Load("openai"); err == nil || !strings.Contains(err.Error(), "printed no key") {
+		t.Errorf("expected an error for empty output, got %v", err)
+	}
+}
+
+func TestProviderStatuses(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test")
+
+	statuses := ProviderStatuses()
+	if len(statuses) != len(KnownProviders()) {
+		t.Fatalf("expected one status per provider, got %+v", statuses)
+	}
+	byName := make(map[string]ProviderStatus)
+	for _, s := range statuses {
+		byName[s.Name] = s
+	}
+
+	openai := byName["openai"]
+	if openai.Configured || openai.DefaultModel != DefaultModel("openai") || openai.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("unexpected openai status: %+v", openai)
+	}
+	anthropic := byName["anthropic"]
+	if !anthropic.Configured || anthropic.DefaultModel != DefaultModel("anthropic") || anthropic.BaseURL != "https://api.anthropic.com/v1" {
+		t.Errorf("unexpected anthropic status: %+v", anthropic)
+	}
+
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	if s := ProviderStatuses()[0]; s.Name != "openai" || !s.Configured {
+		t.Errorf("expected openai configured once its key is set, got %+v", s)
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentialCommandTimeout bounds a credential command, which may wait on a
+// secrets manager over the network.
+const credentialCommandTimeout = 30 * time.Second
+
+var (
+	credentialMu sync.Mutex
+	// credentialKeys caches the key each credential command printed, so a
+	// command runs once per process until RefreshAPIKey reruns it.
+	credentialKeys = map[string]string{}
+)
+
+// CredentialCommandEnv returns the environment variable holding the given
+// provider's credential command, e.g. PILOT_ANTHROPIC_CREDENTIAL_COMMAND.
+func CredentialCommandEnv(provider string) string {
+	return "PILOT_" + strings.ToUpper(provider) + "_CREDENTIAL_COMMAND"
+}
+
+// CredentialCommand returns the provider's credential command, or "" if it
+// has none.
+func CredentialCommand(provider string) string {
+	return strings.TrimSpace(os.Getenv(CredentialCommandEnv(provider)))
+}
+
+// commandAPIKey returns the key the provider's credential command prints,
+// running it on first use. It returns "" and no error if there is no
+// command.
+func commandAPIKey(provider string) (string, error) {
+	command := CredentialCommand(provider)
+	if command == "" {
+		return "", nil
+	}
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	if key, ok := credentialKeys[command]; ok {
+		return key, nil
+	}
+	key, err := runCredentialCommand(provider, command)
+	if err != nil {
+		return "", err
+	}
+	credentialKeys[command] = key
+	return key, nil
+}
+
+// RefreshAPIKey reruns the provider's credential command, for a key that
+// was rejected, and returns the new key.
+func RefreshAPIKey(provider string) (string, error) {
+	command := CredentialCommand(provider)
+	if command == "" {
+		return "", fmt.Errorf("no credential command for %s: set %s", provider, CredentialCommandEnv(provider))
+	}
+	credentialMu.Lock()
+	defer credentialMu.Unlock()
+	key, err := runCredentialCommand(provider, command)
+	if err != nil {
+		return "", err
+	}
+	credentialKeys[command] = key
+	return key, nil
+}
+
+// runCredentialCommand runs command in the shell and returns its trimmed
+// stdout. The output is never part of an error, since it holds the key.
+func runCredentialCommand(provider, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", "-c", command)
+	}
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%s credential command timed out after %s", provider, credentialCommandTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s credential command failed: %w: %s", provider, err, msg)
+		}
+		return "", fmt.Errorf("%s credential command failed: %w", provider, err)
+	}
+	key := strings.TrimSpace(stdout.String())
+	if key == "" {
+		return "", fmt.Errorf("%s credential command printed no key", provider)
+	}
+	return key, nil
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ProjectConfigFile is the per-project config file, relative to the working directory.
+var ProjectConfigFile = filepath.Join(".pilot", "config.json")
+
+// projectConfig is the schema of the project config file. Every field is
+// optional; each maps to the environment variable noted beside it.
+type projectConfig struct {
+	Provider           string          `json:"provider"`             // PILOT_PROVIDER
+	Model              string          `json:"model"`                // PILOT_MODEL
+	Ignore             []string        `json:"ignore"`               // PILOT_IGNORE
+	Protect            []string        `json:"protect"`              // PILOT_PROTECT
+	DenyRead           []string        `json:"deny_read"`            // PILOT_DENY_READ
+	BashInterim        *int            `json:"bash_interim"`         // PILOT_BASH_INTERIM (seconds)
+	ToolTimeout        *int            `json:"tool_timeout"`         // PILOT_TOOL_TIMEOUT (seconds)
+	Format             []string        `json:"format"`               // PILOT_FORMAT
+	Approval           string          `json:"approval"`             // PILOT_APPROVAL
+	ToolResultLines    json.RawMessage `json:"tool_result_lines"`    // PILOT_TOOL_RESULT_LINES
+	PagerLines         *int            `json:"pager_lines"`          // PILOT_PAGER_LINES
+	MaxRequestMB       *int            `json:"max_request_mb"`       // PILOT_MAX_REQUEST_MB
+	Temperature        *float64        `json:"temperature"`          // PILOT_TEMPERATURE
+	ExploreTokenBudget *int            `json:"explore_token_budget"` // PILOT_EXPLORE_TOKEN_BUDGET
+	ExploreIterations  *int            `json:"explore_iterations"`   // PILOT_EXPLORE_ITERATIONS
+	ExploreToolCalls   *int            `json:"explore_tool_calls"`   // PILOT_EXPLORE_TOOL_CALLS
+	MemoryTokens       *int            `json:"memory_tokens"`        // PILOT_MEMORY_TOKENS
+	WrapUpIterations   *int            `json:"wrap_up_iterations"`   // PILOT_WRAP_UP_ITERATIONS
+	MaxToolCalls       *int            `json:"max_tool_calls"`       // PILOT_MAX_TOOL_CALLS
+	EnterContinues     *bool           `json:"enter_continues"`      // PILOT_ENTER_CONTINUES
+	Name               string          `json:"name"`                 // PILOT_NAME
+	Tagline            string          `json:"tagline"`              // PILOT_TAGLINE
+	Quiet              *bool           `json:"quiet"`                // PILOT_QUIET
+	Colors             outputColors    `json:"colors"`               // PILOT_COLORS
+	Compaction         string          `json:"compaction"`           // PILOT_COMPACTION
+	AutoCompact        *bool           `json:"auto_compact"`         // PILOT_AUTO_COMPACT
+	IdleCompact        *int            `json:"idle_compact"`         // PILOT_IDLE_COMPACT (percent)
+	SummarizeResults   *int            `json:"summarize_results"`    // PILOT_SUMMARIZE_RESULTS (characters)
+	SummarizeModel     string          `json:"summarize_model"`      // PILOT_SUMMARIZE_MODEL
+	Narration          string          `json:"narration"`            // PILOT_NARRATION
+	ConfirmStyle       string          `json:"confirm_style"`        // PILOT_CONFIRM_STYLE
+	IdleTimeout        *int            `json:"idle_timeout"`         // PILOT_IDLE_TIMEOUT (minutes)
+	IdleAction         string          `json:"idle_action"`          // PILOT_IDLE_ACTION
+	ExitWindow         *int            `json:"exit_window"`          // PILOT_EXIT_WINDOW (seconds)
+	GrepIndex          *bool           `json:"grep_index"`           // PILOT_GREP_INDEX
+	Explore            *bool           `json:"explore"`              // PILOT_EXPLORE
+	ExploreCache       *bool           `json:"explore_cache"`        // PILOT_EXPLORE_CACHE
+	Redact             *bool           `json:"redact"`               // PILOT_REDACT
+	ProjectTree        *bool           `json:"project_tree"`         // PILOT_PROJECT_TREE
+	ForkOnResume       *bool           `json:"fork_on_resume"`       // PILOT_FORK_ON_RESUME
+	Headers            providerHeaders `json:"headers"`              // PILOT_<PROVIDER>_HEADERS
+}
+
+// outputColors maps terminal output parts to their colors.
+type outputColors map[string]string
+
+// providerHeaders maps provider names to the extra request headers sent to
+// that provider.
+type providerHeaders map[string]map[string]string
+
+// loadProjectConfig reads the project config file at path and applies its
+// values as defaults for the corresponding environment variables, so that
+// anything already set in the environment (or .env) takes precedence.
+// A missing file is not an error.
+func loadProjectConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read project config: %w", err)
+	}
+
+	var pc projectConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	defaults := map[string]string{
+		"PILOT_PROVIDER":        pc.Provider,
+		"PILOT_MODEL":           pc.Model,
+		"PILOT_IGNORE":          strings.Join(pc.Ignore, ","),
+		"PILOT_PROTECT":         strings.Join(pc.Protect, ","),
+		"PILOT_DENY_READ":       strings.Join(pc.DenyRead, ","),
+		"PILOT_FORMAT":          strings.Join(pc.Format, ","),
+		"PILOT_APPROVAL":        pc.Approval,
+		"PILOT_NAME":            pc.Name,
+		"PILOT_TAGLINE":         pc.Tagline,
+		"PILOT_COMPACTION":      pc.Compaction,
+		"PILOT_NARRATION":       pc.Narration,
+		"PILOT_IDLE_ACTION":     pc.IdleAction,
+		"PILOT_CONFIRM_STYLE":   pc.ConfirmStyle,
+		"PILOT_SUMMARIZE_MODEL": pc.SummarizeModel,
+	}
+	if len(pc.ToolResultLines) > 0 {
+		// Accept either a number or a string like "full"
+		var s string
+		if err := json.Unmarshal(pc.ToolResultLines, &s); err != nil {
+			s = string(pc.ToolResultLines)
+		}
+		defaults["PILOT_TOOL_RESULT_LINES"] = s
+	}
+	if pc.ExploreTokenBudget != nil {
+		defaults["PILOT_EXPLORE_TOKEN_BUDGET"] = strconv.Itoa(*pc.ExploreTokenBudget)
+	}
+	if pc.ExploreIterations != nil {
+		defaults["PILOT_EXPLORE_ITERATIONS"] = strconv.Itoa(*pc.ExploreIterations)
+	}
+	if pc.ExploreToolCalls != nil {
+		defaults["PILOT_EXPLORE_TOOL_CALLS"] = strconv.Itoa(*pc.ExploreToolCalls)
+	}
+	if pc.PagerLines != nil {
+		defaults["PILOT_PAGER_LINES"] = strconv.Itoa(*pc.PagerLines)
+	}
+	if pc.MaxRequestMB != nil {
+		defaults["PILOT_MAX_REQUEST_MB"] = strconv.Itoa(*pc.MaxRequestMB)
+	}
+	if pc.Temperature != nil {
+		defaults["PILOT_TEMPERATURE"] = strconv.FormatFloat(*pc.Temperature, 'g', -1, 64)
+	}
+	if pc.MemoryTokens != nil {
+		defaults["PILOT_MEMORY_TOKENS"] = strconv.Itoa(*pc.MemoryTokens)
+	}
+	if pc.WrapUpIterations != nil {
+		defaults["PILOT_WRAP_UP_ITERATIONS"] = strconv.Itoa(*pc.WrapUpIterations)
+	}
+	if pc.MaxToolCalls != nil {
+		defaults["PILOT_MAX_TOOL_CALLS"] = strconv.Itoa(*pc.MaxToolCalls)
+	}
+	if pc.EnterContinues != nil {
+		defaults["PILOT_ENTER_CONTINUES"] = strconv.FormatBool(*pc.EnterContinues)
+	}
+	if pc.IdleCompact != nil {
+		defaults["PILOT_IDLE_COMPACT"] = strconv.Itoa(*pc.IdleCompact)
+	}
+	if pc.SummarizeResults != nil {
+		defaults["PILOT_SUMMARIZE_RESULTS"] = strconv.Itoa(*pc.SummarizeResults)
+	}
+	if pc.BashInterim != nil {
+		defaults["PILOT_BASH_INTERIM"] = strconv.Itoa(*pc.BashInterim)
+	}
+	if pc.ToolTimeout != nil {
+		defaults["PILOT_TOOL_TIMEOUT"] = strconv.Itoa(*pc.ToolTimeout)
+	}
+	if pc.ExitWindow != nil {
+		defaults["PILOT_EXIT_WINDOW"] = strconv.Itoa(*pc.ExitWindow)
+	}
+	if pc.IdleTimeout != nil {
+		defaults["PILOT_IDLE_TIMEOUT"] = strconv.Itoa(*pc.IdleTimeout)
+	}
+	if pc.AutoCompact != nil {
+		defaults["PILOT_AUTO_COMPACT"] = strconv.FormatBool(*pc.AutoCompact)
+	}
+	if pc.GrepIndex != nil {
+		defaults["PILOT_GREP_INDEX"] = strconv.FormatBool(*pc.GrepIndex)
+	}
+	if pc.Explore != nil {
+		defaults["PILOT_EXPLORE"] = strconv.FormatBool(*pc.Explore)
+	}
+	if pc.ExploreCache != nil {
+		defaults["PILOT_EXPLORE_CACHE"] = strconv.FormatBool(*pc.ExploreCache)
+	}
+	if pc.Redact != nil {
+		defaults["PILOT_REDACT"] = strconv.FormatBool(*pc.Redact)
+	}
+	if pc.ProjectTree != nil {
+		defaults["PILOT_PROJECT_TREE"] = strconv.FormatBool(*pc.ProjectTree)
+	}
+	if pc.ForkOnResume != nil {
+		defaults["PILOT_FORK_ON_RESUME"] = strconv.FormatBool(*pc.ForkOnResume)
+	}
+	if pc.Quiet != nil {
+		defaults["PILOT_QUIET"] = strconv.FormatBool(*pc.Quiet)
+	}
+	if len(pc.Colors) > 0 {
+		entries := make([]string, 0, len(pc.Colors))
+		for part, color := range pc.Colors {
+			entries = append(entries, part+"="+color)
+		}
+		slices.Sort(entries)
+		defaults["PILOT_COLORS"] = strings.Join(entries, ",")
+	}
+	for provider, headers := range pc.Headers {
+		if !slices.Contains(KnownProviders(), provider) {
+			return fmt.Errorf("%s: headers: unknown provider %q", path, provider)
+		}
+		entries := make([]string, 0, len(headers))
+		for name, value := range headers {
+			entries = append(entries, name+"="+value)
+		}
+		slices.Sort(entries)
+		defaults[headersEnv(provider)] = strings.Join(entries, ",")
+	}
+
+	for key, value := range defaults {
+		if value != "" && os.Getenv(key) == "" {
+			os.Setenv(key, value)
+			projectEnv[key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package debuglog writes an optional troubleshooting log of LLM requests,
+// responses, tool calls, and errors. Entries are timestamped, key=value
+// formatted, and scrubbed of API keys before they reach disk.
+package debuglog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the log size at which the file is rotated.
+const DefaultMaxSize = 5 * 1024 * 1024
+
+// maxValueLen caps how much of a single value is written, so large tool
+// arguments or results don't flood the log.
+const maxValueLen = 500
+
+// redacted replaces secrets in log output.
+const redacted = "[REDACTED]"
+
+// secretPatterns match credentials that may appear in logged content even
+// when they are not among the configured keys. The first group is kept so the
+// kind of credential remains visible.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(sk-)[A-Za-z0-9_\-]{8,}`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9_\-\.=]{8,}`),
+	regexp.MustCompile(`(?i)((?:x-api-key|api[_-]?key)["']?\s*[:=]\s*["']?)[A-Za-z0-9_\-\.]{8,}`),
+	regexp.MustCompile(`(?i)((?:password|passwd|secret|token|access[_-]?key)["']?\s*[:=]\s*["']?)[^\s"'&,;]{4,}`),
+	regexp.MustCompile(`(gh[pousr]_|github_pat_)[A-Za-z0-9_]{20,}`),
+	regexp.MustCompile(`(AKIA)[A-Z0-9]{16}`),
+	regexp.MustCompile(`(xox[abprs]-)[A-Za-z0-9\-]{10,}`),
+}
+
+// Logger appends entries to a debug log file, rotating it to <path>.1 when it
+// exceeds its size limit. A nil *Logger discards everything, so callers can
+// log unconditionally.
+type Logger struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	size    int64
+	maxSize int64
+	secrets []string
+	now     func() time.Time
+}
+
+// Open opens (or creates) the log file at path. Every occurrence of the given
+// secrets is redacted; comma-separated key lists are split into single keys.
+func Open(path string, secrets ...string) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	l := &Logger{path: path, maxSize: DefaultMaxSize, secrets: splitSecrets(secrets), now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Path returns the log file path.
+func (l *Logger) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Log writes one entry: a timestamp, the event name, and key/value pairs.
+// Values longer than 500 characters are truncated. Write errors are ignored;
+// debug logging must never interrupt the session.
+func (l *Logger) Log(event string, kv ...any) {
+	if l == nil {
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(l.now().UTC().Format("2006-01-02T15:04:05.000Z"))
+	sb.WriteByte(' ')
+	sb.WriteString(event)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fmt.Fprintf(&sb, " %v=", kv[i])
+		switch v := kv[i+1].(type) {
+		case string:
+			fmt.Fprintf(&sb, "%q", truncate(v))
+		case error:
+			fmt.Fprintf(&sb, "%q", truncate(v.Error()))
+		default:
+			fmt.Fprintf(&sb, "%v", v)
+		}
+	}
+	line := l.redact(sb.String()) + "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	if l.size+int64(len(line)) > l.maxSize {
+		l.rotate()
+	}
+	if n, err := l.f.WriteString(line); err == nil {
+		l.size += int64(n)
+	}
+}
+
+// Close closes the log file.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Redact replaces the given secrets, and anything that looks like an API key
+// or bearer token, with a placeholder.
+func Redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// Redactor returns a function that applies Redact with the given secrets,
+// for masking output other than the log. Comma-separated key lists are
+// split as in Open.
+func Redactor(secrets ...string) func(string) string {
+	keys := splitSecrets(secrets)
+	return func(s string) string { return Redact(s, keys) }
+}
+
+// splitSecrets splits comma-separated key lists into single, non-empty keys.
+func splitSecrets(secrets []string) []string {
+	var keys []string
+	for _, s := range secrets {
+		for _, k := range strings.Split(s, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+func (l *Logger) redact(s string) string {
+	return Redact(s, l.secrets)
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open debug log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat debug log: %w", err)
+	}
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate moves the current log to <path>.1, replacing any previous rotation,
+// and starts a new file. Must be called with l.mu held.
+func (l *Logger) rotate() {
+	l.f.Close()
+	l.f = nil
+	os.Rename(l.path, l.path+".1")
+	if err := l.open(); err != nil {
+		l.f = nil
+	}
+}
+
+func truncate(s string) string {
+	if len(s) <= maxValueLen {
+		return s
+	}
+	return s[:maxValueLen] + "...(truncated)"
+}
@@ -13,35 +13,85 @@ import (
 
 // AnthropicClient implements LLMClient for the Anthropic Messages API.
 type AnthropicClient struct {
-	apiKey    string
+	keys      *keyPool
 	model     string
 	maxTokens int
 	baseURL   string
 	http      *http.Client
+	retry     retryConfig
+	maxBody   int      // request body cap in bytes; 0 disables
+	temp      *float64 // sampling temperature; nil leaves the provider default
+	raw       rawCapture
+	headers   map[string]string // extra request headers; see SetHeaders
+	refresh   func() (string, error) // fetches a new API key after an auth error; see SetKeyRefresh
 }
 
-// NewAnthropicClient creates a new Anthropic API client.
+// NewAnthropicClient creates a new Anthropic API client. apiKey may hold
+// several comma-separated keys, which are rotated on rate limiting.
 func NewAnthropicClient(apiKey, model string, maxTokens int, baseURL string) *AnthropicClient {
 	return &AnthropicClient{
-		apiKey:    apiKey,
+		keys:      newKeyPool(apiKey),
 		model:     model,
 		maxTokens: maxTokens,
 		baseURL:   baseURL,
 		http: &http.Client{
 			Timeout: 120 * time.Second,
 		},
+		retry:   defaultRetryConfig(),
+		maxBody: DefaultMaxRequestBytes,
 	}
 }
 
+// SetMaxRequestBytes sets the request body cap. Requests over it fail with
+// ErrRequestTooLarge before being sent. Zero or a negative value disables it.
+func (c *AnthropicClient) SetMaxRequestBytes(n int) {
+	c.maxBody = max(n, 0)
+}
+
+// SetHeaders sets extra HTTP headers sent with every request, such as the
+// routing keys a gateway needs. They never replace a header the client sets
+// itself, like the API key.
+func (c *AnthropicClient) SetHeaders(headers map[string]string) {
+	c.headers = headers
+}
+
+// SetKeyRefresh sets a function that fetches a new API key, such as by
+// rerunning a credential command. A request rejected as unauthorized is
+// sent once more with the new key.
+func (c *AnthropicClient) SetKeyRefresh(refresh func() (string, error)) {
+	c.refresh = refresh
+}
+
+// SetRawCapture makes the client keep its latest request and response
+// bodies for LastExchange, with redact (if not nil) applied when they are
+// read back. It is off by default, since bodies can be large.
+func (c *AnthropicClient) SetRawCapture(enabled bool, redact func(string) string) {
+	c.raw.set(enabled, redact)
+}
+
+// LastExchange returns the latest request and response bodies, or false if
+// raw capture is off or nothing has been sent.
+func (c *AnthropicClient) LastExchange() (RawExchange, bool) {
+	return c.raw.last()
+}
+
+// SetTemperature sets the sampling temperature for later requests, or
+// restores the provider default when t is nil. Anthropic accepts at most 1,
+// so higher values are capped.
+func (c *AnthropicClient) SetTemperature(t *float64) {
+	c.temp = t
+}
+
 // Anthropic-specific request/response types
 
 type anthropicRequest struct {
-	Model     string              `json:"model"`
-	MaxTokens int                 `json:"max_tokens"`
-	System    string              `json:"system,omitempty"`
-	Messages  []anthropicMessage  `json:"messages"`
-	Tools     []anthropicToolDef  `json:"tools,omitempty"`
-	Stream    bool                `json:"stream,omitempty"`
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicToolDef `json:"tools,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
 }
 
 type anthropicMessage struct {
@@ -162,10 +212,11 @@ func convertToolDefs(tools []ToolDef) []anthropicToolDef {
 func (c *AnthropicClient) SendMessage(ctx context.Context, messages []Message, tools []ToolDef) (*Response, error) {
 	system, msgs := convertToAnthropicMessages(messages)
 	reqBody := anthropicRequest{
-		Model:     c.model,
-		MaxTokens: c.maxTokens,
-		System:    system,
-		Messages:  msgs,
+		Model:       c.model,
+		MaxTokens:   c.maxTokens,
+		System:      system,
+		Messages:    msgs,
+		Temperature: requestTemperature(CapabilitiesFor("anthropic", c.model), c.temp),
 	}
 	if len(tools) > 0 {
 		reqBody.Tools = convertToolDefs(tools)
@@ -177,16 +228,7 @@ func (c *AnthropicClient) SendMessage(ctx context.Context, messages []Message, t
 	}
 
 	var apiResp anthropicResponse
-	resp, err := doWithRetry(ctx, defaultRetryConfig(), func() (*http.Response, error) {
-		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewReader(bodyBytes))
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("x-api-key", c.apiKey)
-		req.Header.Set("anthropic-version", "2023-06-01")
-		return c.http.Do(req)
-	})
+	resp, err := c.post(ctx, bodyBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -228,29 +270,21 @@ func (c *AnthropicClient) convertResponse(resp anthropicResponse) *Response {
 		}
 	}
 
+	fillToolCallIDs(toolCalls)
+
 	var contentPtr *string
 	if content.Len() > 0 {
 		s := content.String()
 		contentPtr = &s
 	}
 
-	finishReason := "stop"
-	switch resp.StopReason {
-	case "tool_use":
-		finishReason = "tool_calls"
-	case "max_tokens":
-		finishReason = "length"
-	case "end_turn":
-		finishReason = "stop"
-	}
-
 	return &Response{
 		Message: Message{
 			Role:      "assistant",
 			Content:   contentPtr,
 			ToolCalls: toolCalls,
 		},
-		FinishReason: finishReason,
+		FinishReason: anthropicFinishReason(resp.StopReason),
 		Usage: Usage{
 			PromptTokens:     resp.Usage.InputTokens,
 			CompletionTokens: resp.Usage.OutputTokens,
@@ -259,3 +293,56 @@ func (c *AnthropicClient) convertResponse(resp anthropicResponse) *Response {
 	}
 }
 
+// post sends a request body to the Messages endpoint with retry. After an
+// auth error it fetches a new key, if SetKeyRefresh was used, and sends the
+// request once more.
+func (c *AnthropicClient) post(ctx context.Context, body []byte) (*http.Response, error) {
+	if err := checkRequestSize(body, c.maxBody); err != nil {
+		return nil, err
+	}
+	c.raw.begin(body)
+	return c.raw.end(withKeyRefresh(c.keys, c.refresh, func() (*http.Response, error) {
+		return c.send(ctx, body)
+	}))
+}
+
+// send makes one request with retry, selecting an API key from the pool for
+// each attempt.
+func (c *AnthropicClient) send(ctx context.Context, body []byte) (*http.Response, error) {
+	return doWithRetry(ctx, c.retry, retryNotifierFrom(ctx), func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		key := c.keys.pick()
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", key)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		setExtraHeaders(req, c.headers)
+		resp, err := c.http.Do(req)
+		if err == nil {
+			c.keys.observe(key, resp.StatusCode)
+		}
+		return resp, err
+	})
+}
+
+// anthropicFinishReason maps an Anthropic stop_reason to a FinishReason.
+// "pause_turn" (a long server tool turn was paused) is passed through so the
+// caller can send the conversation back for the model to continue.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "pause_turn":
+		return "pause_turn"
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
@@ -2,12 +2,10 @@ package llm
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 )
 
@@ -15,11 +13,12 @@ import (
 func (c *AnthropicClient) StreamMessage(ctx context.Context, messages []Message, tools []ToolDef) (<-chan StreamEvent, error) {
 	system, msgs := convertToAnthropicMessages(messages)
 	reqBody := anthropicRequest{
-		Model:     c.model,
-		MaxTokens: c.maxTokens,
-		System:    system,
-		Messages:  msgs,
-		Stream:    true,
+		Model:       c.model,
+		MaxTokens:   c.maxTokens,
+		System:      system,
+		Messages:    msgs,
+		Temperature: requestTemperature(CapabilitiesFor("anthropic", c.model), c.temp),
+		Stream:      true,
 	}
 	if len(tools) > 0 {
 		reqBody.Tools = convertToolDefs(tools)
@@ -30,16 +29,7 @@ func (c *AnthropicClient) StreamMessage(ctx context.Context, messages []Message,
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	resp, err := doWithRetry(ctx, defaultRetryConfig(), func() (*http.Response, error) {
-		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewReader(bodyBytes))
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("x-api-key", c.apiKey)
-		req.Header.Set("anthropic-version", "2023-06-01")
-		return c.http.Do(req)
-	})
+	resp, err := c.post(ctx, bodyBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -190,13 +180,8 @@ func (c *AnthropicClient) parseAnthropicStream(ctx context.Context, body io.Read
 				continue
 			}
 			event := StreamEvent{}
-			switch ev.Delta.StopReason {
-			case "tool_use":
-				event.FinishReason = "tool_calls"
-			case "max_tokens":
-				event.FinishReason = "length"
-			case "end_turn":
-				event.FinishReason = "stop"
+			if ev.Delta.StopReason != "" {
+				event.FinishReason = anthropicFinishReason(ev.Delta.StopReason)
 			}
 			if ev.Usage != nil {
 				event.Usage = &Usage{
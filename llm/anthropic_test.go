@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"end_turn":      "stop",
+		"tool_use":      "tool_calls",
+		"max_tokens":    "length",
+		"refusal":       "content_filter",
+		"stop_sequence": "stop",
+		"pause_turn":    "pause_turn",
+	}
+	for stop, want := range tests {
+		if got := anthropicFinishReason(stop); got != want {
+			t.Errorf("anthropicFinishReason(%q) = %q, want %q", stop, got, want)
+		}
+	}
+}
+
+func TestParseAnthropicStreamStopSequence(t *testing.T) {
+	body := strings.Join([]string{
+		`data: {"type":"message_start","message":{"id":"msg_1"}}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Done"}}`,
+		`data: {"type":"content_block_stop","index":0}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"stop_sequence","stop_sequence":"END"},"usage":{"output_tokens":3}}`,
+		`data: {"type":"message_stop"}`,
+	}, "\n\n")
+
+	c := &AnthropicClient{}
+	ch := make(chan StreamEvent, 16)
+	go c.parseAnthropicStream(context.Background(), io.NopCloser(strings.NewReader(body)), ch)
+
+	resp, err := AccumulateStream(ch, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.FinishReason != "stop" {
+		t.Errorf("expected finish_reason=stop, got %q", resp.FinishReason)
+	}
+	if resp.Message.ContentString() != "Done" {
+		t.Errorf("expected content %q, got %q", "Done", resp.Message.ContentString())
+	}
+}
@@ -0,0 +1,41 @@
+package llm
+
+import "strings"
+
+// Capabilities lists the optional request features a provider and model
+// accept. Today that is only the sampling temperature: the clients pass it
+// through requestTemperature, which drops or caps the setting so the request
+// does not fail with HTTP 400, and /help grays out /temp without it.
+type Capabilities struct {
+	Temperature    bool    // accepts a sampling temperature
+	MaxTemperature float64 // highest temperature accepted
+}
+
+// capabilityTable maps a provider and model prefix to its capabilities.
+// Lookups take the first matching entry, so specific prefixes come before
+// the provider's catch-all "" entry.
+var capabilityTable = []struct {
+	provider, prefix string
+	caps             Capabilities
+}{
+	// OpenAI reasoning models reject temperature
+	{"openai", "o1", Capabilities{}},
+	{"openai", "o3", Capabilities{}},
+	{"openai", "o4", Capabilities{}},
+	{"openai", "gpt-5", Capabilities{}},
+	{"openai", "", Capabilities{Temperature: true, MaxTemperature: MaxTemperature}},
+
+	// Anthropic caps temperature at 1
+	{"anthropic", "", Capabilities{Temperature: true, MaxTemperature: 1}},
+}
+
+// CapabilitiesFor returns what model accepts on provider. An unknown
+// provider gets no optional features.
+func CapabilitiesFor(provider, model string) Capabilities {
+	for _, e := range capabilityTable {
+		if e.provider == provider && strings.HasPrefix(model, e.prefix) {
+			return e.caps
+		}
+	}
+	return Capabilities{}
+}
@@ -0,0 +1,51 @@
+package llm
+
+import "testing"
+
+func TestCapabilitiesFor(t *testing.T) {
+	tests := []struct {
+		provider, model string
+		temperature     bool
+		maxTemperature  float64
+	}{
+		{"openai", "gpt-4o-mini", true, 2},
+		{"openai", "gpt-3.5-turbo", true, 2},
+		{"openai", "gpt-5.2-codex", false, 0},
+		{"openai", "o4-mini", false, 0},
+		{"openai", "o1-mini", false, 0},
+		{"anthropic", "claude-sonnet-4-6", true, 1},
+		{"anthropic", "claude-3-5-haiku-latest", true, 1},
+		{"acme", "gpt-4o", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.model, func(t *testing.T) {
+			caps := CapabilitiesFor(tt.provider, tt.model)
+			if caps.Temperature != tt.temperature || caps.MaxTemperature != tt.maxTemperature {
+				t.Errorf("temperature = %v (max %g), want %v (max %g)", caps.Temperature, caps.MaxTemperature, tt.temperature, tt.maxTemperature)
+			}
+		})
+	}
+}
+
+func TestRequestTemperatureFiltered(t *testing.T) {
+	tests := []struct {
+		name string
+		caps Capabilities
+		temp *float64
+		want *float64
+	}{
+		{"unset", CapabilitiesFor("openai", "gpt-4o"), nil, nil},
+		{"supported", CapabilitiesFor("openai", "gpt-4o"), ptr(1.5), ptr(1.5)},
+		{"capped", CapabilitiesFor("anthropic", "claude-sonnet-4-6"), ptr(1.5), ptr(1)},
+		{"dropped for reasoning model", CapabilitiesFor("openai", "o3"), ptr(0.2), nil},
+		{"dropped for unknown provider", CapabilitiesFor("acme", "x"), ptr(0.2), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requestTemperature(tt.caps, tt.temp)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("requestTemperature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// A cassette is a JSON Lines file of LLM interactions, one per request, in
+// the order they were made. A Recorder writes one while a real client runs;
+// a CassetteClient replays it without contacting a provider, for
+// reproducible demos and tests. Requests are recorded for inspection but
+// not matched on replay: the Nth request gets the Nth recorded response.
+
+// cassetteEntry is one recorded request and its outcome.
+type cassetteEntry struct {
+	Stream   bool            `json:"stream"`
+	Messages []Message       `json:"messages"`
+	Response *Response       `json:"response,omitempty"` // SendMessage
+	Events   []cassetteEvent `json:"events,omitempty"`   // StreamMessage
+	Error    string          `json:"error,omitempty"`    // the request itself failed
+}
+
+// cassetteEvent is a StreamEvent in serializable form.
+type cassetteEvent struct {
+	Text           string          `json:"text,omitempty"`
+	ToolCallDeltas []ToolCallDelta `json:"tool_call_deltas,omitempty"`
+	Usage          *Usage          `json:"usage,omitempty"`
+	FinishReason   string          `json:"finish_reason,omitempty"`
+	Done           bool            `json:"done,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+func toCassetteEvent(ev StreamEvent) cassetteEvent {
+	ce := cassetteEvent{
+		Text:           ev.TextDelta,
+		ToolCallDeltas: ev.ToolCallDeltas,
+		Usage:          ev.Usage,
+		FinishReason:   ev.FinishReason,
+		Done:           ev.Done,
+	}
+	if ev.Err != nil {
+		ce.Error = ev.Err.Error()
+	}
+	return ce
+}
+
+func (ce cassetteEvent) streamEvent() StreamEvent {
+	ev := StreamEvent{
+		TextDelta:      ce.Text,
+		ToolCallDeltas: ce.ToolCallDeltas,
+		Usage:          ce.Usage,
+		FinishReason:   ce.FinishReason,
+		Done:           ce.Done,
+	}
+	if ce.Error != "" {
+		ev.Err = errors.New(ce.Error)
+	}
+	return ev
+}
+
+// Recorder appends every interaction of the clients it wraps to a cassette
+// file. Recording is best effort: a failed write never fails the request.
+type Recorder struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewRecorder creates (or truncates) the cassette file at path.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create cassette: %w", err)
+	}
+	f.Close()
+	return &Recorder{path: path}, nil
+}
+
+// Wrap returns a client that forwards to client and records each
+// interaction. Clients wrapped by one Recorder share its cassette, so a
+// model switch mid-session keeps recording to the same file.
+func (r *Recorder) Wrap(client LLMClient) LLMClient {
+	return &recordingClient{client: client, rec: r}
+}
+
+func (r *Recorder) write(entry cassetteEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+type recordingClient struct {
+	client LLMClient
+	rec    *Recorder
+}
+
+func (c *recordingClient) SendMessage(ctx context.Context, messages []Message, tools []ToolDef) (*Response, error) {
+	resp, err := c.client.SendMessage(ctx, messages, tools)
+	entry := cassetteEntry{Messages: messages, Response: resp}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	c.rec.write(entry)
+	return resp, err
+}
+
+// StreamMessage forwards the stream's events as they arrive and records
+// them once the stream finishes.
+func (c *recordingClient) StreamMessage(ctx context.Context, messages []Message, tools []ToolDef) (<-chan StreamEvent, error) {
+	events, err := c.client.StreamMessage(ctx, messages, tools)
+	if err != nil {
+		c.rec.write(cassetteEntry{Stream: true, Messages: messages, Error: err.Error()})
+		return nil, err
+	}
+
+	// The caller may rewrite its history before the stream is recorded
+	entry := cassetteEntry{Stream: true, Messages: slices.Clone(messages)}
+	out := make(chan StreamEvent)
+	go func() {
+		defer close(out)
+		recorded := false
+		record := func() {
+			if !recorded {
+				c.rec.write(entry)
+				recorded = true
+			}
+		}
+		// Record before the final event reaches the caller, whose next
+		// request must land after this one in the cassette
+		defer record()
+		for ev := range events {
+			entry.Events = append(entry.Events, toCassetteEvent(ev))
+			final := ev.Done || ev.Err != nil
+			if final {
+				record()
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				final = true // the reader is gone
+			}
+			if final {
+				// Let the provider's stream finish
+				for range events {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// LastExchange reports the wrapped client's latest raw exchange, if it
+// keeps one.
+func (c *recordingClient) LastExchange() (RawExchange, bool) {
+	if r, ok := c.client.(RawExchanger); ok {
+		return r.LastExchange()
+	}
+	return RawExchange{}, false
+}
+
+// CassetteClient implements LLMClient by replaying a recorded cassette in
+// order. It fails once the cassette runs out.
+type CassetteClient struct {
+	mu      sync.Mutex
+	entries []cassetteEntry
+	next    int
+}
+
+// LoadCassette reads the cassette file at path for replay.
+func LoadCassette(path string) (*CassetteClient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open cassette: %w", err)
+	}
+	defer f.Close()
+
+	var entries []cassetteEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20) // entries hold whole conversations
+	for line := 1; scanner.Scan(); line++ {
+		var entry cassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parse cassette line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	return &CassetteClient{entries: entries}, nil
+}
+
+// take returns the next recorded entry, checking it was recorded by the
+// same kind of call.
+func (c *CassetteClient) take(stream bool) (cassetteEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next >= len(c.entries) {
+		return cassetteEntry{}, fmt.Errorf("cassette exhausted after %d interactions", len(c.entries))
+	}
+	entry := c.entries[c.next]
+	c.next++
+	if entry.Stream != stream {
+		recorded, replayed := "StreamMessage", "SendMessage"
+		if stream {
+			recorded, replayed = replayed, recorded
+		}
+		return cassetteEntry{}, fmt.Errorf("cassette interaction %d was recorded from %s, replayed with %s", c.next, recorded, replayed)
+	}
+	return entry, nil
+}
+
+// SendMessage returns the next recorded response.
+func (c *CassetteClient) SendMessage(ctx context.Context, messages []Message, tools []ToolDef) (*Response, error) {
+	entry, err := c.take(false)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+	return entry.Response, nil
+}
+
+// StreamMessage replays the next recorded stream.
+func (c *CassetteClient) StreamMessage(ctx context.Context, messages []Message, tools []ToolDef) (<-chan StreamEvent, error) {
+	entry, err := c.take(true)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+	ch := make(chan StreamEvent, len(entry.Events))
+	for _, ce := range entry.Events {
+		ch <- ce.streamEvent()
+	}
+	close(ch)
+	return ch, nil
+}
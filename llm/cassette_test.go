@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeClient streams a fixed reply with a tool call, answers SendMessage
+// with a summary, and fails every request while fail is set.
+type fakeClient struct {
+	fail bool
+}
+
+func (c *fakeClient) SendMessage(ctx context.Context, messages []Message, tools []ToolDef) (*Response, error) {
+	if c.fail {
+		return nil, errors.New("API error 529: overloaded")
+	}
+	return &Response{Message: TextMessage("assistant", "summary"), FinishReason: "stop", Usage: Usage{TotalTokens: 42}}, nil
+}
+
+func (c *fakeClient) StreamMessage(ctx context.Context, messages []Message, tools []ToolDef) (<-chan StreamEvent, error) {
+	if c.fail {
+		return nil, errors.New("API error 529: overloaded")
+	}
+	var d ToolCallDelta
+	d.ID, d.Function.Name, d.Function.Arguments = "call_1", "read", `{"path":"main.go"}`
+	ch := make(chan StreamEvent, 4)
+	ch <- StreamEvent{TextDelta: "Let me look."}
+	ch <- StreamEvent{ToolCallDeltas: []ToolCallDelta{d}}
+	ch <- StreamEvent{Usage: &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}}
+	ch <- StreamEvent{FinishReason: "tool_calls", Done: true}
+	close(ch)
+	return ch, nil
+}
+
+// turn makes the requests of one recorded turn and returns what the caller
+// saw, with errors as strings.
+func turn(t *testing.T, client LLMClient) []any {
+	t.Helper()
+	ctx := context.Background()
+	messages := []Message{TextMessage("system", "Be brief."), TextMessage("user", "what's in main.go?")}
+	var seen []any
+
+	events, err := client.StreamMessage(ctx, messages, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	var text []string
+	resp, err := AccumulateStream(events, func(s string) { text = append(text, s) })
+	seen = append(seen, text, resp, err)
+
+	resp, err = client.SendMessage(ctx, messages, nil)
+	seen = append(seen, resp, err)
+
+	if f, ok := client.(*recordingClient); ok {
+		f.client.(*fakeClient).fail = true
+	}
+	_, err = client.StreamMessage(ctx, messages, nil)
+	seen = append(seen, err.Error())
+	return seen
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "turn.jsonl")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := turn(t, rec.Wrap(&fakeClient{}))
+
+	replay, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := turn(t, replay)
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replay differs from recording:\n got %+v\nwant %+v", replayed, recorded)
+	}
+
+	resp := recorded[1].(*Response)
+	if len(resp.Message.ToolCalls) != 1 || resp.Message.ToolCalls[0].Function.Name != "read" || resp.Usage.TotalTokens != 15 {
+		t.Errorf("unexpected recorded response: %+v", resp)
+	}
+
+	_, err = replay.SendMessage(context.Background(), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "exhausted after 3 interactions") {
+		t.Errorf("expected exhausted cassette error, got %v", err)
+	}
+}
+
+func TestCassetteReplayWrongCall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "turn.jsonl")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Wrap(&fakeClient{}).SendMessage(context.Background(), nil, nil)
+
+	replay, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = replay.StreamMessage(context.Background(), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "recorded from SendMessage, replayed with StreamMessage") {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+// ErrorKind is the broad cause of a failed request, for telling the user
+// what to do about it.
+type ErrorKind string
+
+const (
+	// ErrorUnknown is anything not recognized below.
+	ErrorUnknown ErrorKind = ""
+	// ErrorAuth is a rejected API key (HTTP 401 or 403).
+	ErrorAuth ErrorKind = "auth"
+	// ErrorRateLimit is HTTP 429 that outlasted every retry.
+	ErrorRateLimit ErrorKind = "rate limit"
+	// ErrorNetwork is a request that got no response, or a stream cut off.
+	ErrorNetwork ErrorKind = "network"
+	// ErrorServer is a provider-side failure (HTTP 5xx) that outlasted every retry.
+	ErrorServer ErrorKind = "server"
+	// ErrorRequest is a request the provider rejected as invalid, such as
+	// HTTP 400 or an oversized body. Retrying it unchanged will not help.
+	ErrorRequest ErrorKind = "request"
+	// ErrorCancelled is a request stopped by the user or a deadline.
+	ErrorCancelled ErrorKind = "cancelled"
+)
+
+// ClassifyError returns the kind of a request error returned by an
+// LLMClient, looking through any wrapping.
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ErrorUnknown
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCancelled
+	}
+
+	var auth *authError
+	if errors.As(err, &auth) {
+		return ErrorAuth
+	}
+	var retryable *retryableError
+	if errors.As(err, &retryable) {
+		switch {
+		case retryable.StatusCode == 429:
+			return ErrorRateLimit
+		case retryable.StatusCode >= 500:
+			return ErrorServer
+		default:
+			return ErrorNetwork
+		}
+	}
+	var status *statusError
+	if errors.As(err, &status) || errors.Is(err, ErrRequestTooLarge) {
+		return ErrorRequest
+	}
+
+	var netErr net.Error
+	var network *networkError
+	if errors.As(err, &network) || errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorNetwork
+	}
+	return ErrorUnknown
+}
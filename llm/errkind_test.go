@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"nil", nil, ErrorUnknown},
+		{"auth", &authError{StatusCode: 401, Body: "invalid x-api-key"}, ErrorAuth},
+		{"wrapped auth", fmt.Errorf("send: %w", &authError{StatusCode: 403}), ErrorAuth},
+		{"rate limit exhausted", &retryableError{StatusCode: 429, Retries: 5}, ErrorRateLimit},
+		{"overloaded", &retryableError{StatusCode: 529, Retries: 5}, ErrorServer},
+		{"timeout status", &retryableError{StatusCode: 408, Retries: 5}, ErrorNetwork},
+		{"bad request", &statusError{StatusCode: 400, Body: "bad input"}, ErrorRequest},
+		{"too large", &RequestTooLargeError{Size: 30 << 20, Limit: 20 << 20}, ErrorRequest},
+		{"no response", &networkError{Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, ErrorNetwork},
+		{"stream cut off", fmt.Errorf("read SSE stream: %w", io.ErrUnexpectedEOF), ErrorNetwork},
+		{"cancelled", context.Canceled, ErrorCancelled},
+		{"cancelled request", &networkError{Err: fmt.Errorf("get: %w", context.Canceled)}, ErrorCancelled},
+		{"other", errors.New("parse response: unexpected token"), ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorFromRetry(t *testing.T) {
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	cfg := retryConfig{maxRetries: 1, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+	send := func() error {
+		_, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
+			return http.Get(server.URL)
+		})
+		return err
+	}
+
+	if got := ClassifyError(send()); got != ErrorAuth {
+		t.Errorf("401: got %q, want %q", got, ErrorAuth)
+	}
+	status = http.StatusServiceUnavailable
+	if got := ClassifyError(send()); got != ErrorServer {
+		t.Errorf("503: got %q, want %q", got, ErrorServer)
+	}
+	server.Close()
+	if got := ClassifyError(send()); got != ErrorNetwork {
+		t.Errorf("closed server: got %q, want %q", got, ErrorNetwork)
+	}
+}
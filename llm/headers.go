@@ -0,0 +1,15 @@
+package llm
+
+import "net/http"
+
+// setExtraHeaders adds headers to req, skipping any the client has already
+// set, so configured headers cannot replace authentication or the API
+// version.
+func setExtraHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		if req.Header.Get(name) != "" {
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+}
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// headerServer records the headers of the last request and answers with
+// reply.
+func headerServer(t *testing.T, reply string) (*httptest.Server, *http.Header) {
+	t.Helper()
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return server, &got
+}
+
+func TestAnthropicClientSendsExtraHeaders(t *testing.T) {
+	server, got := headerServer(t, `{"content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn"}`)
+	c := NewAnthropicClient("real-key", "test-model", 100, server.URL)
+	c.SetHeaders(map[string]string{"X-Route": "team-a", "x-api-key": "spoofed", "Anthropic-Version": "1999-01-01"})
+
+	if _, err := c.SendMessage(context.Background(), []Message{TextMessage("user", "hi")}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Get("X-Route") != "team-a" {
+		t.Errorf("expected X-Route header, got %q", got.Get("X-Route"))
+	}
+	if got.Get("x-api-key") != "real-key" || got.Get("anthropic-version") != "2023-06-01" {
+		t.Errorf("expected client headers kept, got key %q version %q", got.Get("x-api-key"), got.Get("anthropic-version"))
+	}
+}
+
+func TestOpenAIResponsesClientSendsExtraHeaders(t *testing.T) {
+	server, got := headerServer(t, `{"status":"completed","output":[]}`)
+	c := NewOpenAIResponsesClient("real-key", "test-model", 100, server.URL)
+	c.SetHeaders(map[string]string{"OpenAI-Organization": "org-123", "Authorization": "Bearer spoofed"})
+
+	if _, err := c.SendMessage(context.Background(), []Message{TextMessage("user", "hi")}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Get("OpenAI-Organization") != "org-123" {
+		t.Errorf("expected OpenAI-Organization header, got %q", got.Get("OpenAI-Organization"))
+	}
+	if got.Get("Authorization") != "Bearer real-key" {
+		t.Errorf("expected the API key kept, got %q", got.Get("Authorization"))
+	}
+}
@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keyCooldownBase is how long a key sits out after its first 429.
+	keyCooldownBase = 30 * time.Second
+	// keyCooldownMax caps the cooldown for a key that keeps getting rate limited.
+	keyCooldownMax = 5 * time.Minute
+)
+
+// keyPool distributes requests across one or more API keys. Keys are selected
+// round-robin; a key that returns 429 is put on a cooldown that doubles with
+// each consecutive 429, so a persistently rate-limited key is skipped until
+// the others are exhausted too.
+type keyPool struct {
+	mu      sync.Mutex
+	keys    []string
+	next    int
+	strikes []int
+	until   []time.Time
+	now     func() time.Time
+}
+
+// newKeyPool builds a pool from a comma-separated list of keys.
+// Blank entries are ignored; a single key behaves exactly as before.
+func newKeyPool(apiKeys string) *keyPool {
+	var keys []string
+	for _, k := range strings.Split(apiKeys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+	return &keyPool{
+		keys:    keys,
+		strikes: make([]int, len(keys)),
+		until:   make([]time.Time, len(keys)),
+		now:     time.Now,
+	}
+}
+
+// pick returns the next key to use. Keys on cooldown are skipped; if every
+// key is cooling down, the one whose cooldown expires soonest is returned.
+func (p *keyPool) pick() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	best := -1
+	for i := range p.keys {
+		idx := (p.next + i) % len(p.keys)
+		if !now.Before(p.until[idx]) {
+			best = idx
+			break
+		}
+		if best == -1 || p.until[idx].Before(p.until[best]) {
+			best = idx
+		}
+	}
+	p.next = (best + 1) % len(p.keys)
+	return p.keys[best]
+}
+
+// markRateLimited puts key on cooldown after a 429 response.
+func (p *keyPool) markRateLimited(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.index(key)
+	if i < 0 {
+		return
+	}
+	cooldown := keyCooldownBase << p.strikes[i]
+	if cooldown > keyCooldownMax || cooldown <= 0 {
+		cooldown = keyCooldownMax
+	}
+	p.strikes[i]++
+	p.until[i] = p.now().Add(cooldown)
+}
+
+// markOK clears any cooldown state for key after a successful response.
+func (p *keyPool) markOK(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if i := p.index(key); i >= 0 {
+		p.strikes[i] = 0
+		p.until[i] = time.Time{}
+	}
+}
+
+func (p *keyPool) index(key string) int {
+	for i, k := range p.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// observe records the outcome of a request made with key.
+func (p *keyPool) observe(key string, statusCode int) {
+	switch {
+	case statusCode == 429:
+		p.markRateLimited(key)
+	case statusCode >= 200 && statusCode < 300:
+		p.markOK(key)
+	}
+}
+
+// reset replaces the pool's keys, clearing every cooldown.
+func (p *keyPool) reset(apiKeys string) {
+	fresh := newKeyPool(apiKeys)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.next, p.strikes, p.until = fresh.keys, 0, fresh.strikes, fresh.until
+}
+
+// withKeyRefresh runs send, and if it fails with an auth error and refresh
+// is set, replaces the pool's keys with the one refresh fetches and runs
+// send once more. If refresh fails, the auth error is returned with it.
+func withKeyRefresh(keys *keyPool, refresh func() (string, error), send func() (*http.Response, error)) (*http.Response, error) {
+	resp, err := send()
+	var auth *authError
+	if refresh == nil || !errors.As(err, &auth) {
+		return resp, err
+	}
+	key, refreshErr := refresh()
+	if refreshErr != nil {
+		return nil, fmt.Errorf("%w (refreshing the key: %v)", err, refreshErr)
+	}
+	keys.reset(key)
+	return send()
+}
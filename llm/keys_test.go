@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewKeyPool_SplitsCommaSeparated(t *testing.T) {
+	p := newKeyPool(" key-a, ,key-b ,")
+	if len(p.keys) != 2 || p.keys[0] != "key-a" || p.keys[1] != "key-b" {
+		t.Fatalf("unexpected keys: %q", p.keys)
+	}
+}
+
+func TestKeyPool_RoundRobin(t *testing.T) {
+	p := newKeyPool("a,b,c")
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, p.pick())
+	}
+	if strings.Join(got, "") != "abca" {
+		t.Errorf("expected round-robin abca, got %v", got)
+	}
+}
+
+func TestKeyPool_RateLimitedKeyDeprioritized(t *testing.T) {
+	now := time.Now()
+	p := newKeyPool("a,b")
+	p.now = func() time.Time { return now }
+
+	p.markRateLimited("a")
+	for i := 0; i < 3; i++ {
+		if k := p.pick(); k != "b" {
+			t.Fatalf("pick %d: expected b while a cools down, got %s", i, k)
+		}
+	}
+
+	// Repeated 429s lengthen the cooldown.
+	first := p.until[0]
+	p.markRateLimited("a")
+	if !p.until[0].After(first) {
+		t.Errorf("expected longer cooldown after second 429")
+	}
+
+	// Once the cooldown expires, a is back in rotation.
+	now = now.Add(keyCooldownMax + time.Second)
+	seen := map[string]bool{p.pick(): true, p.pick(): true}
+	if !seen["a"] {
+		t.Errorf("expected a to return after cooldown, saw %v", seen)
+	}
+}
+
+func TestKeyPool_AllCoolingPicksSoonestExpiry(t *testing.T) {
+	now := time.Now()
+	p := newKeyPool("a,b")
+	p.now = func() time.Time { return now }
+
+	p.markRateLimited("a")
+	p.markRateLimited("a")
+	p.markRateLimited("b")
+
+	if k := p.pick(); k != "b" {
+		t.Errorf("expected b (shorter cooldown), got %s", k)
+	}
+}
+
+func TestAnthropicClient_429FailsOverToNextKey(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("x-api-key")
+		mu.Lock()
+		seen = append(seen, key)
+		mu.Unlock()
+		if key == "key-a" {
+			w.WriteHeader(429)
+			w.Write([]byte(`rate limited`))
+			return
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	c := NewAnthropicClient("key-a,key-b", "test-model", 100, server.URL)
+	c.retry = retryConfig{maxRetries: 2, baseDelay: time.Millisecond, maxDelay: 10 * time.Millisecond}
+
+	msgs := []Message{TextMessage("user", "hi")}
+	for i := 0; i < 2; i++ {
+		if _, err := c.SendMessage(context.Background(), msgs, nil); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+
+	want := []string{"key-a", "key-b", "key-b"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("expected keys %v, got %v", want, seen)
+	}
+}
+
+func TestOpenAIResponsesClient_429FailsOverToNextKey(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		seen = append(seen, key)
+		mu.Unlock()
+		if key == "key-a" {
+			w.WriteHeader(429)
+			return
+		}
+		w.Write([]byte(`{"status":"completed","output":[]}`))
+	}))
+	defer server.Close()
+
+	c := NewOpenAIResponsesClient("key-a,key-b", "test-model", 100, server.URL)
+	c.retry = retryConfig{maxRetries: 2, baseDelay: time.Millisecond, maxDelay: 10 * time.Millisecond}
+
+	if _, err := c.SendMessage(context.Background(), []Message{TextMessage("user", "hi")}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "key-a" || seen[1] != "key-b" {
+		t.Errorf("expected failover from key-a to key-b, got %v", seen)
+	}
+}
+
+func TestKeyRefreshOnAuthError(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("x-api-key")
+		mu.Lock()
+		seen = append(seen, key)
+		mu.Unlock()
+		if key != "fresh-key" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":{"message":"invalid x-api-key"}}`))
+			return
+		}
+		w.Write([]byte(`{"content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	c := NewAnthropicClient("expired-key", "test-model", 100, server.URL)
+	refreshes := 0
+	c.SetKeyRefresh(func() (string, error) {
+		refreshes++
+		return "fresh-key", nil
+	})
+
+	msgs := []Message{TextMessage("user", "hi")}
+	for i := 0; i < 2; i++ {
+		if _, err := c.SendMessage(context.Background(), msgs, nil); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+	if want := "expired-key,fresh-key,fresh-key"; strings.Join(seen, ",") != want || refreshes != 1 {
+		t.Errorf("expected keys %s with one refresh, got %v with %d", want, seen, refreshes)
+	}
+
+	// A failed refresh keeps the auth error
+	c = NewAnthropicClient("expired-key", "test-model", 100, server.URL)
+	c.SetKeyRefresh(func() (string, error) { return "", errors.New("vault sealed") })
+	_, err := c.SendMessage(context.Background(), msgs, nil)
+	var auth *authError
+	if !errors.As(err, &auth) || !strings.Contains(err.Error(), "vault sealed") {
+		t.Errorf("expected the auth error with the refresh failure, got %v", err)
+	}
+}
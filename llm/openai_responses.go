@@ -13,26 +13,76 @@ import (
 
 // OpenAIResponsesClient implements LLMClient for OpenAI's /v1/responses endpoint.
 type OpenAIResponsesClient struct {
-	apiKey    string
+	keys      *keyPool
 	model     string
 	maxTokens int
 	baseURL   string
 	http      *http.Client
+	retry     retryConfig
+	maxBody   int      // request body cap in bytes; 0 disables
+	temp      *float64 // sampling temperature; nil leaves the provider default
+	raw       rawCapture
+	chain     responsesChain
+	headers   map[string]string // extra request headers; see SetHeaders
+	refresh   func() (string, error) // fetches a new API key after an auth error; see SetKeyRefresh
 }
 
-// NewOpenAIResponsesClient creates a new OpenAI Responses API client.
+// NewOpenAIResponsesClient creates a new OpenAI Responses API client. apiKey
+// may hold several comma-separated keys, which are rotated on rate limiting.
 func NewOpenAIResponsesClient(apiKey, model string, maxTokens int, baseURL string) *OpenAIResponsesClient {
 	return &OpenAIResponsesClient{
-		apiKey:    apiKey,
+		keys:      newKeyPool(apiKey),
 		model:     model,
 		maxTokens: maxTokens,
 		baseURL:   baseURL,
 		http: &http.Client{
 			Timeout: 120 * time.Second,
 		},
+		retry:   defaultRetryConfig(),
+		maxBody: DefaultMaxRequestBytes,
 	}
 }
 
+// SetMaxRequestBytes sets the request body cap. Requests over it fail with
+// ErrRequestTooLarge before being sent. Zero or a negative value disables it.
+func (c *OpenAIResponsesClient) SetMaxRequestBytes(n int) {
+	c.maxBody = max(n, 0)
+}
+
+// SetHeaders sets extra HTTP headers sent with every request, such as the
+// routing keys a gateway needs. They never replace a header the client sets
+// itself, like the API key.
+func (c *OpenAIResponsesClient) SetHeaders(headers map[string]string) {
+	c.headers = headers
+}
+
+// SetKeyRefresh sets a function that fetches a new API key, such as by
+// rerunning a credential command. A request rejected as unauthorized is
+// sent once more with the new key.
+func (c *OpenAIResponsesClient) SetKeyRefresh(refresh func() (string, error)) {
+	c.refresh = refresh
+}
+
+// SetRawCapture makes the client keep its latest request and response
+// bodies for LastExchange, with redact (if not nil) applied when they are
+// read back. It is off by default, since bodies can be large.
+func (c *OpenAIResponsesClient) SetRawCapture(enabled bool, redact func(string) string) {
+	c.raw.set(enabled, redact)
+}
+
+// LastExchange returns the latest request and response bodies, or false if
+// raw capture is off or nothing has been sent.
+func (c *OpenAIResponsesClient) LastExchange() (RawExchange, bool) {
+	return c.raw.last()
+}
+
+// SetTemperature sets the sampling temperature for later requests, or
+// restores the provider default when t is nil. It is not sent to models
+// that reject it.
+func (c *OpenAIResponsesClient) SetTemperature(t *float64) {
+	c.temp = t
+}
+
 // Responses API request types
 
 type responsesRequest struct {
@@ -42,6 +92,11 @@ type responsesRequest struct {
 	Tools           []responsesTool     `json:"tools,omitempty"`
 	MaxOutputTokens int                 `json:"max_output_tokens,omitempty"`
 	Stream          bool                `json:"stream,omitempty"`
+	Temperature     *float64            `json:"temperature,omitempty"`
+
+	// PreviousResponseID chains off a stored response; Input then holds
+	// only the items added since it.
+	PreviousResponseID string `json:"previous_response_id,omitempty"`
 }
 
 type responsesMessageInput struct {
@@ -77,6 +132,10 @@ type responsesResponse struct {
 	Output []responsesOutput `json:"output"`
 	Usage  responsesUsage    `json:"usage"`
 	Error  *responsesError   `json:"error,omitempty"`
+
+	IncompleteDetails *struct {
+		Reason string `json:"reason"` // "max_output_tokens", "content_filter"
+	} `json:"incomplete_details,omitempty"`
 }
 
 type responsesOutput struct {
@@ -173,6 +232,10 @@ func convertResponsesToolDefs(tools []ToolDef) []responsesTool {
 	return result
 }
 
+// messageSeparator joins the text of separate message output items, which
+// a response may hold more than one of.
+const messageSeparator = "\n\n"
+
 // convertResponsesResponse converts the API response to internal Response format.
 func convertResponsesResponse(resp responsesResponse) *Response {
 	var content strings.Builder
@@ -181,11 +244,17 @@ func convertResponsesResponse(resp responsesResponse) *Response {
 	for _, item := range resp.Output {
 		switch item.Type {
 		case "message":
+			// Parts of one message run on; separate messages get a paragraph break
+			var text strings.Builder
 			for _, c := range item.Content {
 				if c.Type == "output_text" {
-					content.WriteString(c.Text)
+					text.WriteString(c.Text)
 				}
 			}
+			if text.Len() > 0 && content.Len() > 0 {
+				content.WriteString(messageSeparator)
+			}
+			content.WriteString(text.String())
 		case "function_call":
 			toolCalls = append(toolCalls, ToolCall{
 				ID:   item.CallID,
@@ -198,33 +267,21 @@ func convertResponsesResponse(resp responsesResponse) *Response {
 		}
 	}
 
+	fillToolCallIDs(toolCalls)
+
 	var contentPtr *string
 	if content.Len() > 0 {
 		s := content.String()
 		contentPtr = &s
 	}
 
-	finishReason := "stop"
-	if len(toolCalls) > 0 {
-		finishReason = "tool_calls"
-	} else {
-		switch resp.Status {
-		case "completed":
-			finishReason = "stop"
-		case "incomplete":
-			finishReason = "length"
-		case "failed":
-			finishReason = "stop"
-		}
-	}
-
 	return &Response{
 		Message: Message{
 			Role:      "assistant",
 			Content:   contentPtr,
 			ToolCalls: toolCalls,
 		},
-		FinishReason: finishReason,
+		FinishReason: responsesFinishReason(resp, len(toolCalls) > 0),
 		Usage: Usage{
 			PromptTokens:     resp.Usage.InputTokens,
 			CompletionTokens: resp.Usage.OutputTokens,
@@ -241,6 +298,7 @@ func (c *OpenAIResponsesClient) SendMessage(ctx context.Context, messages []Mess
 		Input:           input,
 		Instructions:    instructions,
 		MaxOutputTokens: c.maxTokens,
+		Temperature:     requestTemperature(CapabilitiesFor("openai", c.model), c.temp),
 	}
 	if len(tools) > 0 {
 		reqBody.Tools = convertResponsesToolDefs(tools)
@@ -252,15 +310,7 @@ func (c *OpenAIResponsesClient) SendMessage(ctx context.Context, messages []Mess
 	}
 
 	var apiResp responsesResponse
-	resp, err := doWithRetry(ctx, defaultRetryConfig(), func() (*http.Response, error) {
-		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/responses", bytes.NewReader(bodyBytes))
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-		return c.http.Do(req)
-	})
+	resp, err := c.post(ctx, bodyBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -281,3 +331,49 @@ func (c *OpenAIResponsesClient) SendMessage(ctx context.Context, messages []Mess
 	return convertResponsesResponse(apiResp), nil
 }
 
+// post sends a request body to the Responses endpoint with retry. After an
+// auth error it fetches a new key, if SetKeyRefresh was used, and sends the
+// request once more.
+func (c *OpenAIResponsesClient) post(ctx context.Context, body []byte) (*http.Response, error) {
+	if err := checkRequestSize(body, c.maxBody); err != nil {
+		return nil, err
+	}
+	c.raw.begin(body)
+	return c.raw.end(withKeyRefresh(c.keys, c.refresh, func() (*http.Response, error) {
+		return c.send(ctx, body)
+	}))
+}
+
+// send makes one request with retry, selecting an API key from the pool for
+// each attempt.
+func (c *OpenAIResponsesClient) send(ctx context.Context, body []byte) (*http.Response, error) {
+	return doWithRetry(ctx, c.retry, retryNotifierFrom(ctx), func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/responses", bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		key := c.keys.pick()
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		setExtraHeaders(req, c.headers)
+		resp, err := c.http.Do(req)
+		if err == nil {
+			c.keys.observe(key, resp.StatusCode)
+		}
+		return resp, err
+	})
+}
+
+// responsesFinishReason maps a Responses API status to a FinishReason.
+func responsesFinishReason(resp responsesResponse, hasToolCalls bool) string {
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	if resp.Status == "incomplete" {
+		if resp.IncompleteDetails != nil && resp.IncompleteDetails.Reason == "content_filter" {
+			return "content_filter"
+		}
+		return "length"
+	}
+	return "stop"
+}
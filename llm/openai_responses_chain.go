@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// responsesChain remembers the last streamed response so the next request
+// can send previous_response_id and only the input items added since,
+// instead of the whole conversation. The server already holds everything in
+// items: the input of that response followed by its output.
+type responsesChain struct {
+	mu       sync.Mutex
+	id       string            // ID of the last completed streamed response
+	items    []json.RawMessage // input items the server holds for id
+	disabled bool              // the server rejected a chained request
+}
+
+// next returns the previous response ID and the items of input not yet sent,
+// or "" and nil when input does not extend the chained conversation (after
+// compaction, a rewind, or a model switch) and must be sent in full.
+func (ch *responsesChain) next(input []json.RawMessage) (string, []json.RawMessage) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.disabled || ch.id == "" || len(input) <= len(ch.items) {
+		return "", nil
+	}
+	for i, item := range ch.items {
+		if !bytes.Equal(item, input[i]) {
+			return "", nil
+		}
+	}
+	return ch.id, input[len(ch.items):]
+}
+
+// record stores a completed response to chain the next request from. input
+// is the full input the response was generated from.
+func (ch *responsesChain) record(input []json.RawMessage, resp responsesResponse) {
+	if resp.ID == "" {
+		return
+	}
+	// The conversation the next request sends will contain this response's
+	// output as the agent stores it: converted to a Message and back.
+	_, output := convertToResponsesInput([]Message{convertResponsesResponse(resp).Message})
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.id = resp.ID
+	ch.items = append(input[:len(input):len(input)], output...)
+}
+
+// reject stops chaining for the rest of the session, after the server refused
+// a previous_response_id (for example, because responses are not stored).
+func (ch *responsesChain) reject() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.disabled = true
+	ch.id, ch.items = "", nil
+}
+
+// isChainRejected reports whether err is the server refusing a chained
+// request: an unknown or expired response ID, or no support for the parameter.
+func isChainRejected(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+	return (se.StatusCode == http.StatusBadRequest || se.StatusCode == http.StatusNotFound) &&
+		strings.Contains(se.Body, "previous_response")
+}
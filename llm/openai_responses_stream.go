@@ -2,12 +2,10 @@ package llm
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 )
 
@@ -19,33 +17,51 @@ func (c *OpenAIResponsesClient) StreamMessage(ctx context.Context, messages []Me
 		Input:           input,
 		Instructions:    instructions,
 		MaxOutputTokens: c.maxTokens,
+		Temperature:     requestTemperature(CapabilitiesFor("openai", c.model), c.temp),
 		Stream:          true,
 	}
 	if len(tools) > 0 {
 		reqBody.Tools = convertResponsesToolDefs(tools)
 	}
 
+	// Chain off the previous response when this conversation extends it
+	if prevID, newInput := c.chain.next(input); prevID != "" {
+		chained := reqBody
+		chained.PreviousResponseID = prevID
+		chained.Input = newInput
+		bodyBytes, err := json.Marshal(chained)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		resp, err := c.post(ctx, bodyBytes)
+		if err == nil {
+			return c.startResponsesStream(ctx, resp.Body, input), nil
+		}
+		if !isChainRejected(err) {
+			return nil, err
+		}
+		// Fall back to sending the full input from now on
+		c.chain.reject()
+	}
+
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	resp, err := doWithRetry(ctx, defaultRetryConfig(), func() (*http.Response, error) {
-		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/responses", bytes.NewReader(bodyBytes))
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
-		return c.http.Do(req)
-	})
+	resp, err := c.post(ctx, bodyBytes)
 	if err != nil {
 		return nil, err
 	}
+	return c.startResponsesStream(ctx, resp.Body, input), nil
+}
 
+// startResponsesStream parses an SSE body in the background. input is the
+// full conversation the response continues, recorded for chaining.
+func (c *OpenAIResponsesClient) startResponsesStream(ctx context.Context, body io.ReadCloser, input []json.RawMessage) <-chan StreamEvent {
 	ch := make(chan StreamEvent, 32)
-	go c.parseResponsesStream(ctx, resp.Body, ch)
-	return ch, nil
+	go c.parseResponsesStream(ctx, body, ch, input)
+	return ch
 }
 
 // Responses API SSE event types
@@ -78,7 +94,7 @@ type responsesCompleted struct {
 	Response responsesResponse `json:"response"`
 }
 
-func (c *OpenAIResponsesClient) parseResponsesStream(ctx context.Context, body io.ReadCloser, ch chan<- StreamEvent) {
+func (c *OpenAIResponsesClient) parseResponsesStream(ctx context.Context, body io.ReadCloser, ch chan<- StreamEvent, input []json.RawMessage) {
 	defer close(ch)
 	defer body.Close()
 
@@ -93,6 +109,7 @@ func (c *OpenAIResponsesClient) parseResponsesStream(ctx context.Context, body i
 	}
 	funcCalls := make(map[int]*funcCallState)
 	toolCallIdx := 0
+	textOutput := -1 // output_index of the message item text last came from
 
 	for scanner.Scan() {
 		select {
@@ -158,6 +175,14 @@ func (c *OpenAIResponsesClient) parseResponsesStream(ctx context.Context, body i
 			if err := json.Unmarshal([]byte(data), &ev); err != nil {
 				continue
 			}
+			if ev.Delta == "" {
+				continue
+			}
+			// Text from a further message item starts a new paragraph, as in SendMessage
+			if textOutput >= 0 && ev.OutputIndex != textOutput {
+				ch <- StreamEvent{TextDelta: messageSeparator}
+			}
+			textOutput = ev.OutputIndex
 			ch <- StreamEvent{TextDelta: ev.Delta}
 
 		case "response.function_call_arguments.delta":
@@ -184,26 +209,17 @@ func (c *OpenAIResponsesClient) parseResponsesStream(ctx context.Context, body i
 				}},
 			}
 
-		case "response.completed":
+		case "response.completed", "response.incomplete":
 			var ev responsesCompleted
 			if err := json.Unmarshal([]byte(data), &ev); err != nil {
 				// Still send Done even if we can't parse
 				ch <- StreamEvent{Done: true}
 				return
 			}
+			c.chain.record(input, ev.Response)
 			// Extract finish reason and usage from the completed response
-			event := StreamEvent{}
-			if len(funcCalls) > 0 {
-				event.FinishReason = "tool_calls"
-			} else {
-				switch ev.Response.Status {
-				case "completed":
-					event.FinishReason = "stop"
-				case "incomplete":
-					event.FinishReason = "length"
-				default:
-					event.FinishReason = "stop"
-				}
+			event := StreamEvent{
+				FinishReason: responsesFinishReason(ev.Response, len(funcCalls) > 0),
 			}
 			event.Usage = &Usage{
 				PromptTokens:     ev.Response.Usage.InputTokens,
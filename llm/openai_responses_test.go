@@ -1,7 +1,13 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -192,6 +198,25 @@ func TestConvertResponsesResponse_Incomplete(t *testing.T) {
 	}
 }
 
+func TestConvertResponsesResponse_ContentFilter(t *testing.T) {
+	resp := responsesResponse{
+		ID:     "resp_4",
+		Status: "incomplete",
+	}
+	resp.IncompleteDetails = &struct {
+		Reason string `json:"reason"`
+	}{Reason: "content_filter"}
+
+	result := convertResponsesResponse(resp)
+
+	if result.FinishReason != "content_filter" {
+		t.Errorf("expected finish_reason 'content_filter', got %q", result.FinishReason)
+	}
+	if result.Message.Content != nil {
+		t.Errorf("expected no content, got %q", result.Message.ContentString())
+	}
+}
+
 func TestConvertResponsesToolDefs(t *testing.T) {
 	tools := []ToolDef{
 		{
@@ -254,3 +279,148 @@ func TestConvertResponsesResponse_MixedTextAndToolCalls(t *testing.T) {
 		t.Errorf("expected finish_reason 'tool_calls', got %q", result.FinishReason)
 	}
 }
+
+func TestConvertResponsesResponse_MultipleMessages(t *testing.T) {
+	resp := responsesResponse{
+		Status: "completed",
+		Output: []responsesOutput{
+			{Type: "message", Role: "assistant", Content: []responsesContentItem{
+				{Type: "output_text", Text: "part1"},
+				{Type: "output_text", Text: "part2"},
+			}},
+			{Type: "reasoning"},
+			{Type: "message", Role: "assistant", Content: []responsesContentItem{
+				{Type: "output_text", Text: "second"},
+			}},
+			{Type: "message", Role: "assistant"},
+		},
+	}
+
+	result := convertResponsesResponse(resp)
+
+	if got := result.Message.ContentString(); got != "part1part2\n\nsecond" {
+		t.Errorf("expected the messages joined by a blank line, got %q", got)
+	}
+}
+
+// chainServer serves streamed Responses API replies, numbering response IDs
+// and recording each request body. With reject set, chained requests fail
+// the way the API does for an unknown previous response.
+type chainServer struct {
+	mu       sync.Mutex
+	requests []responsesRequest
+	reject   bool
+}
+
+func (s *chainServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req responsesRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	n := len(s.requests)
+	s.mu.Unlock()
+
+	if s.reject && req.PreviousResponseID != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":"previous_response_not_found","param":"previous_response_id"}}`))
+		return
+	}
+	text := fmt.Sprintf("reply %d", n)
+	fmt.Fprintf(w, "data: {\"type\":\"response.output_text.delta\",\"output_index\":0,\"delta\":%q}\n\n", text)
+	fmt.Fprintf(w, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_%d\",\"status\":\"completed\","+
+		"\"output\":[{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":%q}]}]}}\n\n", n, text)
+}
+
+// streamTurn streams one reply for messages and returns messages with the
+// reply appended, as the agent would store it.
+func streamTurn(t *testing.T, c *OpenAIResponsesClient, messages []Message) []Message {
+	t.Helper()
+	events, err := c.StreamMessage(context.Background(), messages, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	resp, err := AccumulateStream(events, nil)
+	if err != nil {
+		t.Fatalf("accumulate: %v", err)
+	}
+	return append(messages, resp.Message)
+}
+
+func TestOpenAIResponsesClient_PreviousResponseID(t *testing.T) {
+	srv := &chainServer{}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	c := NewOpenAIResponsesClient("key", "test-model", 100, server.URL)
+
+	messages := []Message{TextMessage("system", "Be brief."), TextMessage("user", "hello")}
+	messages = streamTurn(t, c, messages)
+	messages = append(messages, TextMessage("user", "and then?"))
+	messages = streamTurn(t, c, messages)
+
+	first, second := srv.requests[0], srv.requests[1]
+	if first.PreviousResponseID != "" || len(first.Input) != 1 {
+		t.Errorf("first request: expected full input without previous ID, got %q with %d items", first.PreviousResponseID, len(first.Input))
+	}
+	if second.PreviousResponseID != "resp_1" {
+		t.Errorf("expected previous_response_id resp_1, got %q", second.PreviousResponseID)
+	}
+	if len(second.Input) != 1 || !strings.Contains(string(second.Input[0]), "and then?") {
+		t.Errorf("expected only the new user message, got %s", second.Input)
+	}
+	if second.Instructions != "Be brief." {
+		t.Errorf("expected instructions resent with a chained request, got %q", second.Instructions)
+	}
+
+	// History no longer extends the chain (e.g. after compaction): full input
+	rewritten := []Message{TextMessage("system", "Be brief."), TextMessage("user", "summary"), TextMessage("user", "go on")}
+	streamTurn(t, c, rewritten)
+	third := srv.requests[2]
+	if third.PreviousResponseID != "" || len(third.Input) != 2 {
+		t.Errorf("expected full input after history changed, got %q with %d items", third.PreviousResponseID, len(third.Input))
+	}
+}
+
+func TestOpenAIResponsesClient_PreviousResponseIDRejected(t *testing.T) {
+	srv := &chainServer{reject: true}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	c := NewOpenAIResponsesClient("key", "test-model", 100, server.URL)
+
+	messages := streamTurn(t, c, []Message{TextMessage("user", "hello")})
+	messages = streamTurn(t, c, append(messages, TextMessage("user", "again")))
+	streamTurn(t, c, append(messages, TextMessage("user", "once more")))
+
+	var chained []string
+	for _, req := range srv.requests {
+		chained = append(chained, req.PreviousResponseID)
+	}
+	// The rejected chained request is retried in full, and chaining stays off
+	want := []string{"", "resp_1", "", ""}
+	if strings.Join(chained, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected previous IDs %q, got %q", want, chained)
+	}
+	if n := len(srv.requests[2].Input); n != 3 {
+		t.Errorf("expected the fallback to send all 3 items, got %d", n)
+	}
+}
+
+func TestOpenAIResponsesClient_StreamMultipleMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, ev := range []string{
+			`{"type":"response.output_text.delta","output_index":0,"delta":"part1"}`,
+			`{"type":"response.output_text.delta","output_index":0,"delta":"part2"}`,
+			`{"type":"response.output_text.delta","output_index":2,"delta":""}`,
+			`{"type":"response.output_text.delta","output_index":2,"delta":"second"}`,
+			`{"type":"response.completed","response":{"id":"resp_1","status":"completed"}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", ev)
+		}
+	}))
+	defer server.Close()
+	c := NewOpenAIResponsesClient("key", "test-model", 100, server.URL)
+
+	messages := streamTurn(t, c, []Message{TextMessage("user", "hello")})
+	if got := messages[1].ContentString(); got != "part1part2\n\nsecond" {
+		t.Errorf("expected the messages joined by a blank line, got %q", got)
+	}
+}
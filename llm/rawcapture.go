@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// RawExchange is a client's most recent request and response body as sent
+// and received. A streamed response holds the event stream read so far.
+type RawExchange struct {
+	Request  string
+	Status   int // HTTP status; 0 if no response arrived
+	Response string
+}
+
+// RawExchanger is implemented by clients that can report their most recent
+// raw exchange.
+type RawExchanger interface {
+	// LastExchange returns the latest exchange, or false if capture is off
+	// or nothing has been sent.
+	LastExchange() (RawExchange, bool)
+}
+
+// rawCapture keeps the latest request and response bodies of a client when
+// enabled. Bodies are redacted when read back, not as they stream in.
+type rawCapture struct {
+	mu       sync.Mutex
+	enabled  bool
+	redact   func(string) string
+	sent     bool
+	request  []byte
+	status   int
+	response bytes.Buffer
+}
+
+func (rc *rawCapture) set(enabled bool, redact func(string) string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.enabled, rc.redact = enabled, redact
+	if !enabled {
+		rc.sent, rc.request, rc.status = false, nil, 0
+		rc.response.Reset()
+	}
+}
+
+// begin records a request body about to be sent, replacing the last exchange.
+func (rc *rawCapture) begin(body []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.enabled {
+		return
+	}
+	rc.sent, rc.request, rc.status = true, body, 0
+	rc.response.Reset()
+}
+
+// end records the outcome of the request: the body of a failed status, or
+// a response whose body is copied as the caller reads it.
+func (rc *rawCapture) end(resp *http.Response, err error) (*http.Response, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.enabled {
+		return resp, err
+	}
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		rc.status = se.StatusCode
+		rc.response.WriteString(se.Body)
+	case err == nil:
+		rc.status = resp.StatusCode
+		resp.Body = &capturedBody{ReadCloser: resp.Body, rc: rc}
+	}
+	return resp, err
+}
+
+func (rc *rawCapture) last() (RawExchange, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.enabled || !rc.sent {
+		return RawExchange{}, false
+	}
+	ex := RawExchange{Request: string(rc.request), Status: rc.status, Response: rc.response.String()}
+	if rc.redact != nil {
+		ex.Request, ex.Response = rc.redact(ex.Request), rc.redact(ex.Response)
+	}
+	return ex, true
+}
+
+// capturedBody copies what is read from a response body into the capture.
+type capturedBody struct {
+	io.ReadCloser
+	rc *rawCapture
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.rc.mu.Lock()
+	b.rc.response.Write(p[:n])
+	b.rc.mu.Unlock()
+	return n, err
+}
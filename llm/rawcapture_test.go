@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func maskHunter(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") }
+
+func TestRawCapture(t *testing.T) {
+	const reply = `{"type":"message","role":"assistant","content":[{"type":"text","text":"ok hunter2"}],"stop_reason":"end_turn"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+	messages := []Message{TextMessage("user", "my password is hunter2")}
+
+	c := NewAnthropicClient("sk-ant-test", "claude-sonnet-4-6", 1024, server.URL)
+	if _, err := c.SendMessage(context.Background(), messages, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.LastExchange(); ok {
+		t.Error("expected no capture while disabled")
+	}
+
+	c.SetRawCapture(true, maskHunter)
+	if _, err := c.SendMessage(context.Background(), messages, nil); err != nil {
+		t.Fatal(err)
+	}
+	ex, ok := c.LastExchange()
+	if !ok {
+		t.Fatal("expected a captured exchange")
+	}
+	if !strings.Contains(ex.Request, `"model":"claude-sonnet-4-6"`) || !strings.Contains(ex.Request, "my password is [REDACTED]") {
+		t.Errorf("expected redacted request body, got %s", ex.Request)
+	}
+	if strings.Contains(ex.Request+ex.Response, "hunter2") {
+		t.Error("secret leaked into the capture")
+	}
+	if ex.Status != http.StatusOK || ex.Response != strings.ReplaceAll(reply, "hunter2", "[REDACTED]") {
+		t.Errorf("unexpected response capture: %d %s", ex.Status, ex.Response)
+	}
+}
+
+func TestRawCaptureStreamAndError(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"bad input"}}`))
+			return
+		}
+		w.Write([]byte("data: {\"type\":\"response.output_text.delta\",\"output_index\":0,\"delta\":\"hi\"}\n\n"))
+		w.Write([]byte("data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"status\":\"completed\",\"output\":[]}}\n\n"))
+	}))
+	defer server.Close()
+
+	c := NewOpenAIResponsesClient("sk-test", "gpt-4o-mini", 1024, server.URL)
+	c.SetRawCapture(true, nil)
+	events, err := c.StreamMessage(context.Background(), []Message{TextMessage("user", "hello")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AccumulateStream(events, nil); err != nil {
+		t.Fatal(err)
+	}
+	ex, _ := c.LastExchange()
+	if !strings.Contains(ex.Response, `"delta":"hi"`) || !strings.Contains(ex.Response, "response.completed") {
+		t.Errorf("expected the event stream as received, got %q", ex.Response)
+	}
+
+	fail = true
+	c.SendMessage(context.Background(), []Message{TextMessage("user", "again")}, nil)
+	ex, _ = c.LastExchange()
+	if !strings.Contains(ex.Request, "again") || ex.Status != http.StatusBadRequest || !strings.Contains(ex.Response, "bad input") {
+		t.Errorf("expected the failed exchange, got %+v", ex)
+	}
+}
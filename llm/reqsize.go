@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxRequestBytes is the request body cap clients start with. It sits
+// below the providers' own limits, so an oversized conversation fails here
+// with a clear error instead of an HTTP 413.
+const DefaultMaxRequestBytes = 20 << 20
+
+// ErrRequestTooLarge matches (with errors.Is) a request whose body is over
+// the client's cap or was rejected by the provider with HTTP 413. Compacting
+// the conversation is the usual way out.
+var ErrRequestTooLarge = errors.New("request too large")
+
+// RequestTooLargeError reports a request body over the client's cap. It is
+// returned before anything is sent.
+type RequestTooLargeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("request body is %s, over the %s limit: compact the conversation or drop large tool results",
+		formatBytes(e.Size), formatBytes(e.Limit))
+}
+
+// Is makes errors.Is(err, ErrRequestTooLarge) match.
+func (e *RequestTooLargeError) Is(target error) bool {
+	return target == ErrRequestTooLarge
+}
+
+// checkRequestSize rejects a body over limit. A limit of zero or less
+// disables the check.
+func checkRequestSize(body []byte, limit int) error {
+	if limit > 0 && len(body) > limit {
+		return &RequestTooLargeError{Size: len(body), Limit: limit}
+	}
+	return nil
+}
+
+// formatBytes renders n as KB or MB with one decimal.
+func formatBytes(n int) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRequestOverCapRejectedBeforeSend(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	messages := []Message{TextMessage("user", strings.Repeat("x", 4096))}
+	anthropic := NewAnthropicClient("sk-ant-test", "claude-sonnet-4-6", 1024, server.URL)
+	anthropic.SetMaxRequestBytes(1024)
+	openai := NewOpenAIResponsesClient("sk-test", "gpt-4o-mini", 1024, server.URL)
+	openai.SetMaxRequestBytes(1024)
+
+	for name, client := range map[string]LLMClient{"anthropic": anthropic, "openai": openai} {
+		t.Run(name, func(t *testing.T) {
+			_, err := client.SendMessage(context.Background(), messages, nil)
+			if !errors.Is(err, ErrRequestTooLarge) {
+				t.Errorf("SendMessage: expected ErrRequestTooLarge, got %v", err)
+			}
+			_, err = client.StreamMessage(context.Background(), messages, nil)
+			if !errors.Is(err, ErrRequestTooLarge) {
+				t.Errorf("StreamMessage: expected ErrRequestTooLarge, got %v", err)
+			}
+			var tooLarge *RequestTooLargeError
+			if !errors.As(err, &tooLarge) || tooLarge.Limit != 1024 || tooLarge.Size <= 4096 {
+				t.Errorf("expected size and limit in error, got %v", err)
+			}
+		})
+	}
+	if calls.Load() != 0 {
+		t.Errorf("expected no HTTP calls, got %d", calls.Load())
+	}
+}
+
+func TestRequestUnderCapSent(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient("sk-ant-test", "claude-sonnet-4-6", 1024, server.URL)
+	client.SetMaxRequestBytes(0) // disabled
+	if _, err := client.SendMessage(context.Background(), []Message{TextMessage("user", strings.Repeat("x", 4096))}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the request to be sent, got %d calls", calls.Load())
+	}
+}
+
+func TestStatus413IsRequestTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte(`request_too_large`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAIResponsesClient("sk-test", "gpt-4o-mini", 1024, server.URL)
+	_, err := client.SendMessage(context.Background(), []Message{TextMessage("user", "hi")}, nil)
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected a 413 to match ErrRequestTooLarge, got %v", err)
+	}
+}
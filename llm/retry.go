@@ -27,6 +27,24 @@ func defaultRetryConfig() retryConfig {
 	}
 }
 
+// RetryNotifier is called before each retry wait with the retry number
+// (1-based), the configured maximum, the delay before the next attempt, and a
+// short reason such as "rate limited".
+type RetryNotifier func(attempt, maxRetries int, delay time.Duration, reason string)
+
+type retryNotifierKey struct{}
+
+// WithRetryNotifier returns a context whose requests report retries to notify.
+func WithRetryNotifier(ctx context.Context, notify RetryNotifier) context.Context {
+	return context.WithValue(ctx, retryNotifierKey{}, notify)
+}
+
+// retryNotifierFrom returns the notifier attached to ctx, or nil.
+func retryNotifierFrom(ctx context.Context) RetryNotifier {
+	notify, _ := ctx.Value(retryNotifierKey{}).(RetryNotifier)
+	return notify
+}
+
 // retryableError is returned when retries are exhausted, containing the last status and body.
 type retryableError struct {
 	StatusCode int
@@ -38,13 +56,54 @@ func (e *retryableError) Error() string {
 	return fmt.Sprintf("request failed (HTTP %d) after %d retries: %s", e.StatusCode, e.Retries, e.Body)
 }
 
+// statusError is a non-retryable error response, such as a 400 for a
+// malformed request.
+type statusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("API error (HTTP %d): %s", e.StatusCode, e.Body)
+}
+
+// Is makes a 413 match ErrRequestTooLarge.
+func (e *statusError) Is(target error) bool {
+	return target == ErrRequestTooLarge && e.StatusCode == http.StatusRequestEntityTooLarge
+}
+
+// authError is a 401 or 403: the API key is missing, wrong, or lacks access.
+type authError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("authentication error (HTTP %d): %s", e.StatusCode, e.Body)
+}
+
+// networkError is a request that never got a response, after retries.
+type networkError struct {
+	Err error
+}
+
+func (e *networkError) Error() string {
+	return fmt.Sprintf("http request: %s", e.Err)
+}
+
+func (e *networkError) Unwrap() error {
+	return e.Err
+}
+
 // doWithRetry executes an HTTP request function with exponential backoff retry
 // for 429 and 5xx errors. It respects the Retry-After header when present.
 // The doReq function receives the attempt number (0-based) and should return
 // the HTTP response. On success (2xx), it returns the response for the caller
 // to process. On non-retryable errors (4xx except 429), it returns immediately.
-func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Response, error)) (*http.Response, error) {
+// notify, if non-nil, is called before each retry wait.
+func doWithRetry(ctx context.Context, cfg retryConfig, notify RetryNotifier, doReq func() (*http.Response, error)) (*http.Response, error) {
 	var retryAfterOverride time.Duration // one-shot override from Retry-After header
+	var reason string                    // why the previous attempt failed
 
 	for attempt := 0; attempt <= cfg.maxRetries; attempt++ {
 		if attempt > 0 {
@@ -53,6 +112,9 @@ func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Respo
 				delay = retryAfterOverride
 			}
 			retryAfterOverride = 0 // consume the override
+			if notify != nil {
+				notify(attempt, cfg.maxRetries, delay, reason)
+			}
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
@@ -62,10 +124,11 @@ func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Respo
 
 		resp, err := doReq()
 		if err != nil {
+			reason = "connection error"
 			if attempt < cfg.maxRetries {
 				continue
 			}
-			return nil, fmt.Errorf("http request: %w", err)
+			return nil, &networkError{Err: err}
 		}
 
 		// Respect server-side retry override before checking status codes.
@@ -79,6 +142,7 @@ func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Respo
 			}
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
+			reason = retryReason(resp.StatusCode)
 			if attempt < cfg.maxRetries {
 				continue
 			}
@@ -96,7 +160,7 @@ func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Respo
 		case resp.StatusCode == 401 || resp.StatusCode == 403:
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			return nil, fmt.Errorf("authentication error (HTTP %d): %s", resp.StatusCode, string(body))
+			return nil, &authError{StatusCode: resp.StatusCode, Body: string(body)}
 
 		case resp.StatusCode == 408, resp.StatusCode == 409, resp.StatusCode == 429, resp.StatusCode >= 500:
 			if ra := parseRetryAfter(resp); ra > 0 && ra < cfg.maxDelay {
@@ -104,6 +168,7 @@ func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Respo
 			}
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
+			reason = retryReason(resp.StatusCode)
 			if attempt < cfg.maxRetries {
 				continue
 			}
@@ -116,13 +181,25 @@ func doWithRetry(ctx context.Context, cfg retryConfig, doReq func() (*http.Respo
 		default:
 			body, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			return nil, fmt.Errorf("API error (HTTP %d): %s", resp.StatusCode, string(body))
+			return nil, &statusError{StatusCode: resp.StatusCode, Body: string(body)}
 		}
 	}
 
 	return nil, fmt.Errorf("exhausted retries")
 }
 
+// retryReason describes a retryable HTTP status for retry notifications.
+func retryReason(status int) string {
+	switch {
+	case status == 429:
+		return "rate limited"
+	case status >= 500:
+		return fmt.Sprintf("server error (HTTP %d)", status)
+	default:
+		return fmt.Sprintf("request failed (HTTP %d)", status)
+	}
+}
+
 // backoffDelay calculates the delay for a given attempt using exponential backoff with jitter.
 func backoffDelay(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
 	delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(attempt)))
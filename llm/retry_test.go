@@ -16,7 +16,7 @@ func TestDoWithRetry_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	resp, err := doWithRetry(context.Background(), defaultRetryConfig(), func() (*http.Response, error) {
+	resp, err := doWithRetry(context.Background(), defaultRetryConfig(), nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err != nil {
@@ -44,7 +44,7 @@ func TestDoWithRetry_429ThenSuccess(t *testing.T) {
 	defer server.Close()
 
 	cfg := retryConfig{maxRetries: 5, baseDelay: 10 * time.Millisecond, maxDelay: 100 * time.Millisecond}
-	resp, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	resp, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err != nil {
@@ -67,7 +67,7 @@ func TestDoWithRetry_ExhaustedRetries(t *testing.T) {
 	defer server.Close()
 
 	cfg := retryConfig{maxRetries: 2, baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
-	_, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	_, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err == nil {
@@ -92,7 +92,7 @@ func TestDoWithRetry_AuthError_NoRetry(t *testing.T) {
 	defer server.Close()
 
 	cfg := retryConfig{maxRetries: 3, baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
-	_, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	_, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err == nil {
@@ -114,7 +114,7 @@ func TestDoWithRetry_ContextCanceled(t *testing.T) {
 	cancel() // cancel immediately
 
 	cfg := retryConfig{maxRetries: 5, baseDelay: time.Second, maxDelay: 10 * time.Second}
-	_, err := doWithRetry(ctx, cfg, func() (*http.Response, error) {
+	_, err := doWithRetry(ctx, cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err == nil {
@@ -137,7 +137,7 @@ func TestDoWithRetry_ServerError_Retries(t *testing.T) {
 	defer server.Close()
 
 	cfg := retryConfig{maxRetries: 3, baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
-	resp, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	resp, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err != nil {
@@ -176,7 +176,7 @@ func TestDoWithRetry_RetryAfterIsOneShot(t *testing.T) {
 	cfg := retryConfig{maxRetries: 5, baseDelay: 10 * time.Millisecond, maxDelay: 5 * time.Second}
 
 	start := time.Now()
-	resp, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	resp, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	elapsed := time.Since(start)
@@ -211,7 +211,7 @@ func TestDoWithRetry_408and409_Retries(t *testing.T) {
 		}))
 
 		cfg := retryConfig{maxRetries: 3, baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
-		resp, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+		resp, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 			return http.Get(server.URL)
 		})
 		server.Close()
@@ -241,7 +241,7 @@ func TestDoWithRetry_XShouldRetryTrue(t *testing.T) {
 	defer server.Close()
 
 	cfg := retryConfig{maxRetries: 3, baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
-	resp, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	resp, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err != nil {
@@ -264,7 +264,7 @@ func TestDoWithRetry_XShouldRetryFalse(t *testing.T) {
 	defer server.Close()
 
 	cfg := retryConfig{maxRetries: 3, baseDelay: 10 * time.Millisecond, maxDelay: 50 * time.Millisecond}
-	_, err := doWithRetry(context.Background(), cfg, func() (*http.Response, error) {
+	_, err := doWithRetry(context.Background(), cfg, nil, func() (*http.Response, error) {
 		return http.Get(server.URL)
 	})
 	if err == nil {
@@ -275,6 +275,68 @@ func TestDoWithRetry_XShouldRetryFalse(t *testing.T) {
 	}
 }
 
+func TestDoWithRetry_Notifier(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch n {
+		case 1:
+			w.Header().Set("Retry-After-Ms", "30")
+			w.WriteHeader(429)
+		case 2:
+			w.WriteHeader(503)
+		default:
+			w.WriteHeader(200)
+		}
+	}))
+	defer server.Close()
+
+	type notice struct {
+		attempt, max int
+		delay        time.Duration
+		reason       string
+	}
+	var notices []notice
+	notify := func(attempt, maxRetries int, delay time.Duration, reason string) {
+		notices = append(notices, notice{attempt, maxRetries, delay, reason})
+	}
+
+	cfg := retryConfig{maxRetries: 5, baseDelay: 10 * time.Millisecond, maxDelay: 100 * time.Millisecond}
+	resp, err := doWithRetry(context.Background(), cfg, notify, func() (*http.Response, error) {
+		return http.Get(server.URL)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(notices) != 2 {
+		t.Fatalf("expected 2 notifications, got %d: %+v", len(notices), notices)
+	}
+	if n := notices[0]; n.attempt != 1 || n.max != 5 || n.reason != "rate limited" || n.delay < 30*time.Millisecond {
+		t.Errorf("unexpected first notice: %+v", n)
+	}
+	if n := notices[1]; n.attempt != 2 || n.reason != "server error (HTTP 503)" || n.delay <= 0 || n.delay > cfg.maxDelay {
+		t.Errorf("unexpected second notice: %+v", n)
+	}
+}
+
+func TestRetryNotifierFromContext(t *testing.T) {
+	if retryNotifierFrom(context.Background()) != nil {
+		t.Error("expected no notifier on a plain context")
+	}
+	called := false
+	ctx := WithRetryNotifier(context.Background(), func(int, int, time.Duration, string) { called = true })
+	notify := retryNotifierFrom(ctx)
+	if notify == nil {
+		t.Fatal("expected notifier from context")
+	}
+	notify(1, 5, time.Second, "rate limited")
+	if !called {
+		t.Error("expected notifier to be called")
+	}
+}
+
 func TestParseRetryAfter(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1,14 +1,22 @@
 package llm
 
-import "strings"
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode/utf8"
+)
 
 // AccumulateStream collects streaming events into a complete Response.
-// It also calls onText for each text delta for real-time display.
+// It also calls onText for each text delta for real-time display. A UTF-8
+// sequence split across deltas is held back until it completes, so onText
+// never sees half a character.
 func AccumulateStream(events <-chan StreamEvent, onText func(string)) (*Response, error) {
 	var content strings.Builder
 	toolCalls := make(map[int]*ToolCall) // accumulate by index
 	var usage Usage
 	var finishReason string
+	var pending string // incomplete trailing UTF-8 sequence not yet passed to onText
 
 	for event := range events {
 		if event.Err != nil {
@@ -21,7 +29,11 @@ func AccumulateStream(events <-chan StreamEvent, onText func(string)) (*Response
 		if event.TextDelta != "" {
 			content.WriteString(event.TextDelta)
 			if onText != nil {
-				onText(event.TextDelta)
+				var text string
+				text, pending = splitIncompleteRune(pending + event.TextDelta)
+				if text != "" {
+					onText(text)
+				}
 			}
 		}
 
@@ -50,6 +62,11 @@ func AccumulateStream(events <-chan StreamEvent, onText func(string)) (*Response
 		}
 	}
 
+	// A sequence the stream never completed is shown as it is
+	if pending != "" {
+		onText(pending)
+	}
+
 	// Build the final message
 	var contentPtr *string
 	if content.Len() > 0 {
@@ -63,6 +80,7 @@ func AccumulateStream(events <-chan StreamEvent, onText func(string)) (*Response
 			calls = append(calls, *tc)
 		}
 	}
+	fillToolCallIDs(calls)
 
 	msg := Message{
 		Role:      "assistant",
@@ -76,3 +94,42 @@ func AccumulateStream(events <-chan StreamEvent, onText func(string)) (*Response
 		Usage:        usage,
 	}, nil
 }
+
+// splitIncompleteRune splits s before a UTF-8 sequence at its end that is
+// cut short, returning the complete part and the incomplete tail. Bytes that
+// can never start a valid sequence are left in the complete part.
+func splitIncompleteRune(s string) (complete, tail string) {
+	// A sequence is at most utf8.UTFMax bytes, so its start is within reach
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(s[i]) {
+			continue
+		}
+		if !utf8.FullRuneInString(s[i:]) {
+			return s[:i], s[i:]
+		}
+		break
+	}
+	return s, ""
+}
+
+// fillToolCallIDs gives every tool call without a provider-supplied ID a
+// synthetic one, so its result can still be paired with it by
+// ToolResultMessage and the provider conversions.
+func fillToolCallIDs(calls []ToolCall) {
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = syntheticToolCallID(i, calls[i])
+		}
+	}
+}
+
+// syntheticToolCallID derives a deterministic ID from the call's position in
+// the turn and its name and arguments. The hash keeps it from colliding with
+// synthetic IDs from earlier turns in the same conversation.
+func syntheticToolCallID(index int, tc ToolCall) string {
+	h := fnv.New32a()
+	h.Write([]byte(tc.Function.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(tc.Function.Arguments))
+	return fmt.Sprintf("call_%d_%08x", index, h.Sum32())
+}
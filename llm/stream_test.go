@@ -3,6 +3,7 @@ package llm
 import (
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestAccumulateStreamTextOnly(t *testing.T) {
@@ -34,6 +35,78 @@ func TestAccumulateStreamTextOnly(t *testing.T) {
 	}
 }
 
+func TestAccumulateStreamSplitRune(t *testing.T) {
+	// "é" is 0xC3 0xA9 and "世" is 0xE4 0xB8 0x96; each is split across deltas
+	deltas := []string{"caf\xc3", "\xa9 \xe4", "\xb8", "\x96!"}
+	ch := make(chan StreamEvent, 10)
+	go func() {
+		for _, d := range deltas {
+			ch <- StreamEvent{TextDelta: d}
+		}
+		ch <- StreamEvent{Done: true}
+		close(ch)
+	}()
+
+	var chunks []string
+	resp, err := AccumulateStream(ch, func(text string) {
+		chunks = append(chunks, text)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.Message.ContentString() != "café 世!" {
+		t.Errorf("content = %q, want %q", resp.Message.ContentString(), "café 世!")
+	}
+	for _, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Errorf("onText got a partial rune: %q", c)
+		}
+	}
+	if got := strings.Join(chunks, ""); got != "café 世!" {
+		t.Errorf("onText collected %q", got)
+	}
+}
+
+func TestAccumulateStreamUnfinishedRune(t *testing.T) {
+	ch := make(chan StreamEvent, 10)
+	go func() {
+		ch <- StreamEvent{TextDelta: "ok \xe4\xb8"}
+		close(ch)
+	}()
+
+	var collected strings.Builder
+	if _, err := AccumulateStream(ch, func(text string) {
+		collected.WriteString(text)
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if collected.String() != "ok \xe4\xb8" {
+		t.Errorf("onText collected %q, want the unfinished bytes flushed at the end", collected.String())
+	}
+}
+
+func TestSplitIncompleteRune(t *testing.T) {
+	tests := []struct {
+		in, complete, tail string
+	}{
+		{"", "", ""},
+		{"abc", "abc", ""},
+		{"café", "café", ""},
+		{"caf\xc3", "caf", "\xc3"},
+		{"a\xe4\xb8", "a", "\xe4\xb8"},
+		{"a\xf0\x9f\x98", "a", "\xf0\x9f\x98"},
+		{"a\xff", "a\xff", ""}, // never valid: passed through
+		{"a\xa9", "a\xa9", ""}, // stray continuation byte
+	}
+	for _, tt := range tests {
+		complete, tail := splitIncompleteRune(tt.in)
+		if complete != tt.complete || tail != tt.tail {
+			t.Errorf("splitIncompleteRune(%q) = %q, %q; want %q, %q", tt.in, complete, tail, tt.complete, tt.tail)
+		}
+	}
+}
+
 func TestAccumulateStreamToolCalls(t *testing.T) {
 	ch := make(chan StreamEvent, 10)
 	go func() {
@@ -114,6 +187,71 @@ func TestAccumulateStreamToolCalls(t *testing.T) {
 	}
 }
 
+func TestAccumulateStreamMissingToolCallID(t *testing.T) {
+	accumulate := func() *Response {
+		ch := make(chan StreamEvent, 10)
+		go func() {
+			ch <- StreamEvent{ToolCallDeltas: []ToolCallDelta{{Index: 0, ID: "call_abc"}}}
+			ch <- StreamEvent{ToolCallDeltas: []ToolCallDelta{{Index: 1}}}
+			ch <- StreamEvent{ToolCallDeltas: []ToolCallDelta{{Index: 2}}}
+			for i, name := range []string{"glob", "read", "read"} {
+				var d ToolCallDelta
+				d.Index = i
+				d.Function.Name = name
+				d.Function.Arguments = `{"path":"` + name + `.go"}`
+				if i == 2 {
+					d.Function.Arguments = `{"path":"other.go"}`
+				}
+				ch <- StreamEvent{ToolCallDeltas: []ToolCallDelta{d}}
+			}
+			ch <- StreamEvent{FinishReason: "tool_calls", Done: true}
+			close(ch)
+		}()
+		resp, err := AccumulateStream(ch, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp
+	}
+
+	resp := accumulate()
+	calls := resp.Message.ToolCalls
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 tool calls, got %d", len(calls))
+	}
+	if calls[0].ID != "call_abc" {
+		t.Errorf("expected provider ID kept, got %q", calls[0].ID)
+	}
+	if !strings.HasPrefix(calls[1].ID, "call_1_") || !strings.HasPrefix(calls[2].ID, "call_2_") {
+		t.Errorf("expected index-based synthetic IDs, got %q and %q", calls[1].ID, calls[2].ID)
+	}
+	if calls[1].ID == calls[2].ID {
+		t.Errorf("expected distinct IDs, both %q", calls[1].ID)
+	}
+	if again := accumulate().Message.ToolCalls; again[1].ID != calls[1].ID || again[2].ID != calls[2].ID {
+		t.Errorf("expected deterministic IDs, got %q/%q then %q/%q", calls[1].ID, calls[2].ID, again[1].ID, again[2].ID)
+	}
+
+	// The synthetic ID pairs the call with its result in both conversions
+	history := []Message{resp.Message, ToolResultMessage(calls[1].ID, "contents")}
+	_, anthropicMsgs := convertToAnthropicMessages(history)
+	toolUse := anthropicMsgs[0].Content.([]anthropicContentBlock)[1]
+	toolResult := anthropicMsgs[1].Content.([]anthropicContentBlock)[0]
+	if toolUse.ID != calls[1].ID || toolResult.ToolUseID != calls[1].ID {
+		t.Errorf("anthropic: tool_use %q, tool_result %q, want %q", toolUse.ID, toolResult.ToolUseID, calls[1].ID)
+	}
+	_, input := convertToResponsesInput(history)
+	var pairedIDs int
+	for _, item := range input {
+		if strings.Contains(string(item), `"call_id":"`+calls[1].ID+`"`) {
+			pairedIDs++
+		}
+	}
+	if pairedIDs != 2 {
+		t.Errorf("responses: expected function_call and its output to share %q, got %d items", calls[1].ID, pairedIDs)
+	}
+}
+
 func TestAccumulateStreamError(t *testing.T) {
 	ch := make(chan StreamEvent, 10)
 	go func() {
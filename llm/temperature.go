@@ -0,0 +1,16 @@
+package llm
+
+// MaxTemperature is the highest sampling temperature any provider accepts.
+// Anthropic caps it lower, at 1.
+const MaxTemperature = 2.0
+
+// requestTemperature returns the temperature to send to a model with caps,
+// capped at its maximum, or nil to leave the provider default: when none is
+// set or the model does not support one.
+func requestTemperature(caps Capabilities, temperature *float64) *float64 {
+	if temperature == nil || !caps.Temperature {
+		return nil
+	}
+	t := min(*temperature, caps.MaxTemperature)
+	return &t
+}
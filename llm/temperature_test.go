@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// temperatureSent sends one request from client and returns the temperature
+// in its body, or nil if the field was omitted.
+func temperatureSent(t *testing.T, newClient func(baseURL string) LLMClient) any {
+	t.Helper()
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusBadRequest) // not retried; only the body matters
+	}))
+	defer server.Close()
+
+	newClient(server.URL).SendMessage(context.Background(), []Message{TextMessage("user", "hi")}, nil)
+	if body == nil {
+		t.Fatal("no request received")
+	}
+	return body["temperature"]
+}
+
+func TestTemperatureInRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		model    string
+		temp     *float64
+		want     any
+	}{
+		{"openai unset", "openai", "gpt-4o-mini", nil, nil},
+		{"openai set", "openai", "gpt-4o-mini", ptr(0.2), 0.2},
+		{"openai zero", "openai", "gpt-4o-mini", ptr(0), 0.0},
+		{"openai above anthropic cap", "openai", "gpt-4o-mini", ptr(1.5), 1.5},
+		{"gpt-5 reasoning", "openai", "gpt-5.2-codex", ptr(0.2), nil},
+		{"o-series reasoning", "openai", "o4-mini", ptr(0.2), nil},
+		{"anthropic unset", "anthropic", "claude-sonnet-4-6", nil, nil},
+		{"anthropic set", "anthropic", "claude-sonnet-4-6", ptr(0.7), 0.7},
+		{"anthropic capped", "anthropic", "claude-sonnet-4-6", ptr(1.5), 1.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := temperatureSent(t, func(baseURL string) LLMClient {
+				if tt.provider == "anthropic" {
+					c := NewAnthropicClient("sk-ant-test", tt.model, 1024, baseURL)
+					c.SetTemperature(tt.temp)
+					return c
+				}
+				c := NewOpenAIResponsesClient("sk-test", tt.model, 1024, baseURL)
+				c.SetTemperature(tt.temp)
+				return c
+			})
+			if got != tt.want {
+				t.Errorf("temperature in request = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(f float64) *float64 { return &f }
@@ -80,7 +80,9 @@ type Usage struct {
 
 // Response is the higher-level response returned by the LLM client.
 type Response struct {
-	Message      Message
+	Message Message
+	// FinishReason is "stop", "tool_calls", "length", or "content_filter"
+	// (the provider refused or filtered the response).
 	FinishReason string
 	Usage        Usage
 }
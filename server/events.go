@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+	"github.com/lowkaihon/cli-coding-agent/ui"
+)
+
+// Event is one server-sent event of a turn. Type says which fields are set.
+type Event struct {
+	Type string `json:"type"`
+
+	Text   string `json:"text,omitempty"`   // assistant, warning, subagent_status
+	Name   string `json:"name,omitempty"`   // tool_call, subagent_tool_call
+	Args   string `json:"args,omitempty"`   // tool_call, subagent_tool_call
+	Result string `json:"result,omitempty"` // tool_result
+
+	Path       string `json:"path,omitempty"`        // diff, file_preview
+	OldContent string `json:"old_content,omitempty"` // diff
+	NewContent string `json:"new_content,omitempty"` // diff, file_preview
+	Patch      string `json:"patch,omitempty"`       // patch
+
+	ID     int    `json:"id,omitempty"`     // confirm: answer with POST /confirm
+	Prompt string `json:"prompt,omitempty"` // confirm
+
+	Attempt    int    `json:"attempt,omitempty"`     // retry
+	MaxRetries int    `json:"max_retries,omitempty"` // retry
+	DelayMS    int64  `json:"delay_ms,omitempty"`    // retry
+	Reason     string `json:"reason,omitempty"`      // retry
+
+	Changes []agent.FileChange `json:"changes,omitempty"` // file_changes
+	Error   string             `json:"error,omitempty"`   // done
+}
+
+// Event types.
+const (
+	EventThinking         = "thinking"
+	EventRetry            = "retry"
+	EventAssistant        = "assistant"
+	EventAssistantDone    = "assistant_done"
+	EventWarning          = "warning"
+	EventToolCall         = "tool_call"
+	EventToolResult       = "tool_result"
+	EventSubAgentToolCall = "subagent_tool_call"
+	EventSubAgentStatus   = "subagent_status"
+	EventDiff             = "diff"
+	EventFilePreview      = "file_preview"
+	EventPatch            = "patch"
+	EventConfirm          = "confirm"
+	EventFileChanges      = "file_changes"
+	EventDone             = "done"
+)
+
+// eventUI implements agent.UI by streaming each call as a server-sent event.
+// Confirmations wait for an answer posted to /confirm.
+type eventUI struct {
+	srv *Server
+	ctx context.Context // the turn; ends any pending confirmation
+
+	mu sync.Mutex // explore sub-agents may report concurrently
+	w  io.Writer
+	f  http.Flusher
+}
+
+func (u *eventUI) emit(ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fmt.Fprintf(u.w, "data: %s\n\n", data)
+	if u.f != nil {
+		u.f.Flush()
+	}
+}
+
+// StartEscapeListener returns parent unchanged: a turn is cancelled with
+// POST /cancel or by closing the request.
+func (u *eventUI) StartEscapeListener(parent context.Context) (context.Context, ui.Interrupter, error) {
+	return parent, noopInterrupter{}, nil
+}
+
+func (u *eventUI) PrintSpinner() { u.emit(Event{Type: EventThinking}) }
+func (u *eventUI) ClearSpinner() {}
+
+func (u *eventUI) PrintRetry(attempt, maxRetries int, delay time.Duration, reason string) {
+	u.emit(Event{Type: EventRetry, Attempt: attempt, MaxRetries: maxRetries, DelayMS: delay.Milliseconds(), Reason: reason})
+}
+
+func (u *eventUI) PrintAssistant(text string) { u.emit(Event{Type: EventAssistant, Text: text}) }
+func (u *eventUI) PrintAssistantDone()        { u.emit(Event{Type: EventAssistantDone}) }
+func (u *eventUI) PrintWarning(msg string)    { u.emit(Event{Type: EventWarning, Text: msg}) }
+
+func (u *eventUI) PrintToolCall(name, args string) {
+	u.emit(Event{Type: EventToolCall, Name: name, Args: args})
+}
+
+func (u *eventUI) PrintToolResult(result string) {
+	u.emit(Event{Type: EventToolResult, Result: result})
+}
+
+func (u *eventUI) PrintSubAgentToolCall(name, args string) {
+	u.emit(Event{Type: EventSubAgentToolCall, Name: name, Args: args})
+}
+
+func (u *eventUI) PrintSubAgentStatus(msg string) {
+	u.emit(Event{Type: EventSubAgentStatus, Text: msg})
+}
+
+func (u *eventUI) PrintDiff(path, oldContent, newContent string) {
+	u.emit(Event{Type: EventDiff, Path: path, OldContent: oldContent, NewContent: newContent})
+}
+
+func (u *eventUI) PrintFilePreview(path, content string) {
+	u.emit(Event{Type: EventFilePreview, Path: path, NewContent: content})
+}
+
+func (u *eventUI) PrintPatch(patch string) { u.emit(Event{Type: EventPatch, Patch: patch}) }
+
+// ConfirmAction sends a confirm event and waits for the client's answer. It
+// denies if the turn ends first.
+func (u *eventUI) ConfirmAction(prompt string) bool {
+	id, answer := u.srv.addPending()
+	defer u.srv.removePending(id)
+
+	u.emit(Event{Type: EventConfirm, ID: id, Prompt: prompt})
+	select {
+	case approved := <-answer:
+		return approved
+	case <-u.ctx.Done():
+		return false
+	}
+}
+
+// noopInterrupter satisfies ui.Interrupter when there is no terminal.
+type noopInterrupter struct{}
+
+func (noopInterrupter) Stop()   {}
+func (noopInterrupter) Pause()  {}
+func (noopInterrupter) Resume() {}
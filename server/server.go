@@ -0,0 +1,217 @@
+// Package server exposes an Agent over a local HTTP API, so editors and
+// extensions can drive Pilot without the terminal REPL.
+//
+// Endpoints:
+//
+//	POST /message   {"text": "..."} runs a turn, streaming Events as SSE
+//	POST /confirm   {"id": 1, "approve": true} answers a confirm event
+//	POST /cancel    cancels the running turn
+//	GET  /context   context window usage
+//	GET  /sessions  saved sessions for the working directory
+//
+// Only one turn runs at a time. Requests must come from localhost and
+// carry no Origin header, so web pages cannot drive the agent.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+)
+
+// Server serves one Agent.
+type Server struct {
+	agent   *agent.Agent
+	workDir string
+
+	turnMu   sync.Mutex // held while a turn runs
+	cancelMu sync.Mutex
+	cancel   context.CancelFunc // cancels the running turn, if any
+
+	pendingMu sync.Mutex
+	nextID    int
+	pending   map[int]chan bool // open confirmations by event ID
+}
+
+// New returns a server for ag, whose sessions are stored for workDir.
+func New(ag *agent.Agent, workDir string) *Server {
+	return &Server{agent: ag, workDir: workDir, pending: make(map[int]chan bool)}
+}
+
+// Handler returns the HTTP handler for the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /message", s.handleMessage)
+	mux.HandleFunc("POST /confirm", s.handleConfirm)
+	mux.HandleFunc("POST /cancel", s.handleCancel)
+	mux.HandleFunc("GET /context", s.handleContext)
+	mux.HandleFunc("GET /sessions", s.handleSessions)
+	return localOnly(mux)
+}
+
+// localOnly rejects requests that did not come from a local, non-browser
+// client: the Host must be a loopback name (which defeats DNS rebinding) and
+// there must be no Origin header (which browsers send on cross-site requests).
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		ip := net.ParseIP(host)
+		if host != "localhost" && (ip == nil || !ip.IsLoopback()) || r.Header.Get("Origin") != "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type messageRequest struct {
+	Text string `json:"text"`
+}
+
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	var req messageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		http.Error(w, `want {"text": "..."}`, http.StatusBadRequest)
+		return
+	}
+	if !s.turnMu.TryLock() {
+		http.Error(w, "a turn is already running", http.StatusConflict)
+		return
+	}
+	defer s.turnMu.Unlock()
+
+	// Closing the request cancels the turn, as does POST /cancel
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	s.cancelMu.Lock()
+	s.cancel = cancel
+	s.cancelMu.Unlock()
+	defer func() {
+		s.cancelMu.Lock()
+		s.cancel = nil
+		s.cancelMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f, _ := w.(http.Flusher)
+	events := &eventUI{srv: s, ctx: ctx, w: w, f: f}
+
+	s.agent.CreateCheckpoint(req.Text)
+	err := s.agent.Run(ctx, req.Text, events)
+	if changes := s.agent.TurnFileChanges(); len(changes) > 0 {
+		events.emit(Event{Type: EventFileChanges, Changes: changes})
+	}
+	if saveErr := s.agent.SaveSession(); saveErr != nil {
+		events.emit(Event{Type: EventWarning, Text: "Session save failed: " + saveErr.Error()})
+	}
+
+	done := Event{Type: EventDone}
+	switch {
+	case errors.Is(err, context.Canceled) || ctx.Err() != nil:
+		done.Error = "cancelled"
+	case err != nil:
+		done.Error = err.Error()
+	}
+	events.emit(done)
+}
+
+type confirmRequest struct {
+	ID      int  `json:"id"`
+	Approve bool `json:"approve"`
+}
+
+func (s *Server) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	var req confirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `want {"id": n, "approve": bool}`, http.StatusBadRequest)
+		return
+	}
+
+	s.pendingMu.Lock()
+	answer, ok := s.pending[req.ID]
+	delete(s.pending, req.ID)
+	s.pendingMu.Unlock()
+	if !ok {
+		http.Error(w, "no pending confirmation with that id", http.StatusNotFound)
+		return
+	}
+	answer <- req.Approve
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	s.cancelMu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.cancelMu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// contextResponse is the body of GET /context.
+type contextResponse struct {
+	TotalTokens   int `json:"total_tokens"`
+	ContextWindow int `json:"context_window"`
+	Threshold     int `json:"threshold"`
+	MessageCount  int `json:"message_count"`
+	SystemTokens  int `json:"system_tokens"`
+	ToolDefTokens int `json:"tool_def_tokens"`
+	MessageTokens int `json:"message_tokens"`
+	ActualTokens  int `json:"actual_tokens"`
+}
+
+func (s *Server) handleContext(w http.ResponseWriter, r *http.Request) {
+	// Agent state is only read between turns
+	if !s.turnMu.TryLock() {
+		http.Error(w, "a turn is running", http.StatusConflict)
+		return
+	}
+	stats := s.agent.ContextUsage()
+	s.turnMu.Unlock()
+
+	writeJSON(w, contextResponse(stats))
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := agent.ListSessions(s.workDir, 0)
+	if err != nil {
+		http.Error(w, "list sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []agent.SessionMeta{}
+	}
+	writeJSON(w, sessions)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// addPending opens a confirmation and returns its ID and answer channel.
+func (s *Server) addPending() (int, chan bool) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.nextID++
+	answer := make(chan bool, 1)
+	s.pending[s.nextID] = answer
+	return s.nextID, answer
+}
+
+// removePending closes a confirmation that is no longer waiting.
+func (s *Server) removePending(id int) {
+	s.pendingMu.Lock()
+	delete(s.pending, id)
+	s.pendingMu.Unlock()
+}
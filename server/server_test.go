@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lowkaihon/cli-coding-agent/agent"
+	"github.com/lowkaihon/cli-coding-agent/llm"
+	"github.com/lowkaihon/cli-coding-agent/tools"
+)
+
+// scriptedClient streams its responses in order, then plain "done" replies.
+type scriptedClient struct {
+	responses []llm.Response
+	calls     int32
+}
+
+func (c *scriptedClient) SendMessage(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (*llm.Response, error) {
+	return &llm.Response{Message: llm.TextMessage("assistant", "done"), FinishReason: "stop"}, nil
+}
+
+func (c *scriptedClient) StreamMessage(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (<-chan llm.StreamEvent, error) {
+	idx := int(atomic.AddInt32(&c.calls, 1)) - 1
+	resp := llm.Response{Message: llm.TextMessage("assistant", "done"), FinishReason: "stop"}
+	if idx < len(c.responses) {
+		resp = c.responses[idx]
+	}
+
+	ch := make(chan llm.StreamEvent, 10)
+	go func() {
+		defer close(ch)
+		if text := resp.Message.ContentString(); text != "" {
+			ch <- llm.StreamEvent{TextDelta: text}
+		}
+		for i, tc := range resp.Message.ToolCalls {
+			var d llm.ToolCallDelta
+			d.Index, d.ID = i, tc.ID
+			d.Function.Name, d.Function.Arguments = tc.Function.Name, tc.Function.Arguments
+			ch <- llm.StreamEvent{ToolCallDeltas: []llm.ToolCallDelta{d}}
+		}
+		ch <- llm.StreamEvent{FinishReason: resp.FinishReason, Done: true}
+	}()
+	return ch, nil
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *scriptedClient, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	client := &scriptedClient{}
+	ag := agent.New(client, tools.NewRegistry(dir), dir, 128000)
+	ts := httptest.NewServer(New(ag, dir).Handler())
+	t.Cleanup(ts.Close)
+	return ts, client, dir
+}
+
+// runTurn posts a message and returns the turn's events. onEvent, if set,
+// sees each event as it arrives.
+func runTurn(t *testing.T, ts *httptest.Server, text string, onEvent func(Event)) []Event {
+	t.Helper()
+	body, _ := json.Marshal(messageRequest{Text: text})
+	resp, err := http.Post(ts.URL+"/message", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("post message: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var events []Event
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("bad event %q: %v", data, err)
+		}
+		events = append(events, ev)
+		if onEvent != nil {
+			onEvent(ev)
+		}
+	}
+	return events
+}
+
+func eventTypes(events []Event) []string {
+	var types []string
+	for _, ev := range events {
+		if ev.Type != EventThinking {
+			types = append(types, ev.Type)
+		}
+	}
+	return types
+}
+
+func TestMessageStreamsTurn(t *testing.T) {
+	ts, client, _ := newTestServer(t)
+	client.responses = []llm.Response{{Message: llm.TextMessage("assistant", "Hello!"), FinishReason: "stop"}}
+
+	events := runTurn(t, ts, "hi", nil)
+	got := strings.Join(eventTypes(events), ",")
+	if got != "assistant,assistant_done,done" {
+		t.Fatalf("unexpected events: %s", got)
+	}
+	if events[1].Text != "Hello!" || events[len(events)-1].Error != "" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	resp, err := http.Get(ts.URL + "/context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usage contextResponse
+	json.NewDecoder(resp.Body).Decode(&usage)
+	resp.Body.Close()
+	if usage.MessageCount != 3 || usage.ContextWindow != 128000 {
+		t.Errorf("unexpected context usage: %+v", usage)
+	}
+
+	resp, err = http.Get(ts.URL + "/sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sessions []agent.SessionMeta
+	json.NewDecoder(resp.Body).Decode(&sessions)
+	resp.Body.Close()
+	if len(sessions) != 1 || sessions[0].Preview != "hi" {
+		t.Errorf("expected the turn's session to be saved, got %+v", sessions)
+	}
+}
+
+func TestMessageConfirmation(t *testing.T) {
+	for _, approve := range []bool{true, false} {
+		t.Run(fmt.Sprintf("approve=%v", approve), func(t *testing.T) {
+			ts, client, dir := newTestServer(t)
+			// File tracking resolves paths against the process directory,
+			// which pilot serve shares with the agent but the test does not
+			writeArgs, _ := json.Marshal(map[string]string{"path": filepath.Join(dir, "out.txt"), "content": "hi\n"})
+			client.responses = []llm.Response{{
+				Message: llm.AssistantMessage(nil, []llm.ToolCall{{
+					ID: "call_1", Type: "function",
+					Function: llm.FunctionCall{Name: "write", Arguments: string(writeArgs)},
+				}}),
+				FinishReason: "tool_calls",
+			}}
+
+			events := runTurn(t, ts, "write a file", func(ev Event) {
+				if ev.Type != EventConfirm {
+					return
+				}
+				body, _ := json.Marshal(confirmRequest{ID: ev.ID, Approve: approve})
+				resp, err := http.Post(ts.URL+"/confirm", "application/json", strings.NewReader(string(body)))
+				if err != nil {
+					t.Errorf("post confirm: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusNoContent {
+					t.Errorf("confirm: expected 204, got %d", resp.StatusCode)
+				}
+			})
+
+			want := "tool_call,file_preview,confirm,tool_result,assistant,assistant_done,done"
+			if approve {
+				want = "tool_call,file_preview,confirm,tool_result,assistant,assistant_done,file_changes,done"
+			}
+			if got := strings.Join(eventTypes(events), ","); got != want {
+				t.Fatalf("unexpected events:\n got %s\nwant %s", got, want)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "out.txt"))
+			if approve && err != nil {
+				t.Errorf("expected file written after approval: %v", err)
+			}
+			if !approve && err == nil {
+				t.Error("expected no file after denial")
+			}
+			for _, ev := range events {
+				if ev.Type == EventFileChanges && (len(ev.Changes) != 1 || ev.Changes[0].Path != "out.txt" || ev.Changes[0].Kind != agent.FileCreated) {
+					t.Errorf("unexpected file changes: %+v", ev.Changes)
+				}
+			}
+		})
+	}
+}
+
+func TestConfirmUnknownID(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+	resp, err := http.Post(ts.URL+"/confirm", "application/json", strings.NewReader(`{"id": 42, "approve": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestLocalOnly(t *testing.T) {
+	ts, _, _ := newTestServer(t)
+
+	tests := map[string]func(*http.Request){
+		"browser origin": func(r *http.Request) { r.Header.Set("Origin", "https://example.com") },
+		"foreign host":   func(r *http.Request) { r.Host = "example.com" },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", ts.URL+"/context", nil)
+			modify(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("expected 403, got %d", resp.StatusCode)
+			}
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected local request to succeed, got %d", resp.StatusCode)
+	}
+}
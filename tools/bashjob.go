@@ -0,0 +1,299 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxJobOutput caps the output a bash command keeps for bash_output.
+	maxJobOutput = 1 << 20
+	// maxJobWait caps how long bash_output waits for a job to exit.
+	maxJobWait = 60
+)
+
+type bashOutputInput struct {
+	JobID int  `json:"job_id"`
+	Wait  int  `json:"wait"`
+	Kill  bool `json:"kill"`
+}
+
+// bashJob is a running or finished bash command whose output is collected
+// as it arrives, so it can be handed to the model in parts.
+type bashJob struct {
+	id       int // set when the job moves to the background
+	command  string
+	timeout  time.Duration
+	cmd      *exec.Cmd
+	done     chan struct{} // closed once the command has exited
+	err      error         // result of Wait; read only after done
+	timedOut atomic.Bool
+
+	mu      sync.Mutex
+	output  []byte
+	dropped bool // output past maxJobOutput was discarded
+	read    int  // bytes of output already returned to the model
+}
+
+// Write collects command output, keeping at most maxJobOutput bytes.
+func (j *bashJob) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	room := maxJobOutput - len(j.output)
+	if len(p) > room {
+		j.dropped = true
+		j.output = append(j.output, p[:max(room, 0)]...)
+	} else {
+		j.output = append(j.output, p...)
+	}
+	return len(p), nil
+}
+
+// take returns up to n bytes of output not yet returned, and whether more
+// is waiting after them.
+func (j *bashJob) take(n int) (chunk string, more bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	end := min(j.read+n, len(j.output))
+	chunk = string(j.output[j.read:end])
+	j.read = end
+	return chunk, end < len(j.output)
+}
+
+// kill stops the command; its exit is still reported through done.
+func (j *bashJob) kill() {
+	j.cmd.Process.Kill()
+}
+
+// exited reports whether the command has exited.
+func (j *bashJob) exited() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// status describes how the command ended. Call it only after done.
+func (j *bashJob) status() string {
+	switch {
+	case j.timedOut.Load():
+		return fmt.Sprintf("timed out after %ds", int(j.timeout.Seconds()))
+	case j.err != nil:
+		return "exited: " + j.err.Error()
+	default:
+		return "exited with code 0"
+	}
+}
+
+// result formats a command that finished in the foreground the way the bash
+// tool always has: its output, capped at maxOutputChars, after the exit code
+// or timeout if it failed.
+func (j *bashJob) result() string {
+	output, truncated := j.take(maxOutputChars)
+	var result string
+	switch {
+	case j.timedOut.Load():
+		result = fmt.Sprintf("Command timed out after %ds.\n%s", int(j.timeout.Seconds()), output)
+	case j.err != nil:
+		result = fmt.Sprintf("Exit code: %s\n%s", j.err, output)
+	default:
+		result = output
+		if result == "" {
+			result = "(no output)"
+		}
+	}
+	if truncated {
+		result += "\n[output truncated]"
+	}
+	return result
+}
+
+// startBashJob starts command in the working directory. It is killed after
+// timeout, or by Shutdown.
+func (r *Registry) startBashJob(command string, timeout time.Duration) (*bashJob, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("bash", "-c", command)
+	}
+	cmd.Dir = r.workDir
+	// Don't wait forever on output pipes held open by orphaned children
+	cmd.WaitDelay = time.Second
+
+	job := &bashJob{command: command, timeout: timeout, cmd: cmd, done: make(chan struct{})}
+	cmd.Stdout = job
+	cmd.Stderr = job
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	untrack := r.trackJob(cmd.Process)
+	timer := time.AfterFunc(timeout, func() {
+		job.timedOut.Store(true)
+		job.kill()
+	})
+	go func() {
+		job.err = cmd.Wait()
+		timer.Stop()
+		untrack()
+		close(job.done)
+	}()
+	return job, nil
+}
+
+// runBash runs command and returns its result. Cancelling ctx kills it. With
+// SetBashInterim, a command still running after the interim delay moves to
+// the background and the model gets its output so far instead, to follow up
+// on with bash_output.
+func (r *Registry) runBash(ctx context.Context, command string, timeout time.Duration) string {
+	job, err := r.startBashJob(command, timeout)
+	if err != nil {
+		return fmt.Sprintf("Exit code: %s\n", err)
+	}
+
+	var interim <-chan time.Time
+	if r.bashInterim > 0 {
+		t := time.NewTimer(r.bashInterim)
+		defer t.Stop()
+		interim = t.C
+	}
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		job.kill()
+		<-job.done
+	case <-interim:
+		if !job.exited() {
+			return r.handOff(job)
+		}
+		<-job.done
+	}
+	return job.result()
+}
+
+// handOff registers a running job for bash_output and returns the interim
+// result: what the command printed so far and how to get the rest.
+func (r *Registry) handOff(job *bashJob) string {
+	r.bgMu.Lock()
+	r.bgNext++
+	job.id = r.bgNext
+	if r.bgJobs == nil {
+		r.bgJobs = make(map[int]*bashJob)
+	}
+	r.bgJobs[job.id] = job
+	r.bgMu.Unlock()
+
+	output, more := job.take(maxOutputChars)
+	if output == "" {
+		output = "(no output yet)"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Command still running after %s; it continues in the background as job %d.\nOutput so far:\n%s\n", r.bashInterim, job.id, output)
+	if more {
+		b.WriteString("[more output waiting]\n")
+	}
+	fmt.Fprintf(&b, "[Call bash_output with job_id=%d for new output and the exit status (wait=N waits up to N seconds for it to exit), or kill=true to stop it. It is killed after its %ds timeout.]",
+		job.id, int(job.timeout.Seconds()))
+	return b.String()
+}
+
+func (r *Registry) bashOutputTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[bashOutputInput](input)
+	if err != nil {
+		return "", err
+	}
+	r.bgMu.Lock()
+	job := r.bgJobs[params.JobID]
+	r.bgMu.Unlock()
+	if job == nil {
+		return "", fmt.Errorf("no background job %d", params.JobID)
+	}
+
+	if params.Kill && !job.exited() {
+		job.kill()
+		<-job.done
+	}
+	if wait := min(params.Wait, maxJobWait); wait > 0 && !job.exited() {
+		t := time.NewTimer(time.Duration(wait) * time.Second)
+		select {
+		case <-job.done:
+		case <-t.C:
+		case <-ctx.Done():
+		}
+		t.Stop()
+	}
+
+	status := "running"
+	if job.exited() {
+		status = job.status()
+	}
+	output, more := job.take(maxOutputChars)
+	if output == "" {
+		output = "(no new output)"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Job %d (%s): %s\n%s", job.id, job.command, status, output)
+	if more {
+		b.WriteString("\n[more output waiting; call bash_output again]")
+	} else if job.dropped && job.exited() {
+		b.WriteString("\n[output truncated]")
+	}
+	return b.String(), nil
+}
+
+// SetBashInterim sets how long a bash command may run before it moves to
+// the background and the model gets its output so far (0 disables it, the
+// default). Enabling it adds the bash_output tool after bash.
+func (r *Registry) SetBashInterim(d time.Duration) {
+	r.bashInterim = max(d, 0)
+	if (d > 0) == r.HasTool("bash_output") {
+		return
+	}
+	if d <= 0 {
+		r.tools = slices.DeleteFunc(r.tools, func(t toolEntry) bool { return t.name == "bash_output" })
+		return
+	}
+	r.registerBashOutput()
+	// Move it from the end to just after bash
+	entry := r.tools[len(r.tools)-1]
+	r.tools = r.tools[:len(r.tools)-1]
+	at := slices.IndexFunc(r.tools, func(t toolEntry) bool { return t.name == "bash" }) + 1
+	r.tools = slices.Insert(r.tools, at, entry)
+}
+
+// registerBashOutput registers the bash_output tool for commands that
+// outlast the interim delay.
+func (r *Registry) registerBashOutput() {
+	r.register("bash_output",
+		"Get new output and the exit status of a bash command that moved to the background because it was still running. Each call returns only output not seen before. Use wait to block until the job exits instead of polling repeatedly, and kill to stop a job you no longer need.",
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"job_id": {
+					"type": "integer",
+					"description": "Job number from the bash result"
+				},
+				"wait": {
+					"type": "integer",
+					"description": "Seconds to wait for the job to exit before returning (default: 0, max: 60)"
+				},
+				"kill": {
+					"type": "boolean",
+					"description": "Stop the job (default: false)"
+				}
+			},
+			"required": ["job_id"]
+		}`),
+		r.bashOutputTool,
+	)
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// chunkTailBytes is how much of the end of the staged content a write_chunk
+// result quotes, so the model can pick up exactly where it left off.
+const chunkTailBytes = 80
+
+type writeChunkInput struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Final   bool   `json:"final"`
+	Restart bool   `json:"restart"`
+}
+
+// chunkedWrite is a file the model is writing in parts with write_chunk.
+// The parts are appended to a temp file outside the project and kept across
+// turns, so a cancelled turn loses none of them.
+type chunkedWrite struct {
+	tmpPath string
+	chunks  int
+	size    int
+	tail    string // last chunkTailBytes of the content so far
+}
+
+func (r *Registry) writeChunkTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[writeChunkInput](input)
+	if err != nil {
+		return "", err
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	absPath, err := ValidatePath(r.workDir, params.Path)
+	if err != nil {
+		return "", err
+	}
+	if err := r.checkProtected(absPath); err != nil {
+		return "", err
+	}
+
+	if params.Restart {
+		r.discardChunks(absPath)
+	}
+	if params.Content != "" {
+		if err := r.appendChunk(absPath, params.Content); err != nil {
+			return "", err
+		}
+	}
+	cw, ok := r.stagedChunks(absPath)
+	if !ok {
+		if params.Final {
+			return "", fmt.Errorf("nothing staged for %s; send its content with write_chunk first", params.Path)
+		}
+		return fmt.Sprintf("Nothing staged for %s.", params.Path), nil
+	}
+	if !params.Final {
+		return fmt.Sprintf("Staged chunk %d for %s (%d bytes so far, ending with %q). Send the next chunk, or final=true to write the file.",
+			cw.chunks, params.Path, cw.size, cw.tail), nil
+	}
+
+	data, err := os.ReadFile(cw.tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("read staged chunks: %w", err)
+	}
+	confirm, err := r.writeConfirmation(params.Path, absPath, string(data))
+	if err != nil {
+		return "", err
+	}
+	// The chunks stay staged until the file is written, so a denied or
+	// failed write can be retried without sending them again
+	write := confirm.Execute
+	confirm.Execute = func() (string, error) {
+		result, err := write()
+		if err == nil {
+			r.discardChunks(absPath)
+		}
+		return result, err
+	}
+	return "", confirm
+}
+
+// appendChunk appends content to the chunks staged for absPath, starting a
+// new staged file if there is none.
+func (r *Registry) appendChunk(absPath, content string) error {
+	r.chunkMu.Lock()
+	defer r.chunkMu.Unlock()
+	cw := r.chunks[absPath]
+	if cw == nil {
+		f, err := os.CreateTemp("", "pilot-chunks-*")
+		if err != nil {
+			return fmt.Errorf("stage chunk: %w", err)
+		}
+		f.Close()
+		cw = &chunkedWrite{tmpPath: f.Name()}
+		if r.chunks == nil {
+			r.chunks = make(map[string]*chunkedWrite)
+		}
+		r.chunks[absPath] = cw
+	}
+
+	f, err := os.OpenFile(cw.tmpPath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("stage chunk: %w", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return fmt.Errorf("stage chunk: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("stage chunk: %w", err)
+	}
+	cw.chunks++
+	cw.size += len(content)
+	cw.tail = tailText(cw.tail+content, chunkTailBytes)
+	return nil
+}
+
+// stagedChunks returns the state of the chunks staged for absPath, if any.
+func (r *Registry) stagedChunks(absPath string) (chunkedWrite, bool) {
+	r.chunkMu.Lock()
+	defer r.chunkMu.Unlock()
+	cw, ok := r.chunks[absPath]
+	if !ok {
+		return chunkedWrite{}, false
+	}
+	return *cw, true
+}
+
+// discardChunks drops the chunks staged for absPath.
+func (r *Registry) discardChunks(absPath string) {
+	r.chunkMu.Lock()
+	defer r.chunkMu.Unlock()
+	if cw, ok := r.chunks[absPath]; ok {
+		os.Remove(cw.tmpPath)
+		delete(r.chunks, absPath)
+	}
+}
+
+// removeChunks deletes every staged chunk file.
+func (r *Registry) removeChunks() {
+	r.chunkMu.Lock()
+	defer r.chunkMu.Unlock()
+	for _, cw := range r.chunks {
+		os.Remove(cw.tmpPath)
+	}
+	r.chunks = nil
+}
+
+// tailText returns at most the last n bytes of s, starting on a whole
+// character.
+func tailText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[len(s)-n:]
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
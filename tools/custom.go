@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CustomTool is a user-defined tool backed by a shell command, loaded from a
+// JSON file by LoadCustomTools.
+type CustomTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"` // JSON schema of the input; defaults to an empty object
+	// Command is run with each {{arg}} replaced by that input value, quoted
+	// for the shell. Missing arguments become empty strings.
+	Command string `json:"command"`
+}
+
+var (
+	customToolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	placeholder    = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+)
+
+// LoadCustomTools reads every *.json file in dir as a CustomTool, in name
+// order. A missing directory is not an error.
+func LoadCustomTools(dir string) ([]CustomTool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var defs []CustomTool
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read custom tool: %w", err)
+		}
+		var def CustomTool
+		if err := json.Unmarshal(data, &def); err != nil {
+			return nil, fmt.Errorf("parse custom tool %s: %w", filepath.Base(file), err)
+		}
+		if err := def.validate(); err != nil {
+			return nil, fmt.Errorf("custom tool %s: %w", filepath.Base(file), err)
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+func (t *CustomTool) validate() error {
+	if !customToolName.MatchString(t.Name) {
+		return fmt.Errorf("invalid name %q: want letters, digits, _ or -", t.Name)
+	}
+	if strings.TrimSpace(t.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if len(t.Schema) == 0 {
+		t.Schema = json.RawMessage(`{"type": "object", "properties": {}}`)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(t.Schema, &schema); err != nil {
+		return fmt.Errorf("schema must be a JSON object: %w", err)
+	}
+	return nil
+}
+
+// AddCustomTools registers user-defined tools after the built-in ones. Like
+// bash, each call needs the user's confirmation before its command runs.
+func (r *Registry) AddCustomTools(defs []CustomTool) error {
+	for _, def := range defs {
+		if r.HasTool(def.Name) {
+			return fmt.Errorf("custom tool %q conflicts with an existing tool", def.Name)
+		}
+		r.register(def.Name, def.Description, def.Schema, func(ctx context.Context, input json.RawMessage) (string, error) {
+			return r.customTool(ctx, def, input)
+		})
+	}
+	return nil
+}
+
+func (r *Registry) customTool(ctx context.Context, def CustomTool, input json.RawMessage) (string, error) {
+	args, err := parseInput[map[string]json.RawMessage](input)
+	if err != nil {
+		return "", err
+	}
+	command := expandCommand(def.Command, args)
+
+	return "", &NeedsConfirmation{
+		Tool:    def.Name,
+		Path:    command,
+		Preview: command,
+		Execute: func() (string, error) {
+			return r.runCustomCommand(ctx, command)
+		},
+	}
+}
+
+// expandCommand replaces each {{name}} in template with the shell-quoted
+// value of args[name]: strings as they are, other values as JSON text.
+func expandCommand(template string, args map[string]json.RawMessage) string {
+	return placeholder.ReplaceAllStringFunc(template, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		raw, ok := args[name]
+		if !ok || string(raw) == "null" {
+			return shellQuote("")
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		return shellQuote(s)
+	})
+}
+
+// runCustomCommand runs command in the working directory and returns its
+// stdout. A failure is returned as an error that includes stderr.
+func (r *Registry) runCustomCommand(ctx context.Context, command string) (string, error) {
+	timeout := time.Duration(maxTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", "-c", command)
+	}
+	cmd.Dir = r.workDir
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	if err == nil {
+		untrack := r.trackJob(cmd.Process)
+		err = cmd.Wait()
+		untrack()
+	}
+
+	output := stdout.String()
+	if len(output) > maxOutputChars {
+		output = output[:maxOutputChars] + "\n[output truncated]"
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("timed out after %s\n%s", timeout, output)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w\n%s%s", err, output, strings.TrimSpace(stderr.String()))
+	}
+	if output == "" {
+		return "(no output)", nil
+	}
+	return output, nil
+}
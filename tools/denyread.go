@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDenyRead are the files read, grep, and glob refuse unless
+// SetDenyRead is given others: dotenv files and SSH keys, which hold secrets
+// that would otherwise be sent to the model.
+var DefaultDenyRead = []string{".env", ".env.*", ".ssh", "id_rsa", "id_dsa", "id_ecdsa", "id_ed25519"}
+
+// SetDenyRead sets the files read, grep, and glob refuse, even inside the
+// working directory. An entry with a path separator is a path (absolute, or
+// relative to the working directory) and covers everything under it; any
+// other entry is a filepath.Match pattern matched against the name of the
+// file and of each directory above it, so ".ssh" covers a whole directory.
+func (r *Registry) SetDenyRead(entries []string) {
+	r.denyRead = nil
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if strings.ContainsAny(e, `/\`) {
+			if !filepath.IsAbs(e) {
+				e = filepath.Join(r.workDir, e)
+			}
+			e = resolvePath(filepath.Clean(e))
+		}
+		r.denyRead = append(r.denyRead, e)
+	}
+}
+
+// DenyRead returns the entries set by SetDenyRead, with paths made
+// absolute, so a registry rooted elsewhere can share them.
+func (r *Registry) DenyRead() []string {
+	return r.denyRead
+}
+
+// readDenied returns the deny-read entry covering absPath, or "" if it may
+// be read.
+func (r *Registry) readDenied(absPath string) string {
+	if len(r.denyRead) == 0 {
+		return ""
+	}
+	resolved := resolvePath(absPath)
+	var names []string
+	if rel, err := filepath.Rel(r.workDir, absPath); err == nil {
+		names = strings.Split(filepath.ToSlash(rel), "/")
+	}
+	for _, e := range r.denyRead {
+		if filepath.IsAbs(e) {
+			if resolved == e || strings.HasPrefix(resolved, e+string(filepath.Separator)) {
+				return e
+			}
+			continue
+		}
+		for _, name := range names {
+			if ok, _ := filepath.Match(e, name); ok {
+				return e
+			}
+		}
+	}
+	return ""
+}
+
+// checkReadable returns an error if absPath, a file the read tool would
+// show the model, is on the deny-read list.
+func (r *Registry) checkReadable(absPath string) error {
+	if entry := r.readDenied(absPath); entry != "" {
+		return fmt.Errorf("refusing to read %s: it matches %q on the deny-read list because it may hold credentials; ask the user for any value you need from it", absPath, entry)
+	}
+	return nil
+}
+
+// deniedNote is the notice appended to grep and glob output when n files
+// or directories were left out because of the deny-read list.
+func deniedNote(n int) string {
+	if n == 1 {
+		return "\n[redacted: 1 path on the deny-read list was left out]"
+	}
+	return fmt.Sprintf("\n[redacted: %d paths on the deny-read list were left out]", n)
+}
@@ -30,13 +30,30 @@ func (r *Registry) editTool(ctx context.Context, input json.RawMessage) (string,
 	if err != nil {
 		return "", err
 	}
+	if err := r.checkProtected(absPath); err != nil {
+		return "", err
+	}
 
-	contentBytes, err := os.ReadFile(absPath)
+	content, enc, err := r.readText(absPath)
 	if err != nil {
-		return "", fmt.Errorf("read file: %w", err)
+		return "", err
+	}
+
+	newContent, err := replaceUnique(content, matchLineEndings(content, params))
+	if err != nil {
+		return "", err
 	}
-	content := string(contentBytes)
 
+	confirm, err := r.editConfirmation(absPath, params.Path, content, newContent, enc)
+	if err != nil {
+		return "", err
+	}
+	return "", confirm
+}
+
+// replaceUnique replaces the one occurrence of params.OldStr in content,
+// failing if it occurs zero or several times.
+func replaceUnique(content string, params editInput) (string, error) {
 	count := strings.Count(content, params.OldStr)
 	if count == 0 {
 		return "", fmt.Errorf("no match found for old_str in %s. Check for exact whitespace and indentation", params.Path)
@@ -54,12 +71,37 @@ func (r *Registry) editTool(ctx context.Context, input json.RawMessage) (string,
 		return "", fmt.Errorf("old_str matches %d times in %s (at %s). Include more surrounding context to make the match unique",
 			count, params.Path, strings.Join(locations, ", "))
 	}
+	return strings.Replace(content, params.OldStr, params.NewStr, 1), nil
+}
 
-	newContent := strings.Replace(content, params.OldStr, params.NewStr, 1)
+// matchLineEndings converts the edit's line breaks to CRLF when the file uses
+// them, since read shows lines without their \r. Strings that already contain
+// a \r are left as written.
+func matchLineEndings(content string, params editInput) editInput {
+	if !strings.Contains(content, "\r\n") {
+		return params
+	}
+	toCRLF := func(s string) string {
+		if strings.Contains(s, "\r") {
+			return s
+		}
+		return strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	params.OldStr = toCRLF(params.OldStr)
+	params.NewStr = toCRLF(params.NewStr)
+	return params
+}
 
-	return "", &NeedsConfirmation{
+// editConfirmation returns the confirmation that writes newContent over a
+// file whose current content is content, in the file's encoding enc.
+func (r *Registry) editConfirmation(absPath, path, content, newContent string, enc textEncoding) (*NeedsConfirmation, error) {
+	data, err := encodeText(newContent, enc)
+	if err != nil {
+		return nil, fmt.Errorf("%s is %s: %w", path, enc, err)
+	}
+	return &NeedsConfirmation{
 		Tool:       "edit",
-		Path:       params.Path,
+		Path:       path,
 		Preview:    content,
 		NewContent: newContent,
 		Execute: func() (string, error) {
@@ -68,11 +110,101 @@ func (r *Registry) editTool(ctx context.Context, input json.RawMessage) (string,
 				return "", fmt.Errorf("stat file: %w", err)
 			}
 
-			if err := AtomicWrite(absPath, []byte(newContent), info.Mode()); err != nil {
+			if err := AtomicWrite(absPath, data, info.Mode()); err != nil {
 				return "", fmt.Errorf("write file: %w", err)
 			}
+			r.index.invalidate(absPath)
 
-			return fmt.Sprintf("Successfully edited %s", params.Path), nil
+			return fmt.Sprintf("Successfully edited %s", path), nil
 		},
+	}, nil
+}
+
+// EditTarget returns the absolute path an edit call would modify, or "" if
+// the call is not an edit or its path is invalid.
+func (r *Registry) EditTarget(name string, input json.RawMessage) string {
+	if name != "edit" {
+		return ""
+	}
+	var params editInput
+	if err := json.Unmarshal(input, &params); err != nil || params.Path == "" {
+		return ""
+	}
+	absPath, err := ValidatePath(r.workDir, params.Path)
+	if err != nil {
+		return ""
+	}
+	return absPath
+}
+
+// EditBatch prepares several edit calls to the same file as one change. The
+// edits apply in order, each against the content the previous ones left, so
+// they need not be re-read from disk in between. errs[i] reports why edit i
+// was skipped; the returned confirmation covers the rest and is nil if every
+// edit failed.
+func (r *Registry) EditBatch(inputs []json.RawMessage) (*NeedsConfirmation, []error) {
+	errs := make([]error, len(inputs))
+	fail := func(err error) (*NeedsConfirmation, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return nil, errs
+	}
+	if len(inputs) == 0 {
+		return nil, errs
+	}
+
+	first, err := parseInput[editInput](inputs[0])
+	if err != nil {
+		return fail(err)
+	}
+	absPath, err := ValidatePath(r.workDir, first.Path)
+	if err == nil {
+		err = r.checkProtected(absPath)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	original, enc, err := r.readText(absPath)
+	if err != nil {
+		return fail(err)
+	}
+
+	content := original
+	applied := 0
+	for i, input := range inputs {
+		params, err := parseInput[editInput](input)
+		if err == nil && params.OldStr == "" {
+			err = fmt.Errorf("old_str is required")
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if path, _ := ValidatePath(r.workDir, params.Path); path != absPath {
+			errs[i] = fmt.Errorf("edit batch mixes %s and %s", first.Path, params.Path)
+			continue
+		}
+
+		params = matchLineEndings(content, params)
+		newContent, err := replaceUnique(content, params)
+		if err != nil && applied > 0 && strings.Count(original, params.OldStr) == 1 {
+			err = fmt.Errorf("old_str overlaps an earlier edit to %s in this response. Combine the overlapping edits into one", params.Path)
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		content = newContent
+		applied++
+	}
+
+	if applied == 0 {
+		return nil, errs
+	}
+	confirm, err := r.editConfirmation(absPath, first.Path, original, content, enc)
+	if err != nil {
+		return fail(err)
 	}
+	return confirm, errs
 }
@@ -0,0 +1,151 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// textEncoding is a character encoding read, write, and edit convert files
+// from and back to, so the model always works with UTF-8 text.
+type textEncoding string
+
+const (
+	encUTF8    textEncoding = "utf-8"
+	encUTF16LE textEncoding = "utf-16le"
+	encUTF16BE textEncoding = "utf-16be"
+	encLatin1  textEncoding = "latin-1"
+)
+
+// parseEncoding returns the encoding named by name, accepting common
+// spellings such as "UTF16LE" or "iso-8859-1". An empty name is UTF-8.
+func parseEncoding(name string) (textEncoding, error) {
+	switch strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(name))) {
+	case "", "utf8":
+		return encUTF8, nil
+	case "utf16le":
+		return encUTF16LE, nil
+	case "utf16be":
+		return encUTF16BE, nil
+	case "latin1", "iso88591":
+		return encLatin1, nil
+	}
+	return "", fmt.Errorf("unsupported encoding %q: want utf-8, utf-16le, utf-16be, or latin-1", name)
+}
+
+// bomEncoding returns the UTF-16 encoding data's byte order mark names, or
+// "" if it has none. A UTF-8 BOM needs no conversion and is not reported.
+func bomEncoding(data []byte) textEncoding {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return encUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return encUTF16BE
+	}
+	return ""
+}
+
+// decodeText converts data in enc to UTF-8. A byte order mark is kept as
+// U+FEFF at the start, so encodeText writes it back.
+func decodeText(data []byte, enc textEncoding) (string, error) {
+	switch enc {
+	case encUTF16LE, encUTF16BE:
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("not %s: odd number of bytes", enc)
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if enc == encUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units)), nil
+	case encLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	}
+	return string(data), nil
+}
+
+// encodeText converts UTF-8 text to enc. It fails on a character enc cannot
+// represent rather than writing a substitute. UTF-8 text is written as it is.
+func encodeText(text string, enc textEncoding) ([]byte, error) {
+	switch enc {
+	case encUTF16LE, encUTF16BE:
+		units := utf16.Encode([]rune(text))
+		data := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			if enc == encUTF16LE {
+				data = append(data, byte(u), byte(u>>8))
+			} else {
+				data = append(data, byte(u>>8), byte(u))
+			}
+		}
+		return data, nil
+	case encLatin1:
+		data := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xFF {
+				return nil, fmt.Errorf("%q cannot be encoded in latin-1", r)
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	}
+	return []byte(text), nil
+}
+
+// fileEncoding returns the encoding of absPath, whose content on disk is
+// data: UTF-16 if it starts with a byte order mark, else the encoding a read
+// with an explicit encoding chose, else UTF-8.
+func (r *Registry) fileEncoding(absPath string, data []byte) textEncoding {
+	if enc := bomEncoding(data); enc != "" {
+		return enc
+	}
+	r.encMu.Lock()
+	defer r.encMu.Unlock()
+	if enc, ok := r.encodings[absPath]; ok {
+		return enc
+	}
+	return encUTF8
+}
+
+// setFileEncoding records the encoding a read chose for absPath, so later
+// writes and edits of it re-encode their content the same way.
+func (r *Registry) setFileEncoding(absPath string, enc textEncoding) {
+	r.encMu.Lock()
+	defer r.encMu.Unlock()
+	if enc == encUTF8 {
+		delete(r.encodings, absPath)
+		return
+	}
+	if r.encodings == nil {
+		r.encodings = make(map[string]textEncoding)
+	}
+	r.encodings[absPath] = enc
+}
+
+// readText returns the content of absPath as UTF-8 text, staged content
+// taking precedence over the disk, and the encoding it is stored in.
+func (r *Registry) readText(absPath string) (string, textEncoding, error) {
+	data, diskErr := os.ReadFile(absPath)
+	enc := r.fileEncoding(absPath, data)
+	if content, ok := r.stagedContent(absPath); ok {
+		return content, enc, nil
+	}
+	if diskErr != nil {
+		return "", "", fmt.Errorf("read file: %w", diskErr)
+	}
+	text, err := decodeText(data, enc)
+	if err != nil {
+		return "", "", fmt.Errorf("read file: %w", err)
+	}
+	return text, enc, nil
+}
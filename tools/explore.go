@@ -4,11 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
 )
 
 // ExploreFunc is the callback signature for running a sub-agent exploration.
-// It receives a context and task description, returns the exploration summary.
-type ExploreFunc func(ctx context.Context, task string) (string, error)
+// It receives a context, task description, the absolute directory the
+// sub-agent is scoped to, any extra absolute directories it may read (see
+// SetExploreRoots), and the limits the caller asked for, and returns the
+// exploration summary.
+type ExploreFunc func(ctx context.Context, task, dir string, roots []string, limits ExploreLimits) (string, error)
+
+// ExploreLimits bounds one exploration. A zero field keeps the sub-agent's
+// configured default.
+type ExploreLimits struct {
+	MaxIterations int // model requests the sub-agent may make
+	MaxToolCalls  int // tool calls across the whole exploration
+}
 
 // SetExploreFunc injects the explore callback, breaking the circular dependency
 // between the tools and agent packages.
@@ -16,8 +28,25 @@ func (r *Registry) SetExploreFunc(fn ExploreFunc) {
 	r.exploreFunc = fn
 }
 
+// SetExplore adds or removes the explore tool. It is on by default; with it
+// off, the model has to research with glob, grep, and read itself.
+func (r *Registry) SetExplore(enabled bool) {
+	if enabled == r.HasTool("explore") {
+		return
+	}
+	if !enabled {
+		r.tools = slices.DeleteFunc(r.tools, func(t toolEntry) bool { return t.name == "explore" })
+		return
+	}
+	r.registerExplore()
+}
+
 type exploreInput struct {
-	Task string `json:"task"`
+	Task          string   `json:"task"`
+	Path          string   `json:"path"`
+	Roots         []string `json:"roots"`
+	MaxIterations int      `json:"max_iterations"`
+	MaxToolCalls  int      `json:"max_tool_calls"`
 }
 
 func (r *Registry) exploreTool(ctx context.Context, input json.RawMessage) (string, error) {
@@ -28,17 +57,48 @@ func (r *Registry) exploreTool(ctx context.Context, input json.RawMessage) (stri
 	if params.Task == "" {
 		return "", fmt.Errorf("task is required")
 	}
+	if params.MaxIterations < 0 || params.MaxToolCalls < 0 {
+		return "", argError("omit max_iterations and max_tool_calls to use the defaults, or pass positive numbers",
+			"max_iterations and max_tool_calls must not be negative")
+	}
 	if r.exploreFunc == nil {
 		return "", fmt.Errorf("explore sub-agent not configured")
 	}
 
-	return r.exploreFunc(ctx, params.Task)
+	dir := r.workDir
+	if params.Path != "" {
+		dir, err = ValidatePath(r.workDir, params.Path)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			return "", fmt.Errorf("stat path: %w", err)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("path %q is not a directory", params.Path)
+		}
+	}
+
+	var roots []string
+	for _, p := range params.Roots {
+		root, err := r.exploreRoot(p)
+		if err != nil {
+			return "", err
+		}
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+
+	limits := ExploreLimits{MaxIterations: params.MaxIterations, MaxToolCalls: params.MaxToolCalls}
+	return r.exploreFunc(ctx, params.Task, dir, roots, limits)
 }
 
 // NewReadOnlyRegistry creates a registry with only read-only tools (glob, grep, ls, read).
 // Used by the explore sub-agent to prevent file modifications.
 func NewReadOnlyRegistry(workDir string) *Registry {
-	r := &Registry{workDir: workDir}
+	r := &Registry{workDir: workDir, index: newGrepIndex()}
 	r.registerReadOnlyTools()
 	return r
 }
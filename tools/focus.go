@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// focusScope narrows the default search scope of glob, grep, and ls.
+type focusScope struct {
+	spec    string // relative to the working directory, with forward slashes
+	dir     string // absolute directory the walk starts from
+	pattern string // glob over relative paths files must match; "" for a plain directory
+}
+
+// SetFocus narrows glob, grep, and ls to spec when they are called without
+// a path: a directory under the working directory, or a glob over relative
+// paths such as "agent/**/*.go". An explicit path argument to grep or ls
+// still reaches the whole tree. An empty spec clears the focus.
+func (r *Registry) SetFocus(spec string) error {
+	if spec == "" {
+		r.focus = nil
+		return nil
+	}
+
+	if filepath.IsAbs(spec) {
+		rel, err := filepath.Rel(r.workDir, spec)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("path %q is outside the working directory", spec)
+		}
+		spec = rel
+	}
+	spec = filepath.ToSlash(filepath.Clean(spec))
+
+	base, pattern := spec, ""
+	if strings.ContainsAny(spec, "*?[") {
+		base, pattern = globBase(spec), spec
+		if _, err := filepath.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return fmt.Errorf("invalid focus pattern: %w", err)
+		}
+	}
+	dir, err := ValidatePath(r.workDir, base)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("focus: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("focus %q is not a directory", base)
+	}
+	r.focus = &focusScope{spec: spec, dir: dir, pattern: pattern}
+	return nil
+}
+
+// Focus returns the current focus, or "" if there is none.
+func (r *Registry) Focus() string {
+	if r.focus == nil {
+		return ""
+	}
+	return r.focus.spec
+}
+
+// focusDir returns the directory a default-scoped walk starts from.
+func (r *Registry) focusDir() string {
+	if r.focus == nil {
+		return r.workDir
+	}
+	return r.focus.dir
+}
+
+// inFocus reports whether rel, a slash-separated path relative to the working
+// directory, is within a focus pattern. Directory focus is enforced by where
+// the walk starts, so it always matches.
+func (r *Registry) inFocus(rel string) bool {
+	if r.focus == nil || r.focus.pattern == "" {
+		return true
+	}
+	ok, _ := matchGlob(r.focus.pattern, rel)
+	return ok
+}
+
+// focusNote describes the focus for results that may be narrowed by it.
+func (r *Registry) focusNote() string {
+	if r.focus == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (focused on %s)", r.focus.spec)
+}
+
+// globBase returns the leading directories of pattern before the first
+// segment with a wildcard, or "." if the first segment has one.
+func globBase(pattern string) string {
+	var dirs []string
+	for _, seg := range strings.Split(pattern, "/") {
+		if strings.ContainsAny(seg, "*?[") {
+			break
+		}
+		dirs = append(dirs, seg)
+	}
+	if len(dirs) == 0 {
+		return "."
+	}
+	return strings.Join(dirs, "/")
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// formatTimeout bounds each formatter run.
+const formatTimeout = 30 * time.Second
+
+// formatter runs command on files whose name matches pattern.
+type formatter struct {
+	pattern string
+	command string
+}
+
+// SetFormatters sets the commands run on a file after a write or edit. Each
+// entry is "pattern=command": pattern is a glob matched against the file
+// name (e.g. "*.go"), and command gets the file's path appended, as in
+// "gofmt -w" or "prettier --write". The first matching entry is used.
+func (r *Registry) SetFormatters(specs []string) error {
+	var formatters []formatter
+	for _, spec := range specs {
+		pattern, command, ok := strings.Cut(spec, "=")
+		pattern, command = strings.TrimSpace(pattern), strings.TrimSpace(command)
+		if !ok || pattern == "" || command == "" {
+			return fmt.Errorf("invalid formatter %q: want pattern=command", spec)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid formatter pattern %q: %w", pattern, err)
+		}
+		formatters = append(formatters, formatter{pattern: pattern, command: command})
+	}
+	r.formatters = formatters
+	return nil
+}
+
+// FormatCommand returns the command line that formats path, or "" if no
+// formatter matches it.
+func (r *Registry) FormatCommand(path string) string {
+	name := filepath.Base(path)
+	for _, f := range r.formatters {
+		if matched, _ := filepath.Match(f.pattern, name); matched {
+			return f.command + " " + shellQuote(path)
+		}
+	}
+	return ""
+}
+
+// RunFormatter runs the formatter for path in the working directory and
+// returns its output. A non-zero exit is returned as an error that includes
+// the output, for the model to act on.
+func (r *Registry) RunFormatter(ctx context.Context, path string) (string, error) {
+	command := r.FormatCommand(path)
+	if command == "" {
+		return "", fmt.Errorf("no formatter for %s", path)
+	}
+	ctx, cancel := context.WithTimeout(ctx, formatTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", "-c", command)
+	}
+	cmd.Dir = r.workDir
+	cmd.WaitDelay = time.Second
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Start()
+	if err == nil {
+		untrack := r.trackJob(cmd.Process)
+		err = cmd.Wait()
+		untrack()
+	}
+	if absPath, err := ValidatePath(r.workDir, path); err == nil {
+		r.index.invalidate(absPath)
+	}
+
+	output := strings.TrimSpace(buf.String())
+	if len(output) > maxOutputChars {
+		output = output[:maxOutputChars] + "\n[output truncated]"
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("timed out after %s\n%s", formatTimeout, output)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w\n%s", err, output)
+	}
+	return output, nil
+}
+
+// shellQuote quotes s as one argument for the shell RunFormatter uses.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,351 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitTimeout bounds each git invocation made by the git tools.
+const gitTimeout = 30 * time.Second
+
+type gitBranchInput struct {
+	All bool `json:"all"`
+}
+
+type gitCheckoutInput struct {
+	Branch string `json:"branch"`
+	Create bool   `json:"create"`
+	Force  bool   `json:"force"`
+}
+
+type gitCommitInput struct {
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+	All     bool     `json:"all"`
+}
+
+// gitInfoTimeout bounds the git calls of GitInfo, which runs every turn.
+const gitInfoTimeout = 2 * time.Second
+
+// gitCommitPreviewLines caps the staged diff shown when confirming a commit.
+const gitCommitPreviewLines = 400
+
+// runGit runs git with args in the working directory and returns its combined
+// output. A non-zero exit is returned as an error that includes the output.
+func (r *Registry) runGit(ctx context.Context, args ...string) (string, error) {
+	return r.runGitWith(ctx, nil, nil, args...)
+}
+
+// runGitWith is runGit with extra environment variables and standard input.
+func (r *Registry) runGitWith(ctx context.Context, env []string, stdin io.Reader, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.workDir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = stdin
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(buf.String())
+		if out == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], out)
+	}
+	return buf.String(), nil
+}
+
+// GitInfo describes the git repository containing the working directory.
+type GitInfo struct {
+	Root   string // repository root; "" outside a repository
+	Branch string // current branch; "" for a detached HEAD
+	Dirty  bool   // tracked files have uncommitted changes
+}
+
+// GitInfo returns the repository state of the working directory, or the zero
+// GitInfo outside a repository or without git. Untracked files are not
+// checked, which keeps it cheap in large trees.
+func (r *Registry) GitInfo() GitInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), gitInfoTimeout)
+	defer cancel()
+
+	root, err := r.runGit(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return GitInfo{}
+	}
+	status, err := r.runGit(ctx, "status", "--porcelain", "--branch", "--untracked-files=no")
+	if err != nil {
+		return GitInfo{}
+	}
+	info := GitInfo{Root: filepath.FromSlash(strings.TrimSpace(root))}
+	header, changes, _ := strings.Cut(status, "\n")
+	info.Branch = statusBranch(header)
+	info.Dirty = strings.TrimSpace(changes) != ""
+	return info
+}
+
+// statusBranch returns the branch named by the "## ..." header line of
+// git status --porcelain --branch, or "" for a detached HEAD.
+func statusBranch(header string) string {
+	header = strings.TrimPrefix(header, "## ")
+	for _, prefix := range []string{"No commits yet on ", "Initial commit on "} {
+		if rest, ok := strings.CutPrefix(header, prefix); ok {
+			return rest
+		}
+	}
+	if strings.HasPrefix(header, "HEAD (no branch)") {
+		return ""
+	}
+	branch, _, _ := strings.Cut(header, "...")
+	branch, _, _ = strings.Cut(branch, " ")
+	return branch
+}
+
+func (r *Registry) gitBranchTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[gitBranchInput](input)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"branch", "--list", "--format=%(HEAD) %(refname:short)"}
+	if params.All {
+		args = append(args, "--all")
+	}
+	out, err := r.runGit(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	current := "(detached HEAD)"
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "* "); ok && !strings.HasPrefix(name, "(") {
+			current = name
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	if sb.Len() == 0 {
+		return "No branches yet (repository has no commits).", nil
+	}
+	return fmt.Sprintf("Current branch: %s\n\n%s", current, sb.String()), nil
+}
+
+func (r *Registry) gitCheckoutTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[gitCheckoutInput](input)
+	if err != nil {
+		return "", err
+	}
+	if params.Branch == "" {
+		return "", fmt.Errorf("branch is required")
+	}
+	if strings.HasPrefix(params.Branch, "-") {
+		return "", fmt.Errorf("invalid branch name %q", params.Branch)
+	}
+	if _, err := r.runGit(ctx, "check-ref-format", "--branch", params.Branch); err != nil {
+		return "", fmt.Errorf("invalid branch name %q", params.Branch)
+	}
+
+	if !params.Force {
+		status, err := r.runGit(ctx, "status", "--porcelain")
+		if err != nil {
+			return "", err
+		}
+		if status = strings.TrimSpace(status); status != "" {
+			return "", fmt.Errorf("working tree has uncommitted changes; commit or stash them first, or set force to switch anyway:\n%s", status)
+		}
+	}
+
+	args := []string{"checkout"}
+	if params.Create {
+		args = append(args, "-b")
+	}
+	args = append(args, params.Branch)
+
+	return "", &NeedsConfirmation{
+		Tool:    "git_checkout",
+		Path:    params.Branch,
+		Preview: "git " + strings.Join(args, " "),
+		Execute: func() (string, error) {
+			out, err := r.runGit(ctx, args...)
+			if err != nil {
+				return fmt.Sprintf("Error: %s", err), nil
+			}
+			if out = strings.TrimSpace(out); out == "" {
+				out = fmt.Sprintf("Switched to branch %s", params.Branch)
+			}
+			return out, nil
+		},
+	}
+}
+
+// gitCommitTool commits the given files, every change (all), or what is
+// already staged. The staged diff is previewed against a scratch copy of the
+// index, so nothing is staged until the commit is approved. The message goes
+// to git on stdin, and the commit is never amended or forced.
+func (r *Registry) gitCommitTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[gitCommitInput](input)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(params.Message) == "" {
+		return "", fmt.Errorf("message is required")
+	}
+
+	var paths []string
+	for _, f := range params.Files {
+		if f == "" || strings.HasPrefix(f, "-") {
+			return "", fmt.Errorf("invalid file %q", f)
+		}
+		abs, err := ValidatePath(r.workDir, f)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(r.workDir, abs)
+		if rel == "." {
+			return "", fmt.Errorf("%q would stage every change; list the files, or set all only if the user asked to commit everything", f)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	if params.All && len(paths) > 0 {
+		return "", fmt.Errorf("set either files or all, not both")
+	}
+
+	// add stages the commit's changes; commit then records them. With files,
+	// the commit takes only those paths, leaving anything else staged alone.
+	var add, commit []string
+	target := "staged changes"
+	switch {
+	case len(paths) > 0:
+		add = append([]string{"add", "--"}, paths...)
+		commit = append([]string{"commit", "-F", "-", "--"}, paths...)
+		target = strings.Join(paths, ", ")
+	case params.All:
+		add = []string{"add", "-A"}
+		commit = []string{"commit", "-F", "-"}
+		target = "all changes"
+	default:
+		commit = []string{"commit", "-F", "-"}
+	}
+
+	stat, diff, err := r.stagedDiff(ctx, add, paths)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(stat) == "" {
+		if add == nil {
+			return "", fmt.Errorf("nothing is staged; pass the files to commit")
+		}
+		return "", fmt.Errorf("no changes to commit in %s", target)
+	}
+
+	return "", &NeedsConfirmation{
+		Tool:    "git_commit",
+		Path:    target,
+		Preview: commitPreview(params.Message, stat, diff),
+		Execute: func() (string, error) {
+			if add != nil {
+				if _, err := r.runGit(ctx, add...); err != nil {
+					return fmt.Sprintf("Error: %s", err), nil
+				}
+			}
+			out, err := r.runGitWith(ctx, nil, strings.NewReader(params.Message), commit...)
+			if err != nil {
+				return fmt.Sprintf("Error: %s", err), nil
+			}
+			return strings.TrimSpace(out), nil
+		},
+	}
+}
+
+// stagedDiff returns the stat and patch the commit would record: the index
+// as it is when add is nil, or a scratch copy of it after running add.
+func (r *Registry) stagedDiff(ctx context.Context, add, paths []string) (stat, diff string, err error) {
+	var env []string
+	if add != nil {
+		index, err := r.scratchIndex(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		defer os.Remove(index)
+		env = []string{"GIT_INDEX_FILE=" + index}
+		if _, err := r.runGitWith(ctx, env, nil, add...); err != nil {
+			return "", "", err
+		}
+	}
+	args := append([]string{"--"}, paths...)
+	if stat, err = r.runGitWith(ctx, env, nil, append([]string{"diff", "--cached", "--stat"}, args...)...); err != nil {
+		return "", "", err
+	}
+	if diff, err = r.runGitWith(ctx, env, nil, append([]string{"diff", "--cached"}, args...)...); err != nil {
+		return "", "", err
+	}
+	return stat, diff, nil
+}
+
+// scratchIndex copies the repository's index to a temp file, which is empty
+// if the repository has no index yet. The caller removes it.
+func (r *Registry) scratchIndex(ctx context.Context) (string, error) {
+	out, err := r.runGit(ctx, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	index := strings.TrimSpace(out)
+	if !filepath.IsAbs(index) {
+		index = filepath.Join(r.workDir, index)
+	}
+	data, err := os.ReadFile(index)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("read git index: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "pilot-index-*")
+	if err != nil {
+		return "", fmt.Errorf("create scratch index: %w", err)
+	}
+	defer f.Close()
+	if len(data) == 0 {
+		// git treats an empty file as a corrupt index, but a missing one as empty
+		os.Remove(f.Name())
+		return f.Name(), nil
+	}
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("write scratch index: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// commitPreview shows the message indented as git log does, then the stat
+// and patch, cut to gitCommitPreviewLines.
+func commitPreview(message, stat, diff string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		sb.WriteString("    " + line + "\n")
+	}
+	sb.WriteString("\n" + stat + "\n")
+
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	if len(lines) > gitCommitPreviewLines {
+		omitted := len(lines) - gitCommitPreviewLines
+		lines = append(lines[:gitCommitPreviewLines], fmt.Sprintf("... (%d more diff lines)", omitted))
+	}
+	sb.WriteString(strings.Join(lines, "\n"))
+	return sb.String()
+}
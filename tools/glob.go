@@ -24,8 +24,19 @@ func (r *Registry) globTool(ctx context.Context, input json.RawMessage) (string,
 
 	const maxResults = 100
 	var matches []string
+	denied := 0
 
-	err = filepath.WalkDir(r.workDir, func(path string, d os.DirEntry, err error) error {
+	// An absolute pattern may search a read root instead of the project
+	base, pattern, inRoot := r.workDir, params.Pattern, false
+	if root, rest, ok := r.globRoot(params.Pattern); ok {
+		base, pattern, inRoot = root, rest, true
+	}
+	walkDir := r.focusDir()
+	if inRoot {
+		walkDir = base
+	}
+
+	err = filepath.WalkDir(walkDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return nil // skip errors
 		}
@@ -35,7 +46,7 @@ func (r *Registry) globTool(ctx context.Context, input json.RawMessage) (string,
 
 		// Skip hidden directories and common ignores
 		if d.IsDir() {
-			if shouldSkipDir(d.Name()) {
+			if r.skipDir(d.Name()) {
 				return filepath.SkipDir
 			}
 			// Skip symlinks that point to directories
@@ -45,20 +56,24 @@ func (r *Registry) globTool(ctx context.Context, input json.RawMessage) (string,
 			return nil
 		}
 
-		rel, err := filepath.Rel(r.workDir, path)
+		rel, err := filepath.Rel(base, path)
 		if err != nil {
 			return nil
 		}
 		// Normalize to forward slashes for pattern matching
 		rel = filepath.ToSlash(rel)
 
-		matched, err := matchGlob(params.Pattern, rel)
+		matched, err := matchGlob(pattern, rel)
 		if err != nil {
 			return fmt.Errorf("invalid glob pattern: %w", err)
 		}
 
-		if matched {
-			matches = append(matches, rel)
+		if matched && (inRoot || r.inFocus(rel)) {
+			if r.readDenied(path) != "" {
+				denied++
+				return nil
+			}
+			matches = append(matches, r.displayPath(path))
 		}
 		return nil
 	})
@@ -67,8 +82,12 @@ func (r *Registry) globTool(ctx context.Context, input json.RawMessage) (string,
 		return "", err
 	}
 
+	note := ""
+	if denied > 0 {
+		note = deniedNote(denied)
+	}
 	if len(matches) == 0 {
-		return "No files matched the pattern.", nil
+		return "No files matched the pattern" + r.focusNote() + "." + note, nil
 	}
 
 	var result strings.Builder
@@ -87,6 +106,7 @@ func (r *Registry) globTool(ctx context.Context, input json.RawMessage) (string,
 	if truncated {
 		result.WriteString(fmt.Sprintf("\n... and %d more matches", len(matches)-maxResults))
 	}
+	result.WriteString(note)
 
 	return result.String(), nil
 }
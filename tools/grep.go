@@ -8,15 +8,28 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type grepInput struct {
-	Pattern string `json:"pattern"`
-	Path    string `json:"path"`
-	Include string `json:"include"`
+	Pattern    string `json:"pattern"`
+	Path       string `json:"path"`
+	Include    string `json:"include"`
+	Before     *int   `json:"before"`
+	After      *int   `json:"after"`
+	Context    int    `json:"context"`
+	IgnoreCase bool   `json:"ignore_case"`
+	Word       bool   `json:"word"`
 }
 
+// maxGrepContext caps the context lines shown on each side of a match.
+const maxGrepContext = 10
+
+// maxGrepResults is how many matching lines grep shows; context lines do
+// not count toward it.
+const maxGrepResults = 50
+
 func (r *Registry) grepTool(ctx context.Context, input json.RawMessage) (string, error) {
 	params, err := parseInput[grepInput](input)
 	if err != nil {
@@ -26,23 +39,45 @@ func (r *Registry) grepTool(ctx context.Context, input json.RawMessage) (string,
 		return "", fmt.Errorf("pattern is required")
 	}
 
-	re, err := regexp.Compile(params.Pattern)
+	pattern := params.Pattern
+	if params.Word {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if params.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
 	if err != nil {
 		return "", fmt.Errorf("invalid regex (RE2 syntax): %w", err)
 	}
 
-	searchDir := r.workDir
+	// before and after override context, as ripgrep's -B and -A do -C
+	out := grepOutput{before: params.Context, after: params.Context}
+	if params.Before != nil {
+		out.before = *params.Before
+	}
+	if params.After != nil {
+		out.after = *params.After
+	}
+	if out.before < 0 || out.after < 0 {
+		return "", argError("omit context, before, and after for matching lines only, or pass 0 to "+strconv.Itoa(maxGrepContext),
+			"context, before, and after must not be negative")
+	}
+	out.before, out.after = min(out.before, maxGrepContext), min(out.after, maxGrepContext)
+
+	// Trigrams every match must contain let the index skip files without reading them
+	required := requiredTrigrams(pattern)
+
+	searchDir, focused := r.focusDir(), true
 	if params.Path != "" {
-		searchDir, err = ValidatePath(r.workDir, params.Path)
+		focused = false
+		searchDir, err = r.readPath(params.Path)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	const maxResults = 50
-	var results []string
-	totalMatches := 0
-
+	denied := 0
 	err = filepath.WalkDir(searchDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return nil
@@ -52,7 +87,11 @@ func (r *Registry) grepTool(ctx context.Context, input json.RawMessage) (string,
 		}
 
 		if d.IsDir() {
-			if shouldSkipDir(d.Name()) {
+			if r.skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if r.readDenied(path) != "" {
+				denied++
 				return filepath.SkipDir
 			}
 			return nil
@@ -66,6 +105,12 @@ func (r *Registry) grepTool(ctx context.Context, input json.RawMessage) (string,
 			}
 		}
 
+		if len(required) > 0 && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil && r.index.skip(path, info, required) {
+				return nil
+			}
+		}
+
 		// Skip binary files (check first 512 bytes)
 		if isBinaryFile(path) {
 			return nil
@@ -77,21 +122,16 @@ func (r *Registry) grepTool(ctx context.Context, input json.RawMessage) (string,
 		}
 		defer file.Close()
 
-		rel, _ := filepath.Rel(r.workDir, path)
-		rel = filepath.ToSlash(rel)
-
-		scanner := bufio.NewScanner(file)
-		lineNum := 0
-		for scanner.Scan() {
-			lineNum++
-			line := scanner.Text()
-			if re.MatchString(line) {
-				totalMatches++
-				if len(results) < maxResults {
-					results = append(results, fmt.Sprintf("%s:%d: %s", rel, lineNum, truncateLine(line, 200)))
-				}
-			}
+		rel := r.displayPath(path)
+		if focused && !r.inFocus(rel) {
+			return nil
 		}
+		if r.readDenied(path) != "" {
+			denied++
+			return nil
+		}
+
+		out.searchFile(bufio.NewScanner(file), rel, re)
 		return nil
 	})
 
@@ -99,21 +139,90 @@ func (r *Registry) grepTool(ctx context.Context, input json.RawMessage) (string,
 		return "", err
 	}
 
-	if len(results) == 0 {
-		return "No matches found.", nil
+	note := ""
+	if denied > 0 {
+		note = deniedNote(denied)
+	}
+	if out.shown == 0 {
+		if focused {
+			return "No matches found" + r.focusNote() + "." + note, nil
+		}
+		return "No matches found." + note, nil
 	}
 
-	var out strings.Builder
-	for _, r := range results {
-		out.WriteString(r)
-		out.WriteByte('\n')
+	var b strings.Builder
+	for _, line := range out.lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
 	}
 
-	if totalMatches > maxResults {
-		out.WriteString(fmt.Sprintf("\n... and %d more matches", totalMatches-maxResults))
+	if out.total > maxGrepResults {
+		b.WriteString(fmt.Sprintf("\n... and %d more matches", out.total-maxGrepResults))
 	}
+	b.WriteString(note)
+
+	return b.String(), nil
+}
+
+// grepOutput collects grep's output lines: up to maxGrepResults matches as
+// "path:N: text", each with up to before and after lines of context as
+// "path-N- text". With context, "--" separates hunks that are not
+// contiguous; overlapping context windows merge into one hunk.
+type grepOutput struct {
+	before, after int
+	lines         []string
+	shown         int // matching lines in lines
+	total         int // matching lines found, shown or not
+}
 
-	return out.String(), nil
+// searchFile adds the matches in one file, read from scanner.
+func (g *grepOutput) searchFile(scanner *bufio.Scanner, rel string, re *regexp.Regexp) {
+	type line struct {
+		num  int
+		text string
+	}
+	var recent []line // up to before lines preceding the current one
+	printed := 0      // last line number added from this file
+	afterLeft := 0    // context lines still owed to the last match
+	add := func(num int, sep, text string) {
+		if g.before+g.after > 0 && len(g.lines) > 0 && (printed == 0 || num != printed+1) {
+			g.lines = append(g.lines, "--")
+		}
+		g.lines = append(g.lines, fmt.Sprintf("%s%s%d%s %s", rel, sep, num, sep, truncateLine(text, 200)))
+		printed = num
+	}
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		text := stripBOM(scanner.Text(), lineNum)
+		switch {
+		case re.MatchString(text):
+			g.total++
+			if g.shown == maxGrepResults {
+				// Context never shows a match that is not counted as one
+				afterLeft = 0
+				break
+			}
+			g.shown++
+			for _, l := range recent {
+				if l.num > printed {
+					add(l.num, "-", l.text)
+				}
+			}
+			add(lineNum, ":", text)
+			afterLeft = g.after
+		case afterLeft > 0:
+			add(lineNum, "-", text)
+			afterLeft--
+		}
+		if g.before > 0 {
+			if len(recent) == g.before {
+				recent = recent[1:]
+			}
+			recent = append(recent, line{lineNum, text})
+		}
+	}
 }
 
 func truncateLine(s string, max int) string {
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"io/fs"
+	"os"
+	"regexp/syntax"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxIndexedFileSize is the largest file the grep index covers; bigger files
+// are always scanned.
+const maxIndexedFileSize = 8 << 20
+
+// grepIndex is an in-session trigram index that lets grep skip files which
+// cannot contain a match. Entries are built lazily the first time grep visits
+// a file, and rebuilt when the file's size or modification time changes or
+// when write/edit invalidate it.
+type grepIndex struct {
+	mu    sync.Mutex
+	files map[string]*indexedFile
+}
+
+// indexedFile is the index entry for one file.
+type indexedFile struct {
+	modTime  time.Time
+	size     int64
+	binary   bool     // matches isBinaryFile: NUL in the first 512 bytes, or empty
+	trigrams []uint32 // sorted, unique byte trigrams of the content
+}
+
+func newGrepIndex() *grepIndex {
+	return &grepIndex{files: make(map[string]*indexedFile)}
+}
+
+// SetGrepIndex enables or disables the grep index. It is on by default; with
+// it off, grep reads every file on every search.
+func (r *Registry) SetGrepIndex(enabled bool) {
+	if !enabled {
+		r.index = nil
+	} else if r.index == nil {
+		r.index = newGrepIndex()
+	}
+}
+
+// GrepIndex reports whether the grep index is enabled.
+func (r *Registry) GrepIndex() bool {
+	return r.index != nil
+}
+
+// invalidate drops the entry for path so the next grep re-reads it.
+func (ix *grepIndex) invalidate(path string) {
+	if ix == nil {
+		return
+	}
+	ix.mu.Lock()
+	delete(ix.files, path)
+	ix.mu.Unlock()
+}
+
+// skip reports whether grep can skip the file at path: it is binary, or it
+// lacks one of the trigrams every match must contain. Files that cannot be
+// indexed are never skipped.
+func (ix *grepIndex) skip(path string, info fs.FileInfo, required []uint32) bool {
+	if ix == nil || len(required) == 0 || info.Size() > maxIndexedFileSize {
+		return false
+	}
+
+	ix.mu.Lock()
+	entry := ix.files[path]
+	ix.mu.Unlock()
+
+	if entry == nil || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false
+		}
+		entry = &indexedFile{
+			modTime:  info.ModTime(),
+			size:     info.Size(),
+			binary:   isBinaryContent(data),
+			trigrams: contentTrigrams(data),
+		}
+		ix.mu.Lock()
+		ix.files[path] = entry
+		ix.mu.Unlock()
+	}
+
+	if entry.binary {
+		return true
+	}
+	for _, t := range required {
+		if _, found := slices.BinarySearch(entry.trigrams, t); !found {
+			return true
+		}
+	}
+	return false
+}
+
+// isBinaryContent applies isBinaryFile's test to content already in memory.
+func isBinaryContent(data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	return slices.Contains(data[:min(len(data), 512)], 0)
+}
+
+// contentTrigrams returns the sorted, unique byte trigrams of data.
+func contentTrigrams(data []byte) []uint32 {
+	seen := make(map[uint32]struct{})
+	for i := 0; i+3 <= len(data); i++ {
+		seen[trigram(data[i], data[i+1], data[i+2])] = struct{}{}
+	}
+	out := make([]uint32, 0, len(seen))
+	for t := range seen {
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func trigram(a, b, c byte) uint32 {
+	return uint32(a)<<16 | uint32(b)<<8 | uint32(c)
+}
+
+// requiredTrigrams returns trigrams that every match of the RE2 pattern must
+// contain, taken from case-sensitive literals the match cannot avoid. It
+// returns nil when nothing is required (alternations, optional parts,
+// case-insensitive literals, short literals), in which case grep scans every
+// file.
+func requiredTrigrams(pattern string) []uint32 {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+
+	var literals []string
+	var collect func(re *syntax.Regexp)
+	collect = func(re *syntax.Regexp) {
+		switch re.Op {
+		case syntax.OpLiteral:
+			if re.Flags&syntax.FoldCase == 0 {
+				literals = append(literals, string(re.Rune))
+			}
+		case syntax.OpConcat:
+			for _, sub := range re.Sub {
+				collect(sub)
+			}
+		case syntax.OpCapture, syntax.OpPlus:
+			collect(re.Sub[0])
+		case syntax.OpRepeat:
+			if re.Min >= 1 {
+				collect(re.Sub[0])
+			}
+		}
+	}
+	collect(re)
+
+	var out []uint32
+	for _, lit := range literals {
+		for i := 0; i+3 <= len(lit); i++ {
+			out = append(out, trigram(lit[i], lit[i+1], lit[i+2]))
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
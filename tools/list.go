@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 )
 
 type lsInput struct {
-	Path string `json:"path"`
+	Path    string `json:"path"`
+	Sort    string `json:"sort"`
+	Reverse bool   `json:"reverse"`
 }
 
 func (r *Registry) lsTool(ctx context.Context, input json.RawMessage) (string, error) {
@@ -18,10 +21,16 @@ func (r *Registry) lsTool(ctx context.Context, input json.RawMessage) (string, e
 		return "", err
 	}
 
-	dir := r.workDir
+	switch params.Sort {
+	case "", "name", "size", "mtime":
+	default:
+		return "", fmt.Errorf("invalid sort %q: want name, size, or mtime", params.Sort)
+	}
+
+	dir := r.focusDir()
 	if params.Path != "" {
 		var err error
-		dir, err = ValidatePath(r.workDir, params.Path)
+		dir, err = r.readPath(params.Path)
 		if err != nil {
 			return "", err
 		}
@@ -32,17 +41,22 @@ func (r *Registry) lsTool(ctx context.Context, input json.RawMessage) (string, e
 		return "", fmt.Errorf("read directory: %w", err)
 	}
 
-	var result strings.Builder
+	var infos []os.FileInfo
 	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
 		}
+	}
+	sortEntries(infos, params.Sort, params.Reverse)
 
-		if entry.IsDir() {
-			result.WriteString(fmt.Sprintf("  %s/\n", entry.Name()))
+	var result strings.Builder
+	for _, info := range infos {
+		if info.IsDir() {
+			result.WriteString(fmt.Sprintf("  %s/\n", info.Name()))
+		} else if params.Sort == "mtime" {
+			result.WriteString(fmt.Sprintf("  %-40s %-8s %s\n", info.Name(), formatSize(info.Size()), info.ModTime().Format("2006-01-02 15:04")))
 		} else {
-			result.WriteString(fmt.Sprintf("  %-40s %s\n", entry.Name(), formatSize(info.Size())))
+			result.WriteString(fmt.Sprintf("  %-40s %s\n", info.Name(), formatSize(info.Size())))
 		}
 	}
 
@@ -53,6 +67,34 @@ func (r *Registry) lsTool(ctx context.Context, input json.RawMessage) (string, e
 	return result.String(), nil
 }
 
+// sortEntries orders directory entries by name (A to Z), size (largest
+// first, directories last), or mtime (newest first); reverse flips the order.
+func sortEntries(infos []os.FileInfo, by string, reverse bool) {
+	size := func(info os.FileInfo) int64 {
+		if info.IsDir() {
+			return -1
+		}
+		return info.Size()
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if reverse {
+			a, b = b, a
+		}
+		switch by {
+		case "size":
+			if size(a) != size(b) {
+				return size(a) > size(b)
+			}
+		case "mtime":
+			if !a.ModTime().Equal(b.ModTime()) {
+				return a.ModTime().After(b.ModTime())
+			}
+		}
+		return a.Name() < b.Name()
+	})
+}
+
 func formatSize(bytes int64) string {
 	switch {
 	case bytes >= 1<<20:
@@ -13,3 +13,30 @@ func parseInput[T any](input json.RawMessage) (T, error) {
 	}
 	return params, nil
 }
+
+// ArgError is a tool error caused by a misused argument, with a suggested
+// correction that the agent puts on its own line after the error so the
+// model can retry at once.
+type ArgError struct {
+	Msg string
+	Fix string
+}
+
+func (e *ArgError) Error() string {
+	return e.Msg
+}
+
+// argError returns an ArgError with the message msg and the correction fix.
+func argError(fix, format string, args ...any) error {
+	return &ArgError{Msg: fmt.Sprintf(format, args...), Fix: fix}
+}
+
+// checkLineRange reports a line range whose start is after its end, with
+// the swapped range as the fix. An end of 0 or less means no end.
+func checkLineRange(start, end int) error {
+	if end > 0 && start > end {
+		return argError(fmt.Sprintf("retry with start_line=%d end_line=%d", end, start),
+			"start_line %d is after end_line %d", start, end)
+	}
+	return nil
+}
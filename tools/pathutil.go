@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // ValidatePath ensures the resolved path is within the allowed working directory.
@@ -39,8 +40,10 @@ func AtomicWrite(targetPath string, content []byte, perm os.FileMode) error {
 		return fmt.Errorf("create temp file: %w", err)
 	}
 	tmpPath := tmp.Name()
+	pendingTemps.Store(tmpPath, struct{}{})
 
 	defer func() {
+		pendingTemps.Delete(tmp.Name())
 		if tmpPath != "" {
 			os.Remove(tmpPath)
 		}
@@ -62,3 +65,16 @@ func AtomicWrite(targetPath string, content []byte, perm os.FileMode) error {
 	tmpPath = "" // prevent deferred cleanup
 	return nil
 }
+
+// pendingTemps holds the temp files of atomic writes in progress, so that
+// Shutdown can remove them if the program exits mid-write.
+var pendingTemps sync.Map
+
+// removePendingTemps deletes the temp files of unfinished atomic writes.
+func removePendingTemps() {
+	pendingTemps.Range(func(key, _ any) bool {
+		os.Remove(key.(string))
+		pendingTemps.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxProfileFiles bounds the walk of DetectProject; a project at least this
+// large reports exactly this many files.
+const maxProfileFiles = 20000
+
+// sourceLanguages maps source file extensions to the language DetectProject
+// reports for them.
+var sourceLanguages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".rb":    "ruby",
+	".php":   "php",
+	".cs":    "csharp",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+}
+
+// ProjectProfile describes a project by its size, main language, and the
+// files at its root, such as go.mod or next.config.js.
+type ProjectProfile struct {
+	Files     int             // files outside skipped directories, up to maxProfileFiles
+	Language  string          // language with the most source files, or "" if none
+	RootFiles map[string]bool // names of the entries in the project root
+}
+
+// DetectProject profiles the project in workDir, skipping the directories
+// glob and grep skip plus those matching ignore.
+func DetectProject(workDir string, ignore []string) ProjectProfile {
+	r := &Registry{workDir: workDir, ignore: ignore}
+	profile := ProjectProfile{RootFiles: make(map[string]bool)}
+	if entries, err := os.ReadDir(workDir); err == nil {
+		for _, e := range entries {
+			profile.RootFiles[e.Name()] = true
+		}
+	}
+
+	counts := make(map[string]int)
+	filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != workDir && r.skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		profile.Files++
+		if lang, ok := sourceLanguages[strings.ToLower(filepath.Ext(d.Name()))]; ok {
+			counts[lang]++
+		}
+		if profile.Files >= maxProfileFiles {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+
+	for lang, n := range counts {
+		// Ties go to the alphabetically first language, so the result is stable
+		if best := counts[profile.Language]; n > best || (n == best && lang < profile.Language) {
+			profile.Language = lang
+		}
+	}
+	return profile
+}
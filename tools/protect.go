@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ProtectedPath is a file or directory the write and edit tools refuse to
+// modify, because changing it would break Pilot itself.
+type ProtectedPath struct {
+	Path   string // absolute, or relative to the working directory; a directory covers everything under it
+	Reason string // why it is refused, e.g. "it is Pilot's credentials file"
+}
+
+// SetProtectedPaths sets the paths write and edit refuse, on top of the
+// built-in refusal of anything inside a .git directory.
+func (r *Registry) SetProtectedPaths(paths []ProtectedPath) {
+	r.protected = nil
+	for _, p := range paths {
+		if p.Path == "" {
+			continue
+		}
+		if !filepath.IsAbs(p.Path) {
+			p.Path = filepath.Join(r.workDir, p.Path)
+		}
+		p.Path = resolvePath(filepath.Clean(p.Path))
+		r.protected = append(r.protected, p)
+	}
+}
+
+// checkProtected returns an error if absPath, a path the write or edit tool
+// would modify, is protected.
+func (r *Registry) checkProtected(absPath string) error {
+	resolved := resolvePath(absPath)
+	if rel, err := filepath.Rel(r.workDir, absPath); err == nil {
+		for _, seg := range strings.Split(filepath.ToSlash(rel), "/") {
+			if seg == ".git" {
+				return fmt.Errorf("refusing to modify %s: it is inside git's internal data; use git commands instead", absPath)
+			}
+		}
+	}
+	for _, p := range r.protected {
+		if resolved == p.Path || strings.HasPrefix(resolved, p.Path+string(filepath.Separator)) {
+			return fmt.Errorf("refusing to modify %s: %s", absPath, p.Reason)
+		}
+	}
+	return nil
+}
+
+// resolvePath follows symlinks in path, or in its nearest existing parent
+// if path does not exist yet, so a link cannot route around a protected path.
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(resolvePath(parent), filepath.Base(path))
+}
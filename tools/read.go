@@ -2,19 +2,39 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"unicode/utf8"
 )
 
 type readInput struct {
 	Path      string `json:"path"`
 	StartLine int    `json:"start_line"`
 	EndLine   int    `json:"end_line"`
+	Raw       bool   `json:"raw"`
+	Encoding  string `json:"encoding"`
 }
 
+const (
+	// maxReadLines is how many lines a read returns without an explicit range.
+	maxReadLines = 500
+	// maxPrettySize is the largest file that is pretty-printed; bigger files
+	// are shown as raw lines.
+	maxPrettySize = 1 << 20
+	// csvHeadRows is how many data rows the CSV table shows.
+	csvHeadRows = 20
+	// maxCSVCell is the display width a CSV cell is truncated to.
+	maxCSVCell = 40
+)
+
 func (r *Registry) readTool(ctx context.Context, input json.RawMessage) (string, error) {
 	params, err := parseInput[readInput](input)
 	if err != nil {
@@ -23,17 +43,63 @@ func (r *Registry) readTool(ctx context.Context, input json.RawMessage) (string,
 	if params.Path == "" {
 		return "", fmt.Errorf("path is required")
 	}
+	if err := checkLineRange(params.StartLine, params.EndLine); err != nil {
+		return "", err
+	}
 
-	absPath, err := ValidatePath(r.workDir, params.Path)
+	absPath, err := r.readPath(params.Path)
 	if err != nil {
 		return "", err
 	}
+	if err := r.checkReadable(absPath); err != nil {
+		return "", err
+	}
 
-	file, err := os.Open(absPath)
+	enc, err := parseEncoding(params.Encoding)
 	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
+		return "", err
+	}
+	explicit := params.Encoding != ""
+
+	staged, isStaged := r.stagedContent(absPath)
+
+	// Data files get a readable rendering unless raw lines, a range, or an
+	// encoding were asked for
+	if !isStaged && !params.Raw && params.StartLine <= 0 && params.EndLine <= 0 && !explicit && r.fileEncoding(absPath, nil) == encUTF8 {
+		if out, ok := prettyRead(absPath); ok {
+			return out, nil
+		}
+	}
+
+	var file io.Reader = strings.NewReader(staged)
+	fromBOM := false
+	if !isStaged {
+		f, err := os.Open(absPath)
+		if err != nil {
+			return "", fmt.Errorf("open file: %w", err)
+		}
+		defer f.Close()
+		br := bufio.NewReader(f)
+		file = br
+		if explicit {
+			r.setFileEncoding(absPath, enc)
+		} else {
+			head, _ := br.Peek(2)
+			enc = r.fileEncoding(absPath, head)
+			fromBOM = bomEncoding(head) != ""
+		}
+		if enc != encUTF8 {
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return "", fmt.Errorf("read file: %w", err)
+			}
+			text, err := decodeText(data, enc)
+			if err != nil {
+				return "", fmt.Errorf("read file: %w", err)
+			}
+			file = strings.NewReader(text)
+		}
 	}
-	defer file.Close()
 
 	// Default: 1-indexed, start from line 1
 	startLine := params.StartLine
@@ -42,16 +108,24 @@ func (r *Registry) readTool(ctx context.Context, input json.RawMessage) (string,
 	}
 	endLine := params.EndLine
 
-	const maxLines = 500
-
 	var result strings.Builder
 	scanner := bufio.NewScanner(file)
 	// Increase buffer for long lines
 	scanner.Buffer(make([]byte, 0, 256*1024), 256*1024)
+	// ScanLines drops the \r of CRLF endings; note when it does
+	crlf := false
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance >= 2 && data[advance-2] == '\r' && data[advance-1] == '\n' {
+			crlf = true
+		}
+		return advance, token, err
+	})
 
 	lineNum := 0
 	linesRead := 0
 	totalLines := 0
+	invalidUTF8 := false
 
 	for scanner.Scan() {
 		lineNum++
@@ -65,27 +139,188 @@ func (r *Registry) readTool(ctx context.Context, input json.RawMessage) (string,
 		}
 
 		linesRead++
-		if endLine <= 0 && linesRead > maxLines {
+		if endLine <= 0 && linesRead > maxReadLines {
 			// Count remaining lines
 			for scanner.Scan() {
 				lineNum++
 				totalLines = lineNum
 			}
-			result.WriteString(fmt.Sprintf("\n... (file has %d total lines, showing lines %d-%d. Use start_line/end_line to read more.)",
-				totalLines, startLine, startLine+maxLines-1))
+			result.WriteString("\n" + truncationFooter(totalLines, startLine, startLine+maxReadLines-1))
 			break
 		}
 
-		result.WriteString(fmt.Sprintf("%4d │ %s\n", lineNum, scanner.Text()))
+		line := scanner.Text()
+		invalidUTF8 = invalidUTF8 || !utf8.ValidString(line)
+		result.WriteString(fmt.Sprintf("%4d │ %s\n", lineNum, stripBOM(line, lineNum)))
 	}
 
 	if err := scanner.Err(); err != nil {
 		return "", fmt.Errorf("read file: %w", err)
 	}
 
+	if result.Len() == 0 && startLine > totalLines && totalLines > 0 {
+		return "", argError(fmt.Sprintf("retry with start_line between 1 and %d", totalLines),
+			"start_line %d is past the end of the file, which has %d lines", startLine, totalLines)
+	}
 	if result.Len() == 0 {
 		return "File is empty.", nil
 	}
+	if crlf {
+		result.WriteString("\n(File has CRLF line endings, shown without \\r. Edits keep them.)")
+	}
+	switch {
+	case isStaged:
+	case fromBOM:
+		fmt.Fprintf(&result, "\n(File is %s, detected from its byte order mark; shown decoded. Writes and edits keep the encoding.)", enc)
+	case enc != encUTF8:
+		fmt.Fprintf(&result, "\n(File decoded from %s. Writes and edits keep the encoding.)", enc)
+	case invalidUTF8:
+		result.WriteString("\n(File is not valid UTF-8. If it is Latin-1, read it again with encoding=\"latin-1\" so writes and edits keep that encoding.)")
+	}
 
 	return result.String(), nil
 }
+
+// truncationFooter ends a read cut short at maxReadLines. Its bracketed
+// fields are fixed so the model can take next_range as the start_line and
+// end_line of its next read rather than guessing.
+func truncationFooter(totalLines, shownStart, shownEnd int) string {
+	nextStart := shownEnd + 1
+	nextEnd := min(nextStart+maxReadLines-1, totalLines)
+	return fmt.Sprintf("[truncated: true, total_lines: %d, shown: %d-%d, next_range: %d-%d]\n(Read more with start_line=%d end_line=%d.)",
+		totalLines, shownStart, shownEnd, nextStart, nextEnd, nextStart, nextEnd)
+}
+
+// stripBOM removes a UTF-8 byte order mark from the first line of a file, so
+// read and grep show (and ^ matches) the text after it.
+func stripBOM(line string, lineNum int) string {
+	if lineNum == 1 {
+		return strings.TrimPrefix(line, "\ufeff")
+	}
+	return line
+}
+
+// prettyRead renders JSON and CSV files for reading. It reports false when
+// the file is not a supported type, is too large, or does not parse, so the
+// caller can fall back to raw lines.
+func prettyRead(path string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".json" && ext != ".csv" {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 || info.Size() > maxPrettySize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	var out string
+	switch ext {
+	case ".json":
+		out, err = prettyJSON(data)
+	case ".csv":
+		out, err = csvHead(data, csvHeadRows)
+	}
+	if err != nil {
+		return "", false
+	}
+	return out, true
+}
+
+// prettyJSON re-indents a JSON document with object keys in sorted order.
+// Numbers are kept as written.
+func prettyJSON(data []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("trailing data after JSON value")
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(string(out), "\n")
+	var b strings.Builder
+	b.WriteString("(JSON, pretty-printed with sorted keys; use raw=true for file lines)\n")
+	for i, line := range lines {
+		if i == maxReadLines {
+			fmt.Fprintf(&b, "... (%d more lines)\n", len(lines)-maxReadLines)
+			break
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String(), nil
+}
+
+// csvHead renders the header and first rows of a CSV file as an aligned table.
+func csvHead(data []byte, rows int) (string, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("no records")
+	}
+
+	shown := records
+	if len(shown) > rows+1 {
+		shown = shown[:rows+1]
+	}
+
+	cols := 0
+	for _, rec := range shown {
+		cols = max(cols, len(rec))
+	}
+	cells := make([][]string, len(shown))
+	widths := make([]int, cols)
+	for i, rec := range shown {
+		cells[i] = make([]string, cols)
+		for j, field := range rec {
+			field = strings.ReplaceAll(field, "\n", " ")
+			if utf8.RuneCountInString(field) > maxCSVCell {
+				field = string([]rune(field)[:maxCSVCell-1]) + "…"
+			}
+			cells[i][j] = field
+			widths[j] = max(widths[j], utf8.RuneCountInString(field))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "(CSV, %d columns, %d data rows; use raw=true for file lines)\n", len(records[0]), len(records)-1)
+	for i, row := range cells {
+		for j, cell := range row {
+			if j > 0 {
+				b.WriteString(" | ")
+			}
+			if j == len(row)-1 {
+				b.WriteString(cell)
+			} else {
+				b.WriteString(cell + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)))
+			}
+		}
+		b.WriteString("\n")
+		if i == 0 {
+			for j, w := range widths {
+				if j > 0 {
+					b.WriteString("-+-")
+				}
+				b.WriteString(strings.Repeat("-", w))
+			}
+			b.WriteString("\n")
+		}
+	}
+	if more := len(records) - len(shown); more > 0 {
+		fmt.Fprintf(&b, "... (%d more rows)\n", more)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SetReadRoots gives the read-only tools directories outside the working
+// directory that they may also read: read, grep, and ls accept absolute
+// paths inside them, and glob an absolute pattern. The explore sub-agent's
+// registry gets the roots its task asked for; dirs must be absolute.
+func (r *Registry) SetReadRoots(dirs []string) {
+	r.readRoots = dirs
+}
+
+// readPath is ValidatePath for the read-only tools: an absolute path may
+// also be inside one of the read roots.
+func (r *Registry) readPath(path string) (string, error) {
+	absPath, err := ValidatePath(r.workDir, path)
+	if err == nil || !filepath.IsAbs(path) {
+		return absPath, err
+	}
+	for _, root := range r.readRoots {
+		if absPath, rootErr := ValidatePath(root, path); rootErr == nil {
+			return absPath, nil
+		}
+	}
+	return "", err
+}
+
+// displayPath is how grep and glob show absPath: relative to the working
+// directory, or absolute for a file in a read root.
+func (r *Registry) displayPath(absPath string) string {
+	rel, err := filepath.Rel(r.workDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(absPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// globRoot splits an absolute glob pattern that starts inside a read root
+// into the root and the rest of the pattern, relative to it.
+func (r *Registry) globRoot(pattern string) (root, rest string, ok bool) {
+	if !filepath.IsAbs(pattern) {
+		return "", "", false
+	}
+	for _, root := range r.readRoots {
+		prefix := filepath.ToSlash(root) + "/"
+		if rest, ok := strings.CutPrefix(filepath.ToSlash(pattern), prefix); ok && rest != "" {
+			return root, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// SetExploreRoots sets the directories outside the working directory that
+// an explore call may hand its sub-agent with the roots input. Relative
+// entries are resolved against the working directory.
+func (r *Registry) SetExploreRoots(dirs []string) {
+	r.exploreRoots = nil
+	for _, d := range dirs {
+		if !filepath.IsAbs(d) {
+			d = filepath.Join(r.workDir, d)
+		}
+		r.exploreRoots = append(r.exploreRoots, filepath.Clean(d))
+	}
+}
+
+// ExploreRoots returns the directories set by SetExploreRoots.
+func (r *Registry) ExploreRoots() []string {
+	return r.exploreRoots
+}
+
+// exploreRoot validates one entry of explore's roots input: an existing
+// directory that is, or is inside, one of the explore roots.
+func (r *Registry) exploreRoot(path string) (string, error) {
+	if len(r.exploreRoots) == 0 {
+		return "", argError("omit roots; the user has not set PILOT_EXPLORE_ROOTS",
+			"no extra directories are available to explore")
+	}
+	dir := filepath.Clean(path)
+	allowed := slices.ContainsFunc(r.exploreRoots, func(root string) bool {
+		_, err := ValidatePath(root, dir)
+		return filepath.IsAbs(dir) && err == nil
+	})
+	if !allowed {
+		return "", argError("pass one of: "+strings.Join(r.exploreRoots, ", "),
+			"root %q is not one of the directories available to explore", path)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("stat root: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("root %q is not a directory", path)
+	}
+	return dir, nil
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type recallInput struct {
+	ID        int `json:"id"`
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+}
+
+// ArchiveResult keeps the full output of a tool call whose result went into
+// the conversation summarized, and returns the ID recall finds it by. The
+// archive lasts for the session.
+func (r *Registry) ArchiveResult(output string) int {
+	r.archiveMu.Lock()
+	defer r.archiveMu.Unlock()
+	r.archive = append(r.archive, output)
+	return len(r.archive)
+}
+
+func (r *Registry) recallTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[recallInput](input)
+	if err != nil {
+		return "", err
+	}
+	if err := checkLineRange(params.StartLine, params.EndLine); err != nil {
+		return "", err
+	}
+	r.archiveMu.Lock()
+	var output string
+	found := params.ID > 0 && params.ID <= len(r.archive)
+	if found {
+		output = r.archive[params.ID-1]
+	}
+	r.archiveMu.Unlock()
+	if !found {
+		return "", fmt.Errorf("no archived output %d; archives last only for the session", params.ID)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	start := max(params.StartLine, 1)
+	if start > len(lines) {
+		return "", argError(fmt.Sprintf("retry with start_line between 1 and %d", len(lines)),
+			"archived output %d has only %d lines", params.ID, len(lines))
+	}
+	end := len(lines)
+	if params.EndLine > 0 {
+		end = min(params.EndLine, end)
+	}
+	truncated := params.EndLine <= 0 && end-start+1 > maxReadLines
+	if truncated {
+		end = start + maxReadLines - 1
+	}
+
+	var b strings.Builder
+	for i := start; i <= end; i++ {
+		fmt.Fprintf(&b, "%4d │ %s\n", i, lines[i-1])
+	}
+	if truncated {
+		b.WriteString("\n" + truncationFooter(len(lines), start, end))
+	}
+	return b.String(), nil
+}
+
+// SetRecall adds or removes the recall tool, which returns tool output
+// archived with ArchiveResult. It goes after the scratch tools.
+func (r *Registry) SetRecall(enabled bool) {
+	if enabled == r.HasTool("recall") {
+		return
+	}
+	if !enabled {
+		r.tools = slices.DeleteFunc(r.tools, func(t toolEntry) bool { return t.name == "recall" })
+		return
+	}
+	r.registerRecall()
+	// Move it from the end to just after scratch_list
+	entry := r.tools[len(r.tools)-1]
+	r.tools = r.tools[:len(r.tools)-1]
+	at := slices.IndexFunc(r.tools, func(t toolEntry) bool { return t.name == "scratch_list" }) + 1
+	r.tools = slices.Insert(r.tools, at, entry)
+}
+
+// registerRecall registers the recall tool for summarized tool results.
+func (r *Registry) registerRecall() {
+	r.register("recall",
+		`Get the exact text of a tool result that was replaced by a summary in the conversation. The summary names the archive id to pass. Lines are numbered; without a range at most 500 lines are returned, so use start_line/end_line for the part you need, e.g. the exact lines to quote in an edit.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"id": {
+					"type": "integer",
+					"description": "Archive id from the summary"
+				},
+				"start_line": {
+					"type": "integer",
+					"description": "First line to return (1-indexed, default: 1)"
+				},
+				"end_line": {
+					"type": "integer",
+					"description": "Last line to return (1-indexed, inclusive)"
+				}
+			},
+			"required": ["id"]
+		}`),
+		r.recallTool,
+	)
+}
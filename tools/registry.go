@@ -6,6 +6,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/lowkaihon/cli-coding-agent/llm"
 )
@@ -24,11 +27,48 @@ type Registry struct {
 	tools       []toolEntry
 	workDir     string
 	exploreFunc ExploreFunc
+	ignore      []string        // extra directory name patterns skipped by glob and grep
+	focus       *focusScope     // default scope of glob, grep, and ls; nil for the whole tree
+	protected   []ProtectedPath // paths write and edit refuse, besides .git
+	denyRead    []string        // files read, grep, and glob refuse; see SetDenyRead
+
+	readRoots    []string // directories outside workDir the read-only tools may read; see SetReadRoots
+	exploreRoots []string // directories explore may hand its sub-agent; see SetExploreRoots
+
+	index *grepIndex    // trigram index for grep; nil disables it
+	safe  []safeCommand // bash commands that run without confirmation
+
+	formatters []formatter // commands run on a file after a write or edit; see SetFormatters
+
+	stagedMu sync.Mutex
+	staged   map[string]string // content held for review by absolute path; see StageContent
+
+	encMu     sync.Mutex
+	encodings map[string]textEncoding // non-UTF-8 encodings chosen by read, by absolute path
+
+	jobsMu sync.Mutex
+	jobs   map[*os.Process]struct{} // running bash commands, killed by Shutdown
+
+	toolTimeout time.Duration // limit on read-only tool calls; 0 disables. See SetToolTimeout
+
+	bashInterim time.Duration // run time after which bash hands a command to the background; 0 disables
+	bgMu        sync.Mutex
+	bgJobs      map[int]*bashJob // bash commands handed to the background, by job ID
+	bgNext      int              // last job ID handed out
+
+	chunkMu sync.Mutex
+	chunks  map[string]*chunkedWrite // files being written with write_chunk, by absolute path
+
+	archiveMu sync.Mutex
+	archive   []string // full output of summarized tool results; see ArchiveResult
+
+	scratchMu  sync.Mutex
+	scratchDir string // temp directory of the scratch tools, created on first write; removed by Shutdown
 }
 
 // NewRegistry creates a registry and registers all built-in tools.
 func NewRegistry(workDir string) *Registry {
-	r := &Registry{workDir: workDir}
+	r := &Registry{workDir: workDir, index: newGrepIndex()}
 	r.registerBuiltins()
 	return r
 }
@@ -48,20 +88,116 @@ func (r *Registry) register(name, description string, schema json.RawMessage, fn
 	})
 }
 
-// Execute runs a tool by name with the given input.
+// Execute runs a tool by name with the given input. Read-only tools are
+// cut off after the tool timeout; see SetToolTimeout.
 func (r *Registry) Execute(ctx context.Context, name string, input json.RawMessage) (string, error) {
 	for _, t := range r.tools {
 		if t.name == name {
+			if r.toolTimeout > 0 && r.hasDeadline(name) {
+				return runWithTimeout(ctx, name, r.toolTimeout, t.fn, input)
+			}
 			return t.fn(ctx, input)
 		}
 	}
 	return "", fmt.Errorf("unknown tool: %s", name)
 }
 
+// SetToolTimeout sets how long a read-only tool call may run before it is
+// abandoned with a timeout error (0 disables the limit). bash keeps its own
+// timeout, and explore and bash_output, which wait on purpose, have none.
+func (r *Registry) SetToolTimeout(d time.Duration) {
+	r.toolTimeout = max(d, 0)
+}
+
+// ToolTimeout returns the limit set by SetToolTimeout.
+func (r *Registry) ToolTimeout() time.Duration {
+	return r.toolTimeout
+}
+
+// hasDeadline reports whether calls to the named tool are bounded by the
+// tool timeout. Tools that ask for confirmation are not: their Execute
+// closures run after the call returns, under the caller's context.
+func (r *Registry) hasDeadline(name string) bool {
+	return r.IsReadOnly(name) && name != "explore" && name != "bash_output"
+}
+
+// runWithTimeout runs fn with a context cancelled after timeout. Since a
+// tool blocked in a system call may not notice the cancellation, the call
+// returns at the deadline regardless, leaving fn to finish in the
+// background with its result discarded.
+func runWithTimeout(ctx context.Context, name string, timeout time.Duration, fn ToolFunc, input json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := fn(ctx, input)
+		done <- result{out, err}
+	}()
+	select {
+	case res := <-done:
+		// A tool that noticed the deadline fails with the context's error
+		if res.err == nil || ctx.Err() != context.DeadlineExceeded {
+			return res.out, res.err
+		}
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return "", ctx.Err()
+		}
+	}
+	return "", fmt.Errorf("%s timed out after %s; narrow the path or pattern and try again", name, timeout)
+}
+
+// Shutdown kills any commands still running and removes the scratch
+// directory, unwritten write_chunk content, and temp files left by
+// interrupted atomic writes. Call it before the program exits.
+func (r *Registry) Shutdown() {
+	r.jobsMu.Lock()
+	for p := range r.jobs {
+		p.Kill()
+	}
+	r.jobs = nil
+	r.jobsMu.Unlock()
+
+	removePendingTemps()
+	r.removeChunks()
+	r.removeScratch()
+}
+
+// trackJob records a running process for Shutdown. The returned function
+// stops tracking it and must be called once the process has exited.
+func (r *Registry) trackJob(p *os.Process) (untrack func()) {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+	if r.jobs == nil {
+		r.jobs = make(map[*os.Process]struct{})
+	}
+	r.jobs[p] = struct{}{}
+	return func() {
+		r.jobsMu.Lock()
+		delete(r.jobs, p)
+		r.jobsMu.Unlock()
+	}
+}
+
+// HasTool reports whether a tool with the given name is registered.
+func (r *Registry) HasTool(name string) bool {
+	for _, t := range r.tools {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // IsReadOnly returns true for tools that don't modify the filesystem.
 func (r *Registry) IsReadOnly(name string) bool {
 	switch name {
-	case "glob", "grep", "ls", "read", "explore":
+	case "glob", "grep", "ls", "read", "explore", "git_branch", "scratch_read", "scratch_list", "bash_output", "recall":
 		return true
 	default:
 		return false
@@ -96,7 +232,7 @@ func (r *Registry) registerReadOnlyTools() {
 	)
 
 	r.register("grep",
-		`Search file contents using RE2 regex. Returns matching lines with file paths and line numbers. ALWAYS use this tool for content search — never use bash grep or rg. Supports RE2 regex syntax (e.g., "log.*Error", "func\\s+\\w+"). Note: RE2 does not support lookaheads or lookbehinds. Literal braces need escaping (use "interface\\{\\}" to find "interface{}" in Go code). Filter files with the include parameter using glob patterns (e.g., "*.go", "*.{ts,tsx}").`,
+		`Search file contents using RE2 regex. Returns matching lines with file paths and line numbers. ALWAYS use this tool for content search — never use bash grep or rg. Supports RE2 regex syntax (e.g., "log.*Error", "func\\s+\\w+"). Note: RE2 does not support lookaheads or lookbehinds. Literal braces need escaping (use "interface\\{\\}" to find "interface{}" in Go code). Filter files with the include parameter using glob patterns (e.g., "*.go", "*.{ts,tsx}"). Set context (or before/after) to show lines around each match, like rg -C/-B/-A: matching lines are "path:N: text", context lines "path-N- text", and "--" separates non-adjacent hunks. Only matching lines count toward the 50-result limit. Set ignore_case for a case-insensitive search and word to match whole words only.`,
 		json.RawMessage(`{
 			"type": "object",
 			"properties": {
@@ -111,6 +247,26 @@ func (r *Registry) registerReadOnlyTools() {
 				"include": {
 					"type": "string",
 					"description": "Glob pattern to filter filenames (e.g., '*.go', '*.{ts,tsx}')"
+				},
+				"ignore_case": {
+					"type": "boolean",
+					"description": "Match regardless of case, like prefixing the pattern with (?i) (default false)"
+				},
+				"word": {
+					"type": "boolean",
+					"description": "Match only whole words: the pattern must start and end at word boundaries (default false)"
+				},
+				"context": {
+					"type": "integer",
+					"description": "Lines of context to show before and after each match (default 0, at most 10)"
+				},
+				"before": {
+					"type": "integer",
+					"description": "Lines of context before each match; overrides context"
+				},
+				"after": {
+					"type": "integer",
+					"description": "Lines of context after each match; overrides context"
 				}
 			},
 			"required": ["pattern"]
@@ -118,13 +274,22 @@ func (r *Registry) registerReadOnlyTools() {
 		r.grepTool,
 	)
 
-	r.register("ls", "List directory contents with file/directory indicators and sizes. Can only list directories, not files. Use glob to find files by pattern.",
+	r.register("ls", "List directory contents with file/directory indicators and sizes. Can only list directories, not files. Use glob to find files by pattern. Sort by size to find the largest files, or by mtime to find recently changed ones.",
 		json.RawMessage(`{
 			"type": "object",
 			"properties": {
 				"path": {
 					"type": "string",
 					"description": "Directory path to list (default: working directory)"
+				},
+				"sort": {
+					"type": "string",
+					"enum": ["name", "size", "mtime"],
+					"description": "Order: name (A to Z, default), size (largest first), or mtime (newest first, with modification times shown)"
+				},
+				"reverse": {
+					"type": "boolean",
+					"description": "Reverse the order (default: false)"
 				}
 			}
 		}`),
@@ -132,7 +297,7 @@ func (r *Registry) registerReadOnlyTools() {
 	)
 
 	r.register("read",
-		`Read file contents with line numbers (cat -n format, 1-indexed). Use start_line/end_line for large files to read specific sections. Can only read files, not directories — use ls for directories. Read multiple files in parallel when you need to understand several files at once. Always use this tool instead of bash cat, head, or tail.`,
+		`Read file contents with line numbers (cat -n format, 1-indexed). Use start_line/end_line for large files to read specific sections. Without a range, at most 500 lines are returned; a longer file's result ends with a footer like [truncated: true, total_lines: 1200, shown: 1-500, next_range: 501-1000] — to see more, read next_range as start_line/end_line instead of guessing. Can only read files, not directories — use ls for directories. Read multiple files in parallel when you need to understand several files at once. Always use this tool instead of bash cat, head, or tail. JSON files are pretty-printed with sorted keys and CSV files are shown as a table of the header and first rows; pass raw=true (or a line range) to get the numbered file lines, e.g. before editing. UTF-16 files with a byte order mark are decoded automatically; for other non-UTF-8 files pass encoding. Writes and edits of the file then keep its encoding.`,
 		json.RawMessage(`{
 			"type": "object",
 			"properties": {
@@ -147,6 +312,15 @@ func (r *Registry) registerReadOnlyTools() {
 				"end_line": {
 					"type": "integer",
 					"description": "Last line to read (1-indexed, inclusive)"
+				},
+				"raw": {
+					"type": "boolean",
+					"description": "Show numbered file lines even for JSON/CSV files (default: false)"
+				},
+				"encoding": {
+					"type": "string",
+					"enum": ["utf-8", "utf-16le", "utf-16be", "latin-1"],
+					"description": "Character encoding of the file (default: utf-8, or UTF-16 from a byte order mark)"
 				}
 			},
 			"required": ["path"]
@@ -159,7 +333,7 @@ func (r *Registry) registerBuiltins() {
 	r.registerReadOnlyTools()
 
 	r.register("write",
-		`Create or overwrite a file with the given content. Creates parent directories if needed. User confirmation required. ALWAYS prefer editing existing files over writing new ones — use the edit tool to modify existing files. Never proactively create documentation files (*.md) or README files unless explicitly requested.`,
+		`Create or overwrite a file with the given content. Creates parent directories if needed. User confirmation required. For a very large file, use write_chunk so an interruption does not lose the content. ALWAYS prefer editing existing files over writing new ones — use the edit tool to modify existing files. Never proactively create documentation files (*.md) or README files unless explicitly requested.`,
 		json.RawMessage(`{
 			"type": "object",
 			"properties": {
@@ -177,6 +351,33 @@ func (r *Registry) registerBuiltins() {
 		r.writeTool,
 	)
 
+	r.register("write_chunk",
+		`Write a large file in parts instead of one huge write call. Each call appends content to the file's staged content, kept outside the project; the file itself changes only when you call with final=true, which writes everything staged at once after user confirmation, like write. Staged parts survive an interrupted turn: call with just the path to see how much is staged and how it ends, then continue from there. Use restart=true to discard what is staged and start over. Chunks are joined exactly as sent, so end each one with a newline unless the next continues the same line.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"path": {
+					"type": "string",
+					"description": "File path to write"
+				},
+				"content": {
+					"type": "string",
+					"description": "Next part of the file, appended to what is staged"
+				},
+				"final": {
+					"type": "boolean",
+					"description": "After appending content, write the whole staged file (default: false)"
+				},
+				"restart": {
+					"type": "boolean",
+					"description": "Discard the staged content before appending (default: false)"
+				}
+			},
+			"required": ["path"]
+		}`),
+		r.writeChunkTool,
+	)
+
 	r.register("edit",
 		`Edit a file by replacing an exact string match. The old_str must appear exactly once in the file. When editing text from read tool output, preserve the exact indentation (tabs/spaces) as shown in the file content — do not include line numbers from the read output. If the edit fails because old_str is not unique, include more surrounding context lines to make it unique. Always prefer editing existing files over creating new ones.`,
 		json.RawMessage(`{
@@ -200,6 +401,29 @@ func (r *Registry) registerBuiltins() {
 		r.editTool,
 	)
 
+	r.register("rename",
+		`Rename a symbol or replace a word across the project in one change. Replaces every occurrence of old_str in every matching file, but only whole-word occurrences: "user" does not match inside "username" or "super_user". The user confirms after seeing the diff of every file, and all files are written together or not at all. Use this instead of many edit calls for a project-wide rename; use edit for changes that differ from place to place. Check the occurrences with grep first, since it also replaces matches in comments and strings.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"old_str": {
+					"type": "string",
+					"description": "Exact text to replace, matched as a whole word"
+				},
+				"new_str": {
+					"type": "string",
+					"description": "Replacement text"
+				},
+				"include": {
+					"type": "string",
+					"description": "Glob pattern to filter filenames (e.g., '*.go')"
+				}
+			},
+			"required": ["old_str", "new_str"]
+		}`),
+		r.renameTool,
+	)
+
 	r.register("bash",
 		`Execute a shell command in the working directory. Use for terminal operations like git, builds, tests, and other system commands. Do NOT use bash for file operations (reading, writing, editing, searching) — use the dedicated tools instead. Specifically, do not use cat, head, tail, sed, awk, find, grep, or echo when a dedicated tool exists.
 
@@ -225,6 +449,116 @@ Git safety: Never force-push, reset --hard, use --no-verify, or amend unless the
 		r.bashTool,
 	)
 
+	r.register("git_branch",
+		`List git branches and show the current branch. Use this instead of running git branch through bash.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"all": {
+					"type": "boolean",
+					"description": "Include remote-tracking branches (default: false)"
+				}
+			}
+		}`),
+		r.gitBranchTool,
+	)
+
+	r.register("git_checkout",
+		`Switch to another git branch, or create one with create=true. Use this instead of running git checkout through bash. Requires user confirmation. Refuses when the working tree has uncommitted changes unless force=true; force only skips that check — git still refuses a switch that would overwrite local changes, and nothing is discarded.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"branch": {
+					"type": "string",
+					"description": "Branch to switch to"
+				},
+				"create": {
+					"type": "boolean",
+					"description": "Create the branch from the current HEAD (default: false)"
+				},
+				"force": {
+					"type": "boolean",
+					"description": "Switch even if the working tree has uncommitted changes, carrying them over (default: false)"
+				}
+			},
+			"required": ["branch"]
+		}`),
+		r.gitCheckoutTool,
+	)
+
+	r.register("git_commit",
+		`Commit changes to git. Use this instead of running git commit through bash, and only when the user asks for a commit. Pass the files to commit; only they are staged and committed, and other staged changes are left alone. With neither files nor all, commits what is already staged. Set all=true (like "git add -A") only when the user explicitly asked to commit everything. The user confirms after seeing the staged diff. Never amends or force-commits.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"message": {
+					"type": "string",
+					"description": "Commit message: a short subject line, optionally followed by a blank line and a body"
+				},
+				"files": {
+					"type": "array",
+					"items": {"type": "string"},
+					"description": "Files to stage and commit, relative to the working directory"
+				},
+				"all": {
+					"type": "boolean",
+					"description": "Stage and commit every change, including untracked files (default: false)"
+				}
+			},
+			"required": ["message"]
+		}`),
+		r.gitCommitTool,
+	)
+
+	r.register("scratch_write",
+		`Write a scratch file: working space for intermediate results (notes, generated data, partial outputs) that are not part of the project. Scratch files live in a temporary directory outside the project, need no confirmation, are not checkpointed, and are deleted when the session ends. Never use scratch for changes the user asked for — use write and edit for project files.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {
+					"type": "string",
+					"description": "Scratch file name, relative to the scratch directory (e.g., 'notes.txt', 'data/rows.csv')"
+				},
+				"content": {
+					"type": "string",
+					"description": "Content to write, replacing any earlier content"
+				}
+			},
+			"required": ["name", "content"]
+		}`),
+		r.scratchWriteTool,
+	)
+
+	r.register("scratch_read",
+		`Read a scratch file written earlier in this session with scratch_write.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {
+					"type": "string",
+					"description": "Scratch file name"
+				}
+			},
+			"required": ["name"]
+		}`),
+		r.scratchReadTool,
+	)
+
+	r.register("scratch_list",
+		`List the scratch files written in this session, with sizes.`,
+		json.RawMessage(`{
+			"type": "object",
+			"properties": {}
+		}`),
+		r.scratchListTool,
+	)
+
+	r.registerExplore()
+}
+
+// registerExplore registers the explore tool, which delegates research to
+// the sub-agent set by SetExploreFunc.
+func (r *Registry) registerExplore() {
 	r.register("explore",
 		`Explore the codebase to answer broad questions by delegating to a focused sub-agent. The sub-agent has its own context and read-only tools (glob, grep, ls, read). Use this for questions like "how does authentication work?", "what's the project structure?", or "find all API endpoints". Do NOT use this for direct tasks like editing files or running commands — only for research and exploration.`,
 		json.RawMessage(`{
@@ -233,11 +567,27 @@ Git safety: Never force-push, reset --hard, use --no-verify, or amend unless the
 				"task": {
 					"type": "string",
 					"description": "What to explore or research in the codebase"
+				},
+				"path": {
+					"type": "string",
+					"description": "Optional subdirectory to scope the exploration to (default: working directory). Scoping to the relevant package makes exploration faster and more focused."
+				},
+				"roots": {
+					"type": "array",
+					"items": {"type": "string"},
+					"description": "Optional absolute directories outside the project the sub-agent may also read, such as a dependency's source. Only directories the user made available can be given; they are listed in the Environment section."
+				},
+				"max_iterations": {
+					"type": "integer",
+					"description": "Optional cap on the sub-agent's model requests. Lower it for a quick lookup, raise it for a question that spans much of the codebase."
+				},
+				"max_tool_calls": {
+					"type": "integer",
+					"description": "Optional cap on the sub-agent's tool calls in total. When it is reached, the sub-agent summarizes what it found so far."
 				}
 			},
 			"required": ["task"]
 		}`),
 		r.exploreTool,
 	)
-
 }
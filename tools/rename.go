@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type renameInput struct {
+	OldStr  string `json:"old_str"`
+	NewStr  string `json:"new_str"`
+	Include string `json:"include"`
+}
+
+// FileChange is one file's part of a change spanning several files.
+type FileChange struct {
+	Path    string // relative to the working directory
+	Old     string // content before the change
+	New     string // content after the change
+	absPath string
+	mode    os.FileMode
+	count   int
+}
+
+func (r *Registry) renameTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[renameInput](input)
+	if err != nil {
+		return "", err
+	}
+	if params.OldStr == "" {
+		return "", fmt.Errorf("old_str is required")
+	}
+	if params.OldStr == params.NewStr {
+		return "", fmt.Errorf("old_str and new_str are the same")
+	}
+
+	var changes []FileChange
+	total := 0
+
+	err = filepath.WalkDir(r.workDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if r.skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if params.Include != "" {
+			if matched, _ := filepath.Match(params.Include, d.Name()); !matched {
+				return nil
+			}
+		}
+		if isBinaryFile(path) || r.checkProtected(path) != nil {
+			return nil
+		}
+
+		data, err := r.readFile(path)
+		if err != nil {
+			return nil
+		}
+		content := string(data)
+		newContent, n := replaceWords(content, params.OldStr, params.NewStr)
+		if n == 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(r.workDir, path)
+		changes = append(changes, FileChange{
+			Path:    filepath.ToSlash(rel),
+			Old:     content,
+			New:     newContent,
+			absPath: path,
+			mode:    info.Mode(),
+			count:   n,
+		})
+		total += n
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(changes) == 0 {
+		return fmt.Sprintf("No occurrences of %q found.", params.OldStr), nil
+	}
+
+	return "", &NeedsConfirmation{
+		Tool:    "rename",
+		Path:    fmt.Sprintf("%d file(s)", len(changes)),
+		Changes: changes,
+		Execute: func() (string, error) {
+			if err := r.applyChanges(changes); err != nil {
+				return "", err
+			}
+			var out strings.Builder
+			fmt.Fprintf(&out, "Renamed %q to %q: %d occurrence(s) in %d file(s)\n", params.OldStr, params.NewStr, total, len(changes))
+			for _, c := range changes {
+				fmt.Fprintf(&out, "%s (%d)\n", c.Path, c.count)
+			}
+			return out.String(), nil
+		},
+	}
+}
+
+// replaceWords replaces every occurrence of old in content that is not part
+// of a longer word, returning the result and the number of replacements. An
+// end of old that is a word character must not touch another one.
+func replaceWords(content, old, new string) (string, int) {
+	first, _ := utf8.DecodeRuneInString(old)
+	last, _ := utf8.DecodeLastRuneInString(old)
+	checkBefore, checkAfter := isWordRune(first), isWordRune(last)
+
+	var out strings.Builder
+	count, start := 0, 0
+	for i := 0; i <= len(content)-len(old); {
+		j := strings.Index(content[i:], old)
+		if j < 0 {
+			break
+		}
+		at, end := i+j, i+j+len(old)
+		before, _ := utf8.DecodeLastRuneInString(content[:at])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if checkBefore && at > 0 && isWordRune(before) || checkAfter && end < len(content) && isWordRune(after) {
+			i = at + 1
+			continue
+		}
+		out.WriteString(content[start:at])
+		out.WriteString(new)
+		start, i = end, end
+		count++
+	}
+	if count == 0 {
+		return content, 0
+	}
+	out.WriteString(content[start:])
+	return out.String(), count
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// applyChanges writes every change, or none: it fails without writing if a
+// file changed since the change was prepared, and restores the files already
+// written if a later write fails.
+func (r *Registry) applyChanges(changes []FileChange) error {
+	for _, c := range changes {
+		data, err := r.readFile(c.absPath)
+		if err != nil {
+			return err
+		}
+		if string(data) != c.Old {
+			return fmt.Errorf("%s changed since the rename was prepared; nothing was written", c.Path)
+		}
+	}
+	for i, c := range changes {
+		if err := AtomicWrite(c.absPath, []byte(c.New), c.mode); err != nil {
+			for _, done := range changes[:i] {
+				AtomicWrite(done.absPath, []byte(done.Old), done.mode)
+				r.index.invalidate(done.absPath)
+			}
+			return fmt.Errorf("write %s: %w; earlier files were restored", c.Path, err)
+		}
+		r.index.invalidate(c.absPath)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// safeCommand is one entry of the safe bash command allowlist.
+type safeCommand struct {
+	prefix string         // matched on a word boundary
+	re     *regexp.Regexp // or, if set, matched against the whole command
+}
+
+// shellMetachars let one command run or redirect into another, so a command
+// containing any of them is never treated as safe.
+const shellMetachars = ";&|<>`\n\r"
+
+// SetSafeCommands sets the bash commands that run without confirmation. An
+// entry is either a command prefix, matched on a word boundary ("git status"
+// matches "git status -s" but not "git stash"), or a regular expression
+// prefixed with "re:" that must match the whole command. Commands that chain,
+// pipe, redirect, or substitute are never safe, whatever the allowlist says,
+// but that is all a prefix checks: any arguments follow it, so "git diff"
+// also allows "git diff --output=notes.txt". List only commands that are
+// read-only with every argument.
+func (r *Registry) SetSafeCommands(patterns []string) error {
+	var safe []safeCommand
+	for _, p := range patterns {
+		if expr, ok := strings.CutPrefix(p, "re:"); ok {
+			re, err := regexp.Compile(`^(?:` + expr + `)$`)
+			if err != nil {
+				return fmt.Errorf("invalid safe command pattern %q: %w", p, err)
+			}
+			safe = append(safe, safeCommand{re: re})
+			continue
+		}
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			safe = append(safe, safeCommand{prefix: p})
+		}
+	}
+	r.safe = safe
+	return nil
+}
+
+// isSafeCommand reports whether a bash command matches the allowlist.
+func (r *Registry) isSafeCommand(command string) bool {
+	if len(r.safe) == 0 || strings.ContainsAny(command, shellMetachars) || strings.Contains(command, "$(") {
+		return false
+	}
+	command = strings.Join(strings.Fields(command), " ")
+	for _, s := range r.safe {
+		if s.re != nil {
+			if s.re.MatchString(command) {
+				return true
+			}
+		} else if command == s.prefix || strings.HasPrefix(command, s.prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReadOnlyCall is IsReadOnly for a specific call: besides the read-only
+// tools, it includes bash commands on the safe allowlist.
+func (r *Registry) IsReadOnlyCall(name string, input json.RawMessage) bool {
+	if r.IsReadOnly(name) {
+		return true
+	}
+	if name != "bash" {
+		return false
+	}
+	var params bashInput
+	if err := json.Unmarshal(input, &params); err != nil {
+		return false
+	}
+	return r.isSafeCommand(params.Command)
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type scratchWriteInput struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type scratchReadInput struct {
+	Name string `json:"name"`
+}
+
+// scratchPath returns the absolute path of the scratch file name, creating
+// the session's scratch directory on first use when create is set. Names
+// are relative to the scratch directory and cannot leave it.
+func (r *Registry) scratchPath(name string, create bool) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("name %q must be relative to the scratch directory", name)
+	}
+	dir, err := r.scratchRoot(create)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "", fmt.Errorf("scratch file %q not found", name)
+	}
+	path, err := ValidatePath(dir, name)
+	if err != nil || path == dir {
+		return "", fmt.Errorf("name %q is outside the scratch directory", name)
+	}
+	return path, nil
+}
+
+// scratchRoot returns the session's scratch directory, or "" if it has not
+// been created and create is false.
+func (r *Registry) scratchRoot(create bool) (string, error) {
+	r.scratchMu.Lock()
+	defer r.scratchMu.Unlock()
+	if r.scratchDir == "" && create {
+		dir, err := os.MkdirTemp("", "pilot-scratch-*")
+		if err != nil {
+			return "", fmt.Errorf("create scratch directory: %w", err)
+		}
+		r.scratchDir = dir
+	}
+	return r.scratchDir, nil
+}
+
+// removeScratch deletes the scratch directory and everything in it.
+func (r *Registry) removeScratch() {
+	r.scratchMu.Lock()
+	defer r.scratchMu.Unlock()
+	if r.scratchDir != "" {
+		os.RemoveAll(r.scratchDir)
+		r.scratchDir = ""
+	}
+}
+
+func (r *Registry) scratchWriteTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[scratchWriteInput](input)
+	if err != nil {
+		return "", err
+	}
+	path, err := r.scratchPath(params.Name, true)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(params.Content), 0644); err != nil {
+		return "", fmt.Errorf("write scratch file: %w", err)
+	}
+	return fmt.Sprintf("Wrote scratch file %s (%d bytes)", params.Name, len(params.Content)), nil
+}
+
+func (r *Registry) scratchReadTool(ctx context.Context, input json.RawMessage) (string, error) {
+	params, err := parseInput[scratchReadInput](input)
+	if err != nil {
+		return "", err
+	}
+	path, err := r.scratchPath(params.Name, false)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("scratch file %q not found", params.Name)
+		}
+		return "", fmt.Errorf("read scratch file: %w", err)
+	}
+	if len(data) == 0 {
+		return "(empty file)", nil
+	}
+	return string(data), nil
+}
+
+func (r *Registry) scratchListTool(ctx context.Context, input json.RawMessage) (string, error) {
+	dir, err := r.scratchRoot(false)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "No scratch files.", nil
+	}
+
+	var lines []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		lines = append(lines, fmt.Sprintf("%s (%s)", filepath.ToSlash(rel), formatSize(info.Size())))
+		return nil
+	})
+	if len(lines) == 0 {
+		return "No scratch files.", nil
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
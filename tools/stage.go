@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+)
+
+// StageContent records content as the pending new content of path, a write
+// or edit held for review instead of applied. Until ClearStaged, read,
+// write, and edit see the staged content in place of the file on disk, so
+// later calls in the turn build on it. glob, grep, and bash still see the
+// disk.
+func (r *Registry) StageContent(path, content string) error {
+	absPath, err := ValidatePath(r.workDir, path)
+	if err != nil {
+		return err
+	}
+	r.stagedMu.Lock()
+	defer r.stagedMu.Unlock()
+	if r.staged == nil {
+		r.staged = make(map[string]string)
+	}
+	r.staged[absPath] = content
+	return nil
+}
+
+// ClearStaged drops all staged content, applied or not.
+func (r *Registry) ClearStaged() {
+	r.stagedMu.Lock()
+	defer r.stagedMu.Unlock()
+	r.staged = nil
+}
+
+// stagedContent returns the staged content of absPath, if any.
+func (r *Registry) stagedContent(absPath string) (string, bool) {
+	r.stagedMu.Lock()
+	defer r.stagedMu.Unlock()
+	content, ok := r.staged[absPath]
+	return content, ok
+}
+
+// readFile returns the staged content of absPath, or else the file on disk.
+func (r *Registry) readFile(absPath string) ([]byte, error) {
+	if content, ok := r.stagedContent(absPath); ok {
+		return []byte(content), nil
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	return data, nil
+}
@@ -1,12 +1,18 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf16"
 )
 
 func setupTestDir(t *testing.T) string {
@@ -97,6 +103,196 @@ func TestGrepTool(t *testing.T) {
 	}
 }
 
+func TestGrepFlags(t *testing.T) {
+	dir := setupTestDir(t)
+	r := NewRegistry(dir)
+
+	tests := []struct {
+		name  string
+		input grepInput
+		want  string // "" for no match
+	}{
+		{"case-sensitive by default", grepInput{Pattern: "FUNC"}, ""},
+		{"ignore case", grepInput{Pattern: "FUNC", IgnoreCase: true}, "hello.go:3: func main() {}"},
+		{"word rejects a partial word", grepInput{Pattern: "mai", Word: true}, ""},
+		{"word", grepInput{Pattern: "main|mai", Word: true}, "hello.go:1: package main"},
+		{"word and ignore case", grepInput{Pattern: "MAIN", Word: true, IgnoreCase: true}, "hello.go:3: func main() {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(tt.input)
+			result, err := r.Execute(context.Background(), "grep", input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.want == "" {
+				if !strings.Contains(result, "No matches") {
+					t.Errorf("expected no match, got: %s", result)
+				}
+				return
+			}
+			if !strings.Contains(result, tt.want) {
+				t.Errorf("expected %q in result, got: %s", tt.want, result)
+			}
+		})
+	}
+}
+
+func TestGrepContext(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\nMATCH\nb\nMATCH\nc\nd\ne\nf\nMATCH\ng\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("MATCH\nx\n"), 0644)
+	r := NewRegistry(dir)
+	intp := func(n int) *int { return &n }
+
+	tests := []struct {
+		name  string
+		input grepInput
+		want  string
+	}{
+		{"no context", grepInput{Pattern: "MATCH"},
+			"a.txt:2: MATCH\na.txt:4: MATCH\na.txt:9: MATCH\nb.txt:1: MATCH\n"},
+		// The windows of lines 2 and 4 overlap on line 3 and merge
+		{"overlapping windows merge", grepInput{Pattern: "MATCH", Context: 1},
+			"a.txt-1- a\na.txt:2: MATCH\na.txt-3- b\na.txt:4: MATCH\na.txt-5- c\n--\n" +
+				"a.txt-8- f\na.txt:9: MATCH\na.txt-10- g\n--\nb.txt:1: MATCH\nb.txt-2- x\n"},
+		{"after overrides context", grepInput{Pattern: "MATCH", Context: 3, Before: intp(0), After: intp(2)},
+			"a.txt:2: MATCH\na.txt-3- b\na.txt:4: MATCH\na.txt-5- c\na.txt-6- d\n--\n" +
+				"a.txt:9: MATCH\na.txt-10- g\n--\nb.txt:1: MATCH\nb.txt-2- x\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(tt.input)
+			result, err := r.Execute(context.Background(), "grep", input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", result, tt.want)
+			}
+		})
+	}
+
+	input, _ := json.Marshal(grepInput{Pattern: "MATCH", Context: -1})
+	if _, err := r.Execute(context.Background(), "grep", input); err == nil {
+		t.Error("expected an error for negative context")
+	}
+}
+
+func TestGrepContextCountsMatchesOnly(t *testing.T) {
+	dir := t.TempDir()
+	var content strings.Builder
+	for i := range 60 {
+		fmt.Fprintf(&content, "hit %d\nfiller\n", i)
+	}
+	os.WriteFile(filepath.Join(dir, "many.txt"), []byte(content.String()), 0644)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(grepInput{Pattern: "hit", Context: 1})
+	result, err := r.Execute(context.Background(), "grep", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := strings.Count(result, "many.txt:"); n != 50 {
+		t.Errorf("expected 50 matching lines, got %d", n)
+	}
+	if !strings.Contains(result, "many.txt-100- filler") || !strings.Contains(result, "... and 10 more matches") {
+		t.Errorf("expected context after the last shown match and the rest counted, got:\n%s", result)
+	}
+	if strings.Contains(result, "hit 50") {
+		t.Error("expected no match past the limit shown as context")
+	}
+}
+
+func TestGrepIndexMatchesScanner(t *testing.T) {
+	dir := setupTestDir(t)
+	os.WriteFile(filepath.Join(dir, "data.bin"), []byte("func main\x00binary"), 0644)
+	os.WriteFile(filepath.Join(dir, "empty.go"), nil, 0644)
+
+	indexed := NewRegistry(dir)
+	scanned := NewRegistry(dir)
+	scanned.SetGrepIndex(false)
+
+	patterns := []string{
+		"func main",
+		"package (main|sub)",
+		"(?i)hello",
+		"x = \\d+",
+		"Test[A-Z]\\w+",
+		"a",
+		"nonexistent_string_xyz",
+	}
+	for _, pattern := range patterns {
+		input, _ := json.Marshal(grepInput{Pattern: pattern})
+		// Run twice so the second indexed search uses the built entries
+		for range 2 {
+			want, err := scanned.Execute(context.Background(), "grep", input)
+			if err != nil {
+				t.Fatalf("scan %q: %v", pattern, err)
+			}
+			got, err := indexed.Execute(context.Background(), "grep", input)
+			if err != nil {
+				t.Fatalf("indexed %q: %v", pattern, err)
+			}
+			if got != want {
+				t.Errorf("pattern %q: indexed result differs\nindexed: %s\nscanned: %s", pattern, got, want)
+			}
+		}
+	}
+}
+
+func TestGrepIndexInvalidatedByEdit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	os.WriteFile(path, []byte("find the needle here\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("nothing to see\n"), 0644)
+	r := NewRegistry(dir)
+
+	grep := func(pattern string) string {
+		t.Helper()
+		input, _ := json.Marshal(grepInput{Pattern: pattern})
+		result, err := r.Execute(context.Background(), "grep", input)
+		if err != nil {
+			t.Fatalf("grep %q: %v", pattern, err)
+		}
+		return result
+	}
+	confirm := func(tool string, input any) {
+		t.Helper()
+		raw, _ := json.Marshal(input)
+		_, err := r.Execute(context.Background(), tool, raw)
+		nc, ok := err.(*NeedsConfirmation)
+		if !ok {
+			t.Fatalf("%s: expected *NeedsConfirmation, got %T: %v", tool, err, err)
+		}
+		if _, err := nc.Execute(); err != nil {
+			t.Fatalf("%s: %v", tool, err)
+		}
+	}
+
+	if got := grep("needle"); !strings.Contains(got, "a.txt:1") {
+		t.Fatalf("expected match in a.txt, got: %s", got)
+	}
+
+	// Same size, and the old mtime restored: only the edit tool's
+	// invalidation can tell the index the content changed.
+	info, _ := os.Stat(path)
+	confirm("edit", editInput{Path: "a.txt", OldStr: "needle", NewStr: "noodle"})
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+
+	if got := grep("needle"); !strings.Contains(got, "No matches") {
+		t.Errorf("expected no match after edit, got: %s", got)
+	}
+	if got := grep("noodle"); !strings.Contains(got, "a.txt:1") {
+		t.Errorf("expected edited text to match, got: %s", got)
+	}
+
+	confirm("write", writeInput{Path: "b.txt", Content: "a needle now\n"})
+	if got := grep("needle"); !strings.Contains(got, "b.txt:1") {
+		t.Errorf("expected match in written file, got: %s", got)
+	}
+}
+
 func TestReadTool(t *testing.T) {
 	dir := setupTestDir(t)
 	r := NewRegistry(dir)
@@ -134,191 +330,1836 @@ func TestReadTool(t *testing.T) {
 	}
 }
 
-func TestLsTool(t *testing.T) {
+func TestDenyRead(t *testing.T) {
 	dir := setupTestDir(t)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("API_KEY=hello\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "sub", ".ssh"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", ".ssh", "config.go"), []byte("package hello\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	credentials := filepath.Join(dir, "conf", "credentials")
+	os.WriteFile(credentials, []byte("hello"), 0600)
+
 	r := NewRegistry(dir)
+	r.SetDenyRead(append([]string{credentials}, DefaultDenyRead...))
 
-	input, _ := json.Marshal(lsInput{})
-	result, err := r.Execute(context.Background(), "ls", input)
+	for _, path := range []string{".env", "sub/.ssh/config.go", credentials} {
+		input, _ := json.Marshal(readInput{Path: path})
+		if _, err := r.Execute(context.Background(), "read", input); err == nil || !strings.Contains(err.Error(), "deny-read list") {
+			t.Errorf("read %s: expected a deny-read error, got %v", path, err)
+		}
+	}
+	input, _ := json.Marshal(readInput{Path: "hello.go"})
+	if _, err := r.Execute(context.Background(), "read", input); err != nil {
+		t.Errorf("expected hello.go readable, got %v", err)
+	}
+
+	input, _ = json.Marshal(grepInput{Pattern: "hello"})
+	result, err := r.Execute(context.Background(), "grep", input)
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatalf("grep: %v", err)
 	}
-	for _, want := range []string{"hello.go", "sub/"} {
-		if !strings.Contains(result, want) {
-			t.Errorf("expected %q in result, got: %s", want, result)
-		}
+	if strings.Contains(result, "API_KEY") || strings.Contains(result, ".ssh") || !strings.Contains(result, "3 paths on the deny-read list") {
+		t.Errorf("expected denied files left out of grep, got:\n%s", result)
+	}
+
+	input, _ = json.Marshal(globInput{Pattern: "**/*"})
+	result, err = r.Execute(context.Background(), "glob", input)
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if strings.Contains(result, ".env") || strings.Contains(result, ".ssh") || !strings.Contains(result, "hello.go") || !strings.Contains(result, "deny-read list") {
+		t.Errorf("expected denied files left out of glob, got:\n%s", result)
 	}
 }
 
-func TestValidatePath(t *testing.T) {
-	dir := t.TempDir()
+func TestReadToolTruncationFooter(t *testing.T) {
+	dir := setupTestDir(t)
+	var content strings.Builder
+	for i := 1; i <= 1200; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte(content.String()), 0644)
+	os.WriteFile(filepath.Join(dir, "short.txt"), []byte("one\ntwo\n"), 0644)
+	r := NewRegistry(dir)
 
-	// Use an absolute path that is definitely outside the temp dir
-	outsidePath := filepath.Join(os.TempDir(), "definitely_outside", "nope.txt")
+	read := func(params readInput) string {
+		t.Helper()
+		input, _ := json.Marshal(params)
+		result, err := r.Execute(context.Background(), "read", input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
 
 	tests := []struct {
-		name    string
-		path    string
-		wantErr bool
+		params readInput
+		want   string
 	}{
-		{"relative valid", "foo.txt", false},
-		{"nested valid", "sub/foo.txt", false},
-		{"traversal attack", "../../etc/passwd", true},
-		{"absolute outside", outsidePath, true},
-		{"absolute inside", filepath.Join(dir, "inside.txt"), false},
+		{readInput{Path: "big.txt"}, "[truncated: true, total_lines: 1200, shown: 1-500, next_range: 501-1000]"},
+		{readInput{Path: "big.txt", StartLine: 501}, "[truncated: true, total_lines: 1200, shown: 501-1000, next_range: 1001-1200]"},
+	}
+	for _, tt := range tests {
+		result := read(tt.params)
+		if !strings.Contains(result, tt.want) {
+			t.Errorf("read from %d: expected footer %q, got tail: %s", tt.params.StartLine, tt.want, result[len(result)-150:])
+		}
+		if !strings.Contains(result, "start_line=") {
+			t.Error("footer should say how to read the next range")
+		}
+	}
+
+	// The footer's shown range matches the numbered lines returned
+	result := read(readInput{Path: "big.txt", StartLine: 501})
+	if !strings.Contains(result, " 501 │ line 501\n") || !strings.Contains(result, "1000 │ line 1000\n") || strings.Contains(result, "1001 │") {
+		t.Error("shown range does not match the lines returned")
+	}
+
+	for _, params := range []readInput{
+		{Path: "big.txt", StartLine: 1001},
+		{Path: "big.txt", StartLine: 1, EndLine: 800},
+		{Path: "short.txt"},
+	} {
+		if result := read(params); strings.Contains(result, "truncated") {
+			t.Errorf("read %+v should not be truncated, got footer", params)
+		}
 	}
+}
+
+func TestReadToolRangeHints(t *testing.T) {
+	dir := setupTestDir(t)
+	os.WriteFile(filepath.Join(dir, "short.txt"), []byte("one\ntwo\nthree\n"), 0644)
+	r := NewRegistry(dir)
 
+	tests := []struct {
+		params  readInput
+		wantMsg string
+		wantFix string
+	}{
+		{readInput{Path: "short.txt", StartLine: 3, EndLine: 1}, "start_line 3 is after end_line 1", "retry with start_line=1 end_line=3"},
+		{readInput{Path: "short.txt", StartLine: 10}, "past the end of the file, which has 3 lines", "retry with start_line between 1 and 3"},
+	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			_, err := ValidatePath(dir, tt.path)
-			if tt.wantErr && err == nil {
-				t.Error("expected error for path traversal")
-			}
-			if !tt.wantErr && err != nil {
-				t.Errorf("unexpected error: %v", err)
-			}
-		})
+		input, _ := json.Marshal(tt.params)
+		_, err := r.Execute(context.Background(), "read", input)
+		var argErr *ArgError
+		if !errors.As(err, &argErr) {
+			t.Fatalf("read %+v: expected an ArgError, got %v", tt.params, err)
+		}
+		if !strings.Contains(argErr.Msg, tt.wantMsg) || argErr.Fix != tt.wantFix {
+			t.Errorf("read %+v: got %q with fix %q", tt.params, argErr.Msg, argErr.Fix)
+		}
 	}
 }
 
-func TestWriteToolNeedsConfirmation(t *testing.T) {
+func TestReadToolCRLF(t *testing.T) {
 	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "win.go"), []byte("\ufeffpackage main\r\n\r\nfunc main() {\r\n}\r\n"), 0644)
 	r := NewRegistry(dir)
 
-	input, _ := json.Marshal(writeInput{Path: "newfile.txt", Content: "hello world"})
-	_, err := r.Execute(context.Background(), "write", input)
-	if err == nil {
-		t.Fatal("expected NeedsConfirmation error")
+	input, _ := json.Marshal(readInput{Path: "win.go"})
+	result, err := r.Execute(context.Background(), "read", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.ContainsAny(result, "\r\ufeff") {
+		t.Errorf("expected no \\r or BOM in output, got %q", result)
+	}
+	if !strings.Contains(result, "   1 │ package main\n") || !strings.Contains(result, "   3 │ func main() {\n") {
+		t.Errorf("unexpected lines: %q", result)
+	}
+	if !strings.Contains(result, "CRLF line endings") {
+		t.Errorf("expected CRLF note, got %q", result)
+	}
+
+	input, _ = json.Marshal(grepInput{Pattern: `^package main$`})
+	result, err = r.Execute(context.Background(), "grep", input)
+	if err != nil || !strings.Contains(result, "win.go:1: package main") {
+		t.Errorf("expected anchors to ignore the BOM and CRLF, got %q, %v", result, err)
 	}
 
+	// An old_str copied from the read output matches across the CRLF break
+	input, _ = json.Marshal(editInput{Path: "win.go", OldStr: "func main() {\n}", NewStr: "func main() {\n\tprintln()\n}"})
+	_, err = r.Execute(context.Background(), "edit", input)
 	confirm, ok := err.(*NeedsConfirmation)
 	if !ok {
-		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+		t.Fatalf("expected *NeedsConfirmation, got %v", err)
 	}
-	if confirm.Tool != "write" {
-		t.Errorf("expected tool=write, got %s", confirm.Tool)
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "win.go"))
+	if want := "\ufeffpackage main\r\n\r\nfunc main() {\r\n\tprintln()\r\n}\r\n"; string(data) != want {
+		t.Errorf("expected CRLF preserved, got %q", data)
 	}
+}
 
-	// Execute the confirmation
-	result, err := confirm.Execute()
+func TestReadEditUTF16(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	utf16le := func(s string) []byte {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		return b
+	}
+	os.WriteFile(path, utf16le("\ufeffcafé\r\nnaïve\r\n"), 0644)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(readInput{Path: "notes.txt"})
+	result, err := r.Execute(context.Background(), "read", input)
 	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "   1 │ café\n") || !strings.Contains(result, "   2 │ naïve\n") {
+		t.Errorf("expected decoded lines, got %q", result)
+	}
+	if !strings.Contains(result, "utf-16le, detected from its byte order mark") {
+		t.Errorf("expected encoding note, got %q", result)
+	}
+
+	input, _ = json.Marshal(editInput{Path: "notes.txt", OldStr: "naïve", NewStr: "naïve → wise"})
+	_, err = r.Execute(context.Background(), "edit", input)
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %v", err)
+	}
+	if confirm.NewContent != "\ufeffcafé\r\nnaïve → wise\r\n" {
+		t.Errorf("expected decoded content for the diff, got %q", confirm.NewContent)
+	}
+	if _, err := confirm.Execute(); err != nil {
 		t.Fatalf("execute failed: %v", err)
 	}
-	if !strings.Contains(result, "Successfully wrote") {
-		t.Errorf("unexpected result: %s", result)
+	data, _ := os.ReadFile(path)
+	if want := utf16le("\ufeffcafé\r\nnaïve → wise\r\n"); !bytes.Equal(data, want) {
+		t.Errorf("expected UTF-16LE with BOM preserved, got % x", data)
 	}
 
-	// Verify file was created
-	data, err := os.ReadFile(filepath.Join(dir, "newfile.txt"))
-	if err != nil {
-		t.Fatalf("file not created: %v", err)
+	// A write of the whole file keeps the encoding and the BOM read hid
+	input, _ = json.Marshal(writeInput{Path: "notes.txt", Content: "rewritten\n"})
+	_, err = r.Execute(context.Background(), "write", input)
+	confirm, ok = err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %v", err)
 	}
-	if string(data) != "hello world" {
-		t.Errorf("unexpected content: %s", string(data))
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if want := utf16le("\ufeffrewritten\n"); !bytes.Equal(data, want) {
+		t.Errorf("expected UTF-16LE write, got % x", data)
 	}
 }
 
-func TestEditToolNeedsConfirmation(t *testing.T) {
+func TestReadEditLatin1(t *testing.T) {
 	dir := t.TempDir()
-	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("hello world"), 0644)
+	path := filepath.Join(dir, "legacy.txt")
+	os.WriteFile(path, []byte("caf\xe9 cr\xe8me\n"), 0644)
 	r := NewRegistry(dir)
 
-	input, _ := json.Marshal(editInput{Path: "test.txt", OldStr: "hello", NewStr: "goodbye"})
-	_, err := r.Execute(context.Background(), "edit", input)
-	if err == nil {
-		t.Fatal("expected NeedsConfirmation error")
+	// Without an encoding, read suggests one
+	input, _ := json.Marshal(readInput{Path: "legacy.txt"})
+	result, err := r.Execute(context.Background(), "read", input)
+	if err != nil || !strings.Contains(result, `encoding="latin-1"`) {
+		t.Errorf("expected a latin-1 suggestion, got %q, %v", result, err)
+	}
+
+	input, _ = json.Marshal(readInput{Path: "legacy.txt", Encoding: "latin-1"})
+	result, err = r.Execute(context.Background(), "read", input)
+	if err != nil || !strings.Contains(result, "   1 │ café crème\n") {
+		t.Errorf("expected decoded line, got %q, %v", result, err)
 	}
 
+	input, _ = json.Marshal(editInput{Path: "legacy.txt", OldStr: "crème", NewStr: "brûlée"})
+	_, err = r.Execute(context.Background(), "edit", input)
 	confirm, ok := err.(*NeedsConfirmation)
 	if !ok {
-		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+		t.Fatalf("expected *NeedsConfirmation, got %v", err)
 	}
-
-	result, err := confirm.Execute()
-	if err != nil {
+	if _, err := confirm.Execute(); err != nil {
 		t.Fatalf("execute failed: %v", err)
 	}
-	if !strings.Contains(result, "Successfully edited") {
-		t.Errorf("unexpected result: %s", result)
+	if data, _ := os.ReadFile(path); string(data) != "caf\xe9 br\xfbl\xe9e\n" {
+		t.Errorf("expected latin-1 bytes, got %q", data)
 	}
 
-	data, _ := os.ReadFile(filepath.Join(dir, "test.txt"))
-	if string(data) != "goodbye world" {
-		t.Errorf("unexpected content: %s", string(data))
+	// Characters latin-1 cannot hold are refused before confirmation
+	input, _ = json.Marshal(editInput{Path: "legacy.txt", OldStr: "café", NewStr: "café ☕"})
+	if _, err := r.Execute(context.Background(), "edit", input); err == nil || !strings.Contains(err.Error(), "latin-1") {
+		t.Errorf("expected latin-1 encoding error, got %v", err)
+	}
+
+	input, _ = json.Marshal(readInput{Path: "legacy.txt", Encoding: "ebcdic"})
+	if _, err := r.Execute(context.Background(), "read", input); err == nil {
+		t.Error("expected unsupported encoding error")
 	}
 }
 
-func TestEditToolNoMatch(t *testing.T) {
+func TestReadToolPrettyJSON(t *testing.T) {
 	dir := t.TempDir()
-	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("hello world"), 0644)
+	os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"zeta":1,"alpha":{"b":[1,2],"a":1.50}}`), 0644)
 	r := NewRegistry(dir)
 
-	input, _ := json.Marshal(editInput{Path: "test.txt", OldStr: "nonexistent", NewStr: "replacement"})
-	_, err := r.Execute(context.Background(), "edit", input)
-	if err == nil {
-		t.Fatal("expected error for no match")
+	input, _ := json.Marshal(readInput{Path: "data.json"})
+	result, err := r.Execute(context.Background(), "read", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if _, ok := err.(*NeedsConfirmation); ok {
-		t.Fatal("should not get NeedsConfirmation for no match")
+	want := `{
+  "alpha": {
+    "a": 1.50,
+    "b": [
+      1,
+      2
+    ]
+  },
+  "zeta": 1
+}
+`
+	if !strings.HasSuffix(result, want) {
+		t.Errorf("expected sorted, indented JSON, got:\n%s", result)
+	}
+
+	// Raw mode returns the numbered file line
+	input, _ = json.Marshal(readInput{Path: "data.json", Raw: true})
+	result, err = r.Execute(context.Background(), "read", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, `   1 │ {"zeta":1,`) {
+		t.Errorf("expected raw line, got: %s", result)
 	}
 }
 
-func TestEditToolMultipleMatches(t *testing.T) {
+func TestReadToolInvalidJSONFallsBack(t *testing.T) {
 	dir := t.TempDir()
-	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("aaa\naaa\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{\"a\": \n"), 0644)
 	r := NewRegistry(dir)
 
-	input, _ := json.Marshal(editInput{Path: "test.txt", OldStr: "aaa", NewStr: "bbb"})
-	_, err := r.Execute(context.Background(), "edit", input)
-	if err == nil {
-		t.Fatal("expected error for multiple matches")
+	input, _ := json.Marshal(readInput{Path: "broken.json"})
+	result, err := r.Execute(context.Background(), "read", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if !strings.Contains(err.Error(), "matches 2 times") {
-		t.Errorf("unexpected error: %v", err)
+	if !strings.Contains(result, `   1 │ {"a": `) {
+		t.Errorf("expected raw lines for invalid JSON, got: %s", result)
 	}
 }
 
-func TestBashToolNeedsConfirmation(t *testing.T) {
+func TestReadToolCSVHead(t *testing.T) {
 	dir := t.TempDir()
+	var b strings.Builder
+	b.WriteString("id,name,city\n")
+	for i := 1; i <= 25; i++ {
+		fmt.Fprintf(&b, "%d,user%d,Springfield\n", i, i)
+	}
+	os.WriteFile(filepath.Join(dir, "users.csv"), []byte(b.String()), 0644)
 	r := NewRegistry(dir)
 
-	input, _ := json.Marshal(bashInput{Command: "echo hello"})
-	_, err := r.Execute(context.Background(), "bash", input)
-	if err == nil {
-		t.Fatal("expected NeedsConfirmation error")
+	input, _ := json.Marshal(readInput{Path: "users.csv"})
+	result, err := r.Execute(context.Background(), "read", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-
-	confirm, ok := err.(*NeedsConfirmation)
-	if !ok {
-		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
+	want := []string{
+		"(CSV, 3 columns, 25 data rows; use raw=true for file lines)",
+		"id | name   | city",
+		"---+--------+------------",
+		"1  | user1  | Springfield",
 	}
-	if confirm.Tool != "bash" {
-		t.Errorf("expected tool=bash, got %s", confirm.Tool)
+	for i, w := range want {
+		if lines[i] != w {
+			t.Errorf("line %d = %q, want %q", i, lines[i], w)
+		}
 	}
-
-	result, err := confirm.Execute()
-	if err != nil {
-		t.Fatalf("execute failed: %v", err)
+	if got := lines[len(lines)-2]; got != "20 | user20 | Springfield" {
+		t.Errorf("expected last shown row 20, got %q", got)
+	}
+	if got := lines[len(lines)-1]; got != "... (5 more rows)" {
+		t.Errorf("expected more-rows note, got %q", got)
+	}
+}
+
+func TestLsTool(t *testing.T) {
+	dir := setupTestDir(t)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(lsInput{})
+	result, err := r.Execute(context.Background(), "ls", input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"hello.go", "sub/"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in result, got: %s", want, result)
+		}
+	}
+}
+
+func TestLsToolSort(t *testing.T) {
+	dir := setupTestDir(t)
+	now := time.Now()
+	os.Chtimes(filepath.Join(dir, "readme.md"), now, now)
+	os.Chtimes(filepath.Join(dir, "hello.go"), now.Add(-time.Hour), now.Add(-time.Hour))
+	os.Chtimes(filepath.Join(dir, "hello_test.go"), now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	os.Chtimes(filepath.Join(dir, "sub"), now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+	r := NewRegistry(dir)
+
+	order := func(params lsInput) []string {
+		t.Helper()
+		input, _ := json.Marshal(params)
+		result, err := r.Execute(context.Background(), "ls", input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var names []string
+		for _, line := range strings.Split(strings.TrimSpace(result), "\n") {
+			names = append(names, strings.Fields(line)[0])
+		}
+		return names
+	}
+
+	tests := []struct {
+		params lsInput
+		want   string
+	}{
+		{lsInput{}, "hello.go hello_test.go readme.md sub/"},
+		{lsInput{Sort: "size"}, "hello_test.go hello.go readme.md sub/"},
+		{lsInput{Sort: "size", Reverse: true}, "sub/ readme.md hello.go hello_test.go"},
+		{lsInput{Sort: "mtime"}, "readme.md hello.go hello_test.go sub/"},
+		{lsInput{Sort: "mtime", Reverse: true}, "sub/ hello_test.go hello.go readme.md"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(order(tt.params), " "); got != tt.want {
+			t.Errorf("ls %+v = %s, want %s", tt.params, got, tt.want)
+		}
+	}
+
+	input, _ := json.Marshal(lsInput{Sort: "age"})
+	if _, err := r.Execute(context.Background(), "ls", input); err == nil {
+		t.Error("expected error for unknown sort")
+	}
+}
+
+func TestProjectTree(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{".git", "node_modules/pkg", "dist", "a/b/c/d"} {
+		os.MkdirAll(filepath.Join(dir, d), 0755)
+	}
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "a", "b", "c", "one.go"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "a", "b", "c", "two.go"), []byte("x"), 0644)
+	r := NewRegistry(dir)
+	r.SetIgnoreDirs([]string{"dist"})
+
+	want := "a/\n  b/\n    c/ (3 entries)\nREADME.md\n"
+	if got := r.ProjectTree(); got != want {
+		t.Errorf("ProjectTree() = %q, want %q", got, want)
+	}
+}
+
+func TestDetectProject(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"go.mod", "main.go", "cmd/tool/main.go", "internal/x.go", "scripts/gen.py", "README.md"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+	// Skipped directories are not counted
+	os.MkdirAll(filepath.Join(dir, "node_modules", "dep"), 0755)
+	for i := range 5 {
+		os.WriteFile(filepath.Join(dir, "node_modules", "dep", fmt.Sprintf("f%d.js", i)), []byte("x"), 0644)
+	}
+	os.MkdirAll(filepath.Join(dir, "gen"), 0755)
+	for i := range 5 {
+		os.WriteFile(filepath.Join(dir, "gen", fmt.Sprintf("f%d.py", i)), []byte("x"), 0644)
+	}
+
+	p := DetectProject(dir, []string{"gen"})
+	if p.Files != 6 || p.Language != "go" {
+		t.Errorf("expected 6 files of go, got %d of %q", p.Files, p.Language)
+	}
+	if !p.RootFiles["go.mod"] || !p.RootFiles["cmd"] || p.RootFiles["main.py"] {
+		t.Errorf("unexpected root files: %v", p.RootFiles)
+	}
+
+	if p := DetectProject(t.TempDir(), nil); p.Files != 0 || p.Language != "" {
+		t.Errorf("expected an empty profile, got %+v", p)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := setupTestDir(t)
+	r := NewRegistry(dir)
+	before := r.Fingerprint()
+	if r.Fingerprint() != before {
+		t.Fatal("expected a stable fingerprint for an unchanged tree")
+	}
+
+	os.MkdirAll(filepath.Join(dir, "node_modules"), 0755)
+	os.WriteFile(filepath.Join(dir, "node_modules", "dep.js"), []byte("x"), 0644)
+	if r.Fingerprint() != before {
+		t.Error("expected files in skipped directories to be ignored")
+	}
+
+	os.WriteFile(filepath.Join(dir, "sub", "nested.go"), []byte("package sub\n\nvar x = 4242\n"), 0644)
+	if r.Fingerprint() == before {
+		t.Error("expected the fingerprint to change after a file changed")
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	dir := t.TempDir()
+
+	// Use an absolute path that is definitely outside the temp dir
+	outsidePath := filepath.Join(os.TempDir(), "definitely_outside", "nope.txt")
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"relative valid", "foo.txt", false},
+		{"nested valid", "sub/foo.txt", false},
+		{"traversal attack", "../../etc/passwd", true},
+		{"absolute outside", outsidePath, true},
+		{"absolute inside", filepath.Join(dir, "inside.txt"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidatePath(dir, tt.path)
+			if tt.wantErr && err == nil {
+				t.Error("expected error for path traversal")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWriteToolNeedsConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(writeInput{Path: "newfile.txt", Content: "hello world"})
+	_, err := r.Execute(context.Background(), "write", input)
+	if err == nil {
+		t.Fatal("expected NeedsConfirmation error")
+	}
+
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+	if confirm.Tool != "write" {
+		t.Errorf("expected tool=write, got %s", confirm.Tool)
+	}
+
+	// Execute the confirmation
+	result, err := confirm.Execute()
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if !strings.Contains(result, "Successfully wrote") {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	// Verify file was created
+	data, err := os.ReadFile(filepath.Join(dir, "newfile.txt"))
+	if err != nil {
+		t.Fatalf("file not created: %v", err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("unexpected content: %s", string(data))
+	}
+}
+
+func TestWriteToolBinaryContent(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte("bad \uFFFD char\n"), 0644)
+	r := NewRegistry(dir)
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    string
+	}{
+		{"text", "new.txt", "hello\n", ""},
+		{"null bytes", "new.txt", "PK\x03\x04\x00\x00", "contains null bytes"},
+		{"replacement characters", "new.txt", "caf\uFFFD\n", "replacement characters"},
+		{"replacement characters already there", "old.txt", "still \uFFFD\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(writeInput{Path: tt.path, Content: tt.content})
+			_, err := r.Execute(context.Background(), "write", input)
+			confirm, ok := err.(*NeedsConfirmation)
+			if !ok {
+				t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+			}
+			if tt.want == "" && confirm.Warning != "" {
+				t.Errorf("expected no warning, got %q", confirm.Warning)
+			}
+			if !strings.Contains(confirm.Warning, tt.want) || (tt.want != "" && !strings.Contains(confirm.Warning, "binary")) {
+				t.Errorf("expected a binary content warning with %q, got %q", tt.want, confirm.Warning)
+			}
+		})
+	}
+}
+
+func TestWriteChunk(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte("old\n"), 0644)
+	r := NewRegistry(dir)
+	ctx := context.Background()
+	chunk := func(in writeChunkInput) (string, error) {
+		input, _ := json.Marshal(in)
+		return r.Execute(ctx, "write_chunk", input)
+	}
+
+	for _, part := range []string{"line 1\n", "line 2\n"} {
+		if _, err := chunk(writeChunkInput{Path: "big.txt", Content: part}); err != nil {
+			t.Fatalf("chunk failed: %v", err)
+		}
+	}
+	// Asking with only the path reports progress without changing anything
+	result, err := chunk(writeChunkInput{Path: "big.txt"})
+	if err != nil || !strings.Contains(result, "Staged chunk 2") || !strings.Contains(result, "14 bytes") || !strings.Contains(result, `"line 1\nline 2\n"`) {
+		t.Errorf("unexpected progress: %q, %v", result, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "big.txt")); string(data) != "old\n" {
+		t.Errorf("file changed before final: %q", data)
+	}
+
+	_, err = chunk(writeChunkInput{Path: "big.txt", Content: "line 3\n", Final: true})
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+	if confirm.Tool != "write" || confirm.Preview != "old\n" || confirm.NewContent != "line 1\nline 2\nline 3\n" {
+		t.Errorf("unexpected confirmation: tool=%s preview=%q new=%q", confirm.Tool, confirm.Preview, confirm.NewContent)
+	}
+	cw, _ := r.stagedChunks(filepath.Join(dir, "big.txt"))
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "big.txt")); string(data) != "line 1\nline 2\nline 3\n" {
+		t.Errorf("unexpected content: %q", data)
+	}
+	if _, err := os.Stat(cw.tmpPath); !os.IsNotExist(err) {
+		t.Error("expected staged chunks removed after the write")
+	}
+	if _, err := chunk(writeChunkInput{Path: "big.txt", Final: true}); err == nil || strings.Contains(err.Error(), "confirmation") {
+		t.Errorf("expected nothing staged after the write, got %v", err)
+	}
+}
+
+func TestWriteChunkRestartAndShutdown(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry(dir)
+	ctx := context.Background()
+	chunk := func(in writeChunkInput) error {
+		input, _ := json.Marshal(in)
+		_, err := r.Execute(ctx, "write_chunk", input)
+		return err
+	}
+
+	chunk(writeChunkInput{Path: "out.txt", Content: "draft"})
+	chunk(writeChunkInput{Path: "out.txt", Content: "fresh", Restart: true})
+	err := chunk(writeChunkInput{Path: "out.txt", Final: true})
+	if confirm, ok := err.(*NeedsConfirmation); !ok || confirm.NewContent != "fresh" {
+		t.Fatalf("expected restart to discard the draft, got %v", err)
+	}
+
+	cw, _ := r.stagedChunks(filepath.Join(dir, "out.txt"))
+	r.Shutdown()
+	if _, err := os.Stat(cw.tmpPath); !os.IsNotExist(err) {
+		t.Error("expected Shutdown to remove unwritten chunks")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.txt")); !os.IsNotExist(err) {
+		t.Error("expected no file written without confirmation")
+	}
+}
+
+func TestEditToolNeedsConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("hello world"), 0644)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(editInput{Path: "test.txt", OldStr: "hello", NewStr: "goodbye"})
+	_, err := r.Execute(context.Background(), "edit", input)
+	if err == nil {
+		t.Fatal("expected NeedsConfirmation error")
+	}
+
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+
+	result, err := confirm.Execute()
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if !strings.Contains(result, "Successfully edited") {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "test.txt"))
+	if string(data) != "goodbye world" {
+		t.Errorf("unexpected content: %s", string(data))
+	}
+}
+
+func TestEditToolNoMatch(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("hello world"), 0644)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(editInput{Path: "test.txt", OldStr: "nonexistent", NewStr: "replacement"})
+	_, err := r.Execute(context.Background(), "edit", input)
+	if err == nil {
+		t.Fatal("expected error for no match")
+	}
+	if _, ok := err.(*NeedsConfirmation); ok {
+		t.Fatal("should not get NeedsConfirmation for no match")
+	}
+}
+
+func TestEditToolMultipleMatches(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "test.txt"), []byte("aaa\naaa\n"), 0644)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(editInput{Path: "test.txt", OldStr: "aaa", NewStr: "bbb"})
+	_, err := r.Execute(context.Background(), "edit", input)
+	if err == nil {
+		t.Fatal("expected error for multiple matches")
+	}
+	if !strings.Contains(err.Error(), "matches 2 times") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEditBatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.txt")
+	os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644)
+	r := NewRegistry(dir)
+
+	edit := func(p, oldStr, newStr string) json.RawMessage {
+		input, _ := json.Marshal(editInput{Path: p, OldStr: oldStr, NewStr: newStr})
+		return input
+	}
+	inputs := []json.RawMessage{
+		edit("test.txt", "one\n", "ONE\n"),
+		edit("test.txt", "ONE\ntwo", "ONE\nTWO"), // sees the first edit
+		edit("test.txt", "missing", "x"),
+		edit("other.txt", "three", "THREE"),
+	}
+	if got := r.EditTarget("edit", inputs[0]); got != path {
+		t.Errorf("EditTarget = %q, want %q", got, path)
+	}
+	if got := r.EditTarget("write", inputs[0]); got != "" {
+		t.Errorf("EditTarget for write = %q, want empty", got)
+	}
+
+	confirm, errs := r.EditBatch(inputs)
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if errs[2] == nil || !strings.Contains(errs[2].Error(), "no match") {
+		t.Errorf("expected no-match error, got %v", errs[2])
+	}
+	if errs[3] == nil || !strings.Contains(errs[3].Error(), "mixes") {
+		t.Errorf("expected mixed-path error, got %v", errs[3])
+	}
+	if confirm.Preview != "one\ntwo\nthree\n" || confirm.NewContent != "ONE\nTWO\nthree\n" {
+		t.Errorf("unexpected diff: %q -> %q", confirm.Preview, confirm.NewContent)
+	}
+
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "ONE\nTWO\nthree\n" {
+		t.Errorf("unexpected content: %q", data)
+	}
+
+	confirm, errs = r.EditBatch([]json.RawMessage{edit("test.txt", "nope", "x")})
+	if confirm != nil || errs[0] == nil {
+		t.Errorf("expected no confirmation when every edit fails, got %v, %v", confirm, errs)
+	}
+}
+
+func TestRenameTool(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("func user() {}\nvar username = user()\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "pkg"), 0755)
+	os.WriteFile(filepath.Join(dir, "pkg", "b.go"), []byte("// user and super_user\nx := user()\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("user\n"), 0644)
+	r := NewRegistry(dir)
+
+	rename := func(oldStr, newStr, include string) (*NeedsConfirmation, error) {
+		input, _ := json.Marshal(renameInput{OldStr: oldStr, NewStr: newStr, Include: include})
+		_, err := r.Execute(context.Background(), "rename", input)
+		confirm, ok := err.(*NeedsConfirmation)
+		if !ok {
+			return nil, err
+		}
+		return confirm, nil
+	}
+
+	confirm, err := rename("user", "account", "*.go")
+	if err != nil || confirm == nil {
+		t.Fatalf("expected confirmation, got %v", err)
+	}
+	if len(confirm.Changes) != 2 || confirm.Changes[0].Path != "a.go" || confirm.Changes[1].Path != "pkg/b.go" {
+		t.Fatalf("unexpected changes: %+v", confirm.Changes)
+	}
+	if got := confirm.Changes[0].New; got != "func account() {}\nvar username = account()\n" {
+		t.Errorf("unexpected preview of a.go: %q", got)
+	}
+	if got := confirm.Changes[1].New; got != "// account and super_user\nx := account()\n" {
+		t.Errorf("unexpected preview of pkg/b.go: %q", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.go")); !strings.Contains(string(data), "func user()") {
+		t.Error("file changed before confirmation")
+	}
+
+	result, err := confirm.Execute()
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if !strings.Contains(result, "4 occurrence(s) in 2 file(s)") {
+		t.Errorf("unexpected result: %q", result)
+	}
+	for path, want := range map[string]string{
+		"a.go":      "func account() {}\nvar username = account()\n",
+		"pkg/b.go":  "// account and super_user\nx := account()\n",
+		"notes.txt": "user\n",
+	} {
+		if data, _ := os.ReadFile(filepath.Join(dir, path)); string(data) != want {
+			t.Errorf("%s = %q, want %q", path, data, want)
+		}
+	}
+
+	// A file changed after the preview aborts the whole rename
+	confirm, _ = rename("account", "member", "")
+	os.WriteFile(filepath.Join(dir, "pkg", "b.go"), []byte("account := 1\n"), 0644)
+	if _, err := confirm.Execute(); err == nil || !strings.Contains(err.Error(), "nothing was written") {
+		t.Errorf("expected stale-file error, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.go")); !strings.Contains(string(data), "func account()") {
+		t.Errorf("a.go was written despite the failed rename: %q", data)
+	}
+
+	if confirm, err := rename("nobody", "x", ""); confirm != nil || err != nil {
+		t.Errorf("expected no confirmation without matches, got %v, %v", confirm, err)
+	}
+	if _, err := rename("user", "user", ""); err == nil {
+		t.Error("expected error for identical old_str and new_str")
+	}
+}
+
+func TestReplaceWords(t *testing.T) {
+	tests := []struct {
+		content, old, new, want string
+		count                   int
+	}{
+		{"foo foobar barfoo foo_x foo", "foo", "baz", "baz foobar barfoo foo_x baz", 2},
+		{"a.b a.bc", "a.b", "c.d", "c.d a.bc", 1},
+		{"x->y", "->", ".", "x.y", 1},
+		{"éfoo foo", "foo", "bar", "éfoo bar", 1},
+		{"aa aaa", "aa", "b", "b aaa", 1},
+	}
+	for _, tt := range tests {
+		got, n := replaceWords(tt.content, tt.old, tt.new)
+		if got != tt.want || n != tt.count {
+			t.Errorf("replaceWords(%q, %q) = %q, %d; want %q, %d", tt.content, tt.old, got, n, tt.want, tt.count)
+		}
+	}
+}
+
+func TestBashToolNeedsConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(bashInput{Command: "echo hello"})
+	_, err := r.Execute(context.Background(), "bash", input)
+	if err == nil {
+		t.Fatal("expected NeedsConfirmation error")
+	}
+
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+	if confirm.Tool != "bash" {
+		t.Errorf("expected tool=bash, got %s", confirm.Tool)
+	}
+
+	result, err := confirm.Execute()
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
 	}
 	if !strings.Contains(result, "hello") {
 		t.Errorf("expected hello in output, got: %s", result)
 	}
 }
 
-func TestIsReadOnly(t *testing.T) {
+func TestSafeCommands(t *testing.T) {
+	r := NewRegistry(t.TempDir())
+	if err := r.SetSafeCommands([]string{"git status", "ls", `re:go (vet|build) \./\.\.\.`}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command string
+		safe    bool
+	}{
+		{"git status", true},
+		{"git  status -s", true},
+		{"ls", true},
+		{"ls -la sub", true},
+		{"go vet ./...", true},
+		{"go build ./...", true},
+		{"git stash", false},
+		{"lsof", false},
+		{"go vet ./... -o x", false},
+		{"go test ./...", false},
+		{"ls; rm -rf sub", false},
+		{"git status && touch x", false},
+		{"ls | xargs rm", false},
+		{"ls > out.txt", false},
+		{"ls $(touch x)", false},
+		{"ls `touch x`", false},
+		{"ls\ntouch x", false},
+	}
+	for _, tt := range tests {
+		if got := r.isSafeCommand(tt.command); got != tt.safe {
+			t.Errorf("%q: expected safe=%v", tt.command, tt.safe)
+		}
+	}
+
+	input, _ := json.Marshal(bashInput{Command: "git status"})
+	_, err := r.Execute(context.Background(), "bash", input)
+	if confirm, ok := err.(*NeedsConfirmation); !ok || !confirm.Safe {
+		t.Errorf("expected a safe NeedsConfirmation, got %v", err)
+	}
+	if !r.IsReadOnlyCall("bash", input) || r.IsReadOnlyCall("write", input) {
+		t.Error("expected only the allowlisted bash call to be read-only")
+	}
+
+	if err := r.SetSafeCommands([]string{"re:go (vet"}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestShutdownKillsRunningCommand(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	dir := t.TempDir()
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(bashInput{Command: "sleep 30", Timeout: 60})
+	_, err := r.Execute(context.Background(), "bash", input)
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+
+	done := make(chan string, 1)
+	go func() {
+		result, _ := confirm.Execute()
+		done <- result
+	}()
+
+	// Wait for the command to be tracked
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.jobsMu.Lock()
+		n := len(r.jobs)
+		r.jobsMu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command was never tracked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r.Shutdown()
+
+	select {
+	case result := <-done:
+		if !strings.Contains(result, "Exit code") {
+			t.Errorf("expected killed command to report an exit code, got: %s", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command still running after Shutdown")
+	}
+}
+
+func TestToolTimeout(t *testing.T) {
+	r := NewRegistry(t.TempDir())
+	r.SetToolTimeout(50 * time.Millisecond)
+	stuck := make(chan struct{})
+	defer close(stuck)
+	setTool := func(name string, fn ToolFunc) {
+		for i := range r.tools {
+			if r.tools[i].name == name {
+				r.tools[i].fn = fn
+			}
+		}
+	}
+	// glob blocks without looking at its context, like a hung system call;
+	// grep gives up cooperatively
+	setTool("glob", func(ctx context.Context, input json.RawMessage) (string, error) {
+		<-stuck
+		return "late", nil
+	})
+	setTool("grep", func(ctx context.Context, input json.RawMessage) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	for _, name := range []string{"glob", "grep"} {
+		start := time.Now()
+		_, err := r.Execute(context.Background(), name, json.RawMessage(`{}`))
+		if err == nil || !strings.Contains(err.Error(), name+" timed out after 50ms") {
+			t.Errorf("%s: expected timeout error, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: returned after %s", name, elapsed)
+		}
+	}
+
+	// Cancelling the turn is reported as such, not as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Execute(ctx, "glob", json.RawMessage(`{}`)); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Fast calls and tools without a deadline are unaffected
+	input, _ := json.Marshal(readInput{Path: "missing.txt"})
+	if _, err := r.Execute(context.Background(), "read", input); err == nil || strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected read's own error, got %v", err)
+	}
+	if r.hasDeadline("bash") || r.hasDeadline("write") || r.hasDeadline("explore") || r.hasDeadline("bash_output") {
+		t.Error("expected bash, write, explore, and bash_output to have no deadline")
+	}
+}
+
+func TestBashInterimHandoff(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	r := NewRegistry(t.TempDir())
+	if r.HasTool("bash_output") {
+		t.Fatal("expected bash_output only with an interim delay")
+	}
+	r.SetBashInterim(200 * time.Millisecond)
+	defs := r.Definitions()
+	for i, d := range defs {
+		if d.Function.Name == "bash" && (i+1 >= len(defs) || defs[i+1].Function.Name != "bash_output") {
+			t.Fatal("expected bash_output registered right after bash")
+		}
+	}
+
+	run := func(command string) string {
+		t.Helper()
+		input, _ := json.Marshal(bashInput{Command: command, Timeout: 30})
+		_, err := r.Execute(context.Background(), "bash", input)
+		confirm, ok := err.(*NeedsConfirmation)
+		if !ok {
+			t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+		}
+		result, _ := confirm.Execute()
+		return result
+	}
+	output := func(args string) string {
+		t.Helper()
+		result, err := r.Execute(context.Background(), "bash_output", json.RawMessage(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// A quick command finishes in the foreground as before
+	if got := run("echo quick"); got != "quick\n" {
+		t.Errorf("expected the plain result, got %q", got)
+	}
+
+	// A slow one hands off its output so far and keeps running
+	got := run("echo start; sleep 1; echo end")
+	if !strings.Contains(got, "background as job 1") || !strings.Contains(got, "start") || strings.Contains(got, "end") {
+		t.Fatalf("unexpected interim result: %q", got)
+	}
+	got = output(`{"job_id": 1, "wait": 10}`)
+	if !strings.Contains(got, "exited with code 0") || !strings.HasSuffix(got, "\nend\n") || strings.Contains(got, "\nstart") {
+		t.Errorf("expected only the new output and the exit status, got %q", got)
+	}
+	if got := output(`{"job_id": 1}`); !strings.Contains(got, "(no new output)") {
+		t.Errorf("expected no new output on a second read, got %q", got)
+	}
+
+	// Jobs can be stopped
+	run("sleep 30")
+	if got := output(`{"job_id": 2, "kill": true}`); !strings.Contains(got, "exited: signal: killed") {
+		t.Errorf("expected the killed job's status, got %q", got)
+	}
+	if _, err := r.Execute(context.Background(), "bash_output", json.RawMessage(`{"job_id": 9}`)); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+
+	r.SetBashInterim(0)
+	if r.HasTool("bash_output") {
+		t.Error("expected bash_output removed with the interim delay off")
+	}
+}
+
+func TestShutdownRemovesPendingTemps(t *testing.T) {
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, ".pilot-interrupted")
+	os.WriteFile(tmp, []byte("partial"), 0644)
+	pendingTemps.Store(tmp, struct{}{})
+
+	NewRegistry(dir).Shutdown()
+
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected pending temp file removed, stat err: %v", err)
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	r := NewRegistry(t.TempDir())
+
+	readOnlyTools := []string{"glob", "grep", "ls", "read"}
+	for _, name := range readOnlyTools {
+		if !r.IsReadOnly(name) {
+			t.Errorf("expected %s to be read-only", name)
+		}
+	}
+
+	writeTools := []string{"write", "edit", "bash"}
+	for _, name := range writeTools {
+		if r.IsReadOnly(name) {
+			t.Errorf("expected %s to NOT be read-only", name)
+		}
+	}
+}
+
+func TestExploreToolPath(t *testing.T) {
+	dir := setupTestDir(t)
+	r := NewRegistry(dir)
+	var gotDir string
+	r.SetExploreFunc(func(ctx context.Context, task, scope string, roots []string, limits ExploreLimits) (string, error) {
+		gotDir = scope
+		return "ok", nil
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		wantDir string
+		wantErr bool
+	}{
+		{"default is work dir", "", dir, false},
+		{"subdirectory", "sub", filepath.Join(dir, "sub"), false},
+		{"outside work dir", "../", "", true},
+		{"missing dir", "nope", "", true},
+		{"file not dir", "hello.go", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDir = ""
+			input, _ := json.Marshal(exploreInput{Task: "look", Path: tt.path})
+			_, err := r.Execute(context.Background(), "explore", input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for path %q", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotDir != tt.wantDir {
+				t.Errorf("expected dir %s, got %s", tt.wantDir, gotDir)
+			}
+		})
+	}
+}
+
+func TestExploreToolRoots(t *testing.T) {
+	dir := setupTestDir(t)
+	extra := t.TempDir()
+	r := NewRegistry(dir)
+	var gotRoots []string
+	r.SetExploreFunc(func(ctx context.Context, task, scope string, roots []string, limits ExploreLimits) (string, error) {
+		gotRoots = roots
+		return "ok", nil
+	})
+
+	input, _ := json.Marshal(exploreInput{Task: "look", Roots: []string{extra}})
+	var argErr *ArgError
+	if _, err := r.Execute(context.Background(), "explore", input); !errors.As(err, &argErr) {
+		t.Fatalf("expected an ArgError with no explore roots set, got %v", err)
+	}
+
+	r.SetExploreRoots([]string{extra})
+	if _, err := r.Execute(context.Background(), "explore", input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(gotRoots) != 1 || gotRoots[0] != extra {
+		t.Errorf("expected roots [%s], got %v", extra, gotRoots)
+	}
+
+	for _, root := range []string{t.TempDir(), "sub", filepath.Join(extra, "..")} {
+		input, _ := json.Marshal(exploreInput{Task: "look", Roots: []string{root}})
+		if _, err := r.Execute(context.Background(), "explore", input); !errors.As(err, &argErr) {
+			t.Errorf("expected an ArgError for root %q, got %v", root, err)
+		}
+	}
+}
+
+func TestReadRoots(t *testing.T) {
+	extra := t.TempDir()
+	os.WriteFile(filepath.Join(extra, "lib.go"), []byte("package lib\n\nfunc Shared() {}\n"), 0644)
+	file := filepath.ToSlash(filepath.Join(extra, "lib.go"))
+
+	r := NewReadOnlyRegistry(setupTestDir(t))
+	input, _ := json.Marshal(readInput{Path: file})
+	if _, err := r.Execute(context.Background(), "read", input); err == nil {
+		t.Fatal("expected a path outside the working directory to be rejected without read roots")
+	}
+
+	r.SetReadRoots([]string{extra})
+	calls := []struct {
+		tool  string
+		input any
+		want  string
+	}{
+		{"read", readInput{Path: file}, "func Shared"},
+		{"grep", grepInput{Pattern: "func Shared", Path: extra}, file + ":3"},
+		{"ls", lsInput{Path: extra}, "lib.go"},
+		{"glob", globInput{Pattern: filepath.ToSlash(extra) + "/*.go"}, file},
+	}
+	for _, c := range calls {
+		input, _ := json.Marshal(c.input)
+		result, err := r.Execute(context.Background(), c.tool, input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.tool, err)
+		}
+		if !strings.Contains(result, c.want) {
+			t.Errorf("%s: expected %q in result, got: %s", c.tool, c.want, result)
+		}
+	}
+
+	outside, _ := json.Marshal(readInput{Path: filepath.Join(t.TempDir(), "x.go")})
+	if _, err := r.Execute(context.Background(), "read", outside); err == nil {
+		t.Error("expected a path outside the read roots to be rejected")
+	}
+}
+
+func TestExploreToolLimits(t *testing.T) {
+	r := NewRegistry(setupTestDir(t))
+	var got ExploreLimits
+	r.SetExploreFunc(func(ctx context.Context, task, scope string, roots []string, limits ExploreLimits) (string, error) {
+		got = limits
+		return "ok", nil
+	})
+
+	input := json.RawMessage(`{"task": "look", "max_iterations": 5, "max_tool_calls": 12}`)
+	if _, err := r.Execute(context.Background(), "explore", input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != (ExploreLimits{MaxIterations: 5, MaxToolCalls: 12}) {
+		t.Errorf("expected the limits passed through, got %+v", got)
+	}
+
+	_, err := r.Execute(context.Background(), "explore", json.RawMessage(`{"task": "look", "max_tool_calls": -1}`))
+	var argErr *ArgError
+	if !errors.As(err, &argErr) {
+		t.Errorf("expected an ArgError for a negative budget, got %v", err)
+	}
+}
+
+func TestSetExplore(t *testing.T) {
 	r := NewRegistry(t.TempDir())
+	hasExplore := func() bool {
+		for _, def := range r.Definitions() {
+			if def.Function.Name == "explore" {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasExplore() {
+		t.Fatal("expected explore registered by default")
+	}
+	n := len(r.Definitions())
 
-	readOnlyTools := []string{"glob", "grep", "ls", "read"}
-	for _, name := range readOnlyTools {
-		if !r.IsReadOnly(name) {
-			t.Errorf("expected %s to be read-only", name)
+	r.SetExplore(false)
+	if hasExplore() || r.HasTool("explore") || len(r.Definitions()) != n-1 {
+		t.Error("expected only explore removed")
+	}
+	input, _ := json.Marshal(exploreInput{Task: "look"})
+	if _, err := r.Execute(context.Background(), "explore", input); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Errorf("expected unknown tool error, got %v", err)
+	}
+
+	r.SetExplore(true)
+	r.SetExplore(true)
+	if !hasExplore() || len(r.Definitions()) != n {
+		t.Error("expected explore restored once")
+	}
+}
+
+func TestIgnoreDirs(t *testing.T) {
+	dir := setupTestDir(t)
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "bundle.go"), []byte("package dist\n\nvar x = 1\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "pkg.egg-info"), 0755)
+	os.WriteFile(filepath.Join(dir, "pkg.egg-info", "meta.go"), []byte("var x = 2\n"), 0644)
+
+	r := NewRegistry(dir)
+	r.SetIgnoreDirs([]string{"dist", "*.egg-info"})
+
+	input, _ := json.Marshal(globInput{Pattern: "**/*.go"})
+	result, err := r.Execute(context.Background(), "glob", input)
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if strings.Contains(result, "bundle.go") || strings.Contains(result, "meta.go") {
+		t.Errorf("expected ignored dirs to be skipped by glob, got:\n%s", result)
+	}
+	if !strings.Contains(result, "sub/nested.go") {
+		t.Errorf("expected non-ignored files in glob result, got:\n%s", result)
+	}
+
+	input, _ = json.Marshal(grepInput{Pattern: "var x"})
+	result, err = r.Execute(context.Background(), "grep", input)
+	if err != nil {
+		t.Fatalf("grep: %v", err)
+	}
+	if strings.Contains(result, "dist") || strings.Contains(result, "egg-info") {
+		t.Errorf("expected ignored dirs to be skipped by grep, got:\n%s", result)
+	}
+}
+
+func TestFocus(t *testing.T) {
+	dir := setupTestDir(t)
+	os.WriteFile(filepath.Join(dir, "sub", "notes.md"), []byte("var x in prose\n"), 0644)
+	r := NewRegistry(dir)
+
+	run := func(tool string, input any) string {
+		t.Helper()
+		data, _ := json.Marshal(input)
+		result, err := r.Execute(context.Background(), tool, data)
+		if err != nil {
+			t.Fatalf("%s: %v", tool, err)
 		}
+		return result
 	}
 
-	writeTools := []string{"write", "edit", "bash"}
-	for _, name := range writeTools {
-		if r.IsReadOnly(name) {
-			t.Errorf("expected %s to NOT be read-only", name)
+	if err := r.SetFocus("sub"); err != nil {
+		t.Fatal(err)
+	}
+	if result := run("glob", globInput{Pattern: "**/*.go"}); strings.Contains(result, "hello.go") || !strings.Contains(result, "sub/nested.go") {
+		t.Errorf("expected glob narrowed to sub, got:\n%s", result)
+	}
+	if result := run("grep", grepInput{Pattern: "package"}); strings.Contains(result, "hello.go") || !strings.Contains(result, "sub/nested.go:1") {
+		t.Errorf("expected grep narrowed to sub, got:\n%s", result)
+	}
+	if result := run("grep", grepInput{Pattern: "package", Path: "."}); !strings.Contains(result, "hello.go") {
+		t.Errorf("expected an explicit grep path to bypass the focus, got:\n%s", result)
+	}
+	if result := run("ls", lsInput{}); !strings.Contains(result, "nested.go") || strings.Contains(result, "readme.md") {
+		t.Errorf("expected ls to default to the focus, got:\n%s", result)
+	}
+	if result := run("glob", globInput{Pattern: "*.md"}); !strings.Contains(result, "No files matched the pattern (focused on sub)") {
+		t.Errorf("expected the focus noted on an empty result, got:\n%s", result)
+	}
+
+	if err := r.SetFocus("sub/*.go"); err != nil {
+		t.Fatal(err)
+	}
+	if result := run("grep", grepInput{Pattern: "var x"}); strings.Contains(result, "notes.md") || !strings.Contains(result, "sub/nested.go") {
+		t.Errorf("expected grep narrowed to the focus glob, got:\n%s", result)
+	}
+
+	for _, bad := range []string{"missing", "hello.go", "../elsewhere", "sub/[*.go"} {
+		if err := r.SetFocus(bad); err == nil {
+			t.Errorf("SetFocus(%q): expected an error", bad)
+		}
+	}
+	if r.Focus() != "sub/*.go" {
+		t.Errorf("expected a failed SetFocus to keep the focus, got %q", r.Focus())
+	}
+
+	r.SetFocus("")
+	if result := run("glob", globInput{Pattern: "**/*.go"}); !strings.Contains(result, "hello.go") {
+		t.Errorf("expected an empty focus to search everything, got:\n%s", result)
+	}
+}
+
+// setupGitRepo creates a temp git repo with one commit on main and a second
+// branch named feature.
+func setupGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/main"},
+		{"add", "."},
+		{"commit", "-q", "-m", "initial"},
+		{"branch", "feature"},
+	} {
+		if args[0] == "add" {
+			os.WriteFile(filepath.Join(dir, "file.txt"), []byte("one\n"), 0644)
+		}
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestGitBranchTool(t *testing.T) {
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+
+	result, err := r.Execute(context.Background(), "git_branch", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "Current branch: main") {
+		t.Errorf("expected current branch main, got:\n%s", result)
+	}
+	if !strings.Contains(result, "* main") || !strings.Contains(result, "  feature") {
+		t.Errorf("expected both branches listed, got:\n%s", result)
+	}
+	if !r.IsReadOnly("git_branch") || r.IsReadOnly("git_checkout") {
+		t.Error("expected git_branch read-only and git_checkout not")
+	}
+}
+
+func TestGitCheckoutTool(t *testing.T) {
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+
+	input, _ := json.Marshal(gitCheckoutInput{Branch: "feature"})
+	_, err := r.Execute(context.Background(), "git_checkout", input)
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+	if confirm.Preview != "git checkout feature" {
+		t.Errorf("unexpected preview: %q", confirm.Preview)
+	}
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	result, _ := r.Execute(context.Background(), "git_branch", json.RawMessage(`{}`))
+	if !strings.Contains(result, "Current branch: feature") {
+		t.Errorf("expected to be on feature, got:\n%s", result)
+	}
+}
+
+func TestGitCheckoutRefusesDirtyTree(t *testing.T) {
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("changed\n"), 0644)
+
+	input, _ := json.Marshal(gitCheckoutInput{Branch: "feature"})
+	_, err := r.Execute(context.Background(), "git_checkout", input)
+	if err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+		t.Fatalf("expected dirty tree refusal, got %v", err)
+	}
+	if _, ok := err.(*NeedsConfirmation); ok {
+		t.Fatal("dirty tree should not reach confirmation")
+	}
+
+	// force skips the check but keeps the local change
+	input, _ = json.Marshal(gitCheckoutInput{Branch: "feature", Force: true})
+	_, err = r.Execute(context.Background(), "git_checkout", input)
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation with force, got %v", err)
+	}
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "file.txt")); string(data) != "changed\n" {
+		t.Errorf("forced checkout discarded local change: %q", data)
+	}
+}
+
+func TestGitCheckoutRejectsBadBranch(t *testing.T) {
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+
+	for _, branch := range []string{"", "-f", "bad..name", "has space"} {
+		input, _ := json.Marshal(gitCheckoutInput{Branch: branch})
+		if _, err := r.Execute(context.Background(), "git_checkout", input); err == nil {
+			t.Errorf("expected error for branch %q", branch)
+		} else if _, ok := err.(*NeedsConfirmation); ok {
+			t.Errorf("branch %q should be rejected before confirmation", branch)
+		}
+	}
+}
+
+func TestGitCommitTool(t *testing.T) {
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("two\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "other.txt"), []byte("leave me\n"), 0644)
+
+	message := "Update file\n\n- adds new.txt\n- quotes \"$HOME\" and `x`"
+	input, _ := json.Marshal(gitCommitInput{Message: message, Files: []string{"file.txt", "new.txt"}})
+	_, err := r.Execute(context.Background(), "git_commit", input)
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+	for _, want := range []string{"    Update file", "+two", "new.txt", "2 files changed"} {
+		if !strings.Contains(confirm.Preview, want) {
+			t.Errorf("expected %q in preview, got:\n%s", want, confirm.Preview)
+		}
+	}
+	if strings.Contains(confirm.Preview, "other.txt") {
+		t.Errorf("unlisted file in preview:\n%s", confirm.Preview)
+	}
+	if status, _ := r.runGit(context.Background(), "status", "--porcelain"); strings.Contains(status, "A ") {
+		t.Errorf("preview staged changes before approval:\n%s", status)
+	}
+
+	if _, err := confirm.Execute(); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	log, _ := r.runGit(context.Background(), "log", "-1", "--format=%B", "--name-only")
+	if !strings.Contains(log, message) || !strings.Contains(log, "file.txt") || !strings.Contains(log, "new.txt") {
+		t.Errorf("unexpected commit:\n%s", log)
+	}
+	if strings.Contains(log, "other.txt") {
+		t.Errorf("unlisted file was committed:\n%s", log)
+	}
+	if status, _ := r.runGit(context.Background(), "status", "--porcelain"); strings.TrimSpace(status) != "?? other.txt" {
+		t.Errorf("expected only other.txt left, got:\n%s", status)
+	}
+}
+
+func TestGitCommitToolRefusals(t *testing.T) {
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644)
+
+	tests := []struct {
+		name  string
+		input gitCommitInput
+		want  string
+	}{
+		{"no message", gitCommitInput{Files: []string{"new.txt"}}, "message is required"},
+		{"dot", gitCommitInput{Message: "m", Files: []string{"."}}, "would stage every change"},
+		{"flag", gitCommitInput{Message: "m", Files: []string{"-A"}}, "invalid file"},
+		{"outside", gitCommitInput{Message: "m", Files: []string{"../x"}}, "outside the working directory"},
+		{"nothing staged", gitCommitInput{Message: "m"}, "nothing is staged"},
+		{"unchanged file", gitCommitInput{Message: "m", Files: []string{"file.txt"}}, "no changes to commit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(tt.input)
+			_, err := r.Execute(context.Background(), "git_commit", input)
+			if _, ok := err.(*NeedsConfirmation); ok || err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected refusal containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	input, _ := json.Marshal(gitCommitInput{Message: "Add everything", All: true})
+	_, err := r.Execute(context.Background(), "git_commit", input)
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok || !strings.Contains(confirm.Preview, "new.txt") {
+		t.Fatalf("expected all=true to preview untracked files, got %v", err)
+	}
+}
+
+func TestGitInfo(t *testing.T) {
+	if info := NewRegistry(t.TempDir()).GitInfo(); info != (GitInfo{}) {
+		t.Errorf("expected zero GitInfo outside a repository, got %+v", info)
+	}
+
+	dir := setupGitRepo(t)
+	r := NewRegistry(dir)
+	root, _ := filepath.EvalSymlinks(dir)
+	info := r.GitInfo()
+	if got, _ := filepath.EvalSymlinks(info.Root); got != root || info.Branch != "main" || info.Dirty {
+		t.Errorf("got %+v, want root %s on a clean main", info, root)
+	}
+
+	// Untracked files are not checked; changes to tracked ones are
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644)
+	if r.GitInfo().Dirty {
+		t.Error("expected an untracked file not to count as dirty")
+	}
+	os.WriteFile(filepath.Join(dir, "file.txt"), []byte("two\n"), 0644)
+	if !r.GitInfo().Dirty {
+		t.Error("expected a modified tracked file to count as dirty")
+	}
+}
+
+func TestStatusBranch(t *testing.T) {
+	tests := map[string]string{
+		"## main":                             "main",
+		"## main...origin/main":               "main",
+		"## feat/x...origin/feat/x [ahead 2]": "feat/x",
+		"## No commits yet on trunk":          "trunk",
+		"## Initial commit on trunk":          "trunk",
+		"## HEAD (no branch)":                 "",
+	}
+	for header, want := range tests {
+		if got := statusBranch(header); got != want {
+			t.Errorf("statusBranch(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestProtectedPaths(t *testing.T) {
+	dir := setupTestDir(t)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "credentials"), []byte("OPENAI_API_KEY=sk-test\n"), 0600)
+	os.MkdirAll(filepath.Join(dir, "sessions"), 0755)
+	os.Symlink(filepath.Join(dir, "credentials"), filepath.Join(dir, "creds-link"))
+
+	r := NewRegistry(dir)
+	r.SetProtectedPaths([]ProtectedPath{
+		{Path: filepath.Join(dir, "credentials"), Reason: "it is Pilot's credentials file"},
+		{Path: "sessions", Reason: "it is Pilot's session storage"},
+	})
+
+	tests := []struct {
+		name  string
+		tool  string
+		input any
+		want  string
+	}{
+		{"write credentials", "write", writeInput{Path: "credentials", Content: "x"}, "credentials file"},
+		{"write through symlink", "write", writeInput{Path: "creds-link", Content: "x"}, "credentials file"},
+		{"edit credentials", "edit", editInput{Path: "credentials", OldStr: "sk-test", NewStr: "x"}, "credentials file"},
+		{"new file in protected dir", "write", writeInput{Path: "sessions/new.json", Content: "{}"}, "session storage"},
+		{"git internals", "edit", editInput{Path: ".git/config", OldStr: "[core]", NewStr: "x"}, "git's internal data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := json.Marshal(tt.input)
+			_, err := r.Execute(context.Background(), tt.tool, input)
+			if _, ok := err.(*NeedsConfirmation); ok || err == nil || !strings.Contains(err.Error(), "refusing to modify") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected refusal mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	confirm, errs := r.EditBatch([]json.RawMessage{json.RawMessage(`{"path":"credentials","old_str":"sk-test","new_str":"x"}`)})
+	if confirm != nil || errs[0] == nil {
+		t.Errorf("expected an edit batch on credentials to be refused, got %v", errs)
+	}
+
+	input, _ := json.Marshal(writeInput{Path: ".gitignore", Content: "dist/\n"})
+	if _, err := r.Execute(context.Background(), "write", input); err == nil {
+		t.Fatal("expected confirmation for .gitignore")
+	} else if _, ok := err.(*NeedsConfirmation); !ok {
+		t.Errorf("expected .gitignore to be writable, got %v", err)
+	}
+}
+
+func TestScratchTools(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := setupTestDir(t)
+	r := NewRegistry(dir)
+	ctx := context.Background()
+
+	result, err := r.Execute(ctx, "scratch_list", json.RawMessage(`{}`))
+	if err != nil || result != "No scratch files." {
+		t.Fatalf("list before any write = %q, %v", result, err)
+	}
+	if _, err := r.Execute(ctx, "scratch_read", json.RawMessage(`{"name": "notes.txt"}`)); err == nil {
+		t.Error("expected error reading a scratch file before any write")
+	}
+
+	for _, input := range []string{
+		`{"name": "notes.txt", "content": "step 1 done"}`,
+		`{"name": "data/rows.csv", "content": "a,b\n1,2\n"}`,
+	} {
+		if _, err := r.Execute(ctx, "scratch_write", json.RawMessage(input)); err != nil {
+			t.Fatalf("write %s: %v", input, err)
+		}
+	}
+
+	result, err = r.Execute(ctx, "scratch_read", json.RawMessage(`{"name": "notes.txt"}`))
+	if err != nil || result != "step 1 done" {
+		t.Errorf("read = %q, %v", result, err)
+	}
+	result, err = r.Execute(ctx, "scratch_list", json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(result, "data/rows.csv") || !strings.Contains(result, "notes.txt") {
+		t.Errorf("list missing files: %q", result)
+	}
+
+	// Scratch files stay out of the project
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("scratch file was written to the project directory")
+	}
+	if _, err := r.Execute(ctx, "read", json.RawMessage(`{"path": "notes.txt"}`)); err == nil {
+		t.Error("read tool should not see scratch files")
+	}
+	if !strings.HasPrefix(r.scratchDir, os.Getenv("TMPDIR")) {
+		t.Errorf("scratch directory %s is not under the temp directory", r.scratchDir)
+	}
+
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "."} {
+		input, _ := json.Marshal(scratchWriteInput{Name: name, Content: "x"})
+		if _, err := r.Execute(ctx, "scratch_write", input); err == nil {
+			t.Errorf("expected error writing scratch file %q", name)
+		}
+	}
+
+	scratchDir := r.scratchDir
+	r.Shutdown()
+	if _, err := os.Stat(scratchDir); !os.IsNotExist(err) {
+		t.Error("Shutdown did not remove the scratch directory")
+	}
+}
+
+func TestFormatters(t *testing.T) {
+	dir := setupTestDir(t)
+	r := NewRegistry(dir)
+
+	for _, spec := range []string{"gofmt -w", "*.go=", "=gofmt", "[.go=gofmt -w"} {
+		if err := r.SetFormatters([]string{spec}); err == nil {
+			t.Errorf("expected error for formatter %q", spec)
+		}
+	}
+
+	if err := r.SetFormatters([]string{"*_test.go=false", "*.go=cat", "*.md = wc -l"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"hello.go":          "cat 'hello.go'",
+		"sub/nested.go":     "cat 'sub/nested.go'",
+		"hello_test.go":     "false 'hello_test.go'",
+		"readme.md":         "wc -l 'readme.md'",
+		"it's.go":           `cat 'it'\''s.go'`,
+		"data.json":         "",
+		"sub/dir.go/x.json": "",
+	}
+	for path, want := range tests {
+		if got := r.FormatCommand(path); got != want {
+			t.Errorf("FormatCommand(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	out, err := r.RunFormatter(context.Background(), "hello.go")
+	if err != nil || !strings.Contains(out, "package main") {
+		t.Errorf("RunFormatter(hello.go) = %q, %v", out, err)
+	}
+	if _, err := r.RunFormatter(context.Background(), "hello_test.go"); err == nil {
+		t.Error("expected a failing formatter to return an error")
+	}
+	if _, err := r.RunFormatter(context.Background(), "data.json"); err == nil {
+		t.Error("expected an error for a file without a formatter")
+	}
+}
+
+func TestCustomTools(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	toolDir := t.TempDir()
+	os.WriteFile(filepath.Join(toolDir, "greet.json"), []byte(`{
+		"name": "greet",
+		"description": "Greet someone",
+		"schema": {"type": "object", "properties": {"name": {"type": "string"}, "times": {"type": "integer"}}},
+		"command": "echo hello {{name}} x{{ times }} {{missing}}end"
+	}`), 0644)
+	os.WriteFile(filepath.Join(toolDir, "notes.txt"), []byte("not a tool"), 0644)
+
+	defs, err := LoadCustomTools(toolDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Name != "greet" {
+		t.Fatalf("expected the greet tool, got %+v", defs)
+	}
+
+	r := NewRegistry(setupTestDir(t))
+	if err := r.AddCustomTools(defs); err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasTool("greet") || r.IsReadOnly("greet") {
+		t.Fatal("expected greet registered and confirmation-gated")
+	}
+	defsOut := r.Definitions()
+	if last := defsOut[len(defsOut)-1].Function; last.Name != "greet" || last.Description != "Greet someone" {
+		t.Errorf("expected greet registered last, got %+v", last)
+	}
+	if err := r.AddCustomTools(defs); err == nil {
+		t.Error("expected an error registering a duplicate tool")
+	}
+
+	_, err = r.Execute(context.Background(), "greet", json.RawMessage(`{"name": "it's me", "times": 3}`))
+	confirm, ok := err.(*NeedsConfirmation)
+	if !ok {
+		t.Fatalf("expected *NeedsConfirmation, got %T: %v", err, err)
+	}
+	if want := `echo hello 'it'\''s me' x'3' ''end`; confirm.Preview != want {
+		t.Errorf("command = %q, want %q", confirm.Preview, want)
+	}
+	out, err := confirm.Execute()
+	if err != nil || out != "hello it's me x3 end\n" {
+		t.Errorf("Execute() = %q, %v", out, err)
+	}
+}
+
+func TestLoadCustomToolsInvalid(t *testing.T) {
+	if defs, err := LoadCustomTools(filepath.Join(t.TempDir(), "missing")); err != nil || len(defs) != 0 {
+		t.Errorf("expected no tools from a missing directory, got %v, %v", defs, err)
+	}
+
+	tests := map[string]string{
+		"bad json":   `{"name": "x",`,
+		"bad name":   `{"name": "two words", "command": "true"}`,
+		"no command": `{"name": "x"}`,
+		"bad schema": `{"name": "x", "command": "true", "schema": []}`,
+	}
+	for name, content := range tests {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "tool.json"), []byte(content), 0644)
+		if _, err := LoadCustomTools(dir); err == nil {
+			t.Errorf("%s: expected an error", name)
 		}
 	}
 }
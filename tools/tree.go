@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Limits of ProjectTree, which keep it to a few hundred tokens.
+const (
+	treeMaxDepth   = 3   // directories nested deeper are summarized by entry count
+	treeMaxEntries = 150 // entries listed before the rest are summarized
+)
+
+// ProjectTree returns a compact indented listing of the working directory,
+// skipping the directories glob and grep skip. Directories end in "/";
+// those below treeMaxDepth show only how many entries they hold.
+func (r *Registry) ProjectTree() string {
+	var out strings.Builder
+	listed, omitted := 0, 0
+
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		entries := r.treeEntries(dir)
+		for _, e := range entries {
+			if listed >= treeMaxEntries {
+				omitted++
+				continue
+			}
+			listed++
+			indent := strings.Repeat("  ", depth)
+			if !e.IsDir() {
+				out.WriteString(indent + e.Name() + "\n")
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if depth+1 >= treeMaxDepth {
+				fmt.Fprintf(&out, "%s%s/ (%d entries)\n", indent, e.Name(), len(r.treeEntries(path)))
+				continue
+			}
+			out.WriteString(indent + e.Name() + "/\n")
+			walk(path, depth+1)
+		}
+	}
+	walk(r.workDir, 0)
+
+	if omitted > 0 {
+		fmt.Fprintf(&out, "... (%d more entries)\n", omitted)
+	}
+	return out.String()
+}
+
+// treeEntries returns the entries of dir that ProjectTree lists, directories
+// first, each group sorted by name.
+func (r *Registry) treeEntries(dir string) []os.DirEntry {
+	all, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var entries []os.DirEntry
+	for _, e := range all {
+		if e.IsDir() && r.skipDir(e.Name()) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].IsDir() && !entries[j].IsDir()
+	})
+	return entries
+}
+
+// Fingerprint returns a hash of the path, size, and modification time of
+// every file under the working directory that glob and grep would visit. It
+// changes whenever one of those files is created, modified, or deleted.
+func (r *Registry) Fingerprint() string {
+	h := fnv.New64a()
+	filepath.WalkDir(r.workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != r.workDir && r.skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -1,5 +1,7 @@
 package tools
 
+import "path/filepath"
+
 // skipDirs defines directory names that file-walking tools (glob, grep) should
 // ignore during traversal. These are typically large, generated, or version-control
 // directories that are not useful for code search.
@@ -14,3 +16,28 @@ var skipDirs = map[string]bool{
 func shouldSkipDir(name string) bool {
 	return skipDirs[name]
 }
+
+// SetIgnoreDirs adds directory name patterns (filepath.Match syntax, matched
+// against the directory's base name) that glob and grep skip, on top of the
+// built-in skip list.
+func (r *Registry) SetIgnoreDirs(patterns []string) {
+	r.ignore = patterns
+}
+
+// IgnoreDirs returns the extra directory patterns set by SetIgnoreDirs.
+func (r *Registry) IgnoreDirs() []string {
+	return r.ignore
+}
+
+// skipDir reports whether the registry's file-walking tools should skip the named directory.
+func (r *Registry) skipDir(name string) bool {
+	if shouldSkipDir(name) {
+		return true
+	}
+	for _, p := range r.ignore {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
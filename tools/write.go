@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf8"
 )
 
 type writeInput struct {
@@ -13,7 +15,7 @@ type writeInput struct {
 	Content string `json:"content"`
 }
 
-// NeedsConfirmation is returned by write, edit, and bash tools instead of
+// NeedsConfirmation is returned by write, edit, rename, and bash tools instead of
 // executing immediately. The agent loop type-asserts this error, displays a
 // preview/diff, and calls Execute on user approval.
 type NeedsConfirmation struct {
@@ -22,6 +24,9 @@ type NeedsConfirmation struct {
 	Preview    string              // old content (empty for new files)
 	NewContent string              // new content (for diff display)
 	Execute    func() (string, error) // deferred action to run on approval
+	Safe       bool                   // bash command on the safe allowlist; may run without asking
+	Changes    []FileChange           // per-file changes of a multi-file edit (rename)
+	Warning    string                 // shown before asking; the user is always asked, even with edits auto-approved
 }
 
 func (e *NeedsConfirmation) Error() string {
@@ -44,29 +49,75 @@ func (r *Registry) writeTool(ctx context.Context, input json.RawMessage) (string
 	if err != nil {
 		return "", err
 	}
+	if err := r.checkProtected(absPath); err != nil {
+		return "", err
+	}
+
+	confirm, err := r.writeConfirmation(params.Path, absPath, params.Content)
+	if err != nil {
+		return "", err
+	}
+	return "", confirm
+}
 
-	// Read existing content for diff display
-	oldContent := ""
-	if data, err := os.ReadFile(absPath); err == nil {
-		oldContent = string(data)
+// writeConfirmation returns the confirmation that writes content to the
+// file at absPath, which the model calls path.
+func (r *Registry) writeConfirmation(path, absPath, content string) (*NeedsConfirmation, error) {
+	// Read existing content for diff display; an existing file keeps its
+	// encoding
+	oldContent, enc := "", encUTF8
+	if text, fileEnc, err := r.readText(absPath); err == nil {
+		oldContent, enc = text, fileEnc
+	}
+	encoded := content
+	if enc != encUTF8 && strings.HasPrefix(oldContent, "\ufeff") && !strings.HasPrefix(encoded, "\ufeff") {
+		// read hides the byte order mark; keep it so the encoding is still detected
+		encoded = "\ufeff" + encoded
+	}
+	data, err := encodeText(encoded, enc)
+	if err != nil {
+		return nil, fmt.Errorf("%s is %s: %w", path, enc, err)
 	}
 
-	return "", &NeedsConfirmation{
+	warning := ""
+	if problem := binaryContent(content, oldContent); problem != "" {
+		warning = fmt.Sprintf("The content for %s %s, so it looks like binary data rather than text. Check it before applying.", path, problem)
+	}
+
+	return &NeedsConfirmation{
 		Tool:       "write",
-		Path:       params.Path,
+		Path:       path,
 		Preview:    oldContent,
-		NewContent: params.Content,
+		NewContent: content,
+		Warning:    warning,
 		Execute: func() (string, error) {
 			dir := filepath.Dir(absPath)
 			if err := os.MkdirAll(dir, 0755); err != nil {
 				return "", fmt.Errorf("create directory: %w", err)
 			}
 
-			if err := AtomicWrite(absPath, []byte(params.Content), 0644); err != nil {
+			if err := AtomicWrite(absPath, data, 0644); err != nil {
 				return "", fmt.Errorf("write file: %w", err)
 			}
+			r.index.invalidate(absPath)
 
-			return fmt.Sprintf("Successfully wrote %s (%d bytes)", params.Path, len(params.Content)), nil
+			return fmt.Sprintf("Successfully wrote %s (%d bytes)", path, len(data)), nil
 		},
+	}, nil
+}
+
+// binaryContent returns why content, to replace oldContent, looks like
+// binary data written by mistake, or "" for ordinary text. Invalid UTF-8 in
+// a tool call's JSON arrives as U+FFFD, so new replacement characters count
+// as invalid UTF-8 too.
+func binaryContent(content, oldContent string) string {
+	switch {
+	case strings.ContainsRune(content, 0):
+		return "contains null bytes"
+	case !utf8.ValidString(content):
+		return "is not valid UTF-8"
+	case strings.ContainsRune(content, utf8.RuneError) && !strings.ContainsRune(oldContent, utf8.RuneError):
+		return "contains U+FFFD replacement characters, left where invalid UTF-8 was"
 	}
+	return ""
 }
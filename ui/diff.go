@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // PrintDiff prints a colorized unified diff.
@@ -41,7 +42,7 @@ func (t *Terminal) PrintDiff(path, oldContent, newContent string) {
 		from = 0
 	}
 
-	fmt.Println(t.c(Cyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", from+1, endOld-from+1, from+1, endNew-from+1)))
+	fmt.Println(t.c(Cyan, hunkHeader(path, oldContent, from, start, endOld, endNew)))
 
 	for i := from; i < start; i++ {
 		fmt.Println(t.c(Gray, " "+oldLines[i]))
@@ -67,6 +68,17 @@ func (t *Terminal) PrintDiff(path, oldContent, newContent string) {
 	}
 }
 
+// hunkHeader formats the "@@ -a,b +c,d @@" line for a hunk showing lines
+// from.. of both versions, followed by the function or block enclosing the
+// first changed line (start) so the reader can tell where the change is.
+func hunkHeader(path, oldContent string, from, start, endOld, endNew int) string {
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", from+1, endOld-from+1, from+1, endNew-from+1)
+	if scope := enclosingScope(path, oldContent, start); scope != "" {
+		header += " " + scope
+	}
+	return header
+}
+
 // PrintFilePreview prints a preview of file contents for the write tool.
 func (t *Terminal) PrintFilePreview(path, content string) {
 	fmt.Println(t.c(Bold+Green, fmt.Sprintf("New file: %s", path)))
@@ -76,11 +88,98 @@ func (t *Terminal) PrintFilePreview(path, content string) {
 	}
 }
 
-// ConfirmAction asks the user for y/n confirmation.
+// PrintPatch prints git output holding a unified diff, such as a commit
+// preview, coloring the diff's headers and changed lines.
+func (t *Terminal) PrintPatch(patch string) {
+	inHunk := false
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			inHunk = false
+			fmt.Println(t.c(Bold, line))
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			fmt.Println(t.c(Cyan, line))
+		case inHunk && strings.HasPrefix(line, "+"):
+			fmt.Println(t.c(Green, line))
+		case inHunk && strings.HasPrefix(line, "-"):
+			fmt.Println(t.c(Red, line))
+		case !inHunk && (strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ")):
+			fmt.Println(t.c(Bold, line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+// ConfirmAction asks the user for y/n confirmation. With a confirmation
+// timeout set, an unanswered prompt takes the configured default when the
+// timeout elapses; a late answer is then discarded.
 func (t *Terminal) ConfirmAction(prompt string) bool {
-	fmt.Print(t.c(Bold+Yellow, prompt+" [y/n] "))
+	response, ok := t.askConfirm(prompt + " [y/n] ")
+	if !ok {
+		return t.confirmApprove
+	}
+	return isYes(response)
+}
+
+// ConfirmExpandable is ConfirmAction for a prompt shown without its details:
+// answering d calls details, which prints them, and asks again.
+func (t *Terminal) ConfirmExpandable(prompt string, details func()) bool {
+	response, ok := t.askConfirm(prompt + " [y/n/d] ")
+	if !ok {
+		return t.confirmApprove
+	}
+	if r := strings.TrimSpace(strings.ToLower(response)); r == "d" || r == "diff" {
+		details()
+		return t.ConfirmAction(prompt)
+	}
+	return isYes(response)
+}
+
+// confirmPoll is how often a confirmation prompt with a timeout checks
+// whether an answer is waiting.
+const confirmPoll = 50 * time.Millisecond
+
+// askConfirm prints prompt and reads the answer. It reports false if the
+// confirmation timeout elapsed first, after saying so.
+func (t *Terminal) askConfirm(prompt string) (string, bool) {
+	fmt.Print(t.c(Bold+Yellow, prompt))
+	if t.confirmTimeout <= 0 {
+		return t.readResponse(), true
+	}
+
+	// Read only once an answer is waiting: a read still blocked after the
+	// timeout would swallow the next line typed, whether the answer to the
+	// next prompt or the next message.
+	timeout := t.after(t.confirmTimeout)
+	poll := time.NewTicker(confirmPoll)
+	defer poll.Stop()
+	for !t.inReady() {
+		select {
+		case <-timeout:
+			action := "denying"
+			if t.confirmApprove {
+				action = "approving"
+			}
+			fmt.Println()
+			t.PrintWarning(fmt.Sprintf("No answer after %s, %s.", t.confirmTimeout, action))
+			return "", false
+		case <-poll.C:
+		}
+	}
+	return t.readResponse(), true
+}
+
+// readResponse reads one line answer from the confirmation input.
+func (t *Terminal) readResponse() string {
 	var response string
-	fmt.Scanln(&response)
+	fmt.Fscanln(t.in, &response)
+	return response
+}
+
+// isYes reports whether a confirmation response means yes.
+func isYes(response string) bool {
 	response = strings.TrimSpace(strings.ToLower(response))
 	return response == "y" || response == "yes"
 }
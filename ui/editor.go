@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrNoEditor is returned by EditText when no editor can be found.
+var ErrNoEditor = errors.New("no editor found: set $EDITOR")
+
+// EditText opens the user's editor on a temp file seeded with initial and
+// returns the saved contents, trimmed. If the editor exits without changing
+// the file, it returns an empty string.
+func EditText(initial string) (string, error) {
+	editor, err := editorCommand()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp("", "pilot-prompt-*.md")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write temp file: %w", err)
+	}
+	f.Close()
+
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("run editor: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read temp file: %w", err)
+	}
+	if string(data) == initial {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// editorCommand resolves the editor from $VISUAL or $EDITOR, split into
+// program and arguments (e.g. "code --wait"). If neither is set, it falls
+// back to a platform default found on PATH.
+func editorCommand() ([]string, error) {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields, nil
+		}
+	}
+
+	fallbacks := []string{"nano", "vi"}
+	if runtime.GOOS == "windows" {
+		fallbacks = []string{"notepad"}
+	}
+	for _, name := range fallbacks {
+		if path, err := exec.LookPath(name); err == nil {
+			return []string{path}, nil
+		}
+	}
+	return nil, ErrNoEditor
+}
@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeEditor writes a shell script that acts as an editor and returns its path.
+func fakeEditor(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake editor script requires a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "editor.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEditTextRoundTrip(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", fakeEditor(t, `printf '\n  Refactor the parser\n\nKeep the API stable.\n' > "$1"`))
+
+	got, err := EditText("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Refactor the parser\n\nKeep the API stable."
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEditTextUnchanged(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", fakeEditor(t, "exit 0"))
+
+	got, err := EditText("draft")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "" {
+		t.Errorf("expected empty result when editor makes no changes, got %q", got)
+	}
+}
+
+func TestEditTextEditorFails(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", fakeEditor(t, "exit 1"))
+
+	if _, err := EditText(""); err == nil {
+		t.Error("expected error when editor exits non-zero")
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "code --wait")
+	cmd, err := editorCommand()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cmd) != 2 || cmd[0] != "code" || cmd[1] != "--wait" {
+		t.Errorf("expected [code --wait], got %q", cmd)
+	}
+
+	t.Setenv("VISUAL", "vim")
+	if cmd, _ := editorCommand(); cmd[0] != "vim" {
+		t.Errorf("expected $VISUAL to take precedence, got %q", cmd)
+	}
+}
+
+func TestEditorCommandMissing(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	t.Setenv("PATH", t.TempDir())
+
+	if _, err := editorCommand(); !errors.Is(err, ErrNoEditor) {
+		t.Errorf("expected ErrNoEditor, got %v", err)
+	}
+	if _, err := EditText("x"); !errors.Is(err, ErrNoEditor) {
+		t.Errorf("expected EditText to return ErrNoEditor, got %v", err)
+	}
+}
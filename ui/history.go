@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxHistoryEntries caps how many prompts are kept in the history file.
+const maxHistoryEntries = 500
+
+// History is a persistent list of previously entered prompts, oldest first.
+// Duplicates are collapsed so that re-entering a prompt moves it to the end.
+type History struct {
+	path    string
+	entries []string
+}
+
+// LoadHistory reads the history file at path. A missing or unreadable file
+// yields an empty history. If the file holds duplicates or more than
+// maxHistoryEntries lines, it is rewritten in compacted form.
+func LoadHistory(path string) *History {
+	h := &History{path: path}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	var raw []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			raw = append(raw, line)
+		}
+	}
+
+	h.entries = dedupHistory(raw)
+	if len(h.entries) > maxHistoryEntries {
+		h.entries = h.entries[len(h.entries)-maxHistoryEntries:]
+	}
+	if len(h.entries) != len(raw) {
+		h.rewrite()
+	}
+	return h
+}
+
+// Entries returns the history entries, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add records a prompt and appends it to the history file. Empty and
+// multi-line inputs (typically pastes) are not recorded.
+func (h *History) Add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.Contains(line, "\n") {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+
+	for i, e := range h.entries {
+		if e == line {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, line)
+
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("create history dir: %w", err)
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	return nil
+}
+
+// rewrite replaces the history file with the in-memory entries.
+// Errors are ignored; the file is rebuilt again on the next load.
+func (h *History) rewrite() {
+	if h.path == "" {
+		return
+	}
+	var sb strings.Builder
+	for _, e := range h.entries {
+		sb.WriteString(e)
+		sb.WriteByte('\n')
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// dedupHistory removes duplicates, keeping the most recent occurrence of each entry.
+func dedupHistory(lines []string) []string {
+	seen := make(map[string]bool, len(lines))
+	out := make([]string, 0, len(lines))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if seen[lines[i]] {
+			continue
+		}
+		seen[lines[i]] = true
+		out = append(out, lines[i])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
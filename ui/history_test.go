@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHistoryMissingFile(t *testing.T) {
+	h := LoadHistory(filepath.Join(t.TempDir(), "history"))
+	if len(h.Entries()) != 0 {
+		t.Errorf("expected empty history, got %v", h.Entries())
+	}
+}
+
+func TestHistoryAddAppendsAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "history")
+	h := LoadHistory(path)
+
+	for _, line := range []string{"first", "second", "  third  "} {
+		if err := h.Add(line); err != nil {
+			t.Fatalf("add %q: %v", line, err)
+		}
+	}
+
+	reloaded := LoadHistory(path)
+	got := strings.Join(reloaded.Entries(), ",")
+	if got != "first,second,third" {
+		t.Errorf("expected first,second,third after reload, got %s", got)
+	}
+}
+
+func TestHistoryAddSkipsEmptyAndMultiline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := LoadHistory(path)
+
+	h.Add("")
+	h.Add("   ")
+	h.Add("line one\nline two")
+
+	if len(h.Entries()) != 0 {
+		t.Errorf("expected no entries, got %v", h.Entries())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected history file not to be created")
+	}
+}
+
+func TestHistoryAddDedup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := LoadHistory(path)
+
+	h.Add("a")
+	h.Add("b")
+	h.Add("b") // consecutive duplicate: no-op
+	h.Add("a") // earlier duplicate: moved to the end
+
+	if got := strings.Join(h.Entries(), ","); got != "b,a" {
+		t.Errorf("expected b,a, got %s", got)
+	}
+
+	// The file accumulated a duplicate; loading compacts it.
+	data, _ := os.ReadFile(path)
+	if got := strings.Count(string(data), "\n"); got != 3 {
+		t.Fatalf("expected 3 appended lines, got %d", got)
+	}
+	reloaded := LoadHistory(path)
+	if got := strings.Join(reloaded.Entries(), ","); got != "b,a" {
+		t.Errorf("expected b,a after reload, got %s", got)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != "b\na\n" {
+		t.Errorf("expected compacted file, got %q", string(data))
+	}
+}
+
+func TestLoadHistoryCapsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var sb strings.Builder
+	for i := 0; i < maxHistoryEntries+10; i++ {
+		sb.WriteString(strings.Repeat("x", i+1))
+		sb.WriteByte('\n')
+	}
+	os.WriteFile(path, []byte(sb.String()), 0600)
+
+	h := LoadHistory(path)
+	if len(h.Entries()) != maxHistoryEntries {
+		t.Fatalf("expected %d entries, got %d", maxHistoryEntries, len(h.Entries()))
+	}
+	if h.Entries()[0] != strings.Repeat("x", 11) {
+		t.Errorf("expected oldest entries to be dropped")
+	}
+}
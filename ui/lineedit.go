@@ -0,0 +1,258 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNoTTY is returned by LineEditor.ReadLine when stdin is not a terminal.
+// Callers should fall back to plain buffered reading.
+var ErrNoTTY = errors.New("stdin is not a terminal")
+
+// LineEditor reads a line of input in raw mode, supporting cursor movement,
+// backspace, and up/down-arrow recall from a History.
+type LineEditor struct {
+	history *History
+	onKey   func() // called for each key read; nil for none
+	draft   string // line being typed when the last read was cancelled
+}
+
+// NewLineEditor creates a line editor backed by the given history.
+func NewLineEditor(history *History) *LineEditor {
+	return &LineEditor{history: history}
+}
+
+// ReadLine prints prompt and reads one line of input. Lines pasted together
+// are joined with newlines, matching the buffered reader's paste handling.
+// Returns io.EOF on Ctrl+D at an empty prompt.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	return e.ReadLineContext(context.Background(), prompt)
+}
+
+// SetOnKey sets a function called for each key read, such as one that
+// restarts an idle countdown.
+func (e *LineEditor) SetOnKey(f func()) {
+	e.onKey = f
+}
+
+// Draft returns the line that was being typed when the last read was
+// cancelled, or "" if there is none. The next read starts with it.
+func (e *LineEditor) Draft() string {
+	return e.draft
+}
+
+// ReadLineContext is like ReadLine but gives up when ctx is done, returning
+// ctx.Err(). A partially typed line is kept as the draft the next read
+// starts with.
+func (e *LineEditor) ReadLineContext(ctx context.Context, prompt string) (string, error) {
+	rm, err := NewRawMode()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoTTY, err)
+	}
+	if err := rm.Enable(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoTTY, err)
+	}
+	defer rm.Disable()
+
+	var hist []string
+	if e.history != nil {
+		hist = e.history.Entries()
+	}
+	readKey := func() (byte, error) {
+		b, err := rm.ReadKeyContext(ctx.Done())
+		if err == nil && e.onKey != nil {
+			e.onKey()
+		}
+		return b, err
+	}
+	line, err := editLine(readKey, rm.Pending, os.Stdout, prompt, hist, e.draft)
+	e.draft = ""
+	if errors.Is(err, ErrStopped) {
+		e.draft = line
+		fmt.Print("\r\n")
+		return "", ctx.Err()
+	}
+	return line, err
+}
+
+// editLine implements the line-editing state machine. readKey returns the next
+// input byte; pending reports whether more input is already buffered, which
+// distinguishes a pasted newline from the user pressing Enter. Editing starts
+// from initial. If readKey fails with ErrStopped, the text typed so far is
+// returned with the error.
+func editLine(readKey func() (byte, error), pending func() bool, out io.Writer, prompt string, hist []string, initial string) (string, error) {
+	var done []string // completed lines of a multi-line paste
+	var buf []rune
+	if initial != "" {
+		lines := strings.Split(initial, "\n")
+		done = lines[:len(lines)-1]
+		buf = []rune(lines[len(lines)-1])
+	}
+	cur := len(buf)
+	histIdx := len(hist)
+	var draft []rune
+
+	redraw := func() {
+		p := prompt
+		if len(done) > 0 {
+			p = ""
+		}
+		fmt.Fprintf(out, "\r\033[K%s%s", p, string(buf))
+		if back := len(buf) - cur; back > 0 {
+			fmt.Fprintf(out, "\033[%dD", back)
+		}
+	}
+	setBuf := func(s []rune) {
+		buf = append([]rune(nil), s...)
+		cur = len(buf)
+		redraw()
+	}
+
+	fmt.Fprint(out, prompt)
+	for _, line := range done {
+		fmt.Fprint(out, line+"\r\n")
+	}
+	fmt.Fprint(out, string(buf))
+	var partial []byte // incomplete UTF-8 sequence
+	for {
+		b, err := readKey()
+		if errors.Is(err, ErrStopped) {
+			return strings.Join(append(done, string(buf)), "\n"), err
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if len(partial) > 0 || b >= utf8.RuneSelf {
+			partial = append(partial, b)
+			if !utf8.FullRune(partial) {
+				continue
+			}
+			r, _ := utf8.DecodeRune(partial)
+			partial = partial[:0]
+			buf = append(buf[:cur], append([]rune{r}, buf[cur:]...)...)
+			cur++
+			redraw()
+			continue
+		}
+
+		switch b {
+		case '\r', '\n':
+			if pending() {
+				done = append(done, string(buf))
+				buf, cur = nil, 0
+				fmt.Fprint(out, "\r\n")
+				continue
+			}
+			fmt.Fprint(out, "\r\n")
+			return strings.TrimSpace(strings.Join(append(done, string(buf)), "\n")), nil
+		case 0x03: // Ctrl+C (delivered as a byte on Windows)
+			fmt.Fprint(out, "^C\r\n")
+			return "", nil
+		case 0x04: // Ctrl+D
+			if len(buf) == 0 && len(done) == 0 {
+				fmt.Fprint(out, "\r\n")
+				return "", io.EOF
+			}
+		case 0x7f, 0x08: // Backspace
+			if cur > 0 {
+				buf = append(buf[:cur-1], buf[cur:]...)
+				cur--
+				redraw()
+			}
+		case 0x01: // Ctrl+A
+			cur = 0
+			redraw()
+		case 0x05: // Ctrl+E
+			cur = len(buf)
+			redraw()
+		case 0x15: // Ctrl+U
+			buf = buf[cur:]
+			cur = 0
+			redraw()
+		case 0x1B:
+			seq, err := readEscape(readKey)
+			if errors.Is(err, ErrStopped) {
+				return strings.Join(append(done, string(buf)), "\n"), err
+			}
+			if err != nil {
+				return "", err
+			}
+			switch seq {
+			case "A": // Up
+				if histIdx > 0 {
+					if histIdx == len(hist) {
+						draft = append([]rune(nil), buf...)
+					}
+					histIdx--
+					setBuf([]rune(hist[histIdx]))
+				}
+			case "B": // Down
+				if histIdx < len(hist) {
+					histIdx++
+					if histIdx == len(hist) {
+						setBuf(draft)
+					} else {
+						setBuf([]rune(hist[histIdx]))
+					}
+				}
+			case "C": // Right
+				if cur < len(buf) {
+					cur++
+					redraw()
+				}
+			case "D": // Left
+				if cur > 0 {
+					cur--
+					redraw()
+				}
+			case "H", "1~":
+				cur = 0
+				redraw()
+			case "F", "4~":
+				cur = len(buf)
+				redraw()
+			case "3~": // Delete
+				if cur < len(buf) {
+					buf = append(buf[:cur], buf[cur+1:]...)
+					redraw()
+				}
+			}
+		default:
+			if b >= 0x20 || b == '\t' {
+				buf = append(buf[:cur], append([]rune{rune(b)}, buf[cur:]...)...)
+				cur++
+				redraw()
+			}
+		}
+	}
+}
+
+// readEscape reads the remainder of an ANSI escape sequence after ESC and
+// returns its final part (e.g. "A" for ESC [ A, "3~" for ESC [ 3 ~).
+// Unrecognized sequences return an empty string.
+func readEscape(readKey func() (byte, error)) (string, error) {
+	b, err := readKey()
+	if err != nil {
+		return "", err
+	}
+	if b != '[' && b != 'O' {
+		return "", nil
+	}
+	var seq []byte
+	for {
+		b, err := readKey()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, b)
+		if (b >= 'A' && b <= 'Z') || b == '~' || len(seq) > 4 {
+			return string(seq), nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// keyFeed returns a readKey function that replays input, then io.EOF.
+func keyFeed(input string) func() (byte, error) {
+	data := []byte(input)
+	return func() (byte, error) {
+		if len(data) == 0 {
+			return 0, io.EOF
+		}
+		b := data[0]
+		data = data[1:]
+		return b, nil
+	}
+}
+
+func noPending() bool { return false }
+
+func TestEditLineHistoryRecall(t *testing.T) {
+	hist := []string{"older", "newer"}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "hello\r", "hello"},
+		{"up recalls newest", "\x1b[A\r", "newer"},
+		{"up twice recalls older", "\x1b[A\x1b[A\r", "older"},
+		{"up past oldest stays", "\x1b[A\x1b[A\x1b[A\r", "older"},
+		{"down restores draft", "dra\x1b[A\x1b[Bft\r", "draft"},
+		{"backspace", "helo\x7f\x7fllo\r", "hello"},
+		{"left then insert", "hllo\x1b[D\x1b[D\x1b[De\r", "hello"},
+		{"utf8", "caf\xc3\xa9\r", "café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := editLine(keyFeed(tt.input), noPending, &out, "> ", hist, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEditLineCtrlDOnEmptyIsEOF(t *testing.T) {
+	var out bytes.Buffer
+	_, err := editLine(keyFeed("\x04"), noPending, &out, "> ", nil, "")
+	if err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestEditLinePastedNewlines(t *testing.T) {
+	input := "line one\rline two\r"
+	remaining := len(input)
+	readKey := keyFeed(input)
+	counted := func() (byte, error) {
+		remaining--
+		return readKey()
+	}
+	var out bytes.Buffer
+	got, err := editLine(counted, func() bool { return remaining > 0 }, &out, "> ", nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "line one\nline two" {
+		t.Errorf("expected joined paste, got %q", got)
+	}
+}
+
+func TestEditLineKeepsDraftWhenStopped(t *testing.T) {
+	readKey := keyFeed("fix the\x1b[D")
+	stopped := func() (byte, error) {
+		b, err := readKey()
+		if err == io.EOF {
+			return 0, ErrStopped
+		}
+		return b, err
+	}
+	var out bytes.Buffer
+	draft, err := editLine(stopped, noPending, &out, "> ", nil, "")
+	if !errors.Is(err, ErrStopped) || draft != "fix the" {
+		t.Fatalf("expected the draft with ErrStopped, got %q, %v", draft, err)
+	}
+
+	// The next read picks up where the draft left off
+	out.Reset()
+	got, err := editLine(keyFeed(" bug\r"), noPending, &out, "> ", nil, draft)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "fix the bug" {
+		t.Errorf("expected the draft continued, got %q", got)
+	}
+	if !strings.HasPrefix(out.String(), "> fix the") {
+		t.Errorf("expected the draft redrawn after the prompt, got %q", out.String())
+	}
+
+	got, err = editLine(keyFeed("three\r"), noPending, &out, "> ", nil, "one\ntwo ")
+	if err != nil || got != "one\ntwo three" {
+		t.Errorf("expected a multi-line draft continued, got %q, %v", got, err)
+	}
+}
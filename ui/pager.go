@@ -0,0 +1,43 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// shouldPage reports whether text has more than threshold lines. A
+// threshold of zero or less never pages.
+func shouldPage(text string, threshold int) bool {
+	if threshold <= 0 {
+		return false
+	}
+	return strings.Count(strings.TrimRight(text, "\n"), "\n")+1 > threshold
+}
+
+// pagerCommand resolves the pager from $PAGER, split into program and
+// arguments (e.g. "less -R"), falling back to less, or more on Windows.
+func pagerCommand() []string {
+	if fields := strings.Fields(os.Getenv("PAGER")); len(fields) > 0 {
+		return fields
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"more"}
+	}
+	return []string{"less"}
+}
+
+// pageText shows text in the pager and waits for the user to quit it.
+func pageText(text string) error {
+	pager := pagerCommand()
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run pager: %w", err)
+	}
+	return nil
+}
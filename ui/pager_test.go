@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShouldPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		threshold int
+		want      bool
+	}{
+		{"disabled", strings.Repeat("line\n", 100), 0, false},
+		{"under threshold", "one\ntwo\n", 3, false},
+		{"at threshold", "one\ntwo\nthree\n", 3, false},
+		{"trailing newlines not counted", "one\ntwo\nthree\n\n\n", 3, false},
+		{"over threshold", "one\ntwo\nthree\nfour", 3, true},
+		{"blank lines count", "one\n\n\nfour\n", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldPage(tt.text, tt.threshold); got != tt.want {
+				t.Errorf("shouldPage(%q, %d) = %v, want %v", tt.text, tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPagerCommand(t *testing.T) {
+	t.Setenv("PAGER", "less -R")
+	if got := pagerCommand(); !slices.Equal(got, []string{"less", "-R"}) {
+		t.Errorf("expected $PAGER split into fields, got %q", got)
+	}
+	t.Setenv("PAGER", "")
+	if got := pagerCommand(); len(got) != 1 || (got[0] != "less" && got[0] != "more") {
+		t.Errorf("expected platform default, got %q", got)
+	}
+}
+
+func TestPageText(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "paged.txt")
+	t.Setenv("PAGER", fakeEditor(t, `cat > "`+out+`"`))
+
+	text := "# Summary\n\nA long response.\n"
+	if err := pageText(text); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || string(data) != text {
+		t.Errorf("expected the pager to receive the response, got %q, %v", data, err)
+	}
+
+	t.Setenv("PAGER", fakeEditor(t, "exit 1"))
+	if err := pageText(text); err == nil {
+		t.Error("expected error when the pager fails")
+	}
+}
@@ -0,0 +1,41 @@
+package ui
+
+import "fmt"
+
+// PrintRawExchange prints the bodies of an LLM request and its response,
+// each cut to limit bytes (0 = no limit). status 0 means no response arrived.
+func (t *Terminal) PrintRawExchange(request string, status int, response string, limit int) {
+	fmt.Println(t.c(Bold, fmt.Sprintf("Request (%s)", formatSize(len(request)))))
+	fmt.Println(rawBody(request, limit))
+	fmt.Println()
+
+	if status == 0 {
+		fmt.Println(t.c(Bold, "Response") + t.c(Gray, " (none received)"))
+		fmt.Println()
+		return
+	}
+	fmt.Println(t.c(Bold, fmt.Sprintf("Response (HTTP %d, %s)", status, formatSize(len(response)))))
+	fmt.Println(rawBody(response, limit))
+	fmt.Println()
+}
+
+// rawBody cuts body to limit bytes (0 = no limit), noting how much was left
+// out.
+func rawBody(body string, limit int) string {
+	if limit <= 0 || len(body) <= limit {
+		return body
+	}
+	return body[:limit] + fmt.Sprintf("\n... (%s more; /raw full shows everything)", formatSize(len(body)-limit))
+}
+
+// formatSize renders n bytes as B, KB, or MB.
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
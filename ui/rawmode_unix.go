@@ -44,6 +44,7 @@ func (rm *RawMode) Enable() error {
 	if err := ioctlTermios(rm.fd, tcsets(), &raw); err != nil {
 		return fmt.Errorf("set raw mode: %w", err)
 	}
+	trackRaw(rm)
 	return nil
 }
 
@@ -52,8 +53,14 @@ func (rm *RawMode) Disable() error {
 	if err := ioctlTermios(rm.fd, tcsets(), &rm.origTerm); err != nil {
 		return fmt.Errorf("restore termios: %w", err)
 	}
+	untrackRaw(rm)
 	return nil
 }
 
 // ErrStopped is returned by ReadKeyContext when the done channel is closed.
 var ErrStopped = errors.New("read stopped")
+
+// Pending reports whether more input is already waiting on stdin.
+func (rm *RawMode) Pending() bool {
+	return StdinHasData()
+}
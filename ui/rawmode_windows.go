@@ -15,6 +15,7 @@ var (
 	procSetConsoleMode    = kernel32.NewProc("SetConsoleMode")
 	procGetStdHandle      = kernel32.NewProc("GetStdHandle")
 	procReadConsoleInput      = kernel32.NewProc("ReadConsoleInputW")
+	procPeekConsoleInput      = kernel32.NewProc("PeekConsoleInputW")
 	procGetNumberOfEvents     = kernel32.NewProc("GetNumberOfConsoleInputEvents")
 	procWaitForSingleObject   = kernel32.NewProc("WaitForSingleObject")
 )
@@ -52,6 +53,19 @@ type keyEventRecord struct {
 type RawMode struct {
 	handle   syscall.Handle
 	origMode uint32
+	pending  []byte // remaining bytes of a translated arrow-key sequence
+}
+
+// arrowSequences maps virtual key codes for arrow/navigation keys to the
+// ANSI escape sequences Unix terminals send, so callers can share one decoder.
+var arrowSequences = map[uint16]string{
+	0x25: "\x1b[D",  // VK_LEFT
+	0x26: "\x1b[A",  // VK_UP
+	0x27: "\x1b[C",  // VK_RIGHT
+	0x28: "\x1b[B",  // VK_DOWN
+	0x24: "\x1b[H",  // VK_HOME
+	0x23: "\x1b[F",  // VK_END
+	0x2E: "\x1b[3~", // VK_DELETE
 }
 
 // NewRawMode creates a new RawMode for the console stdin.
@@ -77,6 +91,7 @@ func (rm *RawMode) Enable() error {
 	if r == 0 {
 		return fmt.Errorf("set console mode: %v", e)
 	}
+	trackRaw(rm)
 	return nil
 }
 
@@ -86,6 +101,7 @@ func (rm *RawMode) Disable() error {
 	if r == 0 {
 		return fmt.Errorf("restore console mode: %v", e)
 	}
+	untrackRaw(rm)
 	return nil
 }
 
@@ -93,6 +109,11 @@ func (rm *RawMode) Disable() error {
 // cancelled by closing the done channel. Uses WaitForSingleObject with a
 // timeout to avoid blocking indefinitely.
 func (rm *RawMode) ReadKeyContext(done <-chan struct{}) (byte, error) {
+	if len(rm.pending) > 0 {
+		b := rm.pending[0]
+		rm.pending = rm.pending[1:]
+		return b, nil
+	}
 	for {
 		// Check if we should stop
 		select {
@@ -133,6 +154,36 @@ func (rm *RawMode) ReadKeyContext(done <-chan struct{}) (byte, error) {
 			if rec.KeyEvent.VirtualKeyCode == 0x1B {
 				return 0x1B, nil
 			}
+			if seq, ok := arrowSequences[rec.KeyEvent.VirtualKeyCode]; ok {
+				rm.pending = []byte(seq[1:])
+				return seq[0], nil
+			}
+		}
+	}
+}
+
+// Pending reports whether more key-down input is already waiting in the
+// console buffer. Key-up and non-key events are ignored so that the release
+// of Enter is not mistaken for pasted text.
+func (rm *RawMode) Pending() bool {
+	if len(rm.pending) > 0 {
+		return true
+	}
+	var recs [32]inputRecord
+	var n uint32
+	r, _, _ := procPeekConsoleInput.Call(
+		uintptr(rm.handle),
+		uintptr(unsafe.Pointer(&recs[0])),
+		uintptr(len(recs)),
+		uintptr(unsafe.Pointer(&n)),
+	)
+	if r == 0 {
+		return false
+	}
+	for _, rec := range recs[:n] {
+		if rec.EventType == keyEventType && rec.KeyEvent.KeyDown != 0 && rec.KeyEvent.UnicodeChar != 0 {
+			return true
 		}
 	}
+	return false
 }
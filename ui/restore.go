@@ -0,0 +1,54 @@
+package ui
+
+import "sync"
+
+// terminalMode is a terminal setting that can be put back the way it was.
+// RawMode implements it; tests substitute their own.
+type terminalMode interface {
+	Disable() error
+}
+
+var (
+	rawMu     sync.Mutex
+	rawActive = make(map[terminalMode]struct{}) // modes enabled and not yet disabled
+)
+
+// trackRaw records m as enabled, for RestoreTerminal.
+func trackRaw(m terminalMode) {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	rawActive[m] = struct{}{}
+}
+
+// untrackRaw records m as disabled.
+func untrackRaw(m terminalMode) {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	delete(rawActive, m)
+}
+
+// RestoreTerminal takes the terminal out of any raw mode still enabled, so
+// the shell gets echo and line editing back. Call it before the program
+// exits other than by returning from main, since deferred Disable calls do
+// not run then. It is safe to call from any goroutine, at any time.
+func RestoreTerminal() {
+	rawMu.Lock()
+	modes := make([]terminalMode, 0, len(rawActive))
+	for m := range rawActive {
+		modes = append(modes, m)
+	}
+	rawMu.Unlock()
+	for _, m := range modes {
+		m.Disable()
+	}
+}
+
+// RestoreOnPanic restores the terminal if the calling goroutine is
+// panicking and then panics again with the same value, so the crash is
+// still reported. It must be deferred directly: defer ui.RestoreOnPanic().
+func RestoreOnPanic() {
+	if r := recover(); r != nil {
+		RestoreTerminal()
+		panic(r)
+	}
+}
@@ -0,0 +1,58 @@
+package ui
+
+import "testing"
+
+// fakeMode is a terminal mode that counts how often it is restored.
+type fakeMode struct{ disabled int }
+
+func (m *fakeMode) Disable() error {
+	m.disabled++
+	untrackRaw(m)
+	return nil
+}
+
+func TestRestoreOnPanic(t *testing.T) {
+	m := &fakeMode{}
+	trackRaw(m)
+	defer untrackRaw(m)
+
+	var recovered any
+	func() {
+		defer func() { recovered = recover() }()
+		func() {
+			defer RestoreOnPanic()
+			panic("boom")
+		}()
+	}()
+	if recovered != "boom" {
+		t.Errorf("expected the panic to be re-raised, got %v", recovered)
+	}
+	if m.disabled != 1 {
+		t.Errorf("expected the terminal restored once, got %d", m.disabled)
+	}
+
+	// Without a panic, nothing is touched
+	trackRaw(m)
+	func() {
+		defer RestoreOnPanic()
+	}()
+	if m.disabled != 1 {
+		t.Errorf("expected no restore without a panic, got %d", m.disabled)
+	}
+}
+
+func TestRestoreTerminal(t *testing.T) {
+	a, b := &fakeMode{}, &fakeMode{}
+	trackRaw(a)
+	trackRaw(b)
+	untrackRaw(b) // disabled normally before the exit
+
+	RestoreTerminal()
+	if a.disabled != 1 || b.disabled != 0 {
+		t.Errorf("expected only the still-raw mode restored, got %d and %d", a.disabled, b.disabled)
+	}
+	RestoreTerminal()
+	if a.disabled != 1 {
+		t.Errorf("expected a restored mode to be forgotten, got %d restores", a.disabled)
+	}
+}
@@ -0,0 +1,136 @@
+package ui
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// maxScopeLen caps the function signature shown in a hunk header.
+const maxScopeLen = 80
+
+// enclosingScope returns the signature of the function or block enclosing the
+// 0-based line of content, for a diff hunk header, or "" if there is none.
+// Go files are parsed; other files use an indentation heuristic.
+func enclosingScope(path, content string, line int) string {
+	var scope string
+	if filepath.Ext(path) == ".go" {
+		scope = goScope(content, line+1)
+	} else {
+		scope = blockScope(strings.Split(content, "\n"), line)
+	}
+
+	scope = strings.Join(strings.Fields(scope), " ")
+	if r := []rune(scope); len(r) > maxScopeLen {
+		scope = string(r[:maxScopeLen-1]) + "…"
+	}
+	return scope
+}
+
+// goScope returns the declaration (function or type) of Go source that
+// contains the 1-based line, up to its opening brace.
+func goScope(src string, line int) string {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if f == nil {
+		return ""
+	}
+
+	for _, decl := range f.Decls {
+		if fset.Position(decl.Pos()).Line > line || fset.Position(decl.End()).Line < line {
+			continue
+		}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			end := d.End()
+			if d.Body != nil {
+				end = d.Body.Lbrace
+			}
+			return sourceRange(fset, src, d.Pos(), end)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || fset.Position(ts.Pos()).Line > line || fset.Position(ts.End()).Line < line {
+					continue
+				}
+				return strings.TrimSpace("type " + ts.Name.Name + " " + typeKeyword(ts.Type))
+			}
+		}
+	}
+	return ""
+}
+
+// typeKeyword names the kind of a type declaration for a hunk header, or ""
+// for other types.
+func typeKeyword(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return ""
+}
+
+// sourceRange returns src between two positions of the same file.
+func sourceRange(fset *token.FileSet, src string, from, to token.Pos) string {
+	start, end := fset.Position(from).Offset, fset.Position(to).Offset
+	if start < 0 || end > len(src) || start > end {
+		return ""
+	}
+	return strings.TrimSpace(src[start:end])
+}
+
+// controlKeywords start blocks that blockScope looks past, so that the
+// header names the function rather than an if or loop inside it.
+var controlKeywords = []string{"if", "else", "elif", "for", "while", "switch", "case", "try", "catch", "except", "finally", "with", "do"}
+
+// blockScope finds the nearest line above lines[line] that is less indented
+// and opens a block (ends with "{" or ":") other than a control statement,
+// which covers most brace and indentation-based languages.
+func blockScope(lines []string, line int) string {
+	if line >= len(lines) {
+		return ""
+	}
+	indent := indentWidth(lines[line])
+	for i := line - 1; i >= 0 && indent > 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || indentWidth(lines[i]) >= indent {
+			continue
+		}
+		indent = indentWidth(lines[i])
+		if !strings.HasSuffix(trimmed, "{") && !strings.HasSuffix(trimmed, ":") {
+			continue
+		}
+		if first := strings.FieldsFunc(trimmed, isWordBoundary); len(first) > 0 && slices.Contains(controlKeywords, first[0]) {
+			continue
+		}
+		return strings.TrimSpace(strings.TrimRight(trimmed, "{:"))
+	}
+	return ""
+}
+
+func isWordBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// indentWidth returns the width of a line's leading whitespace, counting a
+// tab as four columns.
+func indentWidth(s string) int {
+	width := 0
+	for _, c := range s {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
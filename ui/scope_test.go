@@ -0,0 +1,78 @@
+package ui
+
+import "testing"
+
+const scopeGoSrc = `package demo
+
+import "fmt"
+
+type Server struct {
+	addr string
+}
+
+// Start runs the server.
+func (s *Server) Start(port int,
+	verbose bool) error {
+	if verbose {
+		fmt.Println("starting")
+	}
+	return nil
+}
+
+var limit = 10
+`
+
+func TestEnclosingScopeGo(t *testing.T) {
+	tests := []struct {
+		line int // 0-based
+		want string
+	}{
+		{12, "func (s *Server) Start(port int, verbose bool) error"},
+		{14, "func (s *Server) Start(port int, verbose bool) error"},
+		{5, "type Server struct"},
+		{2, ""},
+		{18, ""},
+	}
+	for _, tt := range tests {
+		if got := enclosingScope("server.go", scopeGoSrc, tt.line); got != tt.want {
+			t.Errorf("line %d: expected %q, got %q", tt.line, tt.want, got)
+		}
+	}
+}
+
+func TestEnclosingScopeHeuristic(t *testing.T) {
+	py := "class Cache:\n    def get(self, key):\n        if key in self.data:\n            return self.data[key]\n        return None\n"
+	if got := enclosingScope("cache.py", py, 3); got != "def get(self, key)" {
+		t.Errorf("python: expected the enclosing def, got %q", got)
+	}
+	if got := enclosingScope("cache.py", py, 1); got != "class Cache" {
+		t.Errorf("python: expected the enclosing class, got %q", got)
+	}
+
+	js := "function load(url) {\n  for (const u of urls) {\n    fetch(u);\n  }\n}\n"
+	if got := enclosingScope("load.js", js, 2); got != "function load(url)" {
+		t.Errorf("js: expected the enclosing function, got %q", got)
+	}
+	if got := enclosingScope("load.js", js, 0); got != "" {
+		t.Errorf("js: expected no scope at top level, got %q", got)
+	}
+}
+
+func TestEnclosingScopeTruncates(t *testing.T) {
+	src := "package p\n\nfunc F(aVeryLongParameterName string, anotherVeryLongParameterName int, third bool) {\n\treturn\n}\n"
+	got := []rune(enclosingScope("p.go", src, 3))
+	if len(got) != maxScopeLen || got[len(got)-1] != '…' {
+		t.Errorf("expected a %d-rune truncated scope, got %q", maxScopeLen, string(got))
+	}
+}
+
+func TestHunkHeaderIncludesGoFunc(t *testing.T) {
+	got := hunkHeader("server.go", scopeGoSrc, 9, 12, 13, 13)
+	want := "@@ -10,5 +10,5 @@ func (s *Server) Start(port int, verbose bool) error"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := hunkHeader("notes.txt", "a\nb\n", 0, 1, 1, 1); got != "@@ -1,2 +1,2 @@" {
+		t.Errorf("expected a bare header without scope, got %q", got)
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,18 +33,136 @@ const (
 	White   = "\033[97m"
 )
 
+// Output parts whose color SetColors can change.
+const (
+	PartPrompt    = "prompt"    // the input prompt, also before replayed user messages
+	PartAssistant = "assistant" // streamed assistant text
+	PartTool      = "tool"      // the tool name of a tool call
+	PartError     = "error"     // error messages
+)
+
+// defaultColors are the codes of each configurable part unless SetColors
+// changes them. Assistant text is uncolored.
+var defaultColors = map[string]string{
+	PartPrompt:    Bold + Blue,
+	PartAssistant: "",
+	PartTool:      Yellow,
+	PartError:     Red,
+}
+
+// namedColors are the names ParseColor accepts, joined with spaces or "+"
+// (e.g. "bold cyan").
+var namedColors = map[string]string{
+	"bold":      Bold,
+	"dim":       Dim,
+	"italic":    "\033[3m",
+	"underline": "\033[4m",
+	"black":     "\033[30m",
+	"red":       Red,
+	"green":     Green,
+	"yellow":    Yellow,
+	"blue":      Blue,
+	"magenta":   Magenta,
+	"cyan":      Cyan,
+	"gray":      Gray,
+	"grey":      Gray,
+	"white":     White,
+}
+
+// defaultToolResultLines is how many lines of each tool result are shown by default.
+const defaultToolResultLines = 5
+
 // Terminal handles all user-facing output.
 type Terminal struct {
-	color bool
+	color       bool
+	resultLines int    // tool result lines to show; 0 shows everything
+	lastResult  string // most recent tool result, kept for full display on demand
+	pagerLines  int    // responses longer than this reopen in the pager; 0 disables
+	name        string // custom assistant name shown in the banner; empty uses the logo
+	tagline     string // banner subtitle; empty uses the default
+
+	colors map[string]string // codes of the configurable parts; see SetColors
+
+	response strings.Builder // assistant text streamed since the last PrintAssistantDone
+
+	redact func(string) string // masks secrets in displayed tool calls and results; nil shows them as is
+
+	in             io.Reader   // confirmation answers; os.Stdin outside tests
+	inReady        func() bool // reports whether in has input waiting; StdinHasData outside tests
+	confirmTimeout time.Duration
+	confirmApprove bool                                   // answer taken when a confirmation times out
+	after          func(d time.Duration) <-chan time.Time // time.After, replaced in tests
 }
 
 // NewTerminal creates a terminal with color detection.
 func NewTerminal() *Terminal {
 	return &Terminal{
-		color: isTerminal(),
+		color:       isTerminal(),
+		resultLines: defaultToolResultLines,
+		colors:      maps.Clone(defaultColors),
+		in:          os.Stdin,
+		inReady:     StdinHasData,
+		after:       time.After,
 	}
 }
 
+// SetConfirmTimeout makes confirmation prompts give up after d, approving
+// if approve is set and denying otherwise. Zero waits indefinitely.
+func (t *Terminal) SetConfirmTimeout(d time.Duration, approve bool) {
+	t.confirmTimeout = d
+	t.confirmApprove = approve
+}
+
+// SetRedactor sets the function that masks secrets in displayed tool call
+// arguments and results. It affects display only: tools still run with, and
+// the model still sees, the original text. Nil disables masking.
+func (t *Terminal) SetRedactor(redact func(string) string) {
+	t.redact = redact
+}
+
+// masked applies the redactor, if any.
+func (t *Terminal) masked(s string) string {
+	if t.redact == nil {
+		return s
+	}
+	return t.redact(s)
+}
+
+// SetToolResultLines sets how many lines of each tool result are displayed.
+// Zero or a negative value shows results in full. This affects display only;
+// the model always receives the complete result.
+func (t *Terminal) SetToolResultLines(n int) {
+	if n < 0 {
+		n = 0
+	}
+	t.resultLines = n
+}
+
+// SetPagerLines makes responses longer than n lines reopen in $PAGER once
+// streaming finishes. Zero or a negative value disables paging.
+func (t *Terminal) SetPagerLines(n int) {
+	if n < 0 {
+		n = 0
+	}
+	t.pagerLines = n
+}
+
+// SetBranding customizes the startup banner. A name other than "Pilot"
+// replaces the ASCII logo and a tagline replaces the "AI Coding Agent"
+// subtitle. Empty values keep the defaults.
+func (t *Terminal) SetBranding(name, tagline string) {
+	if name == "Pilot" {
+		name = ""
+	}
+	t.name = name
+	t.tagline = tagline
+}
+
+// ToolResultLines returns the current tool result display limit (0 = unlimited).
+func (t *Terminal) ToolResultLines() int {
+	return t.resultLines
+}
+
 func isTerminal() bool {
 	fi, err := os.Stdout.Stat()
 	if err != nil {
@@ -50,12 +172,63 @@ func isTerminal() bool {
 }
 
 func (t *Terminal) c(code, text string) string {
-	if !t.color {
+	if !t.color || code == "" {
 		return text
 	}
 	return code + text + Reset
 }
 
+// SetColors sets the colors of output parts (PartPrompt, PartAssistant,
+// PartTool, PartError) from a map of part to color, each a value
+// ParseColor accepts. A part that is unknown or given a color that cannot
+// be parsed keeps its default; the returned messages describe each one.
+func (t *Terminal) SetColors(colors map[string]string) []string {
+	if t.colors == nil {
+		t.colors = maps.Clone(defaultColors)
+	}
+	var problems []string
+	for _, part := range slices.Sorted(maps.Keys(colors)) {
+		if _, ok := defaultColors[part]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown color setting %q: want one of prompt, assistant, tool, error", part))
+			continue
+		}
+		code, err := ParseColor(colors[part])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s color: %s; using the default", part, err))
+			continue
+		}
+		t.colors[part] = code
+	}
+	return problems
+}
+
+// ParseColor returns the escape codes for a color: names from namedColors
+// joined with spaces or "+" (e.g. "bold magenta"), ANSI SGR parameters
+// (e.g. "1;35" or "38;5;208"), or "default" for no color.
+func ParseColor(spec string) (string, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "default" || spec == "none" {
+		return "", nil
+	}
+	var code strings.Builder
+	for _, word := range strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == '+' }) {
+		if named, ok := namedColors[word]; ok {
+			code.WriteString(named)
+			continue
+		}
+		for _, param := range strings.Split(word, ";") {
+			if n, err := strconv.Atoi(param); err != nil || n < 0 || n > 255 {
+				return "", fmt.Errorf("invalid color %q: want a name like \"bold cyan\" or ANSI codes like \"1;36\"", spec)
+			}
+		}
+		code.WriteString("\033[" + word + "m")
+	}
+	if code.Len() == 0 {
+		return "", fmt.Errorf("empty color: want a name like \"bold cyan\" or ANSI codes like \"1;36\"")
+	}
+	return code.String(), nil
+}
+
 // PrintBanner prints the startup banner.
 func (t *Terminal) PrintBanner(model, workDir, version string) {
 	banner := `
@@ -65,6 +238,9 @@ func (t *Terminal) PrintBanner(model, workDir, version string) {
  / ____/ / / /_/ / /_  
 /_/   /_/_/\____/\__/  
 `
+	if t.name != "" {
+		banner = "\n" + t.name + "\n"
+	}
 	fmt.Print(t.c(Bold+Cyan, banner))
 	
 	versionStr := ""
@@ -72,7 +248,11 @@ func (t *Terminal) PrintBanner(model, workDir, version string) {
 		versionStr = " v" + version
 	}
 	
-	fmt.Println(t.c(Bold+White, "AI Coding Agent") + t.c(Gray, versionStr))
+	tagline := "AI Coding Agent"
+	if t.tagline != "" {
+		tagline = t.tagline
+	}
+	fmt.Println(t.c(Bold+White, tagline) + t.c(Gray, versionStr))
 	fmt.Println()
 	fmt.Println(t.c(Gray, "  Model:   ") + t.c(Cyan, model))
 	fmt.Println(t.c(Gray, "  Dir:     ") + t.c(White, workDir))
@@ -83,7 +263,7 @@ func (t *Terminal) PrintBanner(model, workDir, version string) {
 
 // Prompt returns the formatted prompt string.
 func (t *Terminal) Prompt() string {
-	return t.c(Bold+Blue, "> ")
+	return t.c(t.colors[PartPrompt], "> ")
 }
 
 // PrintPrompt prints the input prompt.
@@ -105,38 +285,78 @@ func (t *Terminal) ReadLine(prompt string) (string, error) {
 
 // PrintAssistant prints assistant text.
 func (t *Terminal) PrintAssistant(text string) {
-	fmt.Print(text)
+	t.response.WriteString(text)
+	fmt.Print(t.c(t.colors[PartAssistant], text))
 }
 
-// PrintAssistantDone signals end of assistant output.
+// PrintAssistantDone signals end of assistant output. A response longer
+// than the pager threshold is then reopened in the pager for scrolling.
 func (t *Terminal) PrintAssistantDone() {
 	fmt.Println()
 	fmt.Println()
+
+	text := t.response.String()
+	t.response.Reset()
+	if t.pagerLines > 0 && shouldPage(text, t.pagerLines) && isTerminal() {
+		if err := pageText(text); err != nil {
+			t.PrintWarning(fmt.Sprintf("Pager failed: %s", err))
+		}
+	}
 }
 
 // PrintToolCall prints a tool invocation.
 func (t *Terminal) PrintToolCall(name string, args string) {
-	fmt.Println(t.c(Yellow, fmt.Sprintf("  ↳ %s", name)) + t.c(Gray, fmt.Sprintf(" %s", truncate(args, 100))))
+	fmt.Println(t.c(t.colors[PartTool], fmt.Sprintf("  ↳ %s", name)) + t.c(Gray, fmt.Sprintf(" %s", truncate(t.masked(args), 100))))
 }
 
-// PrintToolResult prints a tool's result (truncated).
+// PrintToolResult prints a tool's result, truncated to the configured line limit.
 func (t *Terminal) PrintToolResult(result string) {
+	t.lastResult = result
+	for _, line := range toolResultLines(t.masked(result), t.resultLines) {
+		fmt.Println(t.c(Gray, line))
+	}
+}
+
+// PrintLastToolResult prints the most recent tool result without truncation.
+func (t *Terminal) PrintLastToolResult() {
+	if t.lastResult == "" {
+		fmt.Println(t.c(Gray, "No tool result yet."))
+		fmt.Println()
+		return
+	}
+	t.PrintFullToolResult(t.lastResult)
+}
+
+// PrintFullToolResult prints a tool result without truncation.
+func (t *Terminal) PrintFullToolResult(result string) {
+	for _, line := range toolResultLines(t.masked(result), 0) {
+		fmt.Println(t.c(Gray, line))
+	}
+	fmt.Println()
+}
+
+// toolResultLines formats a tool result for display: each line indented and
+// truncated to 120 columns, with at most maxLines lines (0 = no limit)
+// followed by a count of the lines omitted.
+func toolResultLines(result string, maxLines int) []string {
 	lines := strings.Split(result, "\n")
-	if len(lines) > 5 {
-		for _, line := range lines[:5] {
-			fmt.Println(t.c(Gray, "    "+truncate(line, 120)))
-		}
-		fmt.Println(t.c(Gray, fmt.Sprintf("    ... (%d more lines)", len(lines)-5)))
-	} else {
-		for _, line := range lines {
-			fmt.Println(t.c(Gray, "    "+truncate(line, 120)))
-		}
+	shown := lines
+	if maxLines > 0 && len(lines) > maxLines {
+		shown = lines[:maxLines]
+	}
+	out := make([]string, 0, len(shown)+1)
+	for _, line := range shown {
+		out = append(out, "    "+truncate(line, 120))
 	}
+	if len(shown) < len(lines) {
+		out = append(out, fmt.Sprintf("    ... (%d more lines)", len(lines)-len(shown)))
+	}
+	return out
 }
 
 // PrintSubAgentToolCall prints a sub-agent's tool invocation with deeper indentation.
 func (t *Terminal) PrintSubAgentToolCall(name string, args string) {
-	fmt.Println(t.c(Dim+Yellow, fmt.Sprintf("      ↳ %s", name)) + t.c(Gray, fmt.Sprintf(" %s", truncate(args, 80))))
+	fmt.Println(t.c(Dim+t.colors[PartTool], fmt.Sprintf("      ↳ %s", name)) + t.c(Gray, fmt.Sprintf(" %s", truncate(t.masked(args), 80))))
 }
 
 // PrintSubAgentStatus prints a sub-agent status line.
@@ -146,7 +366,16 @@ func (t *Terminal) PrintSubAgentStatus(msg string) {
 
 // PrintError prints an error message.
 func (t *Terminal) PrintError(err error) {
-	fmt.Fprintln(os.Stderr, t.c(Red, "Error: "+err.Error()))
+	t.PrintErrorHint(err, "")
+}
+
+// PrintErrorHint prints an error message followed by hint, a suggestion on
+// what to do about it. An empty hint prints just the error.
+func (t *Terminal) PrintErrorHint(err error, hint string) {
+	fmt.Fprintln(os.Stderr, t.c(t.colors[PartError], "Error: "+err.Error()))
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, t.c(Yellow, "  "+hint))
+	}
 	fmt.Println()
 }
 
@@ -160,22 +389,78 @@ func (t *Terminal) PrintSpinner() {
 	fmt.Print(t.c(Gray, "  thinking..."))
 }
 
+// PrintRetry replaces the spinner line with a retry notice, e.g.
+// "rate limited, retrying in 8s (attempt 2/5)". ClearSpinner removes it.
+func (t *Terminal) PrintRetry(attempt, maxRetries int, delay time.Duration, reason string) {
+	fmt.Print("\r\033[K" + t.c(Gray, "  "+retryStatus(attempt, maxRetries, delay, reason)))
+}
+
+// retryStatus formats a retry notice for the spinner line.
+func retryStatus(attempt, maxRetries int, delay time.Duration, reason string) string {
+	if delay >= time.Second {
+		delay = delay.Round(time.Second)
+	} else {
+		delay = delay.Round(100 * time.Millisecond)
+	}
+	return fmt.Sprintf("%s, retrying in %s (attempt %d/%d)", reason, delay, attempt, maxRetries)
+}
+
 // ClearSpinner clears the thinking indicator.
 func (t *Terminal) ClearSpinner() {
 	fmt.Print("\r\033[K")
 }
 
-// PrintHelp prints all available slash commands.
-func (t *Terminal) PrintHelp() {
+// helpCommands lists the slash commands shown by /help, in display order.
+var helpCommands = []struct{ name, desc string }{
+	{"/help", "Show this help message"},
+	{"/model", "Switch LLM model"},
+	{"/provider", "List providers and key status (/provider <name> switches)"},
+	{"/compact", "Compact conversation (LLM summarizes history; /compact auto on|off)"},
+	{"/clear", "Clear conversation history (/clear keep <n> keeps the last n turns)"},
+	{"/context", "Show context window usage"},
+	{"/resume", "Resume a previous session: /resume [last|<n>]"},
+	{"/rewind", "Rewind to a previous checkpoint"},
+	{"/verbosity", "Tool result lines shown: /verbosity <n>|full|last"},
+	{"/last", "Show the last tool result in full, as the model saw it"},
+	{"/raw", "Show the last raw API request/response (--debug; /raw full)"},
+	{"/temp", "Sampling temperature: /temp <0-2>|default"},
+	{"/memory", "Show MEMORY.md changes this session: /memory diff"},
+	{"/diffstat", "Show lines added and removed per file this session"},
+	{"/focus", "Scope glob/grep/ls to a subtree: /focus <dir-or-glob>"},
+	{"/unfocus", "Clear the focus set by /focus"},
+	{"/edit", "Compose the next prompt in $EDITOR"},
+	{"/explain", "Explain a code selection: /explain <path>:<start>-<end>"},
+	{"/clip", "Attach the clipboard to the next message (/clip <text> sends now)"},
+	{"/quit", "Exit Pilot"},
+}
+
+// PrintHelp prints all available slash commands. Commands in unsupported,
+// which maps a command to why the current model cannot use it, are grayed
+// out with the reason.
+func (t *Terminal) PrintHelp(unsupported map[string]string) {
 	fmt.Println(t.c(Bold, "Commands"))
-	fmt.Println(t.c(Cyan, "  /help   ") + " Show this help message")
-	fmt.Println(t.c(Cyan, "  /model  ") + " Switch LLM model")
-	fmt.Println(t.c(Cyan, "  /compact") + " Compact conversation (LLM summarizes history)")
-	fmt.Println(t.c(Cyan, "  /clear  ") + " Clear conversation history")
-	fmt.Println(t.c(Cyan, "  /context") + " Show context window usage")
-	fmt.Println(t.c(Cyan, "  /resume ") + " Resume a previous session")
-	fmt.Println(t.c(Cyan, "  /rewind ") + " Rewind to a previous checkpoint")
-	fmt.Println(t.c(Cyan, "  /quit   ") + " Exit Pilot")
+	for _, cmd := range helpCommands {
+		if reason, ok := unsupported[cmd.name]; ok {
+			fmt.Println(t.c(Gray, fmt.Sprintf("  %-11s %s (%s)", cmd.name, cmd.desc, reason)))
+			continue
+		}
+		fmt.Println(t.c(Cyan, fmt.Sprintf("  %-11s", cmd.name)) + " " + cmd.desc)
+	}
+	fmt.Println()
+}
+
+// Commands returns the names of all slash commands, in /help order.
+func Commands() []string {
+	names := make([]string, len(helpCommands))
+	for i, cmd := range helpCommands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// PrintInfo prints an informational confirmation message.
+func (t *Terminal) PrintInfo(msg string) {
+	fmt.Println(t.c(Green, msg))
 	fmt.Println()
 }
 
@@ -200,6 +485,34 @@ func (t *Terminal) PrintModelMenu(options []ModelOption) {
 	fmt.Println()
 }
 
+// ProviderItem represents a provider in the /provider listing.
+type ProviderItem struct {
+	Name         string
+	Configured   bool
+	DefaultModel string
+	BaseURL      string
+	Current      bool
+}
+
+// PrintProviders lists providers with whether an API key is configured.
+func (t *Terminal) PrintProviders(items []ProviderItem) {
+	fmt.Println(t.c(Bold, "Providers:"))
+	for _, item := range items {
+		marker := "  "
+		if item.Current {
+			marker = t.c(Green, "→ ")
+		}
+		status := t.c(Green, "key configured")
+		if !item.Configured {
+			status = t.c(Yellow, "no API key")
+		}
+		fmt.Printf("%s%-10s %s  %s\n", marker, item.Name, status,
+			t.c(Gray, fmt.Sprintf("default %s, %s", item.DefaultModel, item.BaseURL)))
+	}
+	fmt.Println(t.c(Gray, "  /provider <name> to switch"))
+	fmt.Println()
+}
+
 // PrintModelSwitch prints a model switch confirmation.
 func (t *Terminal) PrintModelSwitch(model string) {
 	fmt.Println(t.c(Green, fmt.Sprintf("Switched to %s", model)))
@@ -265,6 +578,7 @@ type InterruptListener struct {
 	done    chan struct{} // closed when readLoop has exited
 	mu      sync.Mutex
 	active  bool
+	stopped bool
 }
 
 // StartEscapeListener creates a derived context that cancels when Esc is pressed.
@@ -297,6 +611,7 @@ func (t *Terminal) StartEscapeListener(parent context.Context) (context.Context,
 
 func (il *InterruptListener) readLoop() {
 	defer close(il.done)
+	defer RestoreOnPanic()
 	for {
 		ch, err := il.rawMode.ReadKeyContext(il.stopCh)
 		if err != nil {
@@ -311,18 +626,26 @@ func (il *InterruptListener) readLoop() {
 			continue
 		}
 
-		if ch == 0x1B {
+		// A bare Esc cancels; Esc followed immediately by more bytes is an
+		// escape sequence (e.g. an arrow key) and is ignored.
+		if ch == 0x1B && !il.rawMode.Pending() {
 			il.cancel()
 			return
 		}
 	}
 }
 
-// Stop shuts down the listener and restores terminal mode.
+// Stop shuts down the listener and restores terminal mode. Calling it again
+// is a no-op.
 func (il *InterruptListener) Stop() {
 	il.mu.Lock()
 	il.active = false
+	stopped := il.stopped
+	il.stopped = true
 	il.mu.Unlock()
+	if stopped {
+		return
+	}
 
 	// Restore terminal mode first so Ctrl+C works even if goroutine is slow to exit
 	il.rawMode.Disable()
@@ -427,6 +750,103 @@ func (t *Terminal) PrintCheckpointList(items []CheckpointListItem) {
 	fmt.Println()
 }
 
+// FileChangeItem represents one changed file in a turn summary.
+type FileChangeItem struct {
+	Path    string
+	Kind    string // created, modified, or deleted
+	Added   int
+	Removed int
+}
+
+// PrintFileChanges prints a short summary of the files a turn changed.
+func (t *Terminal) PrintFileChanges(items []FileChangeItem) {
+	noun := "files"
+	if len(items) == 1 {
+		noun = "file"
+	}
+	fmt.Println(t.c(Bold, fmt.Sprintf("Changed %d %s:", len(items), noun)))
+	for _, item := range items {
+		var counts []string
+		if item.Added > 0 {
+			counts = append(counts, t.c(Green, fmt.Sprintf("+%d", item.Added)))
+		}
+		if item.Removed > 0 {
+			counts = append(counts, t.c(Red, fmt.Sprintf("-%d", item.Removed)))
+		}
+		fmt.Printf("  %s  %s  %s\n",
+			t.c(Gray, fmt.Sprintf("%-8s", item.Kind)),
+			item.Path,
+			strings.Join(counts, " "),
+		)
+	}
+	fmt.Println()
+}
+
+// maxDiffStatBar is the widest +/- bar PrintDiffStat draws; files with
+// more changed lines have their bars scaled to fit.
+const maxDiffStatBar = 40
+
+// PrintDiffStat prints each file's changed line count with a +/- bar, in
+// the given order, then the totals, like git diff --stat.
+func (t *Terminal) PrintDiffStat(items []FileChangeItem) {
+	width, most := 0, 0
+	for _, item := range items {
+		width = max(width, len(item.Path))
+		most = max(most, item.Added+item.Removed)
+	}
+	added, removed := 0, 0
+	for _, item := range items {
+		plus, minus := diffStatBar(item.Added, item.Removed, most)
+		bar := ""
+		if plus > 0 {
+			bar += t.c(Green, strings.Repeat("+", plus))
+		}
+		if minus > 0 {
+			bar += t.c(Red, strings.Repeat("-", minus))
+		}
+		fmt.Printf(" %-*s | %5d %s\n", width, item.Path, item.Added+item.Removed, bar)
+		added += item.Added
+		removed += item.Removed
+	}
+	fmt.Println(t.c(Bold, diffStatTotal(len(items), added, removed)))
+	fmt.Println()
+}
+
+// diffStatBar returns how many + and - marks show added and removed lines,
+// scaled so the file with most changed lines gets at most maxDiffStatBar.
+// A nonzero count always gets at least one mark.
+func diffStatBar(added, removed, most int) (plus, minus int) {
+	if most <= maxDiffStatBar {
+		return added, removed
+	}
+	scale := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return max(n*maxDiffStatBar/most, 1)
+	}
+	return scale(added), scale(removed)
+}
+
+// diffStatTotal is the summary line of PrintDiffStat, e.g. "2 files
+// changed, 5 insertions(+), 1 deletion(-)". Zero counts are left out.
+func diffStatTotal(files, added, removed int) string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, one)
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+	parts := []string{plural(files, "file changed", "files changed")}
+	if added > 0 {
+		parts = append(parts, plural(added, "insertion(+)", "insertions(+)"))
+	}
+	if removed > 0 {
+		parts = append(parts, plural(removed, "deletion(-)", "deletions(-)"))
+	}
+	return " " + strings.Join(parts, ", ")
+}
+
 // PrintRewindActions displays the rewind action menu.
 func (t *Terminal) PrintRewindActions() {
 	fmt.Println(t.c(Bold, "Choose action:"))
@@ -457,13 +877,13 @@ func (t *Terminal) PrintConversationHistory(messages []llm.Message) {
 				continue // skip tool-result-in-user-message (Anthropic format)
 			}
 			if msg.Content != nil && *msg.Content != "" {
-				fmt.Println(t.c(Bold+Blue, "> ") + *msg.Content)
+				fmt.Println(t.Prompt() + *msg.Content)
 				fmt.Println()
 			}
 		case "assistant":
 			if msg.Content != nil && *msg.Content != "" {
-				t.PrintAssistant(*msg.Content)
-				t.PrintAssistantDone()
+				// Replayed history is never paged
+				fmt.Print(t.c(t.colors[PartAssistant], *msg.Content) + "\n\n")
 			}
 			for _, tc := range msg.ToolCalls {
 				t.PrintToolCall(tc.Function.Name, tc.Function.Arguments)
@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestToolResultLines(t *testing.T) {
+	result := "1\n2\n3\n4\n5\n6\n7\n8"
+	tests := []struct {
+		name     string
+		maxLines int
+		want     int    // number of content lines shown
+		more     string // expected "more lines" note, or "" for none
+	}{
+		{"default limit", defaultToolResultLines, 5, "... (3 more lines)"},
+		{"custom limit", 2, 2, "... (6 more lines)"},
+		{"limit above length", 20, 8, ""},
+		{"unlimited", 0, 8, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toolResultLines(result, tt.maxLines)
+			shown := len(got)
+			if tt.more != "" {
+				shown--
+				if !strings.HasSuffix(got[len(got)-1], tt.more) {
+					t.Errorf("expected trailing %q, got %q", tt.more, got[len(got)-1])
+				}
+			}
+			if shown != tt.want {
+				t.Errorf("expected %d lines shown, got %d: %q", tt.want, shown, got)
+			}
+		})
+	}
+}
+
+func TestSetToolResultLines(t *testing.T) {
+	term := NewTerminal()
+	if term.ToolResultLines() != defaultToolResultLines {
+		t.Fatalf("expected default %d, got %d", defaultToolResultLines, term.ToolResultLines())
+	}
+	term.SetToolResultLines(12)
+	if term.ToolResultLines() != 12 {
+		t.Errorf("expected 12, got %d", term.ToolResultLines())
+	}
+	term.SetToolResultLines(-3)
+	if term.ToolResultLines() != 0 {
+		t.Errorf("expected negative to mean unlimited (0), got %d", term.ToolResultLines())
+	}
+}
+
+func TestRetryStatus(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  string
+	}{
+		{8*time.Second + 420*time.Millisecond, "rate limited, retrying in 8s (attempt 2/5)"},
+		{340 * time.Millisecond, "rate limited, retrying in 300ms (attempt 2/5)"},
+	}
+	for _, tt := range tests {
+		if got := retryStatus(2, 5, tt.delay, "rate limited"); got != tt.want {
+			t.Errorf("retryStatus(%v) = %q, want %q", tt.delay, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmActionAnswer(t *testing.T) {
+	term := NewTerminal()
+	term.in = strings.NewReader("yes\n")
+	if !term.ConfirmAction("Apply?") {
+		t.Error("expected yes to approve")
+	}
+
+	// An answer within the timeout wins over the default
+	term.SetConfirmTimeout(time.Minute, true)
+	term.in = strings.NewReader("n\n")
+	term.inReady = func() bool { return true }
+	term.after = func(time.Duration) <-chan time.Time { return nil } // never fires
+	if term.ConfirmAction("Apply?") {
+		t.Error("expected n to deny")
+	}
+}
+
+func TestConfirmExpandable(t *testing.T) {
+	term := NewTerminal()
+	shown := 0
+	details := func() { shown++ }
+
+	term.in = strings.NewReader("y\n")
+	if !term.ConfirmExpandable("Apply?", details) || shown != 0 {
+		t.Errorf("expected y to approve without details, shown %d times", shown)
+	}
+
+	term.in = strings.NewReader("d\nn\n")
+	if term.ConfirmExpandable("Apply?", details) || shown != 1 {
+		t.Errorf("expected d to show details once and n to deny, shown %d times", shown)
+	}
+
+	term.in = strings.NewReader("diff\nyes\n")
+	if !term.ConfirmExpandable("Apply?", details) || shown != 2 {
+		t.Errorf("expected diff to show details and yes to approve, shown %d times", shown)
+	}
+}
+
+func TestConfirmActionTimeout(t *testing.T) {
+	// Input that never arrives
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var waited []time.Duration
+	fire := func(d time.Duration) <-chan time.Time {
+		waited = append(waited, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+
+	term := NewTerminal()
+	term.in = r
+	term.inReady = func() bool { return false }
+	term.after = fire
+
+	term.SetConfirmTimeout(30*time.Second, false)
+	if term.ConfirmAction("Run command?") {
+		t.Error("expected timeout to deny by default")
+	}
+
+	term.SetConfirmTimeout(30*time.Second, true)
+	if !term.ConfirmAction("Run command?") {
+		t.Error("expected timeout to approve when configured")
+	}
+
+	if len(waited) != 2 || waited[0] != 30*time.Second {
+		t.Errorf("expected 30s waits, got %v", waited)
+	}
+}
+
+func TestConfirmActionAfterTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	var typed atomic.Bool
+
+	term := NewTerminal()
+	term.in = r
+	term.inReady = typed.Load
+	term.after = func(time.Duration) <-chan time.Time {
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	term.SetConfirmTimeout(30*time.Second, false)
+	if term.ConfirmAction("Run command?") {
+		t.Fatal("expected timeout to deny")
+	}
+
+	// The answer typed after the timeout goes to the next prompt, not to a
+	// read left over from the first
+	go w.Write([]byte("y\n"))
+	typed.Store(true)
+	term.after = func(time.Duration) <-chan time.Time { return nil }
+	done := make(chan bool, 1)
+	go func() { done <- term.ConfirmAction("Write file?") }()
+	select {
+	case approved := <-done:
+		if !approved {
+			t.Error("expected the second prompt to get the answer")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second prompt never got the answer")
+	}
+}
+
+func TestDiffStatFormatting(t *testing.T) {
+	if plus, minus := diffStatBar(3, 2, 10); plus != 3 || minus != 2 {
+		t.Errorf("small change: got %d+ %d-, want unscaled 3+ 2-", plus, minus)
+	}
+	if plus, minus := diffStatBar(150, 1, 200); plus != 30 || minus != 1 {
+		t.Errorf("large change: got %d+ %d-, want 30+ 1-", plus, minus)
+	}
+
+	tests := []struct {
+		files, added, removed int
+		want                  string
+	}{
+		{3, 12, 4, " 3 files changed, 12 insertions(+), 4 deletions(-)"},
+		{1, 1, 0, " 1 file changed, 1 insertion(+)"},
+		{1, 0, 1, " 1 file changed, 1 deletion(-)"},
+	}
+	for _, tt := range tests {
+		if got := diffStatTotal(tt.files, tt.added, tt.removed); got != tt.want {
+			t.Errorf("diffStatTotal(%d, %d, %d) = %q, want %q", tt.files, tt.added, tt.removed, got, tt.want)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"cyan", Cyan, false},
+		{"Bold Magenta", Bold + Magenta, false},
+		{"bold+green", Bold + Green, false},
+		{"1;36", "\033[1;36m", false},
+		{"38;5;208", "\033[38;5;208m", false},
+		{"default", "", false},
+		{"purple", "", true},
+		{"38;5;300", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseColor(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseColor(%q) = %q, %v; want %q, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSetColors(t *testing.T) {
+	term := NewTerminal()
+	term.color = true
+	problems := term.SetColors(map[string]string{
+		"prompt":    "bold magenta",
+		"assistant": "2",
+		"tool":      "orange",
+		"banner":    "red",
+	})
+
+	if got := term.Prompt(); got != Bold+Magenta+"> "+Reset {
+		t.Errorf("expected the configured prompt color, got %q", got)
+	}
+	if got := term.colors[PartAssistant]; got != "\033[2m" {
+		t.Errorf("expected the configured assistant color, got %q", got)
+	}
+	if got := term.colors[PartTool]; got != Yellow {
+		t.Errorf("expected the invalid tool color to fall back to the default, got %q", got)
+	}
+	if got := term.colors[PartError]; got != Red {
+		t.Errorf("expected the unset error color to keep the default, got %q", got)
+	}
+	if len(problems) != 2 || !strings.Contains(problems[0], `"banner"`) || !strings.Contains(problems[1], "tool color") {
+		t.Errorf("expected the unknown part and the invalid color reported, got %q", problems)
+	}
+}